@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// shardCount spreads keys over independently locked maps, so requests for
+// different cities do not contend on one lock.
+const shardCount = 16
+
+// maxShardEntries bounds each shard, so keys derived from request parameters
+// cannot grow a cache without limit.
+const maxShardEntries = 1024
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type shard struct {
+	mu    sync.RWMutex
+	items map[string]entry
+}
+
+// call is a load in progress; callers for the same key wait for it.
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Cache is a small in-process key/value store with a fixed time-to-live.
+// With a stale window, GetOrLoad keeps serving an expired value for that long
+// while a single background load refreshes it.
+type Cache struct {
+	ttl    time.Duration
+	stale  time.Duration
+	shards [shardCount]shard
+
+	mu    sync.Mutex
+	calls map[string]*call
+	// gen is bumped by Clear so loads that started before it are not stored.
+	gen uint64
+}
+
+// New creates a cache whose entries expire ttl after being set.
+func New(ttl time.Duration) *Cache {
+	return NewStale(ttl, 0)
+}
+
+// NewStale creates a cache whose entries expire ttl after being set, and
+// may still be served by GetOrLoad for stale longer while they are reloaded.
+func NewStale(ttl, stale time.Duration) *Cache {
+	c := &Cache{ttl: ttl, stale: stale, calls: map[string]*call{}}
+	for i := range c.shards {
+		c.shards[i].items = map[string]entry{}
+	}
+	return c
+}
+
+// Key builds a cache key from a prefix and a hash of the filters, so every
+// spelling of the same filters shares an entry and keys stay short.
+func Key(prefix string, filters url.Values) string {
+	if len(filters) == 0 {
+		return prefix
+	}
+	sum := sha256.Sum256([]byte(filters.Encode()))
+	return prefix + ":" + hex.EncodeToString(sum[:8])
+}
+
+func (c *Cache) shard(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &c.shards[h.Sum32()%shardCount]
+}
+
+func (c *Cache) lookup(key string) (entry, bool) {
+	s := c.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.items[key]
+	return e, ok
+}
+
+// Get returns the value for key if it is present and not expired.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	e, ok := c.lookup(key)
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key, replacing any existing entry. A full shard
+// first drops entries past their stale window, then an arbitrary entry.
+func (c *Cache) Set(key string, value interface{}) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if _, ok := s.items[key]; !ok && len(s.items) >= maxShardEntries {
+		for k, e := range s.items {
+			if now.After(e.expires.Add(c.stale)) {
+				delete(s.items, k)
+			}
+		}
+		for k := range s.items {
+			if len(s.items) < maxShardEntries {
+				break
+			}
+			delete(s.items, k)
+		}
+	}
+	s.items[key] = entry{value: value, expires: now.Add(c.ttl)}
+}
+
+// GetOrLoad returns the value for key, calling load to fill it when it is
+// missing. Concurrent callers for the same key share a single load. Within
+// the stale window after expiry the old value is returned at once and one
+// background load replaces it. Errors are returned and not cached.
+func (c *Cache) GetOrLoad(key string, load func() (interface{}, error)) (interface{}, error) {
+	e, ok := c.lookup(key)
+	now := time.Now()
+	switch {
+	case ok && now.Before(e.expires):
+		return e.value, nil
+	case ok && now.Before(e.expires.Add(c.stale)):
+		if cl, gen, leader := c.join(key); leader {
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						log.Printf("cache: refreshing %s panicked: %v", key, rec)
+					}
+				}()
+				c.run(key, cl, gen, load)
+			}()
+		}
+		return e.value, nil
+	}
+	cl, gen, leader := c.join(key)
+	if leader {
+		c.run(key, cl, gen, load)
+	}
+	<-cl.done
+	return cl.value, cl.err
+}
+
+// join returns the load in progress for key, or registers a new one that the
+// caller (the leader) must run.
+func (c *Cache) join(key string) (cl *call, gen uint64, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.calls[key]; ok {
+		return cl, 0, false
+	}
+	cl = &call{done: make(chan struct{}), err: errLoadFailed}
+	c.calls[key] = cl
+	return cl, c.gen, true
+}
+
+// errLoadFailed is what waiters see when the leader's load panicked.
+var errLoadFailed = errors.New("cache: load failed")
+
+// run calls load for cl and stores the result unless Clear ran meanwhile.
+func (c *Cache) run(key string, cl *call, gen uint64, load func() (interface{}, error)) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		current := c.gen == gen
+		c.mu.Unlock()
+		if cl.err == nil && current {
+			c.Set(key, cl.value)
+		}
+		close(cl.done)
+	}()
+	cl.value, cl.err = load()
+}
+
+// Clear drops every entry, e.g. after an admin edit. Loads already running
+// still answer their callers but are not stored.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	c.gen++
+	c.mu.Unlock()
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.items = map[string]entry{}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,88 @@
+// Package classify proposes cuisines for restaurants that have none linked,
+// from their name and offer text. Keyword rules always run; a model can be
+// plugged in with Register and its proposals are merged with the rules'.
+package classify
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Input is the text a restaurant is classified from. Listings carry no menu,
+// so Text is the offer text.
+type Input struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// Proposal is a suggested cuisine with a confidence between 0 and 1.
+// Cuisine is a name and may not exist in the cuisines table.
+type Proposal struct {
+	Cuisine    string  `json:"cuisine"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"-"`
+}
+
+// Classifier suggests cuisines for a restaurant.
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, in Input) ([]Proposal, error)
+}
+
+var (
+	mu      sync.RWMutex
+	plugged []Classifier
+)
+
+// Register adds a classifier that runs alongside the keyword rules.
+func Register(c Classifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	plugged = append(plugged, c)
+}
+
+// Classify runs rules and every registered classifier, keeping the most
+// confident proposal per cuisine, most confident first. A failing classifier
+// does not discard the others' proposals; its error is returned with them.
+func Classify(ctx context.Context, rules *Rules, in Input) ([]Proposal, error) {
+	mu.RLock()
+	classifiers := append([]Classifier{rules}, plugged...)
+	mu.RUnlock()
+
+	best := map[string]Proposal{}
+	var firstErr error
+	for _, c := range classifiers {
+		proposals, err := c.Classify(ctx, in)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, p := range proposals {
+			if p.Confidence <= 0 || strings.TrimSpace(p.Cuisine) == "" {
+				continue
+			}
+			p.Confidence = min(p.Confidence, 1)
+			p.Source = c.Name()
+			key := strings.ToLower(strings.TrimSpace(p.Cuisine))
+			if cur, ok := best[key]; !ok || p.Confidence > cur.Confidence {
+				best[key] = p
+			}
+		}
+	}
+
+	out := make([]Proposal, 0, len(best))
+	for _, p := range best {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+		return out[i].Cuisine < out[j].Cuisine
+	})
+	return out, firstErr
+}
@@ -0,0 +1,52 @@
+package classify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Model calls an external cuisine model over HTTP. It POSTs an Input as JSON
+// and expects {"proposals": [{"cuisine": "Chinese", "confidence": 0.8}]}.
+type Model struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewModel returns a Model for url with a 10 second timeout.
+func NewModel(url string) *Model {
+	return &Model{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (m *Model) Name() string { return "model" }
+
+func (m *Model) Classify(ctx context.Context, in Input) ([]Proposal, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cuisine model returned %s", resp.Status)
+	}
+
+	var out struct {
+		Proposals []Proposal `json:"proposals"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Proposals, nil
+}
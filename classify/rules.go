@@ -0,0 +1,136 @@
+package classify
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Confidence of a single keyword hit in the restaurant name. Hits in the
+// offer text count for OfferTextWeight of that, and several hits for the
+// same cuisine combine as independent evidence.
+const (
+	CuisineNameConfidence = 0.9
+	SynonymConfidence     = 0.75
+	KeywordConfidence     = 0.6
+	OfferTextWeight       = 0.5
+)
+
+// Keywords are built-in dish and venue words that hint at a cuisine. They
+// only produce proposals for cuisines that exist.
+var Keywords = map[string]string{
+	"biryani":    "Biryani",
+	"pizza":      "Italian",
+	"pizzeria":   "Italian",
+	"pasta":      "Italian",
+	"trattoria":  "Italian",
+	"sushi":      "Japanese",
+	"ramen":      "Japanese",
+	"dosa":       "South Indian",
+	"idli":       "South Indian",
+	"udupi":      "South Indian",
+	"chettinad":  "South Indian",
+	"dhaba":      "North Indian",
+	"tandoor":    "North Indian",
+	"punjabi":    "North Indian",
+	"momo":       "Tibetan",
+	"noodle":     "Chinese",
+	"wok":        "Chinese",
+	"dim sum":    "Chinese",
+	"manchurian": "Chinese",
+	"burger":     "Fast Food",
+	"fries":      "Fast Food",
+	"shawarma":   "Middle Eastern",
+	"falafel":    "Middle Eastern",
+	"kebab":      "Mughlai",
+	"mughlai":    "Mughlai",
+	"taco":       "Mexican",
+	"burrito":    "Mexican",
+	"bbq":        "BBQ",
+	"barbeque":   "BBQ",
+	"grill":      "BBQ",
+	"seafood":    "Seafood",
+	"fish":       "Seafood",
+	"bakery":     "Bakery",
+	"bakers":     "Bakery",
+	"patisserie": "Bakery",
+	"cake":       "Bakery",
+	"dessert":    "Desserts",
+	"ice cream":  "Desserts",
+	"waffle":     "Desserts",
+	"gelato":     "Desserts",
+	"cafe":       "Cafe",
+	"coffee":     "Cafe",
+	"juice":      "Beverages",
+	"chai":       "Beverages",
+	"shake":      "Beverages",
+}
+
+// Rules is the keyword classifier. Cuisine names, synonym terms and Keywords
+// are matched as whole words, ignoring case and a plural s.
+type Rules struct {
+	keywords map[string]keyword
+}
+
+type keyword struct {
+	cuisine    string
+	confidence float64
+}
+
+// NewRules builds the rules from the cuisine names in the database and the
+// synonym dictionary (term -> canonical cuisine name).
+func NewRules(cuisines []string, synonyms map[string]string) *Rules {
+	r := &Rules{keywords: map[string]keyword{}}
+	add := func(term, cuisine string, confidence float64) {
+		term = normalize(term)
+		if term == "" {
+			return
+		}
+		if cur, ok := r.keywords[term]; !ok || confidence > cur.confidence {
+			r.keywords[term] = keyword{cuisine, confidence}
+		}
+	}
+	for term, cuisine := range Keywords {
+		add(term, cuisine, KeywordConfidence)
+	}
+	for term, cuisine := range synonyms {
+		add(term, cuisine, SynonymConfidence)
+	}
+	for _, c := range cuisines {
+		add(c, c, CuisineNameConfidence)
+	}
+	return r
+}
+
+func (r *Rules) Name() string { return "rules" }
+
+func (r *Rules) Classify(_ context.Context, in Input) ([]Proposal, error) {
+	scores := map[string]float64{}
+	match := func(text string, weight float64) {
+		padded := " " + normalize(text) + " "
+		if padded == "  " {
+			return
+		}
+		for term, k := range r.keywords {
+			if strings.Contains(padded, " "+term+" ") || strings.Contains(padded, " "+term+"s ") {
+				// Combine with earlier hits: 1 - (1-a)(1-b).
+				scores[k.cuisine] = 1 - (1-scores[k.cuisine])*(1-k.confidence*weight)
+			}
+		}
+	}
+	match(in.Name, 1)
+	match(in.Text, OfferTextWeight)
+
+	proposals := make([]Proposal, 0, len(scores))
+	for cuisine, c := range scores {
+		proposals = append(proposals, Proposal{Cuisine: cuisine, Confidence: c})
+	}
+	return proposals, nil
+}
+
+// normalize lowercases s and reduces it to words separated by single spaces.
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
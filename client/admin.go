@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"eazyfind/flags"
+	"eazyfind/maintenance"
+	"eazyfind/models"
+	"eazyfind/scheduler"
+)
+
+// Overview is the admin overview: data health, worker state and schedules.
+// Sections without a typed field are kept raw.
+type Overview struct {
+	FailedGeocodes int                  `json:"failed_geocodes"`
+	Schedules      []scheduler.JobState `json:"schedules"`
+	Outbox         struct {
+		Pending int `json:"pending"`
+		Failed  int `json:"failed"`
+	} `json:"outbox"`
+	Restaurants json.RawMessage `json:"restaurants"`
+	Cities      json.RawMessage `json:"cities"`
+	Worker      json.RawMessage `json:"worker"`
+	Enrichment  json.RawMessage `json:"enrichment"`
+	Throttle    json.RawMessage `json:"throttle"`
+	Outbound    json.RawMessage `json:"outbound"`
+}
+
+// Overview returns the admin overview.
+func (c *Client) Overview(ctx context.Context) (*Overview, error) {
+	var o Overview
+	if err := c.Do(ctx, http.MethodGet, "/api/admin/overview", nil, nil, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Flags lists the feature flags with their effective values.
+func (c *Client) Flags(ctx context.Context) ([]flags.State, error) {
+	var states []flags.State
+	err := c.Do(ctx, http.MethodGet, "/api/admin/flags", nil, nil, &states)
+	return states, err
+}
+
+// SetFlag turns a flag on or off for every instance.
+func (c *Client) SetFlag(ctx context.Context, name string, enabled bool) (*flags.State, error) {
+	var s flags.State
+	err := c.Do(ctx, http.MethodPut, "/api/admin/flags/"+url.PathEscape(name), nil, map[string]bool{"enabled": enabled}, &s)
+	return &s, err
+}
+
+// ResetFlag drops a flag's stored value, so its environment default applies.
+func (c *Client) ResetFlag(ctx context.Context, name string) (*flags.State, error) {
+	var s flags.State
+	err := c.Do(ctx, http.MethodDelete, "/api/admin/flags/"+url.PathEscape(name), nil, nil, &s)
+	return &s, err
+}
+
+// Tasks lists the maintenance tasks and the jobs the serving instance has run.
+func (c *Client) Tasks(ctx context.Context) ([]maintenance.Task, []maintenance.JobStatus, error) {
+	var resp struct {
+		Tasks []maintenance.Task      `json:"tasks"`
+		Jobs  []maintenance.JobStatus `json:"jobs"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/api/admin/tasks", nil, nil, &resp)
+	return resp.Tasks, resp.Jobs, err
+}
+
+// RunTask starts a maintenance task with params (nil for none) and returns
+// its job. dryRun asks tasks that support it to only count changes.
+func (c *Client) RunTask(ctx context.Context, name string, params interface{}, dryRun bool) (*maintenance.JobStatus, error) {
+	var job maintenance.JobStatus
+	err := c.Do(ctx, http.MethodPost, "/api/admin/tasks/"+url.PathEscape(name), dryRunQuery(dryRun), params, &job)
+	return &job, err
+}
+
+// BulkUpdate starts a bulk cuisine, meal type and tag update; body is the
+// request documented for /api/admin/restaurants/bulk-update.
+func (c *Client) BulkUpdate(ctx context.Context, body json.RawMessage, dryRun bool) (*maintenance.JobStatus, error) {
+	var job maintenance.JobStatus
+	err := c.Do(ctx, http.MethodPost, "/api/admin/restaurants/bulk-update", dryRunQuery(dryRun), body, &job)
+	return &job, err
+}
+
+// TaskJob returns a maintenance job's progress. Jobs live on the instance
+// that started them, so behind a load balancer this may 404.
+func (c *Client) TaskJob(ctx context.Context, id string) (*maintenance.JobStatus, error) {
+	var job maintenance.JobStatus
+	err := c.Do(ctx, http.MethodGet, "/api/admin/tasks/jobs/"+url.PathEscape(id), nil, nil, &job)
+	return &job, err
+}
+
+// CancelTaskJob stops a running maintenance job after its current batch.
+func (c *Client) CancelTaskJob(ctx context.Context, id string) (*maintenance.JobStatus, error) {
+	var job maintenance.JobStatus
+	err := c.Do(ctx, http.MethodDelete, "/api/admin/tasks/jobs/"+url.PathEscape(id), nil, nil, &job)
+	return &job, err
+}
+
+// WaitTaskJob polls a maintenance job every interval until it finishes.
+func (c *Client) WaitTaskJob(ctx context.Context, id string, interval time.Duration) (*maintenance.JobStatus, error) {
+	for {
+		job, err := c.TaskJob(ctx, id)
+		if err != nil || job.Status != maintenance.StatusRunning {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// CreateExport queues an async export of the restaurants matching opts.
+func (c *Client) CreateExport(ctx context.Context, opts SearchOptions) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := c.Do(ctx, http.MethodPost, "/api/admin/exports", opts.Values(), nil, &job)
+	return &job, err
+}
+
+// Export returns an export job; once it has succeeded URL links to the file.
+func (c *Client) Export(ctx context.Context, id int64) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := c.Do(ctx, http.MethodGet, "/api/admin/exports/"+strconv.FormatInt(id, 10), nil, nil, &job)
+	return &job, err
+}
+
+// WaitExport polls an export job every interval until it succeeds or fails.
+func (c *Client) WaitExport(ctx context.Context, id int64, interval time.Duration) (*models.ExportJob, error) {
+	for {
+		job, err := c.Export(ctx, id)
+		if err != nil || (job.Status != "PENDING" && job.Status != "RUNNING") {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// StreamExport copies the NDJSON export of the restaurants matching opts to
+// w. It is not retried, as part of the output may already be written.
+func (c *Client) StreamExport(ctx context.Context, opts SearchOptions, w io.Writer) error {
+	q := opts.Values()
+	q.Del("limit")
+	q.Del("page")
+	resp, err := c.send(ctx, http.MethodGet, c.BaseURL+"/api/export/restaurants?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decode(resp, nil)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("export interrupted: %w", err)
+	}
+	return nil
+}
+
+func dryRunQuery(dryRun bool) url.Values {
+	if !dryRun {
+		return nil
+	}
+	return url.Values{"dry_run": {"true"}}
+}
@@ -0,0 +1,162 @@
+// Package client is a typed Go client for the EazyFind API, for internal
+// services and tools that would otherwise hand-roll requests. Responses use
+// the server's models; idempotent requests are retried on network errors,
+// 429 and 5xx responses.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds each attempt of a request.
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetries is how often a failed idempotent request is retried.
+	DefaultRetries = 3
+	// retryBase is the backoff before the first retry; it doubles per
+	// attempt and is fully jittered. A Retry-After header overrides it.
+	retryBase = 250 * time.Millisecond
+)
+
+// Client calls one EazyFind deployment. Set APIKey for metered public access
+// and AdminToken for admin endpoints. A Client is safe for concurrent use.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	AdminToken string
+	Retries    int
+	HTTP       *http.Client
+}
+
+// New returns a Client for baseURL, such as "https://api.eazyfind.in".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Retries: DefaultRetries,
+		HTTP:    &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Error is a non-2xx response.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("eazyfind: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Do sends a request to path (with query, if any) and decodes a JSON
+// response into out when it is non-nil. body, when non-nil, is sent as JSON.
+// It is the escape hatch for endpoints without a typed method.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	retries := c.Retries
+	if method != http.MethodGet && method != http.MethodHead && method != http.MethodPut && method != http.MethodDelete {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u, payload)
+		wait, retry := retryDelay(resp, err, attempt)
+		if !retry || attempt >= retries {
+			if err != nil {
+				return err
+			}
+			return decode(resp, out)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+// retryDelay reports whether a response or error is worth retrying and how
+// long to wait first.
+func retryDelay(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+	} else if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false
+	}
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return time.Duration(rand.Int63n(int64(retryBase << attempt))), true
+}
+
+func decode(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"eazyfind/models"
+)
+
+// SearchOptions are the /api/search filters. Zero values are omitted; Extra
+// carries any parameter without a field.
+type SearchOptions struct {
+	Name      string
+	City      string
+	Area      string
+	Cuisines  []string
+	MealTypes []string
+	Tag       string
+	Brand     string
+	MinCost   int
+	MaxCost   int
+	Rating    float64
+	// Discount is the minimum discount in percent.
+	Discount float64
+	Free     bool
+	// PaymentMethods keeps offers redeemable with any of these methods
+	// ("hdfc", "upi", "app").
+	PaymentMethods []string
+	// Diverse reranks the page so one brand or cuisine does not fill it.
+	Diverse bool
+	// Lat and Lon, when Near is set, search around a point within Radius
+	// meters (the server default when 0).
+	Near     bool
+	Lat, Lon float64
+	Radius   float64
+	Sort     string
+	Limit    int
+	Page     int
+	Extra    url.Values
+}
+
+// Values encodes the options as search query parameters.
+func (o SearchOptions) Values() url.Values {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	num := func(k string, v float64) {
+		if v != 0 {
+			q.Set(k, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	set("name", o.Name)
+	set("city", o.City)
+	set("area", o.Area)
+	set("cuisines", strings.Join(o.Cuisines, ","))
+	set("meal_types", strings.Join(o.MealTypes, ","))
+	set("tag", o.Tag)
+	set("brand", o.Brand)
+	set("payment_method", strings.Join(o.PaymentMethods, ","))
+	num("min_cost", float64(o.MinCost))
+	num("max_cost", float64(o.MaxCost))
+	num("rating", o.Rating)
+	num("discount", o.Discount)
+	if o.Free {
+		q.Set("free", "true")
+	}
+	if o.Diverse {
+		q.Set("diverse", "true")
+	}
+	if o.Near {
+		q.Set("lat", strconv.FormatFloat(o.Lat, 'f', -1, 64))
+		q.Set("lon", strconv.FormatFloat(o.Lon, 'f', -1, 64))
+		num("radius", o.Radius)
+	}
+	set("sort", o.Sort)
+	num("limit", float64(o.Limit))
+	num("page", float64(o.Page))
+	for k, vs := range o.Extra {
+		q[k] = append(q[k], vs...)
+	}
+	return q
+}
+
+// SearchPage is one page of search results.
+type SearchPage struct {
+	Restaurants []models.Restaurant `json:"restaurants"`
+	Pages       int                 `json:"pages"`
+	TotalCount  int                 `json:"total_count"`
+	DidYouMean  string              `json:"did_you_mean,omitempty"`
+}
+
+// Search returns the page of results selected by opts.Page (the first when 0).
+func (c *Client) Search(ctx context.Context, opts SearchOptions) (*SearchPage, error) {
+	var page SearchPage
+	if err := c.Do(ctx, http.MethodGet, "/api/search", opts.Values(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Restaurants iterates over every result of a search, fetching pages as the
+// loop needs them, from opts.Page onwards. Iteration stops at the first
+// error, which is yielded with a zero restaurant.
+func (c *Client) Restaurants(ctx context.Context, opts SearchOptions) iter.Seq2[models.Restaurant, error] {
+	return func(yield func(models.Restaurant, error) bool) {
+		page := max(opts.Page, 1)
+		for {
+			opts.Page = page
+			res, err := c.Search(ctx, opts)
+			if err != nil {
+				yield(models.Restaurant{}, err)
+				return
+			}
+			for _, r := range res.Restaurants {
+				if !yield(r, nil) {
+					return
+				}
+			}
+			if page >= res.Pages || len(res.Restaurants) == 0 {
+				return
+			}
+			page++
+		}
+	}
+}
+
+// Restaurant returns one restaurant with its details.
+func (c *Client) Restaurant(ctx context.Context, id int64) (*models.Restaurant, error) {
+	var r models.Restaurant
+	if err := c.Do(ctx, http.MethodGet, "/api/restaurants/"+strconv.FormatInt(id, 10)+"/details", nil, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Cities returns the published cities.
+func (c *Client) Cities(ctx context.Context) ([]models.City, error) {
+	var cities []models.City
+	err := c.Do(ctx, http.MethodGet, "/api/cities", nil, nil, &cities)
+	return cities, err
+}
+
+// Cuisines returns the cuisines in use, optionally within city.
+func (c *Client) Cuisines(ctx context.Context, city string) ([]models.Cuisine, error) {
+	var cuisines []models.Cuisine
+	err := c.Do(ctx, http.MethodGet, "/api/cuisines", cityQuery(city), nil, &cuisines)
+	return cuisines, err
+}
+
+// MealTypes returns the meal types in use, optionally within city.
+func (c *Client) MealTypes(ctx context.Context, city string) ([]models.MealType, error) {
+	var meals []models.MealType
+	err := c.Do(ctx, http.MethodGet, "/api/meal-types", cityQuery(city), nil, &meals)
+	return meals, err
+}
+
+func cityQuery(city string) url.Values {
+	if city == "" {
+		return nil
+	}
+	return url.Values{"city": {city}}
+}
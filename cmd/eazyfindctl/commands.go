@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/client"
+	"eazyfind/maintenance"
+)
+
+// pollInterval is how often -wait checks a job.
+const pollInterval = 2 * time.Second
+
+func runStatus(ctx context.Context, c *client.Client, args []string) error {
+	o, err := c.Overview(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(o.Schedules))
+	for _, s := range o.Schedules {
+		rows = append(rows, []string{s.Name, s.Schedule, strconv.FormatBool(s.Running), timeOrDash(s.LastRunAt), timeOrDash(s.NextRunAt),
+			strconv.FormatInt(s.Runs, 10), strconv.FormatInt(s.Skipped, 10)})
+	}
+	if output == "table" {
+		fmt.Printf("failed geocodes: %d   outbox pending: %d   outbox failed: %d\n\n", o.FailedGeocodes, o.Outbox.Pending, o.Outbox.Failed)
+	}
+	return render(o, []string{"JOB", "SCHEDULE", "RUNNING", "LAST RUN", "NEXT RUN", "RUNS", "SKIPPED"}, rows)
+}
+
+func runFlags(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		states, err := c.Flags(ctx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(states))
+		for _, s := range states {
+			rows = append(rows, []string{s.Name, strconv.FormatBool(s.Enabled), s.Source, s.Description})
+		}
+		return render(states, []string{"FLAG", "ENABLED", "SOURCE", "DESCRIPTION"}, rows)
+	}
+
+	switch {
+	case args[0] == "set" && len(args) == 3 && (args[2] == "on" || args[2] == "off"):
+		s, err := c.SetFlag(ctx, args[1], args[2] == "on")
+		if err != nil {
+			return err
+		}
+		return render(s, []string{"FLAG", "ENABLED", "SOURCE"}, [][]string{{s.Name, strconv.FormatBool(s.Enabled), s.Source}})
+	case args[0] == "reset" && len(args) == 2:
+		s, err := c.ResetFlag(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return render(s, []string{"FLAG", "ENABLED", "SOURCE"}, [][]string{{s.Name, strconv.FormatBool(s.Enabled), s.Source}})
+	}
+	return errors.New("usage: " + commands["flags"].usage)
+}
+
+func runTasks(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		tasks, jobs, err := c.Tasks(ctx)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return render(map[string]interface{}{"tasks": tasks, "jobs": jobs}, nil, nil)
+		}
+		rows := make([][]string, 0, len(tasks))
+		for _, t := range tasks {
+			rows = append(rows, []string{t.Name, strconv.FormatBool(t.DryRun), t.Description})
+		}
+		if err := render(nil, []string{"TASK", "DRY RUN", "DESCRIPTION"}, rows); err != nil || len(jobs) == 0 {
+			return err
+		}
+		fmt.Println()
+		return printJobs(jobs...)
+	}
+
+	switch args[0] {
+	case "run":
+		fs := flag.NewFlagSet("tasks run", flag.ExitOnError)
+		params := fs.String("params", "", "task parameters as a JSON object")
+		dryRun := fs.Bool("dry-run", false, "only count the changes")
+		wait := fs.Bool("wait", false, "wait for the job to finish")
+		if len(args) < 2 {
+			return errors.New("usage: " + commands["tasks"].usage)
+		}
+		fs.Parse(args[2:])
+		var body interface{}
+		if *params != "" {
+			if !json.Valid([]byte(*params)) {
+				return errors.New("-params must be valid JSON")
+			}
+			body = json.RawMessage(*params)
+		}
+		job, err := c.RunTask(ctx, args[1], body, *dryRun)
+		return finishJob(ctx, c, job, err, *wait)
+	case "job", "cancel":
+		if len(args) != 2 {
+			return errors.New("usage: " + commands["tasks"].usage)
+		}
+		get := c.TaskJob
+		if args[0] == "cancel" {
+			get = c.CancelTaskJob
+		}
+		job, err := get(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return printJobs(*job)
+	}
+	return errors.New("usage: " + commands["tasks"].usage)
+}
+
+func runRequeueGeocodes(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("requeue-geocodes", flag.ExitOnError)
+	city := fs.String("city", "", "only restaurants in this city")
+	failed := fs.Bool("failed", false, "requeue FAILED rows instead of resolved ones")
+	below := fs.Float64("confidence-below", 0, "only pins with geo_confidence below this")
+	before := fs.String("before", "", "only rows geocoded before this date (YYYY-MM-DD)")
+	ids := fs.String("ids", "", "comma-separated restaurant ids")
+	dryRun := fs.Bool("dry-run", false, "only count the rows")
+	wait := fs.Bool("wait", false, "wait for the job to finish")
+	fs.Parse(args)
+
+	params := map[string]interface{}{}
+	if *city != "" {
+		params["city"] = *city
+	}
+	if *failed {
+		params["failed"] = true
+	}
+	if *below > 0 {
+		params["confidence_below"] = *below
+	}
+	if *before != "" {
+		params["before"] = *before
+	}
+	if *ids != "" {
+		var list []int64
+		for _, s := range strings.Split(*ids, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid id %q", s)
+			}
+			list = append(list, id)
+		}
+		params["ids"] = list
+	}
+	job, err := c.RunTask(ctx, "requeue-geocodes", params, *dryRun)
+	return finishJob(ctx, c, job, err, *wait)
+}
+
+// runExport writes restaurants matching key=value search parameters as
+// NDJSON to -out (stdout by default), or with -async queues an export job,
+// waits for it and prints its download link.
+func runExport(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	async := fs.Bool("async", false, "export through an export job and print the link")
+	out := fs.String("out", "", "file to write (default stdout)")
+	fs.Parse(args)
+
+	opts := client.SearchOptions{Extra: url.Values{}}
+	for _, kv := range fs.Args() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("search parameters must be key=value, got %q", kv)
+		}
+		opts.Extra.Add(k, v)
+	}
+
+	if *async {
+		job, err := c.CreateExport(ctx, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "export %d queued\n", job.ID)
+		if job, err = c.WaitExport(ctx, job.ID, pollInterval); err != nil {
+			return err
+		}
+		if job.Status != "SUCCEEDED" {
+			return fmt.Errorf("export %d %s: %s", job.ID, strings.ToLower(job.Status), job.Error)
+		}
+		rows := 0
+		if job.Rows != nil {
+			rows = *job.Rows
+		}
+		return render(job, []string{"EXPORT", "ROWS", "URL"}, [][]string{{strconv.FormatInt(job.ID, 10), strconv.Itoa(rows), job.URL}})
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return c.StreamExport(ctx, opts, w)
+}
+
+// runImport applies a bulk update read from FILE (or - for stdin): the JSON
+// body documented for POST /api/admin/restaurants/bulk-update.
+func runImport(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only count the changes")
+	wait := fs.Bool("wait", false, "wait for the job to finish")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: " + commands["import"].usage)
+	}
+
+	var body []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(body) {
+		return errors.New("import file must be a JSON bulk-update request")
+	}
+	job, err := c.BulkUpdate(ctx, body, *dryRun)
+	return finishJob(ctx, c, job, err, *wait)
+}
+
+// finishJob prints a started maintenance job, first waiting for it with wait.
+func finishJob(ctx context.Context, c *client.Client, job *maintenance.JobStatus, err error, wait bool) error {
+	if err != nil {
+		return err
+	}
+	if wait {
+		if job, err = c.WaitTaskJob(ctx, job.ID, pollInterval); err != nil {
+			return err
+		}
+	}
+	if err := printJobs(*job); err != nil {
+		return err
+	}
+	if job.Status == maintenance.StatusFailed {
+		return fmt.Errorf("job %s failed: %s", job.ID, job.Error)
+	}
+	return nil
+}
+
+func printJobs(jobs ...maintenance.JobStatus) error {
+	rows := make([][]string, 0, len(jobs))
+	for _, j := range jobs {
+		rows = append(rows, []string{j.ID, j.Name, j.Status, strconv.FormatBool(j.DryRun),
+			fmt.Sprintf("%d/%d", j.Processed, j.Total), strconv.FormatInt(j.Updated, 10), j.Error})
+	}
+	var v interface{} = jobs
+	if len(jobs) == 1 {
+		v = jobs[0]
+	}
+	return render(v, []string{"JOB", "TASK", "STATUS", "DRY RUN", "PROCESSED", "UPDATED", "ERROR"}, rows)
+}
+
+func timeOrDash(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
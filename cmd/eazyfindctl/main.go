@@ -0,0 +1,107 @@
+// Command eazyfindctl runs routine operations against an EazyFind deployment
+// through its admin API: exports, bulk imports, geocode requeues, feature
+// flags, worker status and maintenance tasks.
+//
+//	eazyfindctl [-url URL] [-token TOKEN] [-o table|json] <command> [args]
+//
+// The URL and admin token default to EAZYFIND_URL and EAZYFIND_ADMIN_TOKEN;
+// EAZYFIND_API_KEY, when set, is sent as the X-API-Key.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"eazyfind/client"
+)
+
+// command is one eazyfindctl subcommand.
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client.Client, args []string) error
+}
+
+var commands map[string]command
+
+// init fills commands, which the commands reference for their usage lines.
+func init() {
+	commands = map[string]command{
+		"status":           {"status", runStatus},
+		"flags":            {"flags [list | set NAME on|off | reset NAME]", runFlags},
+		"tasks":            {"tasks [list | run NAME [-params JSON] [-dry-run] [-wait] | job ID | cancel ID]", runTasks},
+		"requeue-geocodes": {"requeue-geocodes [-city C] [-failed] [-confidence-below X] [-before DATE] [-ids 1,2] [-dry-run] [-wait]", runRequeueGeocodes},
+		"export":           {"export [-async] [-out FILE] [key=value ...]", runExport},
+		"import":           {"import [-dry-run] [-wait] FILE", runImport},
+	}
+}
+
+// output is the -o format, "table" or "json".
+var output = "table"
+
+func main() {
+	fs := flag.NewFlagSet("eazyfindctl", flag.ExitOnError)
+	baseURL := fs.String("url", envOr("EAZYFIND_URL", "http://localhost:8080"), "API base URL")
+	token := fs.String("token", os.Getenv("EAZYFIND_ADMIN_TOKEN"), "admin token")
+	fs.StringVar(&output, "o", output, "output format: table or json")
+	fs.Usage = usage
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 || (output != "table" && output != "json") {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", fs.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	c := client.New(*baseURL)
+	c.AdminToken = *token
+	c.APIKey = os.Getenv("EAZYFIND_API_KEY")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cmd.run(ctx, c, fs.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "eazyfindctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: eazyfindctl [-url URL] [-token TOKEN] [-o table|json] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range []string{"status", "flags", "tasks", "requeue-geocodes", "export", "import"} {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// render writes v as indented JSON with -o json, or else as a table of
+// header and rows.
+func render(v interface{}, header []string, rows [][]string) error {
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"expvar"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
 	"eazyfind/database"
+	"eazyfind/flags"
 	"eazyfind/handlers"
+	"eazyfind/middleware"
+	"eazyfind/scheduler"
+	"eazyfind/storage"
+	"eazyfind/tracker"
 	"eazyfind/worker"
 
 	"github.com/joho/godotenv"
@@ -16,46 +25,216 @@ import (
 // main initializes the server, database connections, and background workers.
 func main() {
 	_ = godotenv.Load()
+	tracker.Init()
 
 	db, err := database.Connect()
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	go database.LogIndexProblems(db)
+	workerDB, err := database.ConnectWorkers()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer workerDB.Close()
 
-	go worker.StartGeocodingWorker(db)
+	worker.StartGeocodingWorker(workerDB)
+	worker.StartSessionCleanup(workerDB)
+	worker.StartAccountPurge(workerDB)
+	worker.StartEnrichmentWorker(workerDB)
+	worker.StartImageWorker(workerDB)
+	worker.StartLinkChecker(workerDB)
+	worker.StartOfferValidator(workerDB)
+	worker.StartAnalyticsRollup(workerDB)
+	worker.StartPopularTimesEstimator(workerDB)
+	worker.StartCuisineClassifier(workerDB)
+	worker.StartNameNormalizer(workerDB)
+	worker.StartOutboxDispatcher(workerDB)
+	store := storage.FromEnv()
+	handlers.StartExportWorker(workerDB, store)
+	scheduler.Start(workerDB)
+	flags.Start(db)
+	if flags.Enabled(nil, flags.StartupWarmup) {
+		handlers.Warmup(db)
+	}
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /restaurants", handlers.SearchHandler(db))
+	// Searches share the 10-connection pool and exports the workers' pool;
+	// past these caps requests get a fast 503 instead of queueing for a
+	// connection.
+	searchLimit := middleware.NewLimiter("search", int(envInt64("SEARCH_MAX_IN_FLIGHT", 50)), envDuration("SEARCH_TIMEOUT", 10*time.Second))
+	exportLimit := middleware.NewLimiter("export", int(envInt64("EXPORT_MAX_IN_FLIGHT", 2)), 0)
+
+	mux.Handle("GET /restaurants", searchLimit.Wrap(handlers.SearchHandler(db)))
 	mux.HandleFunc("GET /restaurants/{city}", handlers.GetRestaurantsByCityHandler(db))
 	mux.HandleFunc("GET /cities", handlers.CitiesHandler(db))
 	mux.HandleFunc("GET /meal-types", handlers.MealTypesHandler(db))
 	mux.HandleFunc("GET /cuisines", handlers.CuisinesHandler(db))
 
-	mux.HandleFunc("GET /api/restaurants", handlers.SearchHandler(db))
-	mux.HandleFunc("GET /api/search", handlers.SearchHandler(db))
+	mux.Handle("GET /api/restaurants", searchLimit.Wrap(handlers.SearchHandler(db)))
+	mux.Handle("GET /api/search", searchLimit.Wrap(handlers.SearchHandler(db)))
+	mux.Handle("GET /api/search/cost-histogram", searchLimit.Wrap(handlers.CostHistogramHandler(db)))
 	mux.HandleFunc("GET /api/cities", handlers.CitiesHandler(db))
+	mux.HandleFunc("GET /api/cities/service-areas", handlers.ServiceAreasHandler(db))
+	mux.HandleFunc("GET /api/cities/{city}/trends", handlers.CityTrendsHandler(db))
+	mux.Handle("GET /api/export/restaurants", exportLimit.Wrap(handlers.ExportHandler(workerDB, store)))
+	mux.HandleFunc("GET "+storage.FilesPath+"/{key...}", handlers.FilesHandler(store))
+	mux.Handle("GET /api/map/restaurants", searchLimit.Wrap(handlers.MapSearchHandler(db)))
+	mux.HandleFunc("GET /api/map/heatmap", handlers.HeatmapHandler(db))
+	mux.HandleFunc("GET /api/tenant", handlers.TenantHandler)
+	mux.HandleFunc("GET /widget/deals", handlers.WidgetDealsHandler(db))
 	mux.HandleFunc("GET /api/detect-city", handlers.DetectCityHandler(db))
+	mux.HandleFunc("GET /api/detect-area", handlers.DetectAreaHandler(db))
+	mux.HandleFunc("GET /api/geocode", handlers.GeocodeHandler)
 	mux.HandleFunc("GET /api/cuisines", handlers.CuisinesHandler(db))
 	mux.HandleFunc("GET /api/meal-types", handlers.MealTypesHandler(db))
 	mux.HandleFunc("GET /api/restaurants/{city}", handlers.GetRestaurantsByCityHandler(db))
+	mux.HandleFunc("GET /api/restaurants/{id}/{view}", handlers.RestaurantRoutes(db))
+	mux.HandleFunc("POST /api/restaurants/distances", handlers.RestaurantDistancesHandler(db))
+	mux.HandleFunc("GET /api/brands/{id}/nearest", handlers.BrandNearestHandler(db))
+
+	mux.HandleFunc("POST /api/share", handlers.CreateShareHandler(db))
+	mux.HandleFunc("GET /s/{code}", handlers.ResolveShareHandler(db))
+	mux.HandleFunc("GET /r/{restaurantId}", handlers.PartnerRedirectHandler(db))
+
+	mux.HandleFunc("POST /api/offers/{id}/coupon", middleware.RequireUser(handlers.RevealCouponHandler(db)))
+	mux.HandleFunc("POST /api/offers/{id}/coupon/redeem", middleware.RequireUser(handlers.RedeemCouponHandler(db)))
+	voucherSecret := handlers.VoucherSecret()
+	mux.HandleFunc("GET /api/offers/{id}/voucher", middleware.RequireUser(handlers.VoucherHandler(db, voucherSecret)))
+	mux.HandleFunc("POST /api/vouchers/validate", handlers.ValidateVoucherHandler(db, voucherSecret))
+
+	mux.HandleFunc("POST /api/assistant/search", handlers.AssistantSearchHandler(db))
+
+	mux.HandleFunc("GET /api/session/recent", handlers.RecentActivityHandler(db))
+	mux.HandleFunc("GET /api/suggest", handlers.SuggestHandler(db))
+	mux.HandleFunc("GET /api/users/me/recent-searches", handlers.RecentSearchesHandler(db))
+	mux.HandleFunc("DELETE /api/users/me/recent-searches", handlers.DeleteRecentSearchesHandler(db))
+	mux.HandleFunc("DELETE /api/users/me/recent-searches/{id}", handlers.DeleteRecentSearchesHandler(db))
+	mux.HandleFunc("GET /api/users/me/export", middleware.RequireUser(handlers.AccountExportHandler(db)))
+	mux.HandleFunc("DELETE /api/users/me", middleware.RequireUser(handlers.DeleteAccountHandler(db)))
+	mux.HandleFunc("POST /api/users/me/restore", middleware.RequireUser(handlers.RestoreAccountHandler(db)))
+	mux.HandleFunc("POST /api/session/views", handlers.RecordViewHandler(db))
+
+	mux.HandleFunc("POST /api/keys", handlers.CreateAPIKeyHandler(db))
+	mux.HandleFunc("GET /api/keys/{id}/usage", handlers.APIKeyUsageHandler(db))
+
+	mux.HandleFunc("GET /api/admin/overview", middleware.RequireAdmin(handlers.AdminOverviewHandler(db)))
+	mux.HandleFunc("GET /api/admin/indexes", middleware.RequireAdmin(handlers.IndexesHandler(db)))
+	mux.HandleFunc("PUT /api/admin/cities/{id}/published", middleware.RequireAdmin(handlers.SetCityPublishedHandler(db)))
+	mux.HandleFunc("PUT /api/admin/cities/{id}/timezone", middleware.RequireAdmin(handlers.SetCityTimezoneHandler(db)))
+	mux.HandleFunc("PUT /api/admin/cities/{id}/search-radius", middleware.RequireAdmin(handlers.SetCityRadiusHandler(db)))
+	mux.HandleFunc("PUT /api/admin/cities/{id}/service-area", middleware.RequireAdmin(handlers.SetServiceAreaHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/cities/{id}/service-area", middleware.RequireAdmin(handlers.DeleteServiceAreaHandler(db)))
+	mux.HandleFunc("POST /api/admin/exports", middleware.RequireAdmin(handlers.CreateExportJobHandler(workerDB, store)))
+	mux.HandleFunc("GET /api/admin/exports/{id}", middleware.RequireAdmin(handlers.ExportJobHandler(db, store)))
+	mux.HandleFunc("GET /api/admin/restaurants", middleware.RequireAdmin(handlers.AdminSearchHandler(db)))
+	mux.HandleFunc("POST /api/admin/restaurants/bulk-update", middleware.RequireAdmin(handlers.BulkUpdateHandler(workerDB)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/contact", middleware.RequireAdmin(handlers.SetRestaurantContactHandler(db)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/image", middleware.RequireAdmin(handlers.SetRestaurantImageHandler(db, store)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/delivery-zone", middleware.RequireAdmin(handlers.SetDeliveryZoneHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/restaurants/{id}/delivery-zone", middleware.RequireAdmin(handlers.DeleteDeliveryZoneHandler(db)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/offer-window", middleware.RequireAdmin(handlers.SetOfferWindowHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/restaurants/{id}/offer-window", middleware.RequireAdmin(handlers.DeleteOfferWindowHandler(db)))
+	mux.HandleFunc("GET /api/admin/coupons", middleware.RequireAdmin(handlers.CouponsHandler(db)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/coupon", middleware.RequireAdmin(handlers.SetCouponHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/restaurants/{id}/coupon", middleware.RequireAdmin(handlers.DeleteCouponHandler(db)))
+	mux.HandleFunc("PUT /api/admin/restaurants/{id}/popular-times", middleware.RequireAdmin(handlers.SetPopularTimesHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/restaurants/{id}/popular-times", middleware.RequireAdmin(handlers.DeletePopularTimesHandler(db)))
+	mux.HandleFunc("POST /api/admin/maintenance/recompute-discounts", middleware.RequireAdmin(handlers.RecomputeDiscountsHandler(workerDB)))
+	mux.HandleFunc("GET /api/admin/maintenance/jobs/{id}", middleware.RequireAdmin(handlers.MaintenanceJobHandler))
+	mux.HandleFunc("GET /api/admin/tasks", middleware.RequireAdmin(handlers.ListTasksHandler))
+	mux.HandleFunc("POST /api/admin/tasks/{name}", middleware.RequireAdmin(handlers.RunTaskHandler(workerDB)))
+	mux.HandleFunc("GET /api/admin/tasks/jobs/{id}", middleware.RequireAdmin(handlers.MaintenanceJobHandler))
+	mux.HandleFunc("DELETE /api/admin/tasks/jobs/{id}", middleware.RequireAdmin(handlers.CancelMaintenanceJobHandler))
+	mux.HandleFunc("GET /api/admin/dead-links", middleware.RequireAdmin(handlers.DeadLinksHandler(db)))
+	mux.HandleFunc("GET /api/admin/geo-status", middleware.RequireAdmin(handlers.GeoStatusHandler(db)))
+	mux.HandleFunc("GET /api/admin/geocodes/low-confidence", middleware.RequireAdmin(handlers.LowConfidenceGeocodesHandler(db)))
+	mux.HandleFunc("POST /api/admin/geocode/requeue", middleware.RequireAdmin(handlers.RequeueGeocodesHandler(workerDB)))
+	mux.HandleFunc("GET /api/admin/freshness", middleware.RequireAdmin(handlers.StaleCitiesHandler(db)))
+	mux.HandleFunc("GET /api/admin/keys", middleware.RequireAdmin(handlers.ListAPIKeysHandler(db)))
+	mux.HandleFunc("POST /api/admin/keys/{id}/approve", middleware.RequireAdmin(handlers.ApproveAPIKeyHandler(db)))
+	mux.HandleFunc("POST /api/admin/keys/{id}/revoke", middleware.RequireAdmin(handlers.RevokeAPIKeyHandler(db)))
+	mux.HandleFunc("POST /api/admin/impersonation-tokens", middleware.RequireAdmin(handlers.CreateImpersonationTokenHandler(db)))
+	mux.HandleFunc("GET /api/admin/impersonation-tokens/{id}", middleware.RequireAdmin(handlers.ImpersonationTokenHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/impersonation-tokens/{id}", middleware.RequireAdmin(handlers.RevokeImpersonationTokenHandler(db)))
+	mux.HandleFunc("GET /api/admin/flags", middleware.RequireAdmin(handlers.FlagsHandler))
+	mux.HandleFunc("PUT /api/admin/flags/{name}", middleware.RequireAdmin(handlers.SetFlagHandler))
+	mux.HandleFunc("DELETE /api/admin/flags/{name}", middleware.RequireAdmin(handlers.ResetFlagHandler))
+	mux.HandleFunc("GET /api/admin/cuisine-proposals", middleware.RequireAdmin(handlers.CuisineProposalsHandler(db)))
+	mux.HandleFunc("POST /api/admin/cuisine-proposals/{id}/{cuisineId}/accept", middleware.RequireAdmin(handlers.AcceptCuisineProposalHandler(db)))
+	mux.HandleFunc("POST /api/admin/cuisine-proposals/{id}/{cuisineId}/reject", middleware.RequireAdmin(handlers.RejectCuisineProposalHandler(db)))
+	mux.HandleFunc("GET /api/admin/quarantine", middleware.RequireAdmin(handlers.QuarantineHandler(db)))
+	mux.HandleFunc("POST /api/admin/quarantine/{id}/release", middleware.RequireAdmin(handlers.ReleaseQuarantinedHandler(db)))
+	mux.HandleFunc("POST /api/admin/quarantine/{id}/reject", middleware.RequireAdmin(handlers.RejectQuarantinedHandler(db)))
+	mux.HandleFunc("GET /api/admin/synonyms", middleware.RequireAdmin(handlers.SynonymsHandler(db)))
+	mux.HandleFunc("PUT /api/admin/synonyms/{term}", middleware.RequireAdmin(handlers.PutSynonymHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/synonyms/{term}", middleware.RequireAdmin(handlers.DeleteSynonymHandler(db)))
 
+	mux.HandleFunc("GET /debug/vars", middleware.RequireAdmin(expvar.Handler().ServeHTTP))
+
+	// White-label tenants add their own frontends through tenants.cors_origins.
+	origins := []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174"}
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174"},
-		AllowedMethods:   []string{"GET", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
+		AllowOriginFunc: func(origin string) bool {
+			return slices.Contains(origins, origin) || middleware.TenantOriginAllowed(db, origin)
+		},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", middleware.APIKeyHeader, flags.OverrideHeader},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, middleware.ImpersonatingHeader, handlers.SnapshotHeader, "X-Total-Count", "X-Voucher-Expires"},
 		AllowCredentials: true,
 	})
-	handler := c.Handler(mux)
+
+	var handler http.Handler = middleware.LimitBody(envInt64("MAX_BODY_BYTES", 1<<20), mux)
+	handler = middleware.Tenants(db, handler)
+	handler = middleware.APIKeys(db, handler)
+	handler = middleware.Impersonate(db, handler)
+	handler = middleware.Session(middleware.SessionSecret(), handler)
+	handler = middleware.Recover(tracker.Reporter{}, handler)
+	handler = middleware.RequestID(handler)
+	handler = c.Handler(handler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3003"
 	}
 
+	// Explicit timeouts keep slow or stalled clients from holding connections open indefinitely.
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:      envDuration("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT", 120*time.Second),
+		MaxHeaderBytes:    int(envInt64("MAX_HEADER_BYTES", 1<<16)),
+	}
+
 	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
+	if err := srv.ListenAndServe(); err != nil {
 		log.Fatal("Server failed:", err)
 	}
 }
+
+// envDuration reads a Go duration string (e.g. "15s") from the environment.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid %s=%q, using default %v", key, v, fallback)
+	}
+	return fallback
+}
+
+// envInt64 reads a positive integer from the environment.
+func envInt64(key string, fallback int64) int64 {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("Invalid %s=%q, using default %d", key, v, fallback)
+	}
+	return fallback
+}
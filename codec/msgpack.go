@@ -0,0 +1,178 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// MarshalMsgpack encodes v as MessagePack. Structs are written as maps keyed by
+// their json tag names (honouring omitempty), so the document mirrors the JSON
+// response; ids tagged ",string" are written as integers.
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+func appendMsgpack(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, 0xc0), nil
+	}
+	if v.Type() == rawMessageType {
+		var decoded interface{}
+		if err := json.Unmarshal(v.Bytes(), &decoded); err != nil {
+			return nil, err
+		}
+		return appendMsgpack(buf, reflect.ValueOf(decoded))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpack(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendInt64(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendStr(buf, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		fallthrough
+	case reflect.Array:
+		buf = appendLen(buf, v.Len(), 0x90, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if buf, err = appendMsgpack(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		buf = appendLen(buf, v.Len(), 0x80, 0xde)
+		iter := v.MapRange()
+		for iter.Next() {
+			var err error
+			if buf, err = appendMsgpack(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = appendMsgpack(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Struct:
+		return appendStruct(buf, v)
+	}
+
+	// Anything else (channels, funcs) goes through JSON so it fails the same way.
+	raw, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(buf, reflect.ValueOf(json.RawMessage(raw)))
+}
+
+func appendStruct(buf []byte, v reflect.Value) ([]byte, error) {
+	type field struct {
+		name  string
+		value reflect.Value
+	}
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(opts, "omitempty") && isEmpty(fv) {
+			continue
+		}
+		fields = append(fields, field{name, fv})
+	}
+
+	buf = appendLen(buf, len(fields), 0x80, 0xde)
+	for _, f := range fields {
+		buf = appendStr(buf, f.name)
+		var err error
+		if buf, err = appendMsgpack(buf, f.value); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// isEmpty matches encoding/json's definition of an empty value for omitempty.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+func appendInt64(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(buf, byte(n))
+	case n < 0 && n >= -32:
+		return append(buf, byte(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+}
+
+func appendStr(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n <= 31:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+// appendLen writes an array or map header: fix is the fixarray/fixmap prefix,
+// wide the 16-bit form (the 32-bit form follows it).
+func appendLen(buf []byte, n int, fix, wide byte) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, wide), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, wide+1), uint32(n))
+}
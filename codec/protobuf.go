@@ -0,0 +1,115 @@
+// Package codec encodes search results in the binary formats offered through
+// content negotiation alongside JSON.
+package codec
+
+import (
+	"encoding/binary"
+	"math"
+
+	"eazyfind/models"
+)
+
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/msgpack"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// MarshalSearchResponse encodes a SearchResponse message as defined in
+// proto/restaurant.proto. Zero values are omitted, as in proto3.
+func MarshalSearchResponse(restaurants []models.Restaurant, pages, totalCount int) []byte {
+	var buf []byte
+	for _, r := range restaurants {
+		buf = appendMessage(buf, 1, marshalRestaurant(r))
+	}
+	buf = appendInt(buf, 2, int64(pages))
+	buf = appendInt(buf, 3, int64(totalCount))
+	return buf
+}
+
+func marshalRestaurant(r models.Restaurant) []byte {
+	var buf []byte
+	buf = appendInt(buf, 1, r.ID)
+	buf = appendString(buf, 2, r.RestaurantName)
+	buf = appendString(buf, 3, r.City)
+	buf = appendString(buf, 4, r.Area)
+	buf = appendInt(buf, 5, int64(r.CostForTwo))
+	buf = appendDouble(buf, 6, r.Rating)
+	buf = appendDouble(buf, 7, r.Latitude)
+	buf = appendDouble(buf, 8, r.Longitude)
+	buf = appendString(buf, 9, r.ImageURL)
+	buf = appendDouble(buf, 10, r.EffectiveDiscount)
+	buf = appendBool(buf, 11, r.Free)
+	buf = appendString(buf, 12, r.Offer)
+	buf = appendString(buf, 13, r.Percentage)
+	buf = appendBool(buf, 14, r.LocationRestricted)
+	buf = appendDouble(buf, 15, r.Distance)
+	for _, c := range r.Cuisines {
+		var m []byte
+		m = appendInt(m, 1, c.ID)
+		m = appendString(m, 2, c.CuisineName)
+		buf = appendMessage(buf, 16, m)
+	}
+	for _, mt := range r.MealTypes {
+		var m []byte
+		m = appendInt(m, 1, mt.ID)
+		m = appendString(m, 2, mt.MealType)
+		buf = appendMessage(buf, 17, m)
+	}
+	buf = appendString(buf, 18, r.ImageAttribution)
+	if r.GeoConfidence != nil {
+		// Explicit presence: a score of 0 is still written.
+		buf = appendTag(buf, 19, wireFixed64)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(*r.GeoConfidence))
+	}
+	buf = appendString(buf, 20, r.Slug)
+	return buf
+}
+
+func appendTag(buf []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(buf, uint64(field<<3|wireType))
+}
+
+func appendInt(buf []byte, field int, v int64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendTag(buf, field, wireVarint)
+	return binary.AppendUvarint(buf, uint64(v))
+}
+
+func appendBool(buf []byte, field int, v bool) []byte {
+	if !v {
+		return buf
+	}
+	return append(appendTag(buf, field, wireVarint), 1)
+}
+
+func appendDouble(buf []byte, field int, v float64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendTag(buf, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+func appendString(buf []byte, field int, v string) []byte {
+	if v == "" {
+		return buf
+	}
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func appendMessage(buf []byte, field int, msg []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(msg)))
+	return append(buf, msg...)
+}
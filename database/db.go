@@ -3,20 +3,46 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// Default statement timeouts. Handlers answer interactive requests, so a
+// query running longer than a few seconds is a runaway; workers and
+// maintenance tasks batch through whole tables and get longer.
+const (
+	DefaultStatementTimeout       = 15 * time.Second
+	DefaultWorkerStatementTimeout = 5 * time.Minute
+)
+
 // Connect establishes a connection to the PostgreSQL database, optimized for serverless
-// environments like Neon by managing idle connections efficiently.
+// environments like Neon by managing idle connections efficiently. Queries are
+// cancelled server-side after STATEMENT_TIMEOUT (default 15s).
 func Connect() (*sql.DB, error) {
+	return open(envDuration("STATEMENT_TIMEOUT", DefaultStatementTimeout), 10)
+}
+
+// ConnectWorkers opens the smaller pool background workers, scheduled jobs
+// and maintenance tasks share, with WORKER_STATEMENT_TIMEOUT (default 5m), so
+// their long batches neither hit the handler timeout nor take the
+// connections requests need.
+func ConnectWorkers() (*sql.DB, error) {
+	return open(envDuration("WORKER_STATEMENT_TIMEOUT", DefaultWorkerStatementTimeout), 5)
+}
+
+func open(timeout time.Duration, maxOpen int) (*sql.DB, error) {
 	connStr := os.Getenv("DATABASE_URL")
 	if connStr == "" {
 		return nil, fmt.Errorf("DATABASE_URL environment variable not set")
 	}
 
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", withStatementTimeout(connStr, timeout))
 	if err != nil {
 		return nil, err
 	}
@@ -30,10 +56,49 @@ func Connect() (*sql.DB, error) {
 	// Disable idle connections to avoid holding on to suspended compute
 	db.SetMaxIdleConns(0)
 	// Limit open connections for this simple app
-	db.SetMaxOpenConns(10)
+	db.SetMaxOpenConns(maxOpen)
 	// Refresh connections periodically
 	// db.SetConnMaxLifetime(5 * time.Minute)
 
 	fmt.Println("Connected to PostgreSQL successfully (Optimized for Neon)")
 	return db, nil
 }
+
+// withStatementTimeout adds statement_timeout to connStr as a run-time
+// parameter, sent when each connection starts. A timeout already in connStr
+// wins, and 0 leaves the server's default.
+func withStatementTimeout(connStr string, timeout time.Duration) string {
+	if timeout <= 0 || strings.Contains(connStr, "statement_timeout") {
+		return connStr
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		u, err := url.Parse(connStr)
+		if err != nil {
+			return connStr
+		}
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return connStr + " statement_timeout=" + ms
+}
+
+// envDuration reads a Go duration string (e.g. "15s") from the environment;
+// "0" disables the timeout.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s=%q, using default %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Index is an index search depends on, as created by schema.sql.
+type Index struct {
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	Method string `json:"method"`
+	// Status is "ok", "missing", "invalid" (a failed concurrent build) or
+	// "partial" (has a WHERE clause queries do not repeat, so it is unused).
+	Status string `json:"status"`
+}
+
+// RequiredIndexes are the indexes that keep searches off sequential scans.
+var RequiredIndexes = []Index{
+	{Name: "idx_restaurants_geo", Table: "restaurants", Method: "gist"},
+	{Name: "idx_cities_geo", Table: "cities", Method: "gist"},
+	{Name: "idx_restaurants_city", Table: "restaurants", Method: "btree"},
+	{Name: "idx_restaurants_city_norm_trgm", Table: "restaurants", Method: "gin"},
+	{Name: "idx_restaurants_is_duplicate", Table: "restaurants", Method: "btree"},
+	{Name: "idx_restaurants_discount", Table: "restaurants", Method: "btree"},
+	{Name: "idx_restaurants_rating", Table: "restaurants", Method: "btree"},
+	{Name: "idx_restaurants_cost", Table: "restaurants", Method: "btree"},
+	{Name: "idx_restaurants_name_trgm", Table: "restaurants", Method: "gin"},
+}
+
+// CheckIndexes reports the status of each of RequiredIndexes.
+func CheckIndexes(db *sql.DB) ([]Index, error) {
+	out := make([]Index, 0, len(RequiredIndexes))
+	for _, want := range RequiredIndexes {
+		var valid, partial bool
+		err := db.QueryRow(`
+			SELECT i.indisvalid, i.indpred IS NOT NULL
+			FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indexrelid
+			JOIN pg_am am ON am.oid = c.relam
+			WHERE i.indexrelid = to_regclass($1) AND i.indrelid = to_regclass($2) AND am.amname = $3`,
+			want.Name, want.Table, want.Method).Scan(&valid, &partial)
+		switch {
+		case err == sql.ErrNoRows:
+			want.Status = "missing"
+		case err != nil:
+			return nil, err
+		case !valid:
+			want.Status = "invalid"
+		case partial:
+			want.Status = "partial"
+		default:
+			want.Status = "ok"
+		}
+		out = append(out, want)
+	}
+	return out, nil
+}
+
+// LogIndexProblems logs a warning for every required index that is not
+// usable, so a deployment without the current schema.sql is noticed.
+func LogIndexProblems(db *sql.DB) {
+	indexes, err := CheckIndexes(db)
+	if err != nil {
+		log.Printf("Warning: index check failed: %v", err)
+		return
+	}
+	for _, idx := range indexes {
+		if idx.Status != "ok" {
+			log.Printf("Warning: index %s on %s is %s; searches may scan the whole table. Re-apply database_sql/schema.sql", idx.Name, idx.Table, idx.Status)
+		}
+	}
+}
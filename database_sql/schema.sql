@@ -3,6 +3,9 @@
 -- Enable PostGIS extension for spatial grouping and distance calculations
 CREATE EXTENSION IF NOT EXISTS postgis;
 
+-- Enable trigram matching for "did you mean" spelling suggestions
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 -- Restaurants table: Core entity storing establishment details and calculated discounts
 CREATE TABLE IF NOT EXISTS restaurants (
     id BIGSERIAL PRIMARY KEY,
@@ -44,9 +47,13 @@ CREATE TABLE IF NOT EXISTS cities (
     latitude DOUBLE PRECISION,
     longitude DOUBLE PRECISION,
     geo GEOGRAPHY(POINT, 4326),
-    geo_status TEXT DEFAULT 'PENDING'
+    geo_status TEXT DEFAULT 'PENDING',
+    is_published BOOLEAN NOT NULL DEFAULT true
 );
 
+-- Cities still being seeded can be hidden from public endpoints
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS is_published BOOLEAN NOT NULL DEFAULT true;
+
 -- Restaurant -> Cuisines junction table
 CREATE TABLE IF NOT EXISTS restaurant_cuisines (
     restaurant_id BIGINT REFERENCES restaurants(id) ON DELETE CASCADE,
@@ -63,12 +70,10 @@ CREATE TABLE IF NOT EXISTS restaurant_meal_types (
 
 -- Spatial Indexes for efficient location-based lookups
 CREATE INDEX IF NOT EXISTS idx_restaurants_geo
-ON restaurants USING GIST (geo)
-WHERE geo_status = 'RESOLVED';
+ON restaurants USING GIST (geo);
 
 CREATE INDEX IF NOT EXISTS idx_cities_geo 
-ON cities USING GIST (geo) 
-WHERE geo_status = 'RESOLVED';
+ON cities USING GIST (geo);
 
 -- Relational Indexes
 CREATE INDEX IF NOT EXISTS idx_restaurants_city ON restaurants(city);
@@ -78,3 +83,615 @@ CREATE INDEX IF NOT EXISTS idx_restaurants_is_duplicate ON restaurants(is_duplic
 CREATE INDEX IF NOT EXISTS idx_restaurants_rating ON restaurants(rating DESC);
 CREATE INDEX IF NOT EXISTS idx_restaurants_cost ON restaurants(cost_for_two);
 CREATE INDEX IF NOT EXISTS idx_restaurants_discount ON restaurants(effective_discount DESC);
+
+-- Trigram indexes backing spelling suggestions
+CREATE INDEX IF NOT EXISTS idx_restaurants_name_trgm ON restaurants USING GIN (restaurant_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_cuisines_name_trgm ON cuisines USING GIN (cuisine_name gin_trgm_ops);
+
+-- Restaurant history: snapshot of price/deal fields recorded whenever any of them changes
+CREATE TABLE IF NOT EXISTS restaurant_history (
+    id BIGSERIAL PRIMARY KEY,
+    restaurant_id BIGINT REFERENCES restaurants(id) ON DELETE CASCADE,
+    cost_for_two INTEGER,
+    rating NUMERIC(2, 1),
+    offer TEXT,
+    effective_discount DOUBLE PRECISION,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_restaurant_history_restaurant ON restaurant_history(restaurant_id, recorded_at DESC);
+
+CREATE OR REPLACE FUNCTION record_restaurant_history() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+       OR NEW.cost_for_two IS DISTINCT FROM OLD.cost_for_two
+       OR NEW.rating IS DISTINCT FROM OLD.rating
+       OR NEW.offer IS DISTINCT FROM OLD.offer
+       OR NEW.effective_discount IS DISTINCT FROM OLD.effective_discount THEN
+        INSERT INTO restaurant_history (restaurant_id, cost_for_two, rating, offer, effective_discount)
+        VALUES (NEW.id, NEW.cost_for_two, NEW.rating, NEW.offer, NEW.effective_discount);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_restaurant_history ON restaurants;
+CREATE TRIGGER trg_restaurant_history
+AFTER INSERT OR UPDATE OF cost_for_two, rating, offer, effective_discount ON restaurants
+FOR EACH ROW EXECUTE FUNCTION record_restaurant_history();
+
+-- Session activity: recent searches and views per anonymous session, pruned after the retention window
+CREATE TABLE IF NOT EXISTS session_activity (
+    id BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_activity_session ON session_activity(session_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_session_activity_created ON session_activity(created_at);
+
+-- Synonyms: colloquial terms mapped to canonical cuisine names (e.g. 'pizza' -> 'Italian')
+CREATE TABLE IF NOT EXISTS synonyms (
+    term TEXT PRIMARY KEY,
+    canonical TEXT NOT NULL
+);
+
+-- API keys: third-party access to the public API. Keys are stored hashed and start out pending admin approval
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner_email TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'PENDING',
+    rate_limit_per_minute INTEGER NOT NULL DEFAULT 60,
+    daily_quota INTEGER NOT NULL DEFAULT 5000,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    approved_at TIMESTAMPTZ
+);
+
+-- API key usage: per-key daily request counters used for quotas and reporting
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    api_key_id BIGINT REFERENCES api_keys(id) ON DELETE CASCADE,
+    day DATE NOT NULL DEFAULT CURRENT_DATE,
+    requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, day)
+);
+
+-- Outbound clicks: partner deep-link redirects recorded for attribution
+CREATE TABLE IF NOT EXISTS outbound_clicks (
+    id BIGSERIAL PRIMARY KEY,
+    restaurant_id BIGINT REFERENCES restaurants(id) ON DELETE CASCADE,
+    source TEXT,
+    campaign TEXT,
+    session_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbound_clicks_restaurant ON outbound_clicks(restaurant_id, created_at DESC);
+
+-- Share links: short codes resolving to a saved search query string
+CREATE TABLE IF NOT EXISTS share_links (
+    code TEXT PRIMARY KEY,
+    query TEXT UNIQUE NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Change tracking: updated_at on listing tables drives Last-Modified / If-Modified-Since
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE cuisines ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE meal_types ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_restaurants_updated_at ON restaurants;
+CREATE TRIGGER trg_restaurants_updated_at BEFORE UPDATE ON restaurants FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+DROP TRIGGER IF EXISTS trg_cities_updated_at ON cities;
+CREATE TRIGGER trg_cities_updated_at BEFORE UPDATE ON cities FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+DROP TRIGGER IF EXISTS trg_cuisines_updated_at ON cuisines;
+CREATE TRIGGER trg_cuisines_updated_at BEFORE UPDATE ON cuisines FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+DROP TRIGGER IF EXISTS trg_meal_types_updated_at ON meal_types;
+CREATE TRIGGER trg_meal_types_updated_at BEFORE UPDATE ON meal_types FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Junction edits change taxonomy counts, so they touch the owning restaurant
+CREATE OR REPLACE FUNCTION touch_restaurant() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE restaurants SET updated_at = now() WHERE id = COALESCE(NEW.restaurant_id, OLD.restaurant_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_restaurant_cuisines_touch ON restaurant_cuisines;
+CREATE TRIGGER trg_restaurant_cuisines_touch AFTER INSERT OR DELETE ON restaurant_cuisines FOR EACH ROW EXECUTE FUNCTION touch_restaurant();
+DROP TRIGGER IF EXISTS trg_restaurant_meal_types_touch ON restaurant_meal_types;
+CREATE TRIGGER trg_restaurant_meal_types_touch AFTER INSERT OR DELETE ON restaurant_meal_types FOR EACH ROW EXECUTE FUNCTION touch_restaurant();
+
+-- Geo privacy: restaurants whose exact coordinates must not be exposed publicly
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS location_restricted BOOLEAN NOT NULL DEFAULT false;
+
+-- Data freshness: last_scraped_at is set by the scraper whenever it sees a listing,
+-- even if nothing changed; updated_at keeps tracking actual data changes
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS last_scraped_at TIMESTAMPTZ;
+
+CREATE OR REPLACE FUNCTION set_restaurant_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    IF (to_jsonb(NEW) - 'last_scraped_at' - 'updated_at') IS DISTINCT FROM (to_jsonb(OLD) - 'last_scraped_at' - 'updated_at') THEN
+        NEW.updated_at = now();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_restaurants_updated_at ON restaurants;
+CREATE TRIGGER trg_restaurants_updated_at BEFORE UPDATE ON restaurants FOR EACH ROW EXECUTE FUNCTION set_restaurant_updated_at();
+
+UPDATE restaurants SET last_scraped_at = updated_at WHERE last_scraped_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_restaurants_city_scraped ON restaurants(city, last_scraped_at);
+
+-- Contact details for click-to-call and directions; address_line is backfilled by geocoding
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS phone TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS website TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS address_line TEXT;
+
+-- Places enrichment: details filled by the enrichment worker; field_sources records
+-- where each enriched or edited field came from (e.g. {"phone": "google_places"})
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS price_level SMALLINT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS opening_hours JSONB;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS google_place_id TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS field_sources JSONB;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS enrichment_status TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS enriched_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_restaurants_enrichment_pending ON restaurants(id) WHERE enrichment_status IS NULL AND geo_status = 'RESOLVED';
+
+-- Image backfill: image_source is 'google_places', 'placeholder' or 'admin' (uploaded); image_status records the
+-- worker's outcome (STORED, PLACEHOLDER, MISSING) so each row is attempted once
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS image_attribution TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS image_source TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS image_status TEXT;
+
+-- Dead links: image and partner URLs that failed a HEAD check; rows are removed once the link recovers
+CREATE TABLE IF NOT EXISTS dead_links (
+    restaurant_id BIGINT NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    url TEXT NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    failures INTEGER NOT NULL DEFAULT 1,
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_checked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (restaurant_id, field)
+);
+
+-- Offer validation: when the live offer was last confirmed against its source, and when it was found to have ended
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS offer_checked_at TIMESTAMPTZ;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS offer_expired_at TIMESTAMPTZ;
+
+-- Job schedules: cron overrides for background jobs by name (e.g. 'geocoding', 'offer-validation'); 'off' disables a job
+CREATE TABLE IF NOT EXISTS job_schedules (
+    name TEXT PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Hourly outbound click counts, rolled up from outbound_clicks so they outlive event pruning
+CREATE TABLE IF NOT EXISTS click_stats_hourly (
+    hour TIMESTAMPTZ NOT NULL,
+    restaurant_id BIGINT NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    source TEXT NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL,
+    PRIMARY KEY (hour, restaurant_id, source)
+);
+
+-- Geocoding claims: the worker moves rows PENDING -> IN_PROGRESS before calling the API; claims older than
+-- the worker's timeout are returned to PENDING
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS geo_claimed_at TIMESTAMPTZ;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS geo_claimed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_restaurants_geo_pending ON restaurants(id) WHERE geo_status IN ('PENDING', 'IN_PROGRESS');
+
+-- Geocode quality: Google's location_type and partial_match for the stored pin, scored 0-1 in geo_confidence
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS geo_location_type TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS geo_partial_match BOOLEAN;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS geo_confidence NUMERIC(3,2);
+
+CREATE INDEX IF NOT EXISTS idx_restaurants_geo_confidence ON restaurants(geo_confidence) WHERE geo_status = 'RESOLVED';
+
+-- When the geocoding worker last resolved a row; lets admins requeue rows geocoded before a logic or provider change
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS geocoded_at TIMESTAMPTZ;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS geocoded_at TIMESTAMPTZ;
+
+-- URL slugs: lowercase name-area-city, generated on insert; collisions get a numeric suffix (-2, -3, ...).
+-- Setting slug to NULL or '' regenerates it.
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS slug TEXT;
+
+CREATE OR REPLACE FUNCTION slugify(txt TEXT) RETURNS TEXT AS $$
+    SELECT trim(both '-' from regexp_replace(lower(COALESCE(txt, '')), '[^a-z0-9]+', '-', 'g'));
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION set_restaurant_slug() RETURNS TRIGGER AS $$
+DECLARE
+    base TEXT;
+    candidate TEXT;
+    n INTEGER := 1;
+BEGIN
+    IF COALESCE(NEW.slug, '') <> '' THEN
+        RETURN NEW;
+    END IF;
+    base := slugify(concat_ws(' ', NEW.restaurant_name, NULLIF(NEW.area, NEW.city), NEW.city));
+    IF base = '' THEN
+        base := 'restaurant';
+    END IF;
+    candidate := base;
+    WHILE EXISTS (SELECT 1 FROM restaurants WHERE slug = candidate AND id IS DISTINCT FROM NEW.id) LOOP
+        n := n + 1;
+        candidate := base || '-' || n;
+    END LOOP;
+    NEW.slug := candidate;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_restaurants_slug ON restaurants;
+CREATE TRIGGER trg_restaurants_slug BEFORE INSERT OR UPDATE OF slug ON restaurants FOR EACH ROW EXECUTE FUNCTION set_restaurant_slug();
+
+-- Backfill without bumping updated_at
+ALTER TABLE restaurants DISABLE TRIGGER trg_restaurants_updated_at;
+UPDATE restaurants SET slug = NULL WHERE slug IS NULL;
+ALTER TABLE restaurants ENABLE TRIGGER trg_restaurants_updated_at;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_restaurants_slug ON restaurants(slug);
+
+-- City slugs: canonical lowercase identifier for each city, plus alias slugs for alternate names.
+-- City-filtered endpoints accept the slug, display name or any alias.
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS slug TEXT;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS aliases TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE OR REPLACE FUNCTION set_city_slug() RETURNS TRIGGER AS $$
+BEGIN
+    IF COALESCE(NEW.slug, '') = '' THEN
+        NEW.slug := slugify(NEW.city_name);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_cities_slug ON cities;
+CREATE TRIGGER trg_cities_slug BEFORE INSERT OR UPDATE OF slug ON cities FOR EACH ROW EXECUTE FUNCTION set_city_slug();
+
+UPDATE cities SET slug = slugify(city_name) WHERE slug IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cities_slug ON cities(slug);
+CREATE INDEX IF NOT EXISTS idx_cities_aliases ON cities USING GIN (aliases);
+
+-- Well-known former and alternate names
+UPDATE cities c SET aliases = a.aliases
+FROM (
+    SELECT slug, array_agg(alias) AS aliases FROM (VALUES
+        ('bengaluru', 'bangalore'), ('bangalore', 'bengaluru'),
+        ('mumbai', 'bombay'), ('chennai', 'madras'), ('kolkata', 'calcutta'),
+        ('gurugram', 'gurgaon'), ('gurgaon', 'gurugram'),
+        ('delhi-ncr', 'delhi'), ('delhi-ncr', 'new-delhi'), ('delhi-ncr', 'ncr')
+    ) v(slug, alias) GROUP BY slug
+) a
+WHERE c.slug = a.slug AND c.aliases = '{}';
+
+-- Feature flags: stored values take precedence over FLAG_<NAME> env defaults
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Tenants: white-label frontends served by this deployment. A tenant is
+-- resolved from its API keys or from the request Host; one with rows in
+-- tenant_cities only sees those cities and their restaurants.
+CREATE TABLE IF NOT EXISTS tenants (
+    id BIGSERIAL PRIMARY KEY,
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    hosts TEXT[] NOT NULL DEFAULT '{}',
+    cors_origins TEXT[] NOT NULL DEFAULT '{}',
+    branding JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS tenant_cities (
+    tenant_id BIGINT REFERENCES tenants(id) ON DELETE CASCADE,
+    city_id BIGINT REFERENCES cities(id) ON DELETE CASCADE,
+    PRIMARY KEY (tenant_id, city_id)
+);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id BIGINT REFERENCES tenants(id) ON DELETE SET NULL;
+
+-- Service areas: admin-drawn coverage polygons used by detect-city and shown on maps
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS service_area geometry(MultiPolygon, 4326);
+CREATE INDEX IF NOT EXISTS idx_cities_service_area ON cities USING GIST (service_area);
+
+-- Delivery zones: a restaurant delivers inside delivery_area, or when it has
+-- none, within delivery_radius_m of its location
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS delivery_area geometry(MultiPolygon, 4326);
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS delivery_radius_m INTEGER CHECK (delivery_radius_m > 0);
+CREATE INDEX IF NOT EXISTS idx_restaurants_delivery_area ON restaurants USING GIST (delivery_area);
+
+-- Popular times: how busy a restaurant is per local weekday (0 = Sunday) and hour, 0-100. Rows are
+-- imported by admins or estimated nightly from click_stats_hourly; imported ones are never overwritten
+CREATE TABLE IF NOT EXISTS popular_times (
+    restaurant_id BIGINT NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    day SMALLINT NOT NULL CHECK (day BETWEEN 0 AND 6),
+    hour SMALLINT NOT NULL CHECK (hour BETWEEN 0 AND 23),
+    busyness SMALLINT NOT NULL CHECK (busyness BETWEEN 0 AND 100),
+    source TEXT NOT NULL DEFAULT 'import',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (restaurant_id, day, hour)
+);
+
+-- Time-window offers: a city's IANA timezone (NULL = Asia/Kolkata), and the local days
+-- (0 = Sunday; NULL = every day) and hours a restaurant's offer is valid. A window whose
+-- end is before its start runs past midnight
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS timezone TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS offer_window_days SMALLINT[];
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS offer_window_start TIME;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS offer_window_end TIME;
+
+-- Coupon codes: an exclusive code for a restaurant's offer, revealed once per signed-in user.
+-- Each reveal counts towards redemption_limit (NULL = unlimited); redeemed_at is set when the
+-- user reports using it
+CREATE TABLE IF NOT EXISTS coupons (
+    id BIGSERIAL PRIMARY KEY,
+    restaurant_id BIGINT UNIQUE NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    code TEXT NOT NULL,
+    redemption_limit INTEGER CHECK (redemption_limit > 0),
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS coupon_reveals (
+    coupon_id BIGINT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    revealed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    redeemed_at TIMESTAMPTZ,
+    PRIMARY KEY (coupon_id, user_id)
+);
+
+-- Vouchers: signed, expiring QR vouchers for a restaurant's offer, issued to signed-in users and
+-- marked redeemed by the restaurant
+CREATE TABLE IF NOT EXISTS vouchers (
+    id BIGSERIAL PRIMARY KEY,
+    restaurant_id BIGINT NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    offer TEXT NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    redeemed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_vouchers_user ON vouchers (restaurant_id, user_id, expires_at DESC);
+
+-- Tags: free-form lowercase labels (e.g. 'late-night', 'rooftop') set by admins, filterable in search
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS idx_restaurants_tags ON restaurants USING GIN (tags);
+
+-- Cuisine proposals: suggestions from the cuisine classifier for restaurants with no cuisines,
+-- pending until an admin accepts (linking the cuisine) or rejects them
+CREATE TABLE IF NOT EXISTS cuisine_proposals (
+    restaurant_id BIGINT NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    cuisine_id BIGINT NOT NULL REFERENCES cuisines(id) ON DELETE CASCADE,
+    confidence DOUBLE PRECISION NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    reviewed_at TIMESTAMPTZ,
+    PRIMARY KEY (restaurant_id, cuisine_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cuisine_proposals_status ON cuisine_proposals (status, confidence DESC);
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS cuisines_classified_at TIMESTAMPTZ;
+
+-- Name normalization: display_name is the scraped name without emojis, branch suffixes or ALL CAPS;
+-- name_key is the matching key shared by a brand's branches, used for dedup and the brand filter.
+-- name_source is the restaurant_name they were derived from, so renamed rows are picked up again.
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS display_name TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS name_key TEXT;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS name_source TEXT;
+CREATE INDEX IF NOT EXISTS idx_restaurants_name_key ON restaurants (name_key text_pattern_ops);
+
+-- Geocoding errors: the worker's last failure for rows it could not resolve, cleared once resolved
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS last_geo_error TEXT;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS last_geo_error TEXT;
+
+-- Geocoding attempts: when the worker last tried a row. last_geo_error holds an error code (ZERO_RESULTS,
+-- OVER_QUERY_LIMIT, TIMEOUT, REQUEST_DENIED, ...); rows the geocoder cannot find become FAILED and are not retried
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS last_geo_attempt_at TIMESTAMPTZ;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS last_geo_attempt_at TIMESTAMPTZ;
+
+-- Transactional outbox: side effects of a write (cache invalidation, webhooks) recorded in the same
+-- transaction and delivered afterwards by the outbox dispatcher, retried with backoff until failed_at
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT,
+    dispatched_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events (next_attempt_at, id) WHERE dispatched_at IS NULL AND failed_at IS NULL;
+
+-- Export jobs: admin exports written to object storage by the export worker. params is the
+-- search query string; storage_key and row_count are set once the job succeeds
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    params TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'PENDING',
+    storage_key TEXT,
+    row_count INTEGER,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_pending ON export_jobs (id) WHERE status IN ('PENDING', 'RUNNING');
+
+-- Recent searches: the last few distinct searches per owner ('user:<id>' when signed in, else
+-- 'session:<id>'), for "recent" chips in the search box. params is the search query string
+CREATE TABLE IF NOT EXISTS recent_searches (
+    id BIGSERIAL PRIMARY KEY,
+    owner TEXT NOT NULL,
+    query_text TEXT NOT NULL DEFAULT '',
+    params TEXT NOT NULL,
+    searched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (owner, params)
+);
+CREATE INDEX IF NOT EXISTS idx_recent_searches_owner ON recent_searches (owner, searched_at DESC);
+
+-- Payment restrictions parsed from the offer text ("HDFC cards only" -> {hdfc}); NULL or empty
+-- when any payment method redeems the offer. Maintained by recompute-discounts and the offer validator
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS payment_methods TEXT[];
+CREATE INDEX IF NOT EXISTS idx_restaurants_payment_methods ON restaurants USING GIN (payment_methods);
+
+-- Accent-folded city and area columns, so "Bengalūru" matches "Bengaluru" in city and area filters.
+-- unaccent() is only STABLE, so fold_text pins the dictionary to be usable in generated columns.
+-- slugify folds accents too, so accented input still resolves by slug; alternate spellings
+-- ("Trivandrum") are city aliases
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE OR REPLACE FUNCTION fold_text(txt TEXT) RETURNS TEXT AS $$
+    SELECT lower(public.unaccent('public.unaccent'::regdictionary, txt));
+$$ LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE;
+
+CREATE OR REPLACE FUNCTION slugify(txt TEXT) RETURNS TEXT AS $$
+    SELECT trim(both '-' from regexp_replace(COALESCE(fold_text(txt), ''), '[^a-z0-9]+', '-', 'g'));
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS city_norm TEXT GENERATED ALWAYS AS (fold_text(city)) STORED;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS area_norm TEXT GENERATED ALWAYS AS (fold_text(area)) STORED;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS city_name_norm TEXT GENERATED ALWAYS AS (fold_text(city_name)) STORED;
+CREATE INDEX IF NOT EXISTS idx_restaurants_city_norm ON restaurants (city_norm);
+CREATE INDEX IF NOT EXISTS idx_restaurants_area_norm ON restaurants USING GIN (area_norm gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_cities_city_name_norm ON cities (city_name_norm);
+
+UPDATE cities c SET aliases = c.aliases || a.alias
+FROM (VALUES
+    ('thiruvananthapuram', 'trivandrum'), ('kochi', 'cochin'), ('pune', 'poona'),
+    ('vadodara', 'baroda'), ('mysuru', 'mysore'), ('puducherry', 'pondicherry'),
+    ('varanasi', 'benares'), ('prayagraj', 'allahabad'), ('mangaluru', 'mangalore')
+) a(slug, alias)
+WHERE c.slug = a.slug AND NOT a.alias = ANY(c.aliases);
+
+-- Per-city search radius settings, in meters: the default radius for coordinate searches and
+-- per-sort distance caps ({"discount": 30000}). NULL falls back to SEARCH_DEFAULT_RADIUS and
+-- SEARCH_DISTANCE_CAPS
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS search_radius_m INTEGER;
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS distance_caps JSONB;
+
+-- Databases created before geo was declared GEOGRAPHY may hold geometry(Point, 4326) here, where
+-- ST_Distance and ST_DWithin work in degrees. Convert them so distances and radii are in meters;
+-- the check-geo maintenance task verifies the result
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['restaurants', 'cities'] LOOP
+        IF (SELECT format_type(atttypid, atttypmod) FROM pg_attribute
+            WHERE attrelid = t::regclass AND attname = 'geo' AND NOT attisdropped) <> 'geography(Point,4326)' THEN
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN geo TYPE geography(Point, 4326) USING ST_SetSRID(geo::geometry, 4326)::geography', t);
+        END IF;
+    END LOOP;
+END $$;
+
+-- The spatial indexes used to be partial (WHERE geo_status = 'RESOLVED'), which search predicates
+-- never repeat, so ST_DWithin fell back to sequential scans. Rebuild them without the predicate.
+-- City filters match city_norm with ILIKE, which only a trigram index can serve.
+-- GET /api/admin/indexes (and a warning at startup) reports indexes that are missing or unusable
+DO $$
+DECLARE
+    idx TEXT;
+BEGIN
+    FOREACH idx IN ARRAY ARRAY['idx_restaurants_geo', 'idx_cities_geo'] LOOP
+        IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass(idx) AND indpred IS NOT NULL) THEN
+            EXECUTE format('DROP INDEX %I', idx);
+        END IF;
+    END LOOP;
+END $$;
+CREATE INDEX IF NOT EXISTS idx_restaurants_geo ON restaurants USING GIST (geo);
+CREATE INDEX IF NOT EXISTS idx_cities_geo ON cities USING GIST (geo);
+CREATE INDEX IF NOT EXISTS idx_restaurants_city_norm_trgm ON restaurants USING GIN (city_norm gin_trgm_ops);
+
+-- Impersonation: short-lived tokens an admin mints to act as a user while reproducing a support
+-- report. Only the hash is stored; scope is 'read' (GET and HEAD only) or 'write'. Every request made
+-- with a token is recorded in impersonation_requests
+CREATE TABLE IF NOT EXISTS impersonation_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    user_id TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT 'read' CHECK (scope IN ('read', 'write')),
+    reason TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_tokens_user ON impersonation_tokens (user_id, created_at DESC);
+CREATE TABLE IF NOT EXISTS impersonation_requests (
+    id BIGSERIAL PRIMARY KEY,
+    token_id BIGINT NOT NULL REFERENCES impersonation_tokens(id) ON DELETE CASCADE,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_requests_token ON impersonation_requests (token_id, requested_at);
+
+-- Account deletions: users who asked to be forgotten. Their data is kept until purge_after so the
+-- request can be cancelled; the account-purge job then deletes their recent searches and replaces
+-- their user id on vouchers, coupon reveals and impersonation tokens with a random pseudonym
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id TEXT PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    purge_after TIMESTAMPTZ NOT NULL,
+    purged_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_account_deletions_pending ON account_deletions (purge_after) WHERE purged_at IS NULL;
+
+-- Quarantined submissions: public events (restaurant views, outbound clicks) held back by abuse
+-- screening (per-IP velocity, repeated identical submissions) until an admin releases them, which
+-- records them with their original time, or rejects them. payload is the event as submitted
+CREATE TABLE IF NOT EXISTS quarantined_submissions (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    session_id TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'released', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    reviewed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_quarantined_submissions_status ON quarantined_submissions (status, created_at DESC);
+
+-- Last-Modified for a city's restaurant list reads MAX(updated_at); scanning this index backwards stops
+-- at the newest row in the city
+CREATE INDEX IF NOT EXISTS idx_restaurants_updated_at ON restaurants (updated_at);
+
+-- Partner keys: the restaurants a key acts for, set by an admin on approval. Only these keys (or an
+-- admin) may redeem a restaurant's vouchers
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS restaurant_ids BIGINT[] NOT NULL DEFAULT '{}';
+
+-- Trends carry each restaurant's last history row forward, so restaurants the history trigger has never
+-- seen get one row with their current values, dated no later than the earliest recorded history
+INSERT INTO restaurant_history (restaurant_id, cost_for_two, rating, offer, effective_discount, recorded_at)
+SELECT r.id, r.cost_for_two, r.rating, r.offer, r.effective_discount,
+       LEAST(r.updated_at, (SELECT MIN(recorded_at) FROM restaurant_history))
+FROM restaurants r
+WHERE NOT EXISTS (SELECT 1 FROM restaurant_history h WHERE h.restaurant_id = r.id);
@@ -0,0 +1,46 @@
+// Package deals turns scraped offer text into the normalized discount used
+// for ranking.
+package deals
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	percentPattern = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)\s*%`)
+	flatPattern    = regexp.MustCompile(`(?:flat\s*)?(?:rs\.?|₹|inr)\s*(\d{2,5})\s*off`)
+	bogoPattern    = regexp.MustCompile(`\b(?:buy\s*1\s*get\s*1|bogo|1\s*\+\s*1)\b`)
+)
+
+// NormalizeDiscount derives effective_discount (0..1) from an offer's
+// percentage and text. Flat amounts are converted using the cost for two;
+// when several forms are present the largest discount wins.
+func NormalizeDiscount(offer, percentage string, costForTwo int) float64 {
+	best := 0.0
+	text := strings.ToLower(percentage + " " + offer)
+
+	if p, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(percentage), "%")), 64); err == nil {
+		best = math.Max(best, p/100)
+	}
+	for _, m := range percentPattern.FindAllStringSubmatch(text, -1) {
+		if p, err := strconv.ParseFloat(m[1], 64); err == nil {
+			best = math.Max(best, p/100)
+		}
+	}
+	if costForTwo > 0 {
+		for _, m := range flatPattern.FindAllStringSubmatch(text, -1) {
+			if amount, err := strconv.Atoi(m[1]); err == nil {
+				best = math.Max(best, float64(amount)/float64(costForTwo))
+			}
+		}
+	}
+	if bogoPattern.MatchString(text) {
+		best = math.Max(best, 0.5)
+	}
+
+	best = math.Min(math.Max(best, 0), 1)
+	return math.Round(best*1000) / 1000
+}
@@ -0,0 +1,101 @@
+package deals
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PaymentMethodNames are the payment methods an offer can be restricted to,
+// as stored in payment_methods and accepted by the payment_method filter.
+var PaymentMethodNames = []string{
+	"amex", "axis", "citi", "hdfc", "hsbc", "icici", "idfc", "indusind", "kotak", "onecard", "rbl", "sbi", "yes_bank",
+	"amazon_pay", "cred", "gpay", "mobikwik", "paytm", "phonepe", "simpl",
+	"upi", "credit_card", "debit_card", "app",
+}
+
+// paymentPatterns recognise each method in lower-cased offer text. Banks
+// only count next to a card, bank or payment word, so a restaurant named
+// after a street is not mistaken for a bank offer.
+var paymentPatterns = map[string]*regexp.Regexp{
+	"amex":        regexp.MustCompile(`\b(?:amex|american express)\b`),
+	"axis":        bankPattern(`axis`),
+	"citi":        bankPattern(`citi(?:bank)?`),
+	"hdfc":        bankPattern(`hdfc`),
+	"hsbc":        bankPattern(`hsbc`),
+	"icici":       bankPattern(`icici`),
+	"idfc":        bankPattern(`idfc(?: first)?`),
+	"indusind":    bankPattern(`indusind`),
+	"kotak":       bankPattern(`kotak`),
+	"onecard":     regexp.MustCompile(`\bone ?card\b`),
+	"rbl":         bankPattern(`rbl`),
+	"sbi":         bankPattern(`sbi`),
+	"yes_bank":    regexp.MustCompile(`\byes bank\b`),
+	"amazon_pay":  regexp.MustCompile(`\bamazon ?pay\b`),
+	"cred":        regexp.MustCompile(`\b(?:via|using|with|on|through|pay(?:ing)? (?:via|using|with|on)) cred\b|\bcred (?:pay|upi)\b`),
+	"gpay":        regexp.MustCompile(`\b(?:gpay|google ?pay)\b`),
+	"mobikwik":    regexp.MustCompile(`\bmobikwik\b`),
+	"paytm":       regexp.MustCompile(`\bpaytm\b`),
+	"phonepe":     regexp.MustCompile(`\bphone ?pe\b`),
+	"simpl":       regexp.MustCompile(`\bsimpl\b`),
+	"upi":         regexp.MustCompile(`\bupi\b`),
+	"credit_card": regexp.MustCompile(`\bcredit cards?\b`),
+	"debit_card":  regexp.MustCompile(`\bdebit cards?\b`),
+	"app":         regexp.MustCompile(`\b(?:app (?:payments?|only|orders? only)|(?:pay|paid|payment|order|book)(?:ing|s)? (?:via|through|on|using) (?:the |our )?app|only on (?:the |our )?app)\b`),
+}
+
+func bankPattern(bank string) *regexp.Regexp {
+	return regexp.MustCompile(`\b` + bank + `\b(?:\s+bank)?\s+(?:bank|credit|debit|cards?|netbanking|net banking|payments?|customers?|users?)\b|\b(?:on|via|using|with|for)\s+` + bank + `\b`)
+}
+
+// PaymentMethods returns the payment methods an offer is restricted to,
+// sorted; nil means any payment method redeems it. A card-type mention
+// alongside a bank ("HDFC credit cards") is subsumed by the bank.
+func PaymentMethods(offer string) []string {
+	text := strings.ToLower(strings.Join(strings.Fields(offer), " "))
+	if text == "" {
+		return nil
+	}
+	var methods []string
+	banks := false
+	for name, re := range paymentPatterns {
+		if re.MatchString(text) {
+			methods = append(methods, name)
+			if name != "credit_card" && name != "debit_card" && name != "app" && name != "upi" && !isWallet(name) {
+				banks = true
+			}
+		}
+	}
+	if banks {
+		kept := methods[:0]
+		for _, m := range methods {
+			if m != "credit_card" && m != "debit_card" {
+				kept = append(kept, m)
+			}
+		}
+		methods = kept
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func isWallet(name string) bool {
+	switch name {
+	case "amazon_pay", "cred", "gpay", "mobikwik", "paytm", "phonepe", "simpl":
+		return true
+	}
+	return false
+}
+
+// IsPaymentMethod reports whether name is one of PaymentMethodNames.
+func IsPaymentMethod(name string) bool {
+	for _, n := range PaymentMethodNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
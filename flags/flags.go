@@ -0,0 +1,244 @@
+// Package flags holds feature flags for rolling out risky features gradually.
+// A flag's value comes from, in order of precedence: a per-request override
+// header (admins, or everyone when FEATURE_FLAG_OVERRIDES is set), a row in
+// the feature_flags table, a FLAG_<NAME> environment variable, and finally
+// its registered default.
+package flags
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"eazyfind/middleware"
+)
+
+// Built-in flags.
+const (
+	NewRanking          = "new-ranking"
+	Facets              = "facets"
+	V2Envelope          = "v2-envelope"
+	ExperimentalFilters = "experimental-filters"
+	StartupWarmup       = "startup-warmup"
+)
+
+// OverrideHeader sets flags for a single request, e.g.
+// "X-Feature-Flags: facets, new-ranking=off".
+const OverrideHeader = "X-Feature-Flags"
+
+// RefreshInterval bounds how stale the table values may get when they are
+// changed by another instance or directly in the database.
+const RefreshInterval = 30 * time.Second
+
+// Flag describes a feature flag.
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// State is a flag's effective value and where it came from: "db", "env" or
+// "default".
+type State struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Source      string `json:"source"`
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Flag{}
+
+	db       *sql.DB
+	stored   map[string]bool
+	loadedAt time.Time
+)
+
+func init() {
+	Register(Flag{Name: NewRanking, Description: "Alternative relevance ranking for search results"})
+	Register(Flag{Name: Facets, Description: "Facet counts in search responses"})
+	Register(Flag{Name: V2Envelope, Description: "Versioned response envelope for list endpoints"})
+	Register(Flag{Name: ExperimentalFilters, Description: "Search filters still under evaluation"})
+	Register(Flag{Name: StartupWarmup, Description: "Precompute metadata and top deals before serving after a restart"})
+}
+
+// Register adds a flag. Registering the same name twice replaces it.
+func Register(f Flag) {
+	mu.Lock()
+	registry[f.Name] = f
+	mu.Unlock()
+}
+
+// Start loads the stored flag values; until it is called only environment
+// variables and defaults apply.
+func Start(conn *sql.DB) {
+	mu.Lock()
+	db = conn
+	mu.Unlock()
+	reload()
+}
+
+// Enabled reports whether name is on for this request. Unknown flags are off.
+func Enabled(r *http.Request, name string) bool {
+	if r != nil && overridesAllowed(r) {
+		if on, ok := parseOverrides(r.Header.Get(OverrideHeader))[name]; ok {
+			return on
+		}
+	}
+	s, ok := Get(name)
+	return ok && s.Enabled
+}
+
+// Get returns the effective state of name, ignoring request overrides.
+func Get(name string) (State, bool) {
+	refreshIfStale()
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := registry[name]
+	if !ok {
+		return State{}, false
+	}
+	return resolve(f), true
+}
+
+// List returns the effective state of every flag, ordered by name.
+func List() []State {
+	refreshIfStale()
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]State, 0, len(registry))
+	for _, f := range registry {
+		list = append(list, resolve(f))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Set stores a value for name in feature_flags, or clears the stored value
+// when enabled is nil so the environment or default applies again.
+func Set(name string, enabled *bool) error {
+	mu.RLock()
+	conn := db
+	mu.RUnlock()
+	if conn == nil {
+		return errors.New("feature flags not started")
+	}
+
+	var err error
+	if enabled == nil {
+		_, err = conn.Exec("DELETE FROM feature_flags WHERE name = $1", name)
+	} else {
+		_, err = conn.Exec(`
+			INSERT INTO feature_flags (name, enabled) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = now()
+		`, name, *enabled)
+	}
+	if err != nil {
+		return err
+	}
+	reload()
+	return nil
+}
+
+// resolve must be called with mu held.
+func resolve(f Flag) State {
+	s := State{Name: f.Name, Description: f.Description, Enabled: f.Default, Source: "default"}
+	// Unparseable values are ignored.
+	if on, err := strconv.ParseBool(os.Getenv(envKey(f.Name))); err == nil {
+		s.Enabled, s.Source = on, "env"
+	}
+	if on, ok := stored[f.Name]; ok {
+		s.Enabled, s.Source = on, "db"
+	}
+	return s
+}
+
+// envKey maps a flag name to its environment variable, e.g. new-ranking ->
+// FLAG_NEW_RANKING.
+func envKey(name string) string {
+	return "FLAG_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func refreshIfStale() {
+	mu.RLock()
+	stale := db != nil && time.Since(loadedAt) >= RefreshInterval
+	mu.RUnlock()
+	if stale {
+		reload()
+	}
+}
+
+func reload() {
+	mu.Lock()
+	conn := db
+	// Claim the refresh so concurrent requests keep using the current values.
+	loadedAt = time.Now()
+	mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	rows, err := conn.Query("SELECT name, enabled FROM feature_flags")
+	if err != nil {
+		log.Println("Feature flags query error:", err)
+		return
+	}
+	defer rows.Close()
+	values := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var on bool
+		if err := rows.Scan(&name, &on); err == nil {
+			values[name] = on
+		}
+	}
+
+	mu.Lock()
+	stored = values
+	mu.Unlock()
+}
+
+func overridesAllowed(r *http.Request) bool {
+	if on, _ := strconv.ParseBool(os.Getenv("FEATURE_FLAG_OVERRIDES")); on {
+		return true
+	}
+	return middleware.IsAdmin(r)
+}
+
+// parseOverrides reads "a, b=off, c=true": a bare name turns a flag on.
+func parseOverrides(header string) map[string]bool {
+	if header == "" {
+		return nil
+	}
+	overrides := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		on := true
+		if hasValue {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "off", "no":
+				on = false
+			case "on", "yes":
+			default:
+				var err error
+				if on, err = strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+					continue
+				}
+			}
+		}
+		overrides[name] = on
+	}
+	return overrides
+}
@@ -0,0 +1,61 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceSphere(t *testing.T) {
+	degree := EarthRadius * math.Pi / 180
+	tests := []struct {
+		name string
+		a, b LatLon
+		want float64
+	}{
+		{"same point", LatLon{12.9716, 77.5946}, LatLon{12.9716, 77.5946}, 0},
+		{"one degree of latitude", LatLon{0, 0}, LatLon{1, 0}, degree},
+		{"one degree of longitude on the equator", LatLon{0, 77}, LatLon{0, 78}, degree},
+		{"across the antimeridian", LatLon{0, 179.5}, LatLon{0, -179.5}, degree},
+		{"one meter", LatLon{12.9716, 77.5946}, LatLon{12.9716 + 1/degree, 77.5946}, 1},
+		{"antipodes", LatLon{12.9716, 77.5946}, LatLon{-12.9716, -102.4054}, math.Pi * EarthRadius},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Distance(tt.a, tt.b); math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("Distance() = %.4fm, want %.4fm", got, tt.want)
+			}
+			if got, back := Distance(tt.a, tt.b), Distance(tt.b, tt.a); got != back {
+				t.Errorf("Distance() is not symmetric: %v and %v", got, back)
+			}
+		})
+	}
+}
+
+// TestDistanceSpheroid compares Distance with WGS84 spheroid arc lengths, as
+// PostGIS geography measures them, over short north-south and east-west
+// hops at Indian latitudes.
+func TestDistanceSpheroid(t *testing.T) {
+	const a, e2 = 6378137.0, 0.00669437999014
+	const step = 0.01
+	for _, lat := range []float64{8.5, 12.9716, 19.076, 28.6139} {
+		s := math.Sin(lat * math.Pi / 180)
+		rad := step * math.Pi / 180
+		meridian := a * (1 - e2) / math.Pow(1-e2*s*s, 1.5) * rad
+		parallel := a / math.Sqrt(1-e2*s*s) * math.Cos(lat*math.Pi/180) * rad
+
+		p := LatLon{Lat: lat, Lon: 77.5946}
+		for _, c := range []struct {
+			name string
+			to   LatLon
+			want float64
+		}{
+			{"north", LatLon{lat + step, p.Lon}, meridian},
+			{"east", LatLon{lat, p.Lon + step}, parallel},
+		} {
+			got := Distance(p, c.to)
+			if math.Abs(got-c.want) > c.want*0.006 {
+				t.Errorf("lat %v %s: Distance() = %.2fm, spheroid %.2fm", lat, c.name, got, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FakeProviders reports whether DEV_FAKE_PROVIDERS is set, in which case
+// geocoding and reverse geocoding return deterministic synthetic results
+// instead of calling Google or Geoapify. It is meant for local development
+// without API keys.
+var FakeProviders = envFakeProviders()
+
+func envFakeProviders() bool {
+	v := os.Getenv("DEV_FAKE_PROVIDERS")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid DEV_FAKE_PROVIDERS=%q, ignoring", v)
+		return false
+	}
+	if on {
+		log.Println("DEV_FAKE_PROVIDERS set, geocoding returns synthetic coordinates")
+	}
+	return on
+}
+
+// fakeCity is a known city centroid used by the fake providers.
+type fakeCity struct {
+	name     string
+	lat, lon float64
+}
+
+var fakeCities = []fakeCity{
+	{"Bangalore", 12.9716, 77.5946},
+	{"Mumbai", 19.0760, 72.8777},
+	{"Delhi NCR", 28.6139, 77.2090},
+	{"Chennai", 13.0827, 80.2707},
+	{"Kolkata", 22.5726, 88.3639},
+	{"Hyderabad", 17.3850, 78.4867},
+	{"Pune", 18.5204, 73.8567},
+	{"Ahmedabad", 23.0225, 72.5714},
+}
+
+// fakeAliases maps other spellings to an entry in fakeCities.
+var fakeAliases = map[string]string{
+	"bengaluru": "bangalore",
+	"bombay":    "mumbai",
+	"delhi":     "delhi ncr",
+	"new delhi": "delhi ncr",
+	"gurgaon":   "delhi ncr",
+	"gurugram":  "delhi ncr",
+	"noida":     "delhi ncr",
+	"madras":    "chennai",
+	"calcutta":  "kolkata",
+}
+
+// FakeCityCentre returns the centroid of a known city, or for any other name
+// a point inside India derived from a hash of the name.
+func FakeCityCentre(city string) (float64, float64) {
+	key := strings.ToLower(strings.TrimSpace(city))
+	if alias, ok := fakeAliases[key]; ok {
+		key = alias
+	}
+	for _, c := range fakeCities {
+		if strings.ToLower(c.name) == key {
+			return c.lat, c.lon
+		}
+	}
+	x, y := fakeHash(key)
+	return 8 + 22*x, 70 + 18*y
+}
+
+// FakeLocate places name within about 5km of the city's fake centroid; the
+// same name and city always give the same point.
+func FakeLocate(name, city string) (float64, float64) {
+	lat, lon := FakeCityCentre(city)
+	x, y := fakeHash(strings.ToLower(name + "|" + city))
+	return lat + 0.1*(x-0.5), lon + 0.1*(y-0.5)
+}
+
+// fakeReverseCity returns the known city nearest lat/lon, or "" when none is
+// within 50km.
+func fakeReverseCity(lat, lon float64) string {
+	best, bestDist := "", 0.5
+	for _, c := range fakeCities {
+		if d := math.Hypot(c.lat-lat, c.lon-lon); d < bestDist {
+			best, bestDist = c.name, d
+		}
+	}
+	return best
+}
+
+// fakeHash maps s to two values in [0, 1).
+func fakeHash(s string) (float64, float64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+	return float64(sum>>32) / (1 << 32), float64(sum&0xffffffff) / (1 << 32)
+}
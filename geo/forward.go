@@ -0,0 +1,186 @@
+package geo
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ForwardCacheTTL bounds how long a geocoded address is reused.
+	ForwardCacheTTL = 7 * 24 * time.Hour
+	// MaxForwardInFlight caps concurrent provider calls for user addresses;
+	// requests beyond it fail fast with ErrBusy.
+	MaxForwardInFlight = 8
+	// MaxForwardResults is how many candidate places are returned.
+	MaxForwardResults = 5
+)
+
+// Place is a geocoded address.
+type Place struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Address string  `json:"formatted_address"`
+	// Precise is false for approximate matches such as a locality centroid.
+	Precise bool `json:"precise"`
+}
+
+// forwardMetrics is published at /debug/vars as geocode_forward.
+var forwardMetrics = expvar.NewMap("geocode_forward")
+
+var (
+	forwardSlots    = make(chan struct{}, MaxForwardInFlight)
+	forwardMu       sync.Mutex
+	forwardCache    = map[string]forwardEntry{}
+	forwardCacheMax = 10000
+)
+
+type forwardEntry struct {
+	places  []Place
+	expires time.Time
+}
+
+// ForwardConfigured reports whether Geocode has a provider: Google when
+// GOOGLE_MAPS_API_KEY is set, otherwise Geoapify with GEOAPIFY_API_KEY.
+func ForwardConfigured() bool {
+	return FakeProviders || os.Getenv("GOOGLE_MAPS_API_KEY") != "" || os.Getenv("GEOAPIFY_API_KEY") != ""
+}
+
+// Geocode resolves a user-entered address to up to MaxForwardResults places,
+// best first; no match gives an empty slice. Results, including misses, are
+// cached per normalized address. GEOCODE_REGION (an ISO country code) biases
+// Google towards that country. With DEV_FAKE_PROVIDERS the address is placed
+// near the city named by its last comma-separated part.
+func Geocode(address string) ([]Place, error) {
+	key := strings.ToLower(strings.Join(strings.Fields(address), " "))
+	if FakeProviders {
+		parts := strings.Split(key, ",")
+		lat, lon := FakeLocate(key, strings.TrimSpace(parts[len(parts)-1]))
+		return []Place{{Lat: lat, Lon: lon, Address: address, Precise: true}}, nil
+	}
+	forwardMetrics.Add("requests", 1)
+
+	forwardMu.Lock()
+	if e, ok := forwardCache[key]; ok && time.Now().Before(e.expires) {
+		forwardMu.Unlock()
+		forwardMetrics.Add("cache_hits", 1)
+		return e.places, nil
+	}
+	forwardMu.Unlock()
+
+	select {
+	case forwardSlots <- struct{}{}:
+		defer func() { <-forwardSlots }()
+	default:
+		forwardMetrics.Add("busy", 1)
+		return nil, ErrBusy
+	}
+
+	var places []Place
+	var err error
+	if apiKey := os.Getenv("GOOGLE_MAPS_API_KEY"); apiKey != "" {
+		places, err = fetchGooglePlaces(address, apiKey)
+	} else if apiKey := os.Getenv("GEOAPIFY_API_KEY"); apiKey != "" {
+		places, err = fetchGeoapifyPlaces(address, apiKey)
+	} else {
+		return nil, fmt.Errorf("no geocoding provider configured")
+	}
+	if err != nil {
+		forwardMetrics.Add("failures", 1)
+		return nil, err
+	}
+
+	forwardMu.Lock()
+	if len(forwardCache) >= forwardCacheMax {
+		forwardCache = map[string]forwardEntry{}
+	}
+	forwardCache[key] = forwardEntry{places: places, expires: time.Now().Add(ForwardCacheTTL)}
+	forwardMu.Unlock()
+	return places, nil
+}
+
+func fetchGooglePlaces(address, apiKey string) ([]Place, error) {
+	apiURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/geocode/json?address=%s&key=%s", url.QueryEscape(address), url.QueryEscape(apiKey))
+	if region := os.Getenv("GEOCODE_REGION"); region != "" {
+		apiURL += "&region=" + url.QueryEscape(strings.ToLower(region))
+	}
+	resp, err := reverseClient.Get(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocode API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Results []struct {
+			Geometry struct {
+				Location struct {
+					Lat float64 `json:"lat"`
+					Lng float64 `json:"lng"`
+				} `json:"location"`
+				LocationType string `json:"location_type"`
+			} `json:"geometry"`
+			FormattedAddress string `json:"formatted_address"`
+		} `json:"results"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Status != "OK" && result.Status != "ZERO_RESULTS" {
+		return nil, fmt.Errorf("geocode API status %s", result.Status)
+	}
+	places := []Place{}
+	for _, r := range result.Results {
+		if len(places) == MaxForwardResults {
+			break
+		}
+		places = append(places, Place{
+			Lat:     r.Geometry.Location.Lat,
+			Lon:     r.Geometry.Location.Lng,
+			Address: r.FormattedAddress,
+			Precise: r.Geometry.LocationType != "APPROXIMATE",
+		})
+	}
+	return places, nil
+}
+
+func fetchGeoapifyPlaces(address, apiKey string) ([]Place, error) {
+	apiURL := fmt.Sprintf("https://api.geoapify.com/v1/geocode/search?text=%s&limit=%d&apiKey=%s", url.QueryEscape(address), MaxForwardResults, url.QueryEscape(apiKey))
+	resp, err := reverseClient.Get(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocode API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Features []struct {
+			Properties struct {
+				Lat       float64 `json:"lat"`
+				Lon       float64 `json:"lon"`
+				Formatted string  `json:"formatted"`
+				Type      string  `json:"result_type"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	places := []Place{}
+	for _, f := range result.Features {
+		p := f.Properties
+		places = append(places, Place{Lat: p.Lat, Lon: p.Lon, Address: p.Formatted, Precise: p.Type == "building" || p.Type == "street" || p.Type == "amenity"})
+	}
+	return places, nil
+}
@@ -0,0 +1,80 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"eazyfind/cache"
+	"eazyfind/outbound"
+)
+
+const (
+	// IsolineCacheTTL bounds how long a travel-time polygon is reused.
+	IsolineCacheTTL = 30 * time.Minute
+	// isolinePrecision rounds origins (~110m) so nearby users share cache entries.
+	isolinePrecision = 1000.0
+)
+
+// IsolineModes lists the travel modes accepted by Isoline.
+var IsolineModes = map[string]bool{"walk": true, "drive": true}
+
+// isolineCache holds polygons per rounded origin, mode and duration; the
+// cache package bounds its size, so arbitrary origins cannot grow it.
+var (
+	isolineCache = cache.New(IsolineCacheTTL)
+	httpClient   = outbound.New(10*time.Second, 1)
+)
+
+// Isoline returns the GeoJSON geometry of the area reachable from lat/lon within
+// the given minutes using the Geoapify isoline API. Results are cached per
+// rounded origin, mode and duration.
+func Isoline(lat, lon float64, minutes int, mode string) (string, error) {
+	apiKey := os.Getenv("GEOAPIFY_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("GEOAPIFY_API_KEY not set")
+	}
+
+	lat = float64(int(lat*isolinePrecision)) / isolinePrecision
+	lon = float64(int(lon*isolinePrecision)) / isolinePrecision
+	key := fmt.Sprintf("%.3f,%.3f,%s,%d", lat, lon, mode, minutes)
+
+	geometry, err := isolineCache.GetOrLoad(key, func() (interface{}, error) {
+		return fetchIsoline(lat, lon, minutes, mode, apiKey)
+	})
+	if err != nil {
+		return "", err
+	}
+	return geometry.(string), nil
+}
+
+func fetchIsoline(lat, lon float64, minutes int, mode, apiKey string) (string, error) {
+	apiURL := fmt.Sprintf("https://api.geoapify.com/v1/isoline?lat=%f&lon=%f&type=time&mode=%s&range=%d&apiKey=%s",
+		lat, lon, url.QueryEscape(mode), minutes*60, url.QueryEscape(apiKey))
+	resp, err := httpClient.Get(apiURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("isoline API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Features []struct {
+			Geometry json.RawMessage `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Features) == 0 || len(result.Features[0].Geometry) == 0 {
+		return "", fmt.Errorf("no isoline returned")
+	}
+
+	return string(result.Features[0].Geometry), nil
+}
@@ -0,0 +1,94 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// MaxMatrixTargets bounds how many targets one TravelTimes call routes to.
+const MaxMatrixTargets = 100
+
+// fakeSpeeds are the average speeds, in meters per second, the fake
+// provider assumes for each isoline mode.
+var fakeSpeeds = map[string]float64{"walk": 1.4, "drive": 8}
+
+// Travel is the route from an origin to one target.
+type Travel struct {
+	Meters  float64 `json:"meters"`
+	Seconds float64 `json:"seconds"`
+}
+
+// TravelTimes routes from origin to each target by mode ("walk" or "drive")
+// with the Geoapify route matrix API. The result is parallel to targets; an
+// entry is nil when the target is unreachable.
+func TravelTimes(origin LatLon, targets []LatLon, mode string) ([]*Travel, error) {
+	if len(targets) > MaxMatrixTargets {
+		return nil, fmt.Errorf("at most %d targets per route matrix", MaxMatrixTargets)
+	}
+	out := make([]*Travel, len(targets))
+	if len(targets) == 0 {
+		return out, nil
+	}
+	if FakeProviders {
+		// Roads are rarely straight: stretch the great-circle distance a little.
+		for i, t := range targets {
+			meters := Distance(origin, t) * 1.3
+			out[i] = &Travel{Meters: meters, Seconds: meters / fakeSpeeds[mode]}
+		}
+		return out, nil
+	}
+	apiKey := os.Getenv("GEOAPIFY_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEOAPIFY_API_KEY not set")
+	}
+
+	type location struct {
+		Location [2]float64 `json:"location"`
+	}
+	body := struct {
+		Mode    string     `json:"mode"`
+		Sources []location `json:"sources"`
+		Targets []location `json:"targets"`
+	}{Mode: mode, Sources: []location{{[2]float64{origin.Lon, origin.Lat}}}}
+	for _, t := range targets {
+		body.Targets = append(body.Targets, location{[2]float64{t.Lon, t.Lat}})
+	}
+	raw, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, "https://api.geoapify.com/v1/routematrix?apiKey="+url.QueryEscape(apiKey), bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("route matrix API error: %s", resp.Status)
+	}
+
+	var result struct {
+		SourcesToTargets [][]struct {
+			Distance    *float64 `json:"distance"`
+			Time        *float64 `json:"time"`
+			TargetIndex int      `json:"target_index"`
+		} `json:"sources_to_targets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.SourcesToTargets) == 0 {
+		return nil, fmt.Errorf("no route matrix returned")
+	}
+	for _, cell := range result.SourcesToTargets[0] {
+		if cell.Distance != nil && cell.Time != nil && cell.TargetIndex >= 0 && cell.TargetIndex < len(out) {
+			out[cell.TargetIndex] = &Travel{Meters: *cell.Distance, Seconds: *cell.Time}
+		}
+	}
+	return out, nil
+}
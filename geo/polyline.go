@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// LatLon is a single WGS84 coordinate pair.
+type LatLon struct {
+	Lat float64
+	Lon float64
+}
+
+// DecodePolyline decodes a route in Google's encoded polyline format
+// (precision 5), as returned by most directions APIs. Points outside
+// latitude ±90 and longitude ±180 are an error.
+func DecodePolyline(encoded string) ([]LatLon, error) {
+	var points []LatLon
+	var lat, lon int
+	for i := 0; i < len(encoded); {
+		var deltas [2]int
+		for d := range deltas {
+			var result, shift int
+			for {
+				if i >= len(encoded) {
+					return nil, fmt.Errorf("truncated polyline")
+				}
+				b := int(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, fmt.Errorf("invalid polyline character")
+				}
+				if shift > 30 {
+					return nil, fmt.Errorf("invalid polyline value")
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[d] = ^(result >> 1)
+			} else {
+				deltas[d] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lon += deltas[1]
+		p := LatLon{Lat: float64(lat) / 1e5, Lon: float64(lon) / 1e5}
+		if math.Abs(p.Lat) > 90 || math.Abs(p.Lon) > 180 {
+			return nil, fmt.Errorf("polyline point %d out of range", len(points))
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// LineStringWKT renders points as an EWKT LINESTRING suitable for ST_GeogFromText.
+func LineStringWKT(points []LatLon) string {
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, fmt.Sprintf("%f %f", p.Lon, p.Lat))
+	}
+	return "SRID=4326;LINESTRING(" + strings.Join(coords, ", ") + ")"
+}
@@ -0,0 +1,30 @@
+package geo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	got, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	want := []LatLon{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodePolyline() = %v, %v, want %v", got, err, want)
+	}
+
+	tests := []struct {
+		name, encoded string
+	}{
+		{"truncated", "_p~iF~ps|U_"},
+		{"invalid character", "_p~iF ps|U"},
+		{"overlong value", "~~~~~~~~~~~~~~?"},
+		{"latitude out of range", "_mljP?"},
+		{"longitude out of range", "?_qvoa@"},
+		{"later point past 90", "_c`|@_c`|@_qxeO?"},
+	}
+	for _, tt := range tests {
+		if points, err := DecodePolyline(tt.encoded); err == nil {
+			t.Errorf("%s: DecodePolyline(%q) = %v, want an error", tt.name, tt.encoded, points)
+		}
+	}
+}
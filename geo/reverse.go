@@ -0,0 +1,164 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"eazyfind/outbound"
+)
+
+const (
+	// ReverseTimeout bounds a reverse geocode; callers are waiting on it, so
+	// failures are not retried.
+	ReverseTimeout = 3 * time.Second
+	// ReverseCacheTTL bounds how long a resolved city is reused.
+	ReverseCacheTTL = 24 * time.Hour
+	// reversePrecision rounds coordinates (~1km) so nearby users share cache entries.
+	reversePrecision = 100.0
+	// MaxReverseInFlight caps concurrent Geoapify calls; requests beyond it
+	// skip the API and fall back immediately.
+	MaxReverseInFlight = 8
+)
+
+var (
+	// ErrCircuitOpen means Geoapify was skipped after repeated failures.
+	ErrCircuitOpen = outbound.ErrCircuitOpen
+	// ErrBusy means too many reverse geocodes were already in flight.
+	ErrBusy = errors.New("geoapify reverse geocoding busy")
+)
+
+// reverseMetrics is published at /debug/vars as geoapify_reverse; the
+// Geoapify circuit itself is reported under outbound.
+var reverseMetrics = expvar.NewMap("geoapify_reverse")
+
+var (
+	reverseClient   = outbound.New(ReverseTimeout, 0)
+	reverseSlots    = make(chan struct{}, MaxReverseInFlight)
+	reverseMu       sync.Mutex
+	reverseCache    = map[string]reverseEntry{}
+	reverseCacheMax = 10000
+)
+
+type reverseEntry struct {
+	address Address
+	expires time.Time
+}
+
+// Address is what reverse geocoding reports for a point. Area is the
+// neighbourhood or suburb, when the provider knows one.
+type Address struct {
+	City      string `json:"city"`
+	Area      string `json:"area"`
+	Formatted string `json:"formatted_address"`
+}
+
+// ReverseCity returns the city Geoapify reports for lat/lon, as Reverse.
+// With DEV_FAKE_PROVIDERS the nearest built-in city centroid is returned
+// instead.
+func ReverseCity(lat, lon float64) (string, error) {
+	a, err := Reverse(lat, lon)
+	return a.City, err
+}
+
+// Reverse returns the address Geoapify reports for lat/lon. Results are
+// cached per rounded coordinate. It fails fast with ErrCircuitOpen while
+// Geoapify is failing and with ErrBusy when too many calls are in flight, so
+// callers can fall back to their own lookup. With DEV_FAKE_PROVIDERS only
+// City is set, to the nearest built-in city.
+func Reverse(lat, lon float64) (Address, error) {
+	if FakeProviders {
+		return Address{City: fakeReverseCity(lat, lon)}, nil
+	}
+	apiKey := os.Getenv("GEOAPIFY_API_KEY")
+	if apiKey == "" {
+		return Address{}, fmt.Errorf("GEOAPIFY_API_KEY not set")
+	}
+	reverseMetrics.Add("requests", 1)
+
+	key := fmt.Sprintf("%.2f,%.2f", float64(int(lat*reversePrecision))/reversePrecision, float64(int(lon*reversePrecision))/reversePrecision)
+	reverseMu.Lock()
+	if e, ok := reverseCache[key]; ok && time.Now().Before(e.expires) {
+		reverseMu.Unlock()
+		reverseMetrics.Add("cache_hits", 1)
+		return e.address, nil
+	}
+	reverseMu.Unlock()
+
+	select {
+	case reverseSlots <- struct{}{}:
+		defer func() { <-reverseSlots }()
+	default:
+		reverseMetrics.Add("busy", 1)
+		return Address{}, ErrBusy
+	}
+
+	address, err := fetchReverse(lat, lon, apiKey)
+	if errors.Is(err, ErrCircuitOpen) {
+		reverseMetrics.Add("circuit_open", 1)
+		return Address{}, err
+	}
+	if err != nil {
+		reverseMetrics.Add("failures", 1)
+		return Address{}, err
+	}
+
+	reverseMu.Lock()
+	if len(reverseCache) >= reverseCacheMax {
+		// Crude bound: start over rather than track recency.
+		reverseCache = map[string]reverseEntry{}
+	}
+	reverseCache[key] = reverseEntry{address: address, expires: time.Now().Add(ReverseCacheTTL)}
+	reverseMu.Unlock()
+	return address, nil
+}
+
+// RecordReverseFallback counts a caller falling back from Geoapify, by reason.
+func RecordReverseFallback(reason string) {
+	reverseMetrics.Add("fallback_"+reason, 1)
+}
+
+func fetchReverse(lat, lon float64, apiKey string) (Address, error) {
+	apiURL := fmt.Sprintf("https://api.geoapify.com/v1/geocode/reverse?lat=%f&lon=%f&apiKey=%s", lat, lon, url.QueryEscape(apiKey))
+	resp, err := reverseClient.Get(apiURL)
+	if err != nil {
+		return Address{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Address{}, fmt.Errorf("reverse geocode API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Features []struct {
+			Properties struct {
+				City          string `json:"city"`
+				Suburb        string `json:"suburb"`
+				Neighbourhood string `json:"neighbourhood"`
+				District      string `json:"district"`
+				Formatted     string `json:"formatted"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Address{}, err
+	}
+	if len(result.Features) == 0 {
+		return Address{}, nil
+	}
+	p := result.Features[0].Properties
+	a := Address{City: p.City, Formatted: p.Formatted}
+	for _, area := range []string{p.Neighbourhood, p.Suburb, p.District} {
+		if area != "" {
+			a.Area = area
+			break
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// Kinds of public submission screened for abuse.
+const (
+	AbuseKindView   = "view"
+	AbuseKindClick  = "click"
+	AbuseKindShare  = "share"
+	AbuseKindAPIKey = "api-key"
+)
+
+// DuplicateWindow is how long identical submissions from one IP are counted
+// as repeats.
+const DuplicateWindow = 10 * time.Minute
+
+// abuseRule sets the per-IP thresholds for a kind of submission; zero
+// disables a check. Held submissions go to quarantine for an admin to
+// release or reject; dropped ones are discarded.
+type abuseRule struct {
+	HoldPerMinute int
+	DropPerMinute int
+	// DuplicateHold is how many identical submissions within DuplicateWindow
+	// are accepted before further ones are held.
+	DuplicateHold int
+}
+
+var abuseRules = map[string]abuseRule{
+	AbuseKindView:   {HoldPerMinute: 30, DropPerMinute: 120, DuplicateHold: 10},
+	AbuseKindClick:  {HoldPerMinute: 10, DropPerMinute: 60, DuplicateHold: 3},
+	AbuseKindShare:  {DropPerMinute: 20},
+	AbuseKindAPIKey: {DropPerMinute: 3},
+}
+
+type abuseVerdict int
+
+const (
+	abuseAllow abuseVerdict = iota
+	abuseHold
+	abuseDrop
+)
+
+var abuseDropped = expvar.NewMap("abuse_dropped")
+
+type abuseWindow struct {
+	start time.Time
+	count int
+}
+
+// maxAbuseWindows bounds each abuseCounter, so a flood of new addresses
+// cannot grow it without limit.
+const maxAbuseWindows = 100000
+
+// abuseCounter counts hits per key in fixed windows of period.
+type abuseCounter struct {
+	period  time.Duration
+	mu      sync.Mutex
+	windows map[string]*abuseWindow
+	swept   time.Time
+}
+
+// hit counts a hit for key and returns the count in its current window. When
+// the counter is full of live windows, a new key cannot be tracked and is
+// reported as over every limit, so it is held or dropped; existing windows are
+// never discarded early, which would reset a flooding client's count.
+func (c *abuseCounter) hit(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	win, ok := c.windows[key]
+	if !ok || now.Sub(win.start) >= c.period {
+		if !ok && len(c.windows) >= maxAbuseWindows {
+			// Sweeping is a full scan, so do it at most once a second.
+			if now.Sub(c.swept) >= time.Second {
+				c.swept = now
+				for k, w := range c.windows {
+					if now.Sub(w.start) >= c.period {
+						delete(c.windows, k)
+					}
+				}
+			}
+			if len(c.windows) >= maxAbuseWindows {
+				return math.MaxInt
+			}
+		}
+		win = &abuseWindow{start: now}
+		c.windows[key] = win
+	}
+	win.count++
+	return win.count
+}
+
+var (
+	abuseVelocity   = &abuseCounter{period: time.Minute, windows: map[string]*abuseWindow{}}
+	abuseDuplicates = &abuseCounter{period: DuplicateWindow, windows: map[string]*abuseWindow{}}
+)
+
+// trustedProxies is read from TRUSTED_PROXIES: the comma-separated addresses
+// or CIDR ranges of the load balancers and proxies in front of the server
+// ("10.0.0.0/8, 192.168.1.5"). Unset means requests arrive directly.
+var trustedProxies = func() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(part)
+			if addrErr != nil {
+				log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q", part)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}()
+
+func trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address of the client behind any trusted proxies. When the
+// connection comes from one of TRUSTED_PROXIES, X-Forwarded-For is read from
+// the right and the first hop that is not itself a trusted proxy is the
+// client; hops further left were written by the client and are ignored.
+// Otherwise X-Forwarded-For is not trusted and the connection's address is
+// used.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	ip = ip.Unmap()
+	if !trustedProxy(ip) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && trustedProxy(ip); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+	}
+	return ip.String()
+}
+
+// screenSubmission applies the kind's per-IP velocity and duplicate-content
+// checks to a submission whose identifying content is content. It returns
+// the verdict and, when not allowed, the reason.
+func screenSubmission(r *http.Request, kind, content string) (abuseVerdict, string) {
+	rule := abuseRules[kind]
+	ip := clientIP(r)
+	n := abuseVelocity.hit(kind + "|" + ip)
+	if rule.DropPerMinute > 0 && n > rule.DropPerMinute {
+		abuseDropped.Add(kind+".velocity", 1)
+		return abuseDrop, "velocity"
+	}
+	if rule.DuplicateHold > 0 && content != "" {
+		sum := sha256.Sum256([]byte(content))
+		if abuseDuplicates.hit(kind+"|"+ip+"|"+hex.EncodeToString(sum[:8])) > rule.DuplicateHold {
+			return abuseHold, "duplicate"
+		}
+	}
+	if rule.HoldPerMinute > 0 && n > rule.HoldPerMinute {
+		return abuseHold, "velocity"
+	}
+	return abuseAllow, ""
+}
+
+// honeypotFilled reports whether a form's hidden honeypot field, which
+// people never see, was filled in. Such submissions are dropped.
+func honeypotFilled(kind, value string) bool {
+	if value == "" {
+		return false
+	}
+	abuseDropped.Add(kind+".honeypot", 1)
+	return true
+}
+
+// allowPublicSubmission screens a form submission that cannot be held for
+// review, writing 400 for a filled honeypot or 429 beyond the velocity limit.
+func allowPublicSubmission(w http.ResponseWriter, r *http.Request, kind, honeypot string) bool {
+	if honeypotFilled(kind, honeypot) {
+		http.Error(w, "Invalid submission", http.StatusBadRequest)
+		return false
+	}
+	if verdict, _ := screenSubmission(r, kind, ""); verdict != abuseAllow {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many submissions", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// quarantineSubmission stores a held submission for admin review in the
+// background; payload is what releasing it needs to apply it.
+func quarantineSubmission(db *sql.DB, r *http.Request, kind, reason string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Quarantine encode error:", err)
+		return
+	}
+	ip, sid := clientIP(r), middleware.GetSessionID(r.Context())
+	go func() {
+		_, err := db.Exec(`
+			INSERT INTO quarantined_submissions (kind, client_ip, session_id, reason, payload)
+			VALUES ($1, $2, $3, $4, $5)`, kind, ip, sid, reason, string(body))
+		if err != nil {
+			log.Println("Quarantine insert error:", err)
+		}
+	}()
+}
+
+// viewPayload and clickPayload are the quarantined forms of a restaurant
+// view and an outbound click.
+type viewPayload struct {
+	RestaurantID string `json:"restaurant_id"`
+}
+
+type clickPayload struct {
+	RestaurantID int64  `json:"restaurant_id,string"`
+	Source       string `json:"source"`
+	Campaign     string `json:"campaign"`
+}
+
+// QuarantineHandler lists submissions held by abuse screening, newest first.
+// Supports ?status=pending (default), released or rejected, ?kind= and ?limit=.
+func QuarantineHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = "pending"
+		}
+		if status != "pending" && status != "released" && status != "rejected" {
+			http.Error(w, "status must be pending, released or rejected", http.StatusBadRequest)
+			return
+		}
+		b := &QueryBuilder{}
+		b.Where(Compare("status", "=", status))
+		if kind := r.URL.Query().Get("kind"); kind != "" {
+			b.Where(Compare("kind", "=", kind))
+		}
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 200
+		}
+
+		rows, err := db.Query(`
+			SELECT id, kind, client_ip, session_id, reason, payload, status, created_at, reviewed_at
+			FROM quarantined_submissions
+			`+b.WhereClause()+`
+			ORDER BY created_at DESC
+			LIMIT `+strconv.Itoa(limit), b.Args()...)
+		if err != nil {
+			writeQuarantineError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		items := []models.QuarantinedSubmission{}
+		for rows.Next() {
+			var q models.QuarantinedSubmission
+			var payload string
+			if err := rows.Scan(&q.ID, &q.Kind, &q.ClientIP, &q.SessionID, &q.Reason, &payload, &q.Status, &q.CreatedAt, &q.ReviewedAt); err == nil {
+				q.Payload = json.RawMessage(payload)
+				items = append(items, q)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+// ReleaseQuarantinedHandler accepts a held submission as genuine and records
+// it as it would have been, with its original time. Clicks released more than
+// three hours later are not counted by the hourly rollup.
+func ReleaseQuarantinedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewQuarantined(db, w, r, "released")
+	}
+}
+
+// RejectQuarantinedHandler discards a held submission.
+func RejectQuarantinedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewQuarantined(db, w, r, "rejected")
+	}
+}
+
+func reviewQuarantined(db *sql.DB, w http.ResponseWriter, r *http.Request, status string) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid submission id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeQuarantineError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var kind, sid, payload string
+	var createdAt time.Time
+	err = tx.QueryRow(`
+		UPDATE quarantined_submissions SET status = $2, reviewed_at = now()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING kind, session_id, payload, created_at
+	`, id, status).Scan(&kind, &sid, &payload, &createdAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pending submission not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeQuarantineError(w, r, err)
+		return
+	}
+	summary := MutationSummary{Updated: 1}
+	if status == "released" {
+		switch kind {
+		case AbuseKindView:
+			var p viewPayload
+			if err = json.Unmarshal([]byte(payload), &p); err == nil && sid != "" {
+				_, err = tx.Exec("INSERT INTO session_activity (session_id, kind, payload, created_at) VALUES ($1, $2, $3, $4)", sid, ActivityView, p.RestaurantID, createdAt)
+				summary.Created = 1
+			}
+		case AbuseKindClick:
+			var p clickPayload
+			if err = json.Unmarshal([]byte(payload), &p); err == nil {
+				_, err = tx.Exec("INSERT INTO outbound_clicks (restaurant_id, source, campaign, session_id, created_at) VALUES ($1, $2, $3, $4, $5)", p.RestaurantID, p.Source, p.Campaign, sid, createdAt)
+				summary.Created = 1
+			}
+		}
+		if err != nil {
+			writeQuarantineError(w, r, err)
+			return
+		}
+	}
+	if writeDryRun(w, r, summary) {
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeQuarantineError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeQuarantineError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Quarantine error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	saved := trustedProxies
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.5/32")}
+	defer func() { trustedProxies = saved }()
+
+	tests := []struct {
+		name, remote string
+		xff          []string
+		want         string
+	}{
+		{"direct", "203.0.113.7:5123", nil, "203.0.113.7"},
+		{"direct ignores forwarded", "203.0.113.7:5123", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops are skipped", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:443", []string{"198.51.100.1, 192.168.1.5", "10.9.9.9"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.1.2.3:443", nil, "10.1.2.3"},
+		{"malformed hop", "10.1.2.3:443", []string{"198.51.100.1, garbage"}, "10.1.2.3"},
+		{"ipv4-mapped proxy", "[::ffff:10.1.2.3]:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"ipv6 client", "10.1.2.3:443", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbuseCounterFull(t *testing.T) {
+	c := &abuseCounter{period: time.Minute, windows: map[string]*abuseWindow{}}
+	for i := 0; i < maxAbuseWindows; i++ {
+		c.hit("ip" + strconv.Itoa(i))
+	}
+	c.hit("ip0")
+	if got := c.hit("ip0"); got != 3 {
+		t.Errorf("existing key count = %d, want 3", got)
+	}
+	if got := c.hit("new"); got <= abuseRules[AbuseKindView].DropPerMinute {
+		t.Errorf("new key on a full counter = %d, want over every limit", got)
+	}
+	if got := c.hit("ip0"); got != 4 {
+		t.Errorf("existing key count after overflow = %d, want 4; windows were reset", got)
+	}
+
+	// Once windows expire they are swept to make room.
+	for k, w := range c.windows {
+		if k != "ip0" {
+			w.start = w.start.Add(-time.Minute)
+		}
+	}
+	c.swept = time.Time{}
+	if got := c.hit("new"); got != 1 {
+		t.Errorf("new key after expiry = %d, want 1", got)
+	}
+	if got := c.hit("ip0"); got != 5 {
+		t.Errorf("live key count after sweep = %d, want 5", got)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// AccountDeletionGrace is how long a deletion request can be cancelled
+// before the account-purge job removes the user's data.
+const AccountDeletionGrace = 30 * 24 * time.Hour
+
+// AccountExportHandler returns everything stored about the signed-in user as
+// one JSON document: recent searches, revealed coupons, vouchers, support
+// impersonation tokens issued for them (without secrets) and any pending
+// deletion.
+func AccountExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.UserID(r)
+		export, err := accountExport(db, userID)
+		if err != nil {
+			writeAccountError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="eazyfind-account.json"`)
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(export)
+	}
+}
+
+func accountExport(db *sql.DB, userID string) (*models.AccountExport, error) {
+	export := &models.AccountExport{UserID: userID, ExportedAt: time.Now().UTC()}
+
+	var d models.AccountDeletion
+	err := db.QueryRow("SELECT requested_at, purge_after, purged_at FROM account_deletions WHERE user_id = $1", userID).
+		Scan(&d.RequestedAt, &d.PurgeAfter, &d.PurgedAt)
+	if err == nil {
+		export.Deletion = &d
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if export.RecentSearches, err = recentSearches(db, "user:"+userID, "", RecentSearchLimit); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT c.restaurant_id, COALESCE(r.restaurant_name, ''), c.code, c.expires_at, cr.revealed_at, cr.redeemed_at
+		FROM coupon_reveals cr
+		JOIN coupons c ON c.id = cr.coupon_id
+		JOIN restaurants r ON r.id = c.restaurant_id
+		WHERE cr.user_id = $1
+		ORDER BY cr.revealed_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.CouponReveals = []models.UserCouponReveal{}
+	for rows.Next() {
+		var c models.UserCouponReveal
+		if err := rows.Scan(&c.RestaurantID, &c.RestaurantName, &c.Code, &c.ExpiresAt, &c.RevealedAt, &c.RedeemedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.CouponReveals = append(export.CouponReveals, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT id, restaurant_id, offer, issued_at, expires_at, redeemed_at
+		FROM vouchers WHERE user_id = $1
+		ORDER BY issued_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Vouchers = []models.Voucher{}
+	for rows.Next() {
+		var v models.Voucher
+		if err := rows.Scan(&v.ID, &v.RestaurantID, &v.Offer, &v.IssuedAt, &v.ExpiresAt, &v.RedeemedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Vouchers = append(export.Vouchers, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT id, user_id, scope, reason, created_by, created_at, expires_at, revoked_at
+		FROM impersonation_tokens WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	export.ImpersonationTokens = []models.ImpersonationToken{}
+	for rows.Next() {
+		var t models.ImpersonationToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Scope, &t.Reason, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt); err != nil {
+			return nil, err
+		}
+		export.ImpersonationTokens = append(export.ImpersonationTokens, t)
+	}
+	return export, rows.Err()
+}
+
+// DeleteAccountHandler schedules the signed-in user's data for deletion
+// after AccountDeletionGrace and returns the pending deletion. Asking again
+// keeps a pending schedule; after a purge it schedules a new one, so data
+// created since is deleted too. Support cannot delete an account while
+// impersonating its user.
+func DeleteAccountHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.GetImpersonation(r.Context()) != nil {
+			http.Error(w, "Accounts cannot be deleted while impersonating", http.StatusForbidden)
+			return
+		}
+		var d models.AccountDeletion
+		err := db.QueryRow(`
+			INSERT INTO account_deletions (user_id, purge_after)
+			VALUES ($1, now() + $2 * interval '1 second')
+			ON CONFLICT (user_id) DO UPDATE SET
+				requested_at = CASE WHEN account_deletions.purged_at IS NULL THEN account_deletions.requested_at ELSE now() END,
+				purge_after = CASE WHEN account_deletions.purged_at IS NULL THEN account_deletions.purge_after ELSE EXCLUDED.purge_after END,
+				purged_at = NULL
+			RETURNING requested_at, purge_after, purged_at
+		`, middleware.UserID(r), int(AccountDeletionGrace.Seconds())).Scan(&d.RequestedAt, &d.PurgeAfter, &d.PurgedAt)
+		if err != nil {
+			writeAccountError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// RestoreAccountHandler cancels the signed-in user's pending deletion. It
+// returns 404 when none is pending and 410 once the data has been purged.
+func RestoreAccountHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.GetImpersonation(r.Context()) != nil {
+			http.Error(w, "Accounts cannot be restored while impersonating", http.StatusForbidden)
+			return
+		}
+		userID := middleware.UserID(r)
+		res, err := db.Exec("DELETE FROM account_deletions WHERE user_id = $1 AND purged_at IS NULL", userID)
+		if err != nil {
+			writeAccountError(w, r, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var purged bool
+			err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM account_deletions WHERE user_id = $1)", userID).Scan(&purged)
+			if err != nil {
+				writeAccountError(w, r, err)
+				return
+			}
+			if purged {
+				http.Error(w, "Account data has already been deleted", http.StatusGone)
+				return
+			}
+			http.Error(w, "No deletion pending", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeAccountError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Account data error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
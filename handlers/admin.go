@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/database"
+	"eazyfind/models"
+	"eazyfind/outbound"
+	"eazyfind/outbox"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+	"eazyfind/worker"
+)
+
+// AdminOverviewHandler aggregates operational counters for the internal dashboard:
+// geocoding status across restaurants and cities, duplicate flags, and worker health.
+func AdminOverviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		restaurantGeo, err := countByGeoStatus(db, "restaurants")
+		if err != nil {
+			log.Println("Admin overview query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		cityGeo, err := countByGeoStatus(db, "cities")
+		if err != nil {
+			log.Println("Admin overview query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		var total, duplicates int
+		err = db.QueryRow("SELECT COUNT(*), COUNT(*) FILTER (WHERE is_duplicate) FROM restaurants").Scan(&total, &duplicates)
+		if err != nil {
+			log.Println("Admin overview query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		pending, failed, err := outbox.Counts(db)
+		if err != nil {
+			log.Println("Admin overview query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"restaurants": map[string]interface{}{
+				"total":      total,
+				"duplicates": duplicates,
+				"geo_status": restaurantGeo,
+			},
+			"cities": map[string]interface{}{
+				"geo_status": cityGeo,
+			},
+			"failed_geocodes": restaurantGeo["FAILED"] + cityGeo["FAILED"],
+			"worker":          worker.GetHealth(),
+			"enrichment":      worker.GetEnrichmentHealth(),
+			"throttle":        worker.GetThrottleState(),
+			"schedules":       scheduler.States(),
+			"outbound":        outbound.States(),
+			"outbox":          map[string]int{"pending": pending, "failed": failed},
+		})
+	}
+}
+
+// IndexesHandler reports whether each index search depends on exists and is
+// usable, with missing counting every index not "ok".
+func IndexesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		indexes, err := database.CheckIndexes(db)
+		if err != nil {
+			log.Println("Index check error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		missing := 0
+		for _, idx := range indexes {
+			if idx.Status != "ok" {
+				missing++
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"indexes": indexes, "missing": missing})
+	}
+}
+
+// countByGeoStatus groups a geocoded table by geo_status. table is always a
+// compile-time constant supplied by the caller.
+func countByGeoStatus(db *sql.DB, table string) (map[string]int, error) {
+	rows, err := db.Query("SELECT COALESCE(geo_status, 'PENDING'), COUNT(*) FROM " + table + " GROUP BY 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// SetCityPublishedHandler shows or hides a city on public endpoints.
+// Expects {"published": true|false}, with an optional "version" (or If-Match)
+// that makes the edit fail with 409 if the city changed since.
+func SetCityPublishedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid city id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Published *bool  `json:"published"`
+			Version   string `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Published == nil {
+			http.Error(w, "published is required", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+
+		res, err := adminExec(db, r, cityChanged(id), "UPDATE cities SET is_published = $1 WHERE id = $2 AND "+versionMatches("cities", "$3"), *body.Published, id, version)
+		if err != nil {
+			log.Println("City publish update error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			writeNotFoundOrConflict(db, w, r, "cities", id, "City not found")
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Updated: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeadLinksHandler lists image and partner URLs that failed the link checker,
+// most persistent failures first. Supports ?field=image_url|url and ?limit=.
+func DeadLinksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := &QueryBuilder{}
+		if field := r.URL.Query().Get("field"); field != "" {
+			if field != "image_url" && field != "url" {
+				http.Error(w, "field must be image_url or url", http.StatusBadRequest)
+				return
+			}
+			b.Where(Compare("d.field", "=", field))
+		}
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 200
+		}
+
+		rows, err := db.Query(`
+			SELECT d.restaurant_id, COALESCE(r.restaurant_name, ''), d.field, d.url, COALESCE(d.status_code, 0), COALESCE(d.error, ''),
+			       d.failures, d.first_failed_at, d.last_checked_at
+			FROM dead_links d JOIN restaurants r ON r.id = d.restaurant_id
+			`+b.WhereClause()+`
+			ORDER BY d.failures DESC, d.first_failed_at ASC
+			LIMIT `+strconv.Itoa(limit), b.Args()...)
+		if err != nil {
+			log.Println("Dead links query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		links := []models.DeadLink{}
+		for rows.Next() {
+			var l models.DeadLink
+			if err := rows.Scan(&l.RestaurantID, &l.RestaurantName, &l.Field, &l.URL, &l.StatusCode, &l.Error, &l.Failures, &l.FirstFailedAt, &l.LastCheckedAt); err == nil {
+				links = append(links, l)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(links)
+	}
+}
+
+// DefaultLowConfidenceBelow is the geo_confidence threshold used by
+// LowConfidenceGeocodesHandler when ?below= is not given.
+const DefaultLowConfidenceBelow = 0.6
+
+// LowConfidenceGeocodesHandler lists geocoded restaurants whose pins may be
+// imprecise, least confident first. Supports ?below= (default 0.6), ?city=
+// and ?limit=.
+func LowConfidenceGeocodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		below := DefaultLowConfidenceBelow
+		if v := r.URL.Query().Get("below"); v != "" {
+			f, err := parseFinite(v)
+			if err != nil || f <= 0 || f > 1 {
+				http.Error(w, "below must be a number between 0 and 1", http.StatusBadRequest)
+				return
+			}
+			below = f
+		}
+		b := &QueryBuilder{}
+		b.Where(Raw("r.geo_status = 'RESOLVED'"), Raw("r.is_duplicate = false"), Compare("r.geo_confidence", "<", below))
+		if city := r.URL.Query().Get("city"); city != "" {
+			b.Where(FoldedILike(city, "r.city_norm"))
+		}
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 200
+		}
+
+		rows, err := db.Query(`
+			SELECT r.id, r.restaurant_name, r.city, COALESCE(r.area, ''), COALESCE(r.address_line, ''),
+			       r.latitude, r.longitude, COALESCE(r.geo_location_type, ''), COALESCE(r.geo_partial_match, false), r.geo_confidence
+			FROM restaurants r
+			`+b.WhereClause()+`
+			ORDER BY r.geo_confidence ASC, r.id
+			LIMIT `+strconv.Itoa(limit), b.Args()...)
+		if err != nil {
+			log.Println("Low confidence geocodes query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		geocodes := []models.LowConfidenceGeocode{}
+		for rows.Next() {
+			var g models.LowConfidenceGeocode
+			if err := rows.Scan(&g.RestaurantID, &g.RestaurantName, &g.City, &g.Area, &g.AddressLine,
+				&g.Latitude, &g.Longitude, &g.LocationType, &g.PartialMatch, &g.Confidence); err == nil {
+				geocodes = append(geocodes, g)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geocodes)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// adminStatuses are the data issues admin search reports per restaurant and
+// counts in its facets. A restaurant can have several; "ok" means none.
+var adminStatuses = []struct {
+	name string
+	cond string
+}{
+	{"duplicate", "COALESCE(r.is_duplicate, false)"},
+	{"unpublished", "NOT EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"},
+	{"ungeocoded", "COALESCE(r.geo_status, 'PENDING') <> 'RESOLVED'"},
+	{"low_quality", fmt.Sprintf(`(COALESCE(r.restaurant_name, '') = '' OR COALESCE(r.cost_for_two, 0) <= 0 OR COALESCE(r.geo_confidence, 1) < %g
+		OR NOT EXISTS (SELECT 1 FROM restaurant_cuisines rc WHERE rc.restaurant_id = r.id))`, DefaultLowConfidenceBelow)},
+}
+
+// AdminSearchHandler runs the public search over every restaurant, including
+// duplicates, unpublished cities, rows that never geocoded and low-quality
+// rows, so back-office tools can triage them. It accepts the search
+// parameters plus ?status=duplicate,unpublished,ungeocoded,low_quality,ok
+// (any of), and returns each restaurant's statuses with facet counts per
+// status over the matches before the status filter.
+func AdminSearchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var statuses []string
+		for _, s := range splitList(strings.ToLower(query.Get("status")), true) {
+			if s == "" {
+				continue
+			}
+			if s != "ok" && adminStatusCondition(s) == "" {
+				http.Error(w, "status must be duplicate, unpublished, ungeocoded, low_quality or ok", http.StatusBadRequest)
+				return
+			}
+			statuses = append(statuses, s)
+		}
+		query.Del("status")
+
+		normalized, unknown := NormalizeQuery(query)
+		reportUnknownParams(w, unknown)
+		warnings := ValidateSearchQuery(normalized, unknown)
+		if normalized.Get("strict") == "true" && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
+		p := ParseSearchParams(query)
+		p.Include, _ = ParseInclude(normalized, relatedFields)
+		p.Fields = nil
+		p.IncludeUnpublished = true
+		p.IncludeDuplicates = true
+		PrepareSearch(db, &p)
+		warnings = append(warnings, unresolvedWarnings(p.Unresolved)...)
+
+		b := &QueryBuilder{}
+		distanceExpr, preds := SearchPredicates(b, p)
+		b.Where(preds...)
+
+		facets, err := adminSearchFacets(db, b.WhereClause(), b.Args())
+		if err != nil {
+			writeAdminSearchError(w, r, err)
+			return
+		}
+
+		if len(statuses) > 0 {
+			b.Where(func(*QueryBuilder) string {
+				conds := make([]string, 0, len(statuses))
+				for _, s := range statuses {
+					if s == "ok" {
+						conds = append(conds, "NOT ("+adminAnyStatus()+")")
+					} else {
+						conds = append(conds, adminStatusCondition(s))
+					}
+				}
+				return "(" + strings.Join(conds, " OR ") + ")"
+			})
+		}
+		where := b.WhereClause()
+
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*) FROM restaurants r "+where, b.Args()...).Scan(&total); err != nil {
+			writeAdminSearchError(w, r, err)
+			return
+		}
+
+		cols := SelectColumns(nil, p.Include, true)
+		flags := make([]string, 0, len(adminStatuses)+1)
+		for _, s := range adminStatuses {
+			flags = append(flags, s.cond)
+		}
+		flags = append(flags, versionOf("r")+"::text")
+		rows, err := db.Query(fmt.Sprintf("SELECT %s, %s FROM restaurants r %s %s LIMIT %d OFFSET %d",
+			selectList(cols, distanceExpr), strings.Join(flags, ", "), where, OrderByClause(p.Sort), p.Limit, p.Offset), b.Args()...)
+		if err != nil {
+			writeAdminSearchError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		results := []models.AdminRestaurant{}
+		for rows.Next() {
+			set := make([]bool, len(adminStatuses))
+			dest := make([]interface{}, len(set), len(set)+1)
+			for i := range set {
+				dest[i] = &set[i]
+			}
+			var version string
+			res, err := ScanRestaurant(rows, cols, append(dest, &version)...)
+			if err != nil {
+				log.Println("Admin search scan error:", err)
+				continue
+			}
+			res.Version = version
+			item := models.AdminRestaurant{Restaurant: res, Statuses: []string{}}
+			for i, s := range adminStatuses {
+				if set[i] {
+					item.Statuses = append(item.Statuses, s.name)
+				}
+			}
+			if len(item.Statuses) == 0 {
+				item.Statuses = append(item.Statuses, "ok")
+			}
+			results = append(results, item)
+		}
+
+		resp := map[string]interface{}{
+			"restaurants":     results,
+			"pages":           int(math.Ceil(float64(total) / float64(p.Limit))),
+			"total_count":     total,
+			"facets":          facets,
+			"applied_filters": DescribeSearch(db, p),
+		}
+		if len(p.Unresolved) > 0 {
+			resp["unresolved_filters"] = p.Unresolved
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// adminSearchFacets counts the restaurants matching where, overall and per
+// status.
+func adminSearchFacets(db *sql.DB, where string, args []interface{}) (map[string]int, error) {
+	counts := make([]string, 0, len(adminStatuses)+2)
+	counts = append(counts, "COUNT(*)", fmt.Sprintf("COUNT(*) FILTER (WHERE NOT (%s))", adminAnyStatus()))
+	for _, s := range adminStatuses {
+		counts = append(counts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", s.cond))
+	}
+	values := make([]int, len(counts))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := db.QueryRow("SELECT "+strings.Join(counts, ", ")+" FROM restaurants r "+where, args...).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	facets := map[string]int{"total": values[0], "ok": values[1]}
+	for i, s := range adminStatuses {
+		facets[s.name] = values[i+2]
+	}
+	return facets, nil
+}
+
+func adminStatusCondition(name string) string {
+	for _, s := range adminStatuses {
+		if s.name == name {
+			return s.cond
+		}
+	}
+	return ""
+}
+
+// adminAnyStatus matches restaurants with at least one status.
+func adminAnyStatus() string {
+	conds := make([]string, 0, len(adminStatuses))
+	for _, s := range adminStatuses {
+		conds = append(conds, s.cond)
+	}
+	return strings.Join(conds, " OR ")
+}
+
+func writeAdminSearchError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Admin search error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
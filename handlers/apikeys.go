@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/outbox"
+	"eazyfind/sanitize"
+	"eazyfind/tracker"
+
+	"github.com/lib/pq"
+)
+
+// usageHistoryDays is how many days of usage GET /api/keys/{id}/usage reports.
+const usageHistoryDays = 30
+
+// CreateAPIKeyHandler issues a new API key in PENDING state; it only starts
+// working once an admin approves it. The plaintext key is returned exactly once.
+// Expects {"name": "...", "email": "..."}.
+func CreateAPIKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			// Website is a honeypot: the signup form hides it from people.
+			Website string `json:"website"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if !allowPublicSubmission(w, r, AbuseKindAPIKey, body.Website) {
+			return
+		}
+		body.Name = sanitize.Line(body.Name, 100)
+		if body.Name == "" {
+			http.Error(w, "name is required (max 100 characters)", http.StatusBadRequest)
+			return
+		}
+		if _, err := mail.ParseAddress(body.Email); err != nil {
+			http.Error(w, "A valid email is required", http.StatusBadRequest)
+			return
+		}
+
+		raw := make([]byte, 24)
+		rand.Read(raw)
+		key := "ef_" + hex.EncodeToString(raw)
+
+		k := models.APIKey{Name: body.Name, OwnerEmail: body.Email, Key: key}
+		err := db.QueryRow(`
+			INSERT INTO api_keys (name, owner_email, key_hash) VALUES ($1, $2, $3)
+			RETURNING id, status, rate_limit_per_minute, daily_quota, created_at
+		`, body.Name, body.Email, middleware.HashAPIKey(key)).Scan(&k.ID, &k.Status, &k.RateLimitPerMinute, &k.DailyQuota, &k.CreatedAt)
+		if err != nil {
+			log.Println("API key insert error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(k)
+	}
+}
+
+// ListAPIKeysHandler lists all keys (without secrets) for admin review.
+func ListAPIKeysHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query("SELECT id, name, owner_email, status, rate_limit_per_minute, daily_quota, restaurant_ids, created_at, approved_at FROM api_keys ORDER BY id DESC")
+		if err != nil {
+			log.Println("API keys query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		keys := []models.APIKey{}
+		for rows.Next() {
+			var k models.APIKey
+			if err := rows.Scan(&k.ID, &k.Name, &k.OwnerEmail, &k.Status, &k.RateLimitPerMinute, &k.DailyQuota, (*pq.Int64Array)(&k.RestaurantIDs), &k.CreatedAt, &k.ApprovedAt); err == nil {
+				keys = append(keys, k)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// ApproveAPIKeyHandler activates a key, optionally overriding its limits,
+// assigning it to a tenant and binding it to the restaurants it may redeem
+// vouchers for with {"rate_limit_per_minute": 120, "daily_quota": 10000,
+// "tenant": "acme", "restaurant_ids": ["12"]}.
+func ApproveAPIKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RateLimitPerMinute int           `json:"rate_limit_per_minute"`
+			DailyQuota         int           `json:"daily_quota"`
+			Tenant             string        `json:"tenant"`
+			RestaurantIDs      []json.Number `json:"restaurant_ids"`
+		}
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		var restaurantIDs []int64
+		if body.RestaurantIDs != nil {
+			restaurantIDs = []int64{}
+		}
+		for _, raw := range body.RestaurantIDs {
+			id, err := raw.Int64()
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid restaurant id "+raw.String(), http.StatusBadRequest)
+				return
+			}
+			restaurantIDs = append(restaurantIDs, id)
+		}
+		setAPIKeyStatus(db, w, r, `
+			UPDATE api_keys SET status = 'APPROVED', approved_at = now(),
+			       rate_limit_per_minute = COALESCE(NULLIF($2, 0), rate_limit_per_minute),
+			       daily_quota = COALESCE(NULLIF($3, 0), daily_quota),
+			       tenant_id = COALESCE((SELECT id FROM tenants WHERE slug = NULLIF($4, '')), tenant_id),
+			       restaurant_ids = COALESCE($5::bigint[], restaurant_ids)
+			WHERE id = $1
+		`, body.RateLimitPerMinute, body.DailyQuota, body.Tenant, pq.Array(restaurantIDs))
+	}
+}
+
+// RevokeAPIKeyHandler permanently disables a key.
+func RevokeAPIKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setAPIKeyStatus(db, w, r, "UPDATE api_keys SET status = 'REVOKED' WHERE id = $1")
+	}
+}
+
+func setAPIKeyStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, query string, extra ...interface{}) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid key id", http.StatusBadRequest)
+		return
+	}
+
+	msg := outbox.Message{Topic: outbox.TopicAPIKeyChanged, Payload: map[string]interface{}{"id": id}}
+	res, err := adminExec(db, r, msg, query, append([]interface{}{id}, extra...)...)
+	if err != nil {
+		log.Println("API key update error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if writeDryRun(w, r, MutationSummary{Updated: n}) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIKeyUsageHandler reports a key's limits and daily request counts. It is
+// available to the key itself (via X-API-Key) and to admins.
+func APIKeyUsageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid key id", http.StatusBadRequest)
+			return
+		}
+		if k := middleware.GetAPIKey(r.Context()); !middleware.IsAdmin(r) && (k == nil || k.ID != id) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var k models.APIKey
+		err = db.QueryRow("SELECT id, name, status, rate_limit_per_minute, daily_quota FROM api_keys WHERE id = $1", id).
+			Scan(&k.ID, &k.Name, &k.Status, &k.RateLimitPerMinute, &k.DailyQuota)
+		if err == sql.ErrNoRows {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("API key query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT to_char(day, 'YYYY-MM-DD'), requests, day = CURRENT_DATE FROM api_key_usage
+			WHERE api_key_id = $1 AND day > CURRENT_DATE - $2::int
+			ORDER BY day DESC
+		`, id, usageHistoryDays)
+		if err != nil {
+			log.Println("API key usage query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		// A key with no calls yet today has no row for today; its latest row
+		// is an earlier day's.
+		usage := []models.APIKeyUsage{}
+		today := 0
+		for rows.Next() {
+			var u models.APIKeyUsage
+			var isToday bool
+			if err := rows.Scan(&u.Day, &u.Requests, &isToday); err == nil {
+				usage = append(usage, u)
+				if isToday {
+					today = u.Requests
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":             k,
+			"today":           today,
+			"quota_remaining": max(k.DailyQuota-today, 0),
+			"usage":           usage,
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"time"
+)
+
+// AppliedFilters echoes how the server interpreted a search request.
+type AppliedFilters struct {
+	Name      string         `json:"name,omitempty"`
+	City      string         `json:"city,omitempty"`
+	CitySlug  string         `json:"city_slug,omitempty"`
+	Area      string         `json:"area,omitempty"`
+	Tag       string         `json:"tag,omitempty"`
+	Brand     string         `json:"brand,omitempty"`
+	Cuisines  []TaxonomyItem `json:"cuisines,omitempty"`
+	MealTypes []TaxonomyItem `json:"meal_types,omitempty"`
+	MinCost   int            `json:"min_cost,omitempty"`
+	MaxCost   int            `json:"max_cost,omitempty"`
+	Rating    float64        `json:"rating,omitempty"`
+	Discount  float64        `json:"discount,omitempty"`
+	Free      bool           `json:"free,omitempty"`
+	QuietNow  bool           `json:"quiet_now,omitempty"`
+	HappyHour bool           `json:"happy_hour,omitempty"`
+	Location  *AppliedArea   `json:"location,omitempty"`
+	// DeliversTo is the address results must deliver to, as [lat, lon].
+	DeliversTo []float64 `json:"delivers_to,omitempty"`
+	// ActiveAt is the time offers were checked against, when not now.
+	ActiveAt string `json:"active_at,omitempty"`
+	// PaymentMethods are the payment_method values offers were matched against.
+	PaymentMethods []string `json:"payment_methods,omitempty"`
+	// Diverse is set when the page was reranked for variety.
+	Diverse bool `json:"diverse,omitempty"`
+
+	Sort  string `json:"sort"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+// AppliedArea describes the spatial constraint in effect, if any.
+type AppliedArea struct {
+	Mode   string  `json:"mode"`
+	Lat    float64 `json:"lat,omitempty"`
+	Lon    float64 `json:"lon,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+	// RequestedRadius is the client's radius when a sparse search was widened
+	// to Radius.
+	RequestedRadius float64 `json:"requested_radius,omitempty"`
+	WithinMinutes   int     `json:"within_minutes,omitempty"`
+	Travel          string  `json:"travel_mode,omitempty"`
+	Points          int     `json:"points,omitempty"`
+	RouteVertices   int     `json:"route_vertices,omitempty"`
+	// RadiusSource is "request", "city" or "default"; DistanceCap is the
+	// sort's proximity limit, when there is one.
+	RadiusSource string  `json:"radius_source,omitempty"`
+	DistanceCap  float64 `json:"distance_cap,omitempty"`
+}
+
+// DescribeSearch builds the applied_filters payload for already-prepared params.
+func DescribeSearch(db *sql.DB, p SearchParams) AppliedFilters {
+	f := AppliedFilters{
+		Name:      p.Name,
+		Area:      p.Area,
+		Tag:       p.Tag,
+		Brand:     p.Brand,
+		MinCost:   p.MinCost,
+		MaxCost:   p.MaxCost,
+		Rating:    p.Rating,
+		Discount:  math.Round(p.Discount * 100),
+		Free:      p.Free,
+		QuietNow:  p.QuietNow,
+		HappyHour: p.HappyHour,
+		Sort:      p.Sort,
+		Page:      p.Page,
+		Limit:     p.Limit,
+	}
+	f.PaymentMethods = p.PaymentMethods
+	f.Diverse = p.Diverse && p.Limit <= MaxDiverseLimit
+	if _, ok := sortOrders[f.Sort]; !ok {
+		f.Sort = "discount"
+	}
+
+	if p.City != "" {
+		f.City = p.City
+		if c, ok := ResolveCity(db, p.City); ok {
+			f.City, f.CitySlug = c.Name, c.Slug
+		}
+	}
+
+	f.Cuisines = append(f.Cuisines, p.ResolvedCuisines...)
+	f.MealTypes = append(f.MealTypes, p.ResolvedMealTypes...)
+
+	// ID filters are echoed as-is; names are only known for the text filters.
+	for _, id := range splitList(p.CuisineIds, true) {
+		if id != "" {
+			n, _ := strconv.ParseInt(id, 10, 64)
+			f.Cuisines = append(f.Cuisines, TaxonomyItem{ID: n})
+		}
+	}
+	for _, id := range splitList(p.MealTypeIds, true) {
+		if id != "" {
+			n, _ := strconv.ParseInt(id, 10, 64)
+			f.MealTypes = append(f.MealTypes, TaxonomyItem{ID: n})
+		}
+	}
+
+	switch {
+	case len(p.Points) > 0:
+		f.Location = &AppliedArea{Mode: "points", Points: len(p.Points)}
+		if p.City == "" {
+			f.Location.Radius, f.Location.RadiusSource = p.Radius, p.RadiusSource
+		}
+	case p.Isoline != "":
+		f.Location = &AppliedArea{Mode: "isoline", Lat: p.Lat, Lon: p.Lon, WithinMinutes: p.WithinMinutes, Travel: p.Mode}
+	case p.HasLocation:
+		f.Location = &AppliedArea{Mode: "radius", Lat: p.Lat, Lon: p.Lon}
+		if p.City == "" {
+			f.Location.Radius, f.Location.RequestedRadius = p.Radius, p.RequestedRadius
+			f.Location.RadiusSource = p.RadiusSource
+		}
+		// The sort's distance cap applies on top (see SearchPredicates).
+		f.Location.DistanceCap = p.DistanceCap
+		if p.DistanceCap > 0 && (f.Location.Radius == 0 || f.Location.Radius > p.DistanceCap) {
+			f.Location.Radius = p.DistanceCap
+		}
+	}
+	if p.ActiveAtLocal {
+		f.ActiveAt = p.ActiveAt.Format(localWallTime)
+	} else if !p.ActiveAt.IsZero() {
+		f.ActiveAt = p.ActiveAt.Format(time.RFC3339)
+	}
+	if p.DeliversTo != nil {
+		f.DeliversTo = []float64{p.DeliversTo.Lat, p.DeliversTo.Lon}
+	}
+	if len(p.Route) > 0 {
+		if f.Location == nil {
+			f.Location = &AppliedArea{Mode: "route"}
+		}
+		f.Location.RouteVertices = len(p.Route)
+		f.Location.Radius = p.RouteBuffer
+	}
+	return f
+}
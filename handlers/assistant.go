@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	// AssistantTopN is the number of restaurants summarized per answer.
+	AssistantTopN = 3
+	// MaxUtteranceLength bounds the free-form text accepted by the assistant.
+	MaxUtteranceLength = 500
+	// VocabularyCacheTTL controls how often city/cuisine/meal-type names are reloaded.
+	VocabularyCacheTTL = 10 * time.Minute
+)
+
+var (
+	ratingPattern   = regexp.MustCompile(`(?:rated|rating)\s*(?:above|over|at least)?\s*(\d(?:\.\d)?)|(\d(?:\.\d)?)\s*(?:\+|plus)?\s*(?:stars?|rating)`)
+	discountPattern = regexp.MustCompile(`(\d{1,2})\s*(?:%|percent)`)
+	maxCostPattern  = regexp.MustCompile(`(?:under|below|less than|within|up ?to|max(?:imum)?|cheaper than)\s*(?:rs\.?|₹|inr)?\s*(\d{2,5})`)
+	minCostPattern  = regexp.MustCompile(`(?:above|over|more than|at least|min(?:imum)?)\s*(?:rs\.?|₹|inr)?\s*(\d{3,5})`)
+	resetPattern    = regexp.MustCompile(`\b(?:start over|reset|new search|forget that)\b`)
+)
+
+// sortPhrases maps conversational ordering cues to whitelisted sort keys.
+var sortPhrases = []struct {
+	pattern *regexp.Regexp
+	sort    string
+}{
+	{regexp.MustCompile(`\b(?:cheapest|cheap|budget|affordable)\b`), "cost_asc"},
+	{regexp.MustCompile(`\b(?:top|best|highest)[ -]rated\b`), "rating_desc"},
+	{regexp.MustCompile(`\b(?:best deals?|biggest discounts?|most off)\b`), "discount"},
+	{regexp.MustCompile(`\b(?:nearest|closest|near me|nearby)\b`), "distance_asc"},
+}
+
+// vocabulary holds the known filter values an utterance is matched against.
+type vocabulary struct {
+	mu        sync.RWMutex
+	cities    []string
+	cuisines  []string
+	mealTypes []string
+	loaded    time.Time
+}
+
+var assistantVocab vocabulary
+
+func (v *vocabulary) get(db *sql.DB) (cities, cuisines, mealTypes []string) {
+	v.mu.RLock()
+	fresh := v.loaded.After(time.Now().Add(-VocabularyCacheTTL))
+	v.mu.RUnlock()
+	if !fresh {
+		cities, _ := loadNames(db, "SELECT city_name FROM cities")
+		cuisines, _ := loadNames(db, "SELECT cuisine_name FROM cuisines")
+		mealTypes, _ := loadNames(db, "SELECT meal_type FROM meal_types")
+		v.mu.Lock()
+		v.cities, v.cuisines, v.mealTypes, v.loaded = cities, cuisines, mealTypes, time.Now()
+		v.mu.Unlock()
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.cities, v.cuisines, v.mealTypes
+}
+
+func loadNames(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err == nil && n != "" {
+			names = append(names, n)
+		}
+	}
+	// Longest names first so "north indian" wins over "indian".
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	return names, rows.Err()
+}
+
+// containsPhrase reports whether phrase occurs in text on word boundaries,
+// treating hyphens in slugs (e.g. "delhi-ncr") as spaces.
+func containsPhrase(text, phrase string) bool {
+	phrase = strings.ToLower(strings.ReplaceAll(phrase, "-", " "))
+	for i := strings.Index(text, phrase); i >= 0; {
+		end := i + len(phrase)
+		before := i == 0 || !isWordByte(text[i-1])
+		after := end == len(text) || !isWordByte(text[end])
+		if before && after {
+			return true
+		}
+		next := strings.Index(text[i+1:], phrase)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+// ParseUtterance maps free-form text onto search query parameters, layered over
+// the filters carried from the previous conversational turn.
+func ParseUtterance(db *sql.DB, utterance string, state map[string]string) url.Values {
+	text := strings.ToLower(strings.Join(strings.Fields(utterance), " "))
+	text = strings.ReplaceAll(text, ",", "")
+
+	filters := url.Values{}
+	if !resetPattern.MatchString(text) {
+		for k, v := range state {
+			filters.Set(k, v)
+		}
+		filters, _ = NormalizeQuery(filters)
+	}
+
+	if m := ratingPattern.FindStringSubmatch(text); m != nil {
+		filters.Set("rating", m[1]+m[2])
+		text = strings.Replace(text, m[0], " ", 1)
+	}
+	if m := discountPattern.FindStringSubmatch(text); m != nil {
+		filters.Set("discount", m[1])
+		text = strings.Replace(text, m[0], " ", 1)
+	}
+	if m := maxCostPattern.FindStringSubmatch(text); m != nil {
+		filters.Set("max_cost", m[1])
+	}
+	if m := minCostPattern.FindStringSubmatch(text); m != nil {
+		filters.Set("min_cost", m[1])
+	}
+	if containsPhrase(text, "free") {
+		filters.Set("free", "true")
+	}
+	for _, sp := range sortPhrases {
+		if sp.pattern.MatchString(text) {
+			filters.Set("sort", sp.sort)
+			break
+		}
+	}
+
+	cities, cuisines, mealTypes := assistantVocab.get(db)
+	for _, c := range cities {
+		if containsPhrase(text, c) {
+			filters.Set("city", c)
+			break
+		}
+	}
+
+	var matchedCuisines []string
+	for _, c := range cuisines {
+		if containsPhrase(text, c) {
+			matchedCuisines = append(matchedCuisines, c)
+			text = strings.ReplaceAll(text, strings.ToLower(c), " ")
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		if canonical, ok := synonyms.lookup(db, word); ok {
+			matchedCuisines = append(matchedCuisines, canonical)
+		}
+	}
+	if len(matchedCuisines) > 0 {
+		filters.Set("cuisines", strings.Join(matchedCuisines, ","))
+	}
+
+	var matchedMeals []string
+	for _, m := range mealTypes {
+		if containsPhrase(text, m) {
+			matchedMeals = append(matchedMeals, m)
+		}
+	}
+	if len(matchedMeals) > 0 {
+		filters.Set("meal_types", strings.Join(matchedMeals, ","))
+	}
+
+	return filters
+}
+
+// AssistantPick is a single recommended restaurant with short, speakable reasons.
+type AssistantPick struct {
+	ID             int64    `json:"id,string"`
+	RestaurantName string   `json:"restaurant_name"`
+	Area           string   `json:"area,omitempty"`
+	City           string   `json:"city"`
+	Reasons        []string `json:"reasons"`
+}
+
+// pickReasons explains why a restaurant was surfaced, in priority order.
+func pickReasons(r models.Restaurant) []string {
+	reasons := []string{}
+	if r.EffectiveDiscount > 0 {
+		reasons = append(reasons, fmt.Sprintf("%.0f%% off", r.EffectiveDiscount*100))
+	} else if r.Offer != "" {
+		reasons = append(reasons, r.Offer)
+	}
+	if r.Rating > 0 {
+		reasons = append(reasons, fmt.Sprintf("rated %.1f", r.Rating))
+	}
+	if r.CostForTwo > 0 {
+		reasons = append(reasons, fmt.Sprintf("₹%d for two", r.CostForTwo))
+	}
+	if r.Distance > 0 {
+		reasons = append(reasons, fmt.Sprintf("%.1f km away", r.Distance/1000))
+	}
+	if r.Free {
+		reasons = append(reasons, "includes a free item")
+	}
+	return reasons
+}
+
+// summarize renders a one-sentence answer suitable for voice output.
+func summarize(total int, picks []AssistantPick, filters url.Values) string {
+	if total == 0 || len(picks) == 0 {
+		return "I couldn't find any restaurants matching that. Try widening the budget or dropping a filter."
+	}
+	where := ""
+	if city := filters.Get("city"); city != "" {
+		where = " in " + city
+	}
+	top := picks[0]
+	answer := fmt.Sprintf("I found %d places%s. Top pick: %s", total, where, top.RestaurantName)
+	if len(top.Reasons) > 0 {
+		answer += " (" + strings.Join(top.Reasons, ", ") + ")"
+	}
+	return answer + "."
+}
+
+// AssistantSearchHandler is a conversational front door to the search core.
+// Expects {"utterance": "...", "state": {...}, "lat": 12.9, "lon": 77.6}; the
+// returned state should be echoed back on the next turn to refine the search.
+func AssistantSearchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Utterance string            `json:"utterance"`
+			State     map[string]string `json:"state"`
+			Lat       *float64          `json:"lat"`
+			Lon       *float64          `json:"lon"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		body.Utterance = strings.TrimSpace(body.Utterance)
+		if body.Utterance == "" || len(body.Utterance) > MaxUtteranceLength {
+			http.Error(w, fmt.Sprintf("utterance is required (max %d characters)", MaxUtteranceLength), http.StatusBadRequest)
+			return
+		}
+
+		filters := ParseUtterance(db, body.Utterance, body.State)
+		if body.Lat != nil && body.Lon != nil {
+			filters.Set("lat", strconv.FormatFloat(*body.Lat, 'f', -1, 64))
+			filters.Set("lon", strconv.FormatFloat(*body.Lon, 'f', -1, 64))
+		}
+
+		p := ParseSearchParams(filters)
+		p.Limit, p.Offset = AssistantTopN, 0
+		p.Tenant = middleware.GetTenant(r.Context())
+		PrepareSearch(db, &p)
+
+		total, err := CountSearch(db, p)
+		var results []models.Restaurant
+		if err == nil {
+			results, err = FetchSearchPage(db, p)
+		}
+		if err != nil {
+			log.Println("Assistant search error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+
+		// Restricted rows lose their distance here, so no "km away" reason
+		// reveals how far the chosen point is from a hidden location.
+		ApplyGeoPrivacy(r, results)
+		picks := []AssistantPick{}
+		for _, res := range results {
+			picks = append(picks, AssistantPick{
+				ID:             res.ID,
+				RestaurantName: res.RestaurantName,
+				Area:           res.Area,
+				City:           res.City,
+				Reasons:        pickReasons(res),
+			})
+		}
+
+		state := map[string]string{}
+		for k := range filters {
+			if k != "lat" && k != "lon" {
+				state[k] = filters.Get(k)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"answer":      summarize(total, picks, filters),
+			"total_count": total,
+			"results":     picks,
+			"state":       state,
+		})
+	}
+}
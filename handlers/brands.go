@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/names"
+	"eazyfind/tracker"
+)
+
+// brandPredicate keeps the branches of the brand with the given name key.
+// Branches share a matching key; "Domino's" also finds "Domino's Pizza".
+func brandPredicate(key string) Predicate {
+	return func(b *QueryBuilder) string {
+		ph := b.Arg(key)
+		return fmt.Sprintf("(r.name_key = %s OR r.name_key LIKE %s || ' %%')", ph, ph)
+	}
+}
+
+// BrandNearestHandler serves GET /api/brands/{id}/nearest?lat=&lon=: the
+// brand's branch closest to the point, so "KFC near me" resolves to one
+// result. {id} is the brand's name or name key, matched as the brand= search
+// filter is. The response also counts the brand's branches.
+func BrandNearestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := names.Key(r.PathValue("id"))
+		if key == "" {
+			http.Error(w, "Invalid brand", http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		lat, lon, ok := parseLatLon(query.Get("lat"), query.Get("lon"))
+		if !ok {
+			http.Error(w, "lat and lon are required", http.StatusBadRequest)
+			return
+		}
+
+		b := &QueryBuilder{}
+		point := b.GeogPoint(lon, lat)
+		b.Where(brandPredicate(key), Raw("r.geo IS NOT NULL"), Raw("r.is_duplicate = false"),
+			Raw(tenantScope(middleware.GetTenant(r.Context()), "r.city")))
+		if !includeUnpublished(r) {
+			b.Where(Raw("EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"))
+		}
+		where := b.WhereClause()
+
+		var branches int
+		if err := db.QueryRow("SELECT COUNT(*) FROM restaurants r "+where, b.Args()...).Scan(&branches); err != nil {
+			log.Println("Brand branch count error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if branches == 0 {
+			http.Error(w, "Brand not found", http.StatusNotFound)
+			return
+		}
+
+		// <-> orders by distance using the geo GiST index.
+		cols := SelectColumns(nil, relatedFields, true)
+		res, err := ScanRestaurant(db.QueryRow(fmt.Sprintf("SELECT %s FROM restaurants r %s ORDER BY r.geo <-> %s LIMIT 1",
+			selectList(cols, "ST_Distance(r.geo, "+point+")"), where, point), b.Args()...), cols)
+		if err != nil {
+			log.Println("Brand nearest query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		nearest := []models.Restaurant{res}
+		ApplyGeoPrivacy(r, nearest)
+		ApplyDistanceText(r, nearest)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"brand":    key,
+			"branches": branches,
+			"nearest":  nearest[0],
+		})
+	}
+}
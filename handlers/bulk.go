@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"eazyfind/maintenance"
+	"eazyfind/tracker"
+
+	"github.com/lib/pq"
+)
+
+// bulkEdit lists the names to add or remove in a bulk update.
+type bulkEdit struct {
+	Cuisines  []string `json:"cuisines"`
+	MealTypes []string `json:"meal_types"`
+	Tags      []string `json:"tags"`
+}
+
+// BulkUpdateHandler starts a background job that adds and removes cuisines,
+// meal types and tags on every restaurant matching a filter. Expects
+//
+//	{"filter": {"city": "Pune", "cuisines": "chinese"}, "ids": [1, 2],
+//	 "add": {"cuisines": ["Chinese"], "meal_types": ["Dinner"], "tags": ["late-night"]},
+//	 "remove": {"cuisines": ["Fast Food"]}, "dry_run": true}
+//
+// The filter takes search parameters as strings; filter and ids narrow each other and at
+// least one is required. Unknown filter keys and unknown cuisine or meal-type
+// names are rejected rather than ignored, so a typo never widens the match.
+// ?dry_run=true works like the body field. Responds 202 with the job.
+func BulkUpdateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Filter map[string]string `json:"filter"`
+			IDs    []int64           `json:"ids"`
+			Add    bulkEdit          `json:"add"`
+			Remove bulkEdit          `json:"remove"`
+			DryRun bool              `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		body.DryRun = body.DryRun || isDryRun(r)
+		if len(body.Filter) == 0 && len(body.IDs) == 0 {
+			http.Error(w, "filter or ids is required", http.StatusBadRequest)
+			return
+		}
+
+		query := url.Values{}
+		for k, v := range body.Filter {
+			query.Set(k, v)
+		}
+		query, unknown := NormalizeQuery(query)
+		if warnings := ValidateSearchQuery(query, unknown); len(warnings) > 0 {
+			http.Error(w, fmt.Sprintf("invalid filter %s: %s", warnings[0].Param, warnings[0].Message), http.StatusBadRequest)
+			return
+		}
+		p := ParseSearchParams(query)
+		PrepareSearch(db, &p)
+		if len(p.Unresolved) > 0 {
+			http.Error(w, fmt.Sprintf("unknown %s in filter: %s", p.Unresolved[0].Param, p.Unresolved[0].Value), http.StatusBadRequest)
+			return
+		}
+
+		var c maintenance.BulkChanges
+		lists := []struct {
+			table, column string
+			names         []string
+			ids           *[]int64
+		}{
+			{"cuisines", "cuisine_name", body.Add.Cuisines, &c.AddCuisines},
+			{"cuisines", "cuisine_name", body.Remove.Cuisines, &c.RemoveCuisines},
+			{"meal_types", "meal_type", body.Add.MealTypes, &c.AddMealTypes},
+			{"meal_types", "meal_type", body.Remove.MealTypes, &c.RemoveMealTypes},
+		}
+		for _, l := range lists {
+			if len(l.names) == 0 {
+				continue
+			}
+			ids, missing, err := resolveTaxonomyNames(db, l.table, l.column, l.names)
+			if err != nil {
+				log.Println("Bulk update lookup error:", err)
+				tracker.CaptureRequest(r, err)
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+			if len(missing) > 0 {
+				http.Error(w, fmt.Sprintf("unknown %s: %s", l.table, strings.Join(missing, ", ")), http.StatusBadRequest)
+				return
+			}
+			*l.ids = ids
+		}
+		c.AddTags, c.RemoveTags = normalizeTags(body.Add.Tags), normalizeTags(body.Remove.Tags)
+		if len(c.AddCuisines)+len(c.RemoveCuisines)+len(c.AddMealTypes)+len(c.RemoveMealTypes)+len(c.AddTags)+len(c.RemoveTags) == 0 {
+			http.Error(w, "add or remove must list at least one cuisine, meal type or tag", http.StatusBadRequest)
+			return
+		}
+
+		b := &QueryBuilder{}
+		_, preds := SearchPredicates(b, p)
+		if len(body.IDs) > 0 {
+			preds = append(preds, func(b *QueryBuilder) string {
+				return fmt.Sprintf("r.id = ANY(%s)", b.Arg(pq.Array(body.IDs)))
+			})
+		}
+		b.Where(preds...)
+		cond := strings.TrimPrefix(b.WhereClause(), "WHERE ")
+
+		job := maintenance.Start("bulk-update", body.DryRun, func(ctx context.Context, j *maintenance.Job) error {
+			return maintenance.BulkUpdate(ctx, db, cond, b.Args(), c, body.DryRun, j)
+		})
+		status := job.Status()
+
+		w.Header().Set("Location", "/api/admin/tasks/jobs/"+status.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// resolveTaxonomyNames maps names to ids in a lookup table, ignoring case and
+// repeated whitespace but not typos, and returns the names that matched none.
+func resolveTaxonomyNames(db *sql.DB, table, column string, names []string) ([]int64, []string, error) {
+	keys := make([]string, 0, len(names))
+	for _, n := range names {
+		keys = append(keys, taxonomyKey(n))
+	}
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT id, lower(regexp_replace(trim(%[1]s), '\s+', ' ', 'g')) FROM %[2]s WHERE lower(regexp_replace(trim(%[1]s), '\s+', ' ', 'g')) = ANY($1)`,
+		column, table), pq.Array(keys))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	found := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var key string
+		if err := rows.Scan(&id, &key); err == nil {
+			found[key] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var ids []int64
+	var missing []string
+	for _, name := range names {
+		if id, ok := found[taxonomyKey(name)]; ok {
+			ids = append(ids, id)
+		} else if strings.TrimSpace(name) != "" {
+			missing = append(missing, name)
+		}
+	}
+	return ids, missing, nil
+}
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated ones.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
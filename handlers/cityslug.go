@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CityRef identifies a city by its display name and canonical slug.
+type CityRef struct {
+	Name string `json:"city"`
+	Slug string `json:"city_slug"`
+}
+
+// ResolveCity maps a city slug ("bengaluru"), display name ("Bengaluru",
+// ignoring case and accents) or alias ("bangalore") to the city it names.
+func ResolveCity(db *sql.DB, raw string) (CityRef, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return CityRef{}, false
+	}
+	var c CityRef
+	err := db.QueryRow(`
+		SELECT city_name, slug FROM cities
+		WHERE slug = slugify($1) OR city_name_norm = fold_text($1) OR slugify($1) = ANY(aliases)
+		ORDER BY slug = slugify($1) DESC, city_name_norm = fold_text($1) DESC
+		LIMIT 1`, raw).Scan(&c.Name, &c.Slug)
+	return c, err == nil
+}
+
+// canonicalCity returns the display name restaurants are stored under for
+// raw, or raw unchanged when it does not name a known city.
+func canonicalCity(db *sql.DB, raw string) string {
+	if c, ok := ResolveCity(db, raw); ok {
+		return c.Name
+	}
+	return raw
+}
+
+// redirectToCitySlug sends a permanent redirect when the {city} path segment
+// is not the city's canonical slug, so clients converge on one URL. It
+// reports whether a redirect was written.
+func redirectToCitySlug(w http.ResponseWriter, r *http.Request, c CityRef) bool {
+	raw := r.PathValue("city")
+	if raw == c.Slug {
+		return false
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	for i, s := range segments {
+		if s == raw {
+			segments[i] = c.Slug
+			break
+		}
+	}
+	target := url.URL{Path: strings.Join(segments, "/"), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	return true
+}
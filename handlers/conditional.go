@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/tracker"
+)
+
+// notModified sets Last-Modified from lastModQuery (which must return a single
+// timestamp) and writes 304 when the client's If-Modified-Since is not older.
+// It returns true when the response has been fully handled.
+func notModified(db *sql.DB, w http.ResponseWriter, r *http.Request, lastModQuery string, args ...interface{}) bool {
+	var lastMod sql.NullTime
+	if err := db.QueryRow(lastModQuery, args...).Scan(&lastMod); err != nil {
+		log.Println("Last-Modified query error:", err)
+		return false
+	}
+	if !lastMod.Valid {
+		return false
+	}
+	return notModifiedSince(w, r, lastMod.Time)
+}
+
+// notModifiedSince sets Last-Modified to lastMod and writes 304 when the
+// client's If-Modified-Since is not older. It returns true when the response
+// has been fully handled.
+func notModifiedSince(w http.ResponseWriter, r *http.Request, lastMod time.Time) bool {
+	// HTTP dates have second precision.
+	mod := lastMod.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", mod.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !mod.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+const cityRestaurantsLastModified = "SELECT MAX(updated_at) FROM restaurants WHERE city ILIKE $1"
+
+// versionOf renders the updated_at of the row aliased alias as the opaque
+// version admins send back with an edit: microseconds since the epoch.
+// Junction triggers bump a restaurant's updated_at, so taxonomy edits change
+// its version too.
+func versionOf(alias string) string {
+	return fmt.Sprintf("(extract(epoch FROM %s.updated_at) * 1000000)::bigint", alias)
+}
+
+// expectedVersion returns the version an admin edit is conditional on, taken
+// from If-Match or else the body's version field, or nil when neither is set
+// (or If-Match is *). It writes 400 and returns false for a malformed value.
+func expectedVersion(w http.ResponseWriter, r *http.Request, bodyVersion string) (*int64, bool) {
+	v := bodyVersion
+	if m := r.Header.Get("If-Match"); m != "" {
+		v = strings.Trim(strings.TrimPrefix(m, "W/"), `"`)
+	}
+	if v == "" || v == "*" {
+		return nil, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return nil, false
+	}
+	return &n, true
+}
+
+// versionMatches is a condition that holds when the expected version bound
+// to placeholder is NULL or equals the version of the row aliased alias.
+func versionMatches(alias, placeholder string) string {
+	return fmt.Sprintf("(%s::bigint IS NULL OR %s = %s)", placeholder, versionOf(alias), placeholder)
+}
+
+// writeNotFoundOrConflict answers a conditional edit of table's row id that
+// matched nothing: 409 with the current version as ETag when the row exists
+// (someone else changed it first), 404 with notFound otherwise.
+func writeNotFoundOrConflict(db *sql.DB, w http.ResponseWriter, r *http.Request, table string, id int64, notFound string) {
+	var version int64
+	err := db.QueryRow(fmt.Sprintf("SELECT %s FROM %s t WHERE t.id = $1", versionOf("t"), table), id).Scan(&version)
+	if err == sql.ErrNoRows {
+		http.Error(w, notFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Version lookup error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	http.Error(w, "Modified since version was read; reload and retry", http.StatusConflict)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/outbox"
+	"eazyfind/tracker"
+)
+
+// couponOpen is true for a coupon c that has not expired or reached its limit.
+const couponOpen = `(c.expires_at IS NULL OR c.expires_at > now())
+	AND (c.redemption_limit IS NULL OR (SELECT COUNT(*) FROM coupon_reveals cr WHERE cr.coupon_id = c.id) < c.redemption_limit)`
+
+// RevealCouponHandler shows the signed-in user the coupon code for a
+// restaurant's offer. Each user gets one reveal per coupon; asking again
+// returns the same reveal and does not count towards the limit.
+func RevealCouponHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid offer id", http.StatusBadRequest)
+			return
+		}
+		user := middleware.UserID(r)
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+
+		// Locking the coupon serializes reveals so the limit cannot be overshot.
+		var couponID int64
+		var rev models.CouponReveal
+		var limit sql.NullInt64
+		err = tx.QueryRow(fmt.Sprintf(`
+			SELECT c.id, c.code, c.redemption_limit, c.expires_at
+			FROM coupons c JOIN restaurants r ON r.id = c.restaurant_id
+			WHERE c.restaurant_id = $1 AND r.is_duplicate = false %s
+			FOR UPDATE OF c
+		`, andTenantScope(r, "r.city")), id).Scan(&couponID, &rev.Code, &limit, &rev.ExpiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "No coupon for this offer", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+
+		err = tx.QueryRow("SELECT revealed_at, redeemed_at FROM coupon_reveals WHERE coupon_id = $1 AND user_id = $2",
+			couponID, user).Scan(&rev.RevealedAt, &rev.RedeemedAt)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rev)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			writeCouponError(w, r, err)
+			return
+		}
+
+		if rev.ExpiresAt != nil && !rev.ExpiresAt.After(time.Now()) {
+			http.Error(w, "Coupon has expired", http.StatusGone)
+			return
+		}
+		if limit.Valid {
+			var reveals int64
+			if err := tx.QueryRow("SELECT COUNT(*) FROM coupon_reveals WHERE coupon_id = $1", couponID).Scan(&reveals); err != nil {
+				writeCouponError(w, r, err)
+				return
+			}
+			if reveals >= limit.Int64 {
+				http.Error(w, "Coupon limit reached", http.StatusGone)
+				return
+			}
+		}
+
+		err = tx.QueryRow("INSERT INTO coupon_reveals (coupon_id, user_id) VALUES ($1, $2) RETURNING revealed_at",
+			couponID, user).Scan(&rev.RevealedAt)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rev)
+	}
+}
+
+// RedeemCouponHandler records that the signed-in user used the coupon they
+// revealed. Repeating it keeps the first redemption time.
+func RedeemCouponHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid offer id", http.StatusBadRequest)
+			return
+		}
+		res, err := db.Exec(`
+			UPDATE coupon_reveals SET redeemed_at = COALESCE(redeemed_at, now())
+			WHERE user_id = $2 AND coupon_id = (SELECT id FROM coupons WHERE restaurant_id = $1)
+		`, id, middleware.UserID(r))
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Coupon not revealed", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetCouponHandler attaches a coupon code to a restaurant's offer, replacing
+// any previous one. Expects {"code": "EAZY20", "redemption_limit": 100,
+// "expires_at": "2025-01-31T23:59:00+05:30"}; the limit and expiry are
+// optional. Existing reveals keep counting towards the new limit.
+func SetCouponHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Code            string     `json:"code"`
+			RedemptionLimit *int       `json:"redemption_limit"`
+			ExpiresAt       *time.Time `json:"expires_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		body.Code = strings.TrimSpace(body.Code)
+		if body.Code == "" {
+			http.Error(w, "code is required", http.StatusBadRequest)
+			return
+		}
+		if body.RedemptionLimit != nil && *body.RedemptionLimit <= 0 {
+			http.Error(w, "redemption_limit must be positive", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+		// xmax is zero only for a freshly inserted row.
+		var created bool
+		err = tx.QueryRow(`
+			INSERT INTO coupons (restaurant_id, code, redemption_limit, expires_at)
+			SELECT id, $2, $3, $4 FROM restaurants WHERE id = $1
+			ON CONFLICT (restaurant_id) DO UPDATE SET
+				code = EXCLUDED.code, redemption_limit = EXCLUDED.redemption_limit, expires_at = EXCLUDED.expires_at
+			RETURNING xmax = 0
+		`, id, body.Code, body.RedemptionLimit, body.ExpiresAt).Scan(&created)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Restaurant not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		summary := MutationSummary{Updated: 1}
+		if created {
+			summary = MutationSummary{Created: 1}
+		}
+		if writeDryRun(w, r, summary) {
+			return
+		}
+		if err := outbox.Record(tx, restaurantChanged(id)); err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteCouponHandler removes a restaurant's coupon and its reveals.
+func DeleteCouponHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		res, err := adminExec(db, r, restaurantChanged(id), "DELETE FROM coupons WHERE restaurant_id = $1", id)
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			http.Error(w, "Coupon not found", http.StatusNotFound)
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Deleted: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CouponsHandler lists every coupon with its reveal and redemption counts,
+// newest first.
+func CouponsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query(`
+			SELECT c.id, c.restaurant_id, r.restaurant_name, c.code, c.redemption_limit, c.expires_at, c.created_at,
+			       COUNT(cr.user_id), COUNT(cr.redeemed_at)
+			FROM coupons c
+			JOIN restaurants r ON r.id = c.restaurant_id
+			LEFT JOIN coupon_reveals cr ON cr.coupon_id = c.id
+			GROUP BY c.id, r.restaurant_name
+			ORDER BY c.created_at DESC
+		`)
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		coupons := []models.Coupon{}
+		for rows.Next() {
+			var c models.Coupon
+			var limit sql.NullInt64
+			if err := rows.Scan(&c.ID, &c.RestaurantID, &c.RestaurantName, &c.Code, &limit, &c.ExpiresAt, &c.CreatedAt,
+				&c.Reveals, &c.Redemptions); err != nil {
+				log.Println("Coupons scan error:", err)
+				continue
+			}
+			if limit.Valid {
+				n := int(limit.Int64)
+				c.RedemptionLimit = &n
+			}
+			coupons = append(coupons, c)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(coupons)
+	}
+}
+
+func writeCouponError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Coupon error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
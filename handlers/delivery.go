@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/tracker"
+)
+
+// MaxDeliveryRadius bounds delivery_radius_m, in meters.
+const MaxDeliveryRadius = 50000
+
+// SetDeliveryZoneHandler sets where a restaurant delivers. Expects
+// {"radius_m": 3000} and/or {"area": <GeoJSON Polygon or MultiPolygon>}; an
+// area takes precedence over the radius when both are stored. An optional
+// "version" (or If-Match) makes the edit fail with 409 if the restaurant
+// changed since.
+func SetDeliveryZoneHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			RadiusM *int            `json:"radius_m"`
+			Area    json.RawMessage `json:"area"`
+			Version string          `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+		if body.RadiusM == nil && len(body.Area) == 0 {
+			http.Error(w, "radius_m or area is required", http.StatusBadRequest)
+			return
+		}
+		if body.RadiusM != nil && (*body.RadiusM <= 0 || *body.RadiusM > MaxDeliveryRadius) {
+			http.Error(w, "radius_m must be between 1 and "+strconv.Itoa(MaxDeliveryRadius), http.StatusBadRequest)
+			return
+		}
+		var area sql.NullString
+		if len(body.Area) > 0 {
+			geometry, ok := validPolygon(db, w, body.Area)
+			if !ok {
+				return
+			}
+			area = sql.NullString{String: geometry, Valid: true}
+		}
+
+		res, err := adminExec(db, r, restaurantChanged(id), `
+			UPDATE restaurants SET
+				delivery_radius_m = COALESCE($1, delivery_radius_m),
+				delivery_area = COALESCE(ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON($2), 4326)), delivery_area)
+			WHERE id = $3 AND `+versionMatches("restaurants", "$4")+`
+		`, body.RadiusM, area, id, version)
+		writeDeliveryZoneUpdate(db, w, r, id, res, err)
+	}
+}
+
+// DeleteDeliveryZoneHandler removes a restaurant's delivery area and radius.
+func DeleteDeliveryZoneHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, "")
+		if !ok {
+			return
+		}
+		res, err := adminExec(db, r, restaurantChanged(id), "UPDATE restaurants SET delivery_area = NULL, delivery_radius_m = NULL WHERE id = $1 AND "+versionMatches("restaurants", "$2"), id, version)
+		writeDeliveryZoneUpdate(db, w, r, id, res, err)
+	}
+}
+
+func writeDeliveryZoneUpdate(db *sql.DB, w http.ResponseWriter, r *http.Request, id int64, res sql.Result, err error) {
+	if err != nil {
+		log.Println("Delivery zone update error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		writeNotFoundOrConflict(db, w, r, "restaurants", id, "Restaurant not found")
+		return
+	}
+	if writeDryRun(w, r, MutationSummary{Updated: n}) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
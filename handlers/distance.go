@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"eazyfind/geo"
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// distanceLocale formats "N <unit> away" in one language.
+type distanceLocale struct {
+	away         string // "{d}" is replaced with the number and unit
+	m, km, mi    string
+	decimalComma bool
+}
+
+// distanceLocales are the languages distance_text is written in, keyed by
+// primary language subtag. English is the fallback.
+var distanceLocales = map[string]distanceLocale{
+	"en": {away: "{d} away", m: "m", km: "km", mi: "mi"},
+	"hi": {away: "{d} दूर", m: "मी", km: "किमी", mi: "मील"},
+	"fr": {away: "à {d}", m: "m", km: "km", mi: "mi", decimalComma: true},
+	"de": {away: "{d} entfernt", m: "m", km: "km", mi: "mi", decimalComma: true},
+	"es": {away: "a {d}", m: "m", km: "km", mi: "mi", decimalComma: true},
+}
+
+// milesRegions default to miles when the request does not pass units=.
+var milesRegions = map[string]bool{"US": true, "GB": true, "LR": true, "MM": true}
+
+// ApplyDistanceText sets distance_text on rows that carry a distance, as
+// formatted by distanceFormatter.
+func ApplyDistanceText(r *http.Request, restaurants []models.Restaurant) {
+	format := distanceFormatter(r)
+	for i := range restaurants {
+		if restaurants[i].Distance > 0 {
+			restaurants[i].DistanceText = format(restaurants[i].Distance)
+		}
+	}
+}
+
+// distanceFormatter formats meters for the request: in the units= the client
+// asked for (km or mi; otherwise from the Accept-Language region) and the
+// best supported Accept-Language.
+func distanceFormatter(r *http.Request) func(meters float64) string {
+	lang, region := acceptLanguage(r.Header.Get("Accept-Language"))
+	units := r.URL.Query().Get("units")
+	if units != "km" && units != "mi" {
+		units = "km"
+		if milesRegions[region] {
+			units = "mi"
+		}
+	}
+	loc := distanceLocales[lang]
+	return func(meters float64) string { return loc.format(meters, units) }
+}
+
+// format renders meters as "450 m away", "1.2 km away", "12 km away" or
+// "0.8 mi away".
+func (l distanceLocale) format(meters float64, units string) string {
+	var value float64
+	var unit string
+	switch {
+	case units == "mi":
+		value, unit = math.Max(0.1, meters/1609.344), l.mi
+	case meters < 1000:
+		// Nearby places read better in whole 50 m steps.
+		value, unit = math.Max(50, math.Round(meters/50)*50), l.m
+	default:
+		value, unit = meters/1000, l.km
+	}
+	digits := 0
+	if unit != l.m && value < 10 {
+		digits = 1
+	}
+	n := strconv.FormatFloat(value, 'f', digits, 64)
+	if l.decimalComma {
+		n = strings.Replace(n, ".", ",", 1)
+	}
+	return strings.Replace(l.away, "{d}", n+" "+unit, 1)
+}
+
+// acceptLanguage picks the highest-weighted language from an Accept-Language
+// header that distanceLocales supports ("en" when none is), along with the
+// region of the header's preferred tag ("en-US" -> "US").
+func acceptLanguage(header string) (lang, region string) {
+	type tag struct {
+		lang, region string
+		q            float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name == "" || name == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		l, reg, _ := strings.Cut(name, "-")
+		tags = append(tags, tag{strings.ToLower(l), strings.ToUpper(reg), q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	lang = "en"
+	if len(tags) > 0 {
+		region = tags[0].region
+	}
+	for _, t := range tags {
+		if _, ok := distanceLocales[t.lang]; ok && t.q > 0 {
+			lang = t.lang
+			break
+		}
+	}
+	return lang, region
+}
+
+// RestaurantDistancesHandler re-annotates a client-side list of restaurants
+// (favorites, recently viewed) for a new location: it returns the distance
+// from lat/lon to each of ids, in request order, and with mode=walk|drive the
+// travel distance and time too. Distances follow the geo privacy rules:
+// rounded to the caller's coordinate precision, and location-restricted
+// restaurants count as hidden for non-admins. Unknown or hidden ids are
+// listed under not_found; if routing fails the distances are still returned,
+// with travel_unavailable set.
+func RestaurantDistancesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Lat  *float64      `json:"lat"`
+			Lon  *float64      `json:"lon"`
+			IDs  []json.Number `json:"ids"`
+			Mode string        `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.Lat == nil || body.Lon == nil || math.Abs(*body.Lat) > 90 || math.Abs(*body.Lon) > 180 {
+			http.Error(w, "lat and lon are required", http.StatusBadRequest)
+			return
+		}
+		if body.Mode != "" && !geo.IsolineModes[body.Mode] {
+			http.Error(w, "mode must be walk or drive", http.StatusBadRequest)
+			return
+		}
+		if len(body.IDs) == 0 || len(body.IDs) > geo.MaxMatrixTargets {
+			http.Error(w, "ids must list between 1 and "+strconv.Itoa(geo.MaxMatrixTargets)+" restaurant ids", http.StatusBadRequest)
+			return
+		}
+		ids := make([]int64, 0, len(body.IDs))
+		for _, raw := range body.IDs {
+			id, err := raw.Int64()
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid restaurant id "+raw.String(), http.StatusBadRequest)
+				return
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+
+		published := "AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"
+		if includeUnpublished(r) {
+			published = ""
+		}
+		// Distances from caller-chosen points would trilaterate a hidden location.
+		restricted := "AND r.location_restricted = false"
+		if middleware.IsAdmin(r) {
+			restricted = ""
+		}
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT r.id, r.latitude, r.longitude, ST_Distance(r.geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+			FROM restaurants r
+			WHERE r.id = ANY($3) AND r.geo IS NOT NULL AND r.is_duplicate = false %s %s %s`, published, restricted, andTenantScope(r, "r.city")),
+			*body.Lon, *body.Lat, pq.Array(ids))
+		if err != nil {
+			log.Println("Restaurant distances query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		found := map[int64]models.RestaurantDistance{}
+		points := map[int64]geo.LatLon{}
+		format := distanceFormatter(r)
+		decimals := coordinateDecimals(r)
+		for rows.Next() {
+			var d models.RestaurantDistance
+			var pt geo.LatLon
+			if err := rows.Scan(&d.ID, &pt.Lat, &pt.Lon, &d.Distance); err != nil {
+				continue
+			}
+			if decimals < MaxCoordinateDecimals {
+				d.Distance = bucketDistance(d.Distance, decimals)
+			}
+			d.DistanceText = format(d.Distance)
+			found[d.ID], points[d.ID] = d, pt
+		}
+		if err := rows.Err(); err != nil {
+			log.Println("Restaurant distances query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		distances := []models.RestaurantDistance{}
+		notFound := []string{}
+		var targets []geo.LatLon
+		for _, id := range ids {
+			d, ok := found[id]
+			if !ok {
+				notFound = append(notFound, strconv.FormatInt(id, 10))
+				continue
+			}
+			distances = append(distances, d)
+			targets = append(targets, points[id])
+		}
+
+		resp := map[string]interface{}{"distances": distances, "not_found": notFound}
+		if body.Mode != "" && len(targets) > 0 {
+			resp["travel_mode"] = body.Mode
+			travel, err := geo.TravelTimes(geo.LatLon{Lat: *body.Lat, Lon: *body.Lon}, targets, body.Mode)
+			if err != nil {
+				log.Println("Route matrix error:", err)
+				resp["travel_unavailable"] = true
+			}
+			for i, t := range travel {
+				if t != nil {
+					meters := t.Meters
+					if decimals < MaxCoordinateDecimals {
+						meters = bucketDistance(meters, decimals)
+					}
+					distances[i].TravelDistance, distances[i].TravelSeconds = &meters, &t.Seconds
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
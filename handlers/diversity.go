@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"eazyfind/models"
+)
+
+const (
+	// DiverseCandidateFactor is how many rows per result a diverse=true page
+	// fetches to rerank from.
+	DiverseCandidateFactor = 3
+	// MaxDiverseLimit is the largest page reranked; bigger requests (exports,
+	// streams) keep the plain sort order.
+	MaxDiverseLimit = 100
+	// MaxBrandRun and MaxCuisineRun are the most consecutive results a
+	// diverse page shows from one brand, and sharing a cuisine.
+	MaxBrandRun   = 1
+	MaxCuisineRun = 2
+)
+
+// diversityColumns are selected after the restaurant columns for reranking:
+// the brand's name key (the id for rows without one, so they never match)
+// and the cuisine ids.
+const diversityColumns = "COALESCE(NULLIF(r.name_key, ''), r.id::text), ARRAY(SELECT rc.cuisine_id FROM restaurant_cuisines rc WHERE rc.restaurant_id = r.id)"
+
+// diverseCandidate is a fetched row with the keys it is reranked by.
+type diverseCandidate struct {
+	res      models.Restaurant
+	brand    string
+	cuisines []int64
+}
+
+// fetchDiversePage returns the page selected by p, reranked from
+// DiverseCandidateFactor times as many rows in sort order so that runs from
+// one brand or cuisine are broken up. Rows pushed off the page are not
+// carried over, so they can reappear on the next one.
+func fetchDiversePage(db *sql.DB, p SearchParams) ([]models.Restaurant, error) {
+	b := &QueryBuilder{}
+	distanceExpr, preds := SearchPredicates(b, p)
+	b.Where(preds...)
+	where, from := b.WhereClause(), searchSource(b, p.Snapshot)
+	cols := SelectColumns(p.Fields, p.Include, true)
+	rows, err := db.QueryContext(p.context(), fmt.Sprintf("SELECT %s, %s FROM %s %s %s LIMIT %d OFFSET %d",
+		selectList(cols, distanceExpr), diversityColumns, from, where, OrderByClause(p.Sort),
+		p.Limit*DiverseCandidateFactor, p.Offset), b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []diverseCandidate
+	for rows.Next() {
+		var c diverseCandidate
+		var cuisines pq.Int64Array
+		res, err := ScanRestaurant(rows, cols, &c.brand, &cuisines)
+		if err != nil {
+			continue
+		}
+		c.res, c.cuisines = res, cuisines
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return diversify(candidates, p.Limit), nil
+}
+
+// diversify picks up to limit candidates greedily: each slot takes the
+// best-ranked remaining candidate that would not extend a brand run beyond
+// MaxBrandRun or a cuisine run beyond MaxCuisineRun, falling back to the
+// best-ranked remaining one when every candidate would.
+func diversify(candidates []diverseCandidate, limit int) []models.Restaurant {
+	var picked []diverseCandidate
+	for len(picked) < limit && len(candidates) > 0 {
+		next := 0
+		for i, c := range candidates {
+			if !extendsRun(picked, c) {
+				next = i
+				break
+			}
+		}
+		picked = append(picked, candidates[next])
+		candidates = slices.Delete(candidates, next, next+1)
+	}
+	results := make([]models.Restaurant, 0, len(picked))
+	for _, c := range picked {
+		results = append(results, c.res)
+	}
+	return results
+}
+
+// extendsRun reports whether c after picked would make too long a run of one
+// brand, or of results sharing a cuisine.
+func extendsRun(picked []diverseCandidate, c diverseCandidate) bool {
+	brandRun, cuisineRun := 0, 0
+	shared := c.cuisines
+	for i := len(picked) - 1; i >= 0; i-- {
+		if picked[i].brand != c.brand {
+			break
+		}
+		brandRun++
+	}
+	for i := len(picked) - 1; i >= 0 && len(shared) > 0; i-- {
+		shared = slices.DeleteFunc(slices.Clone(shared), func(id int64) bool { return !slices.Contains(picked[i].cuisines, id) })
+		if len(shared) == 0 {
+			break
+		}
+		cuisineRun++
+	}
+	return brandRun >= MaxBrandRun || cuisineRun >= MaxCuisineRun
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"eazyfind/outbox"
+)
+
+// MutationSummary is the response to an admin mutation made with
+// ?dry_run=true: the rows it would have created, updated, deleted or skipped,
+// and for multi-row bodies the entries that failed validation.
+type MutationSummary struct {
+	DryRun  bool     `json:"dry_run"`
+	Created int64    `json:"created"`
+	Updated int64    `json:"updated"`
+	Deleted int64    `json:"deleted"`
+	Skipped int64    `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// isDryRun reports whether the request asked for dry_run=true.
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+// adminExec runs a single-statement admin write in a transaction, recording
+// msg in the outbox with it when it changes any rows. On a dry run the
+// transaction is rolled back, so the result and any constraint errors are
+// exactly those of the real write.
+func adminExec(db *sql.DB, r *http.Request, msg outbox.Message, query string, args ...interface{}) (sql.Result, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(query, args...)
+	if err != nil || isDryRun(r) {
+		return res, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err := outbox.Record(tx, msg); err != nil {
+			return nil, err
+		}
+	}
+	return res, tx.Commit()
+}
+
+// writeDryRun responds with s and returns true on a dry run. Handlers call it
+// once their writes have succeeded and before committing, clearing caches or
+// writing their normal response, all of which a dry run skips.
+func writeDryRun(w http.ResponseWriter, r *http.Request, s MutationSummary) bool {
+	if !isDryRun(r) {
+		return false
+	}
+	s.DryRun = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+	return true
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/storage"
+	"eazyfind/tracker"
+)
+
+const (
+	// StreamLimitThreshold is the page size above which search results are
+	// streamed as NDJSON instead of buffered into a single JSON document.
+	StreamLimitThreshold = 100
+	// MaxExportRows caps a single export.
+	MaxExportRows = 50000
+	// streamWriteTimeout is granted afresh for every streamed row, so long
+	// exports are not cut off by the server-wide WriteTimeout.
+	streamWriteTimeout = 30 * time.Second
+
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// wantsStream reports whether the search should be streamed: either the
+// client asked for NDJSON or the page is too large to buffer comfortably.
+func wantsStream(r *http.Request, p SearchParams) bool {
+	return p.Limit > StreamLimitThreshold || strings.Contains(r.Header.Get("Accept"), ContentTypeNDJSON)
+}
+
+// streamNDJSON writes one restaurant per line, flushing after each row so
+// memory stays flat and clients can render before the query finishes.
+func streamNDJSON(db *sql.DB, w http.ResponseWriter, r *http.Request, p SearchParams) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	enc := json.NewEncoder(w)
+	err := StreamSearch(db, p, func(res models.Restaurant) error {
+		row := []models.Restaurant{res}
+		ApplyGeoPrivacy(r, row)
+		ApplyDistanceText(r, row)
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := enc.Encode(projectRestaurant(row[0], p.Fields)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil {
+		// Headers are already sent; the client sees a truncated stream.
+		log.Println("Stream query error:", err)
+		tracker.CaptureRequest(r, err)
+	}
+}
+
+// ExportHandler streams every restaurant matching the search filters as
+// NDJSON, up to MaxExportRows, in the requested sort order. With
+// ?deliver=url the file is written to store instead and the response links
+// to it for ExportURLTTL; that buffers the export and keeps a file, so it is
+// limited to API-key holders and admins.
+func ExportHandler(db *sql.DB, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		normalized, unknown := NormalizeQuery(r.URL.Query())
+		reportUnknownParams(w, unknown)
+		if warnings := ValidateSearchQuery(normalized, unknown); normalized.Get("strict") == "true" && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
+
+		p := ParseSearchParams(r.URL.Query())
+		p.IncludeUnpublished = includeUnpublished(r)
+		p.Tenant = middleware.GetTenant(r.Context())
+		p.Limit, p.Offset = MaxExportRows, 0
+		PrepareSearch(db, &p)
+
+		if r.URL.Query().Get("deliver") == "url" {
+			if middleware.GetAPIKey(r.Context()) == nil && !middleware.IsAdmin(r) {
+				http.Error(w, "deliver=url requires an API key", http.StatusUnauthorized)
+				return
+			}
+			writeExportFile(db, store, w, r, p)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="restaurants.ndjson"`)
+		streamNDJSON(db, w, r, p)
+	}
+}
+
+// ExportURLTTL is how long the link to a stored export works.
+const ExportURLTTL = time.Hour
+
+// writeExportFile stores the export with storeExport and responds with a
+// signed link to it. The exports/ prefix should carry a lifecycle rule that
+// deletes old files.
+func writeExportFile(db *sql.DB, store storage.Store, w http.ResponseWriter, r *http.Request, p SearchParams) {
+	if store == nil {
+		http.Error(w, "File storage is not configured", http.StatusNotImplemented)
+		return
+	}
+	key, rows, err := storeExport(db, store, p, func(row []models.Restaurant) { ApplyGeoPrivacy(r, row) })
+	var link string
+	if err == nil {
+		link, err = store.SignedURL(key, ExportURLTTL)
+	}
+	if err != nil {
+		log.Println("Export file error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        link,
+		"expires_at": time.Now().Add(ExportURLTTL).UTC(),
+		"rows":       rows,
+	})
+}
+
+// storeExport writes the restaurants selected by p to store as
+// exports/<date>/<random>.ndjson, passing each row through privacy when set,
+// and returns the key and row count.
+func storeExport(db *sql.DB, store storage.Store, p SearchParams, privacy func([]models.Restaurant)) (string, int, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	rows := 0
+	err := StreamSearch(db, p, func(res models.Restaurant) error {
+		row := []models.Restaurant{res}
+		if privacy != nil {
+			privacy(row)
+		}
+		rows++
+		return enc.Encode(projectRestaurant(row[0], p.Fields))
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	id := make([]byte, 12)
+	rand.Read(id)
+	key := fmt.Sprintf("exports/%s/%s.ndjson", time.Now().UTC().Format("2006-01-02"), hex.EncodeToString(id))
+	if _, err := store.Put(key, ContentTypeNDJSON, buf.Bytes()); err != nil {
+		return "", 0, err
+	}
+	return key, rows, nil
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"eazyfind/models"
+	"eazyfind/scheduler"
+	"eazyfind/storage"
+	"eazyfind/tracker"
+)
+
+const (
+	ExportJobSchedule = "@every 10s"
+	// ExportJobsPerRun bounds the jobs one run of the export worker processes.
+	ExportJobsPerRun = 5
+	// ExportJobTimeout is how long a job may stay RUNNING before another run
+	// assumes its instance died and starts it again.
+	ExportJobTimeout = 30 * time.Minute
+)
+
+// Export job statuses.
+const (
+	ExportPending   = "PENDING"
+	ExportRunning   = "RUNNING"
+	ExportSucceeded = "SUCCEEDED"
+	ExportFailed    = "FAILED"
+)
+
+// CreateExportJobHandler queues an export of the restaurants matching the
+// search parameters in the query string, as /api/export/restaurants would
+// stream them to an admin. Responds 202 with the job and its Location.
+func CreateExportJobHandler(db *sql.DB, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "File storage is not configured", http.StatusNotImplemented)
+			return
+		}
+		normalized, unknown := NormalizeQuery(r.URL.Query())
+		reportUnknownParams(w, unknown)
+		if warnings := ValidateSearchQuery(normalized, unknown); normalized.Get("strict") == "true" && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
+		normalized.Del("strict")
+
+		var job models.ExportJob
+		err := db.QueryRow("INSERT INTO export_jobs (params) VALUES ($1) RETURNING "+exportJobColumns, normalized.Encode()).
+			Scan(exportJobDest(&job)...)
+		if err != nil {
+			writeExportJobError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/api/admin/exports/"+strconv.FormatInt(job.ID, 10))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// ExportJobHandler reports an export job. Once it has succeeded the response
+// carries a link to the file valid for ExportURLTTL, made fresh on each call.
+func ExportJobHandler(db *sql.DB, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid export id", http.StatusBadRequest)
+			return
+		}
+		var job models.ExportJob
+		err = db.QueryRow("SELECT "+exportJobColumns+" FROM export_jobs WHERE id = $1", id).Scan(exportJobDest(&job)...)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Export not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeExportJobError(w, r, err)
+			return
+		}
+		if job.Status == ExportSucceeded && store != nil {
+			if job.URL, err = store.SignedURL(job.StorageKey, ExportURLTTL); err != nil {
+				writeExportJobError(w, r, err)
+				return
+			}
+			expires := time.Now().Add(ExportURLTTL).UTC()
+			job.ExpiresAt = &expires
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+const exportJobColumns = "id, params, status, COALESCE(storage_key, ''), row_count, COALESCE(error, ''), created_at, finished_at"
+
+func exportJobDest(job *models.ExportJob) []interface{} {
+	return []interface{}{&job.ID, &job.Params, &job.Status, &job.StorageKey, &job.Rows, &job.Error, &job.CreatedAt, &job.FinishedAt}
+}
+
+func writeExportJobError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Export job error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
+
+// StartExportWorker schedules the worker that runs queued export jobs. It
+// lives here rather than in worker because it shares the search code.
+func StartExportWorker(db *sql.DB, store storage.Store) {
+	if store == nil {
+		log.Println("No file storage configured, skipping export worker")
+		return
+	}
+	scheduler.Register(scheduler.Job{
+		Name:   "exports",
+		Spec:   ExportJobSchedule,
+		Jitter: 2 * time.Second,
+		Run: func() {
+			for i := 0; i < ExportJobsPerRun; i++ {
+				if !runExportJob(db, store) {
+					return
+				}
+			}
+		},
+	})
+}
+
+// runExportJob claims the oldest pending job, or one abandoned RUNNING past
+// ExportJobTimeout, and runs it. It returns false when there was none or the
+// claim failed.
+func runExportJob(db *sql.DB, store storage.Store) bool {
+	var id int64
+	var params string
+	err := db.QueryRow(`
+		UPDATE export_jobs SET status = 'RUNNING', started_at = now()
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = 'PENDING' OR (status = 'RUNNING' AND started_at < now() - make_interval(secs => $1))
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, params`, ExportJobTimeout.Seconds()).Scan(&id, &params)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Println("Export job claim error:", err)
+		tracker.Capture(err, map[string]string{"worker": "exports"})
+		return false
+	}
+
+	key, rows, err := runExport(db, store, params)
+	if err != nil {
+		log.Printf("Export job %d failed: %v", id, err)
+		tracker.Capture(err, map[string]string{"worker": "exports", "id": strconv.FormatInt(id, 10)})
+		_, err = db.Exec("UPDATE export_jobs SET status = 'FAILED', error = $2, finished_at = now() WHERE id = $1", id, err.Error())
+	} else {
+		_, err = db.Exec("UPDATE export_jobs SET status = 'SUCCEEDED', storage_key = $2, row_count = $3, error = NULL, finished_at = now() WHERE id = $1", id, key, rows)
+	}
+	if err != nil {
+		log.Printf("Export job %d update error: %v", id, err)
+		tracker.Capture(err, map[string]string{"worker": "exports", "id": strconv.FormatInt(id, 10)})
+	}
+	return true
+}
+
+// runExport stores the export described by a job's params. Jobs are created
+// by admins, so rows keep full coordinates and include_unpublished applies.
+func runExport(db *sql.DB, store storage.Store, params string) (string, int, error) {
+	query, err := url.ParseQuery(params)
+	if err != nil {
+		return "", 0, err
+	}
+	p := ParseSearchParams(query)
+	p.IncludeUnpublished = query.Get("include_unpublished") == "true"
+	p.Limit, p.Offset = MaxExportRows, 0
+	PrepareSearch(db, &p)
+	return storeExport(db, store, p, nil)
+}
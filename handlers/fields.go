@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"eazyfind/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	cuisinesAggregate  = "COALESCE((SELECT json_agg(json_build_object('id', c.id, 'cuisine_name', c.cuisine_name)) FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE rc.restaurant_id = r.id), '[]')"
+	mealTypesAggregate = "COALESCE((SELECT json_agg(json_build_object('id', m.id, 'meal_type', m.meal_type)) FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE rmt.restaurant_id = r.id), '[]')"
+)
+
+// restaurantColumns maps each selectable JSON field to its SQL expression, in
+// SELECT order. Distance has no fixed expression; it is supplied per query.
+var restaurantColumns = []struct {
+	field string
+	expr  string
+}{
+	{"id", "r.id"},
+	{"restaurant_name", "r.restaurant_name"},
+	{"display_name", "COALESCE(r.display_name, r.restaurant_name, '')"},
+	{"slug", "COALESCE(r.slug, '')"},
+	{"city", "r.city"},
+	{"area", "r.area"},
+	{"cost_for_two", "r.cost_for_two"},
+	{"rating", "r.rating"},
+	{"latitude", "r.latitude"},
+	{"longitude", "r.longitude"},
+	{"image_url", "r.image_url"},
+	{"image_attribution", "COALESCE(r.image_attribution, '')"},
+	{"geo_confidence", "r.geo_confidence"},
+	{"effective_discount", "r.effective_discount"},
+	{"free", "r.free"},
+	{"offer", "r.offer"},
+	{"percentage", "r.percentage"},
+	{"tags", "r.tags"},
+	{"payment_methods", "COALESCE(r.payment_methods, '{}')"},
+	{"location_restricted", "r.location_restricted"},
+	{"distance", ""},
+	{"cuisines", cuisinesAggregate},
+	{"meal_types", mealTypesAggregate},
+}
+
+// relatedFields are the aggregated relations that are only selected when
+// requested through include= (or named explicitly in fields=).
+var relatedFields = []string{"cuisines", "meal_types"}
+
+// requiredColumns are always selected: id identifies the row, and
+// location_restricted and distance drive geo privacy and distance ordering.
+var requiredColumns = map[string]bool{"id": true, "location_restricted": true, "distance": true}
+
+// ParseFields reads a comma-separated fields parameter. It returns nil (all
+// fields) when raw is empty, along with any names that are not selectable.
+func ParseFields(raw string) (fields, invalid []string) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	known := map[string]bool{}
+	for _, c := range restaurantColumns {
+		known[c.field] = true
+	}
+	for _, f := range splitList(raw, true) {
+		switch {
+		case f == "":
+		case known[f]:
+			fields = append(fields, f)
+		default:
+			invalid = append(invalid, f)
+		}
+	}
+	if len(fields) == 0 {
+		// Only unknown names were given; fall back to the full representation.
+		return nil, invalid
+	}
+	return fields, invalid
+}
+
+// ParseInclude reads the include parameter, returning def when it is absent.
+// An empty include= turns every relation off.
+func ParseInclude(query url.Values, def []string) (include, invalid []string) {
+	if !query.Has("include") {
+		return def, nil
+	}
+	include = []string{}
+	for _, f := range splitList(query.Get("include"), true) {
+		switch {
+		case f == "":
+		case slices.Contains(relatedFields, f):
+			include = append(include, f)
+		default:
+			invalid = append(invalid, f)
+		}
+	}
+	return include, invalid
+}
+
+// SelectColumns returns the columns to query for the requested fields and
+// included relations. withDistance is false for queries without a reference
+// point.
+func SelectColumns(fields, include []string, withDistance bool) []string {
+	var cols []string
+	for _, c := range restaurantColumns {
+		switch {
+		case c.field == "distance" && !withDistance:
+		case slices.Contains(relatedFields, c.field):
+			if slices.Contains(include, c.field) || slices.Contains(fields, c.field) {
+				cols = append(cols, c.field)
+			}
+		case fields == nil || requiredColumns[c.field] || slices.Contains(fields, c.field):
+			cols = append(cols, c.field)
+		}
+	}
+	return cols
+}
+
+// selectList renders cols as a SQL select list.
+func selectList(cols []string, distanceExpr string) string {
+	exprs := map[string]string{}
+	for _, c := range restaurantColumns {
+		exprs[c.field] = c.expr
+	}
+	parts := make([]string, 0, len(cols))
+	for _, c := range cols {
+		expr := exprs[c]
+		if c == "distance" {
+			expr = distanceExpr
+		}
+		parts = append(parts, fmt.Sprintf("%s AS %s", expr, c))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanRestaurant reads a row selected with the given columns, followed by
+// any extra columns the caller appended to the select list.
+func ScanRestaurant(row rowScanner, cols []string, extra ...interface{}) (models.Restaurant, error) {
+	var r models.Restaurant
+	var cuisinesJSON, mealTypesJSON []byte
+
+	dest := make([]interface{}, 0, len(cols))
+	for _, c := range cols {
+		switch c {
+		case "id":
+			dest = append(dest, &r.ID)
+		case "restaurant_name":
+			dest = append(dest, &r.RestaurantName)
+		case "display_name":
+			dest = append(dest, &r.DisplayName)
+		case "slug":
+			dest = append(dest, &r.Slug)
+		case "city":
+			dest = append(dest, &r.City)
+		case "area":
+			dest = append(dest, &r.Area)
+		case "cost_for_two":
+			dest = append(dest, &r.CostForTwo)
+		case "rating":
+			dest = append(dest, &r.Rating)
+		case "latitude":
+			dest = append(dest, &r.Latitude)
+		case "longitude":
+			dest = append(dest, &r.Longitude)
+		case "image_url":
+			dest = append(dest, &r.ImageURL)
+		case "image_attribution":
+			dest = append(dest, &r.ImageAttribution)
+		case "geo_confidence":
+			dest = append(dest, &r.GeoConfidence)
+		case "effective_discount":
+			dest = append(dest, &r.EffectiveDiscount)
+		case "free":
+			dest = append(dest, &r.Free)
+		case "offer":
+			dest = append(dest, &r.Offer)
+		case "percentage":
+			dest = append(dest, &r.Percentage)
+		case "tags":
+			dest = append(dest, pq.Array(&r.Tags))
+		case "payment_methods":
+			dest = append(dest, pq.Array(&r.PaymentMethods))
+		case "location_restricted":
+			dest = append(dest, &r.LocationRestricted)
+		case "distance":
+			dest = append(dest, &r.Distance)
+		case "cuisines":
+			dest = append(dest, &cuisinesJSON)
+		case "meal_types":
+			dest = append(dest, &mealTypesJSON)
+		}
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return r, err
+	}
+
+	if cuisinesJSON != nil {
+		json.Unmarshal(cuisinesJSON, &r.Cuisines)
+	}
+	if mealTypesJSON != nil {
+		json.Unmarshal(mealTypesJSON, &r.MealTypes)
+	}
+	return r, nil
+}
+
+// ProjectFields trims each restaurant to the requested JSON fields. With no
+// fields the restaurants are returned unchanged.
+func ProjectFields(restaurants []models.Restaurant, fields []string) interface{} {
+	if fields == nil {
+		return restaurants
+	}
+	projected := make([]interface{}, 0, len(restaurants))
+	for _, res := range restaurants {
+		projected = append(projected, projectRestaurant(res, fields))
+	}
+	return projected
+}
+
+// projectRestaurant trims a single restaurant to the requested JSON fields.
+func projectRestaurant(res models.Restaurant, fields []string) interface{} {
+	if fields == nil {
+		return res
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return out
+	}
+	var all map[string]json.RawMessage
+	json.Unmarshal(raw, &all)
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			out[f] = v
+		}
+		// distance_text goes with distance; it is not selectable on its own.
+		if v, ok := all["distance_text"]; ok && f == "distance" {
+			out["distance_text"] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/storage"
+	"eazyfind/tracker"
+)
+
+// MaxImageUploadBytes bounds an uploaded restaurant image.
+const MaxImageUploadBytes = 5 << 20
+
+// imageExtensions are the accepted upload content types.
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// FilesHandler serves objects from a local store through the signed URLs its
+// SignedURL returns. S3 stores sign their own URLs and never link here.
+func FilesHandler(store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		q := r.URL.Query()
+		if store == nil || !storage.VerifySignedURL(key, q.Get("expires"), q.Get("signature")) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		body, contentType, err := store.Get(key)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("File read error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "private, no-store")
+		io.Copy(w, body)
+	}
+}
+
+// SetRestaurantImageHandler replaces a restaurant's image with the request
+// body (JPEG, PNG or WebP, up to MaxImageUploadBytes), stored under
+// restaurants/<id>-<hash>.<ext>. The image worker never overwrites it.
+func SetRestaurantImageHandler(db *sql.DB, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		if store == nil {
+			http.Error(w, "File storage is not configured", http.StatusNotImplemented)
+			return
+		}
+		ext, ok := imageExtensions[r.Header.Get("Content-Type")]
+		if !ok {
+			http.Error(w, "Content-Type must be image/jpeg, image/png or image/webp", http.StatusUnsupportedMediaType)
+			return
+		}
+		version, ok := expectedVersion(w, r, "")
+		if !ok {
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImageUploadBytes))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Image must be at most %d bytes", MaxImageUploadBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(data) == 0 {
+			http.Error(w, "Image is empty", http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256(data)
+		key := fmt.Sprintf("restaurants/%d-%s.%s", id, hex.EncodeToString(sum[:8]), ext)
+
+		// A dry run checks the update without uploading.
+		imageURL := key
+		if !isDryRun(r) {
+			if imageURL, err = store.Put(key, r.Header.Get("Content-Type"), data); err != nil {
+				writeImageError(w, r, err)
+				return
+			}
+		}
+		res, err := adminExec(db, r, restaurantChanged(id), `
+			UPDATE restaurants SET image_url = $1, image_source = 'admin', image_status = 'STORED', image_attribution = NULL
+			WHERE id = $2 AND `+versionMatches("restaurants", "$3"), imageURL, id, version)
+		if err != nil {
+			writeImageError(w, r, err)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			if !isDryRun(r) {
+				store.Delete(key)
+			}
+			writeNotFoundOrConflict(db, w, r, "restaurants", id, "Restaurant not found")
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Updated: n}) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"image_url": imageURL})
+	}
+}
+
+func writeImageError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Restaurant image upload error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"eazyfind/flags"
+	"eazyfind/tracker"
+)
+
+// FlagsHandler lists every feature flag with its effective value and source.
+func FlagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags.List())
+}
+
+// SetFlagHandler turns {name} on or off for all instances.
+// Expects a JSON body of the form {"enabled": true}.
+func SetFlagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := flags.Get(name); !ok {
+		http.Error(w, "Unknown flag", http.StatusNotFound)
+		return
+	}
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		http.Error(w, "enabled is required", http.StatusBadRequest)
+		return
+	}
+	writeFlag(w, r, name, body.Enabled)
+}
+
+// ResetFlagHandler drops the stored value for {name}, so its FLAG_<NAME>
+// environment variable or default applies again.
+func ResetFlagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := flags.Get(name); !ok {
+		http.Error(w, "Unknown flag", http.StatusNotFound)
+		return
+	}
+	writeFlag(w, r, name, nil)
+}
+
+func writeFlag(w http.ResponseWriter, r *http.Request, name string, enabled *bool) {
+	// Flags are stored outside a transaction, so a dry run works out the
+	// change from the current state instead of writing it.
+	if state, _ := flags.Get(name); isDryRun(r) {
+		var s MutationSummary
+		switch {
+		case enabled == nil && state.Source == "db":
+			s.Deleted = 1
+		case enabled == nil || (state.Source == "db" && state.Enabled == *enabled):
+			s.Skipped = 1
+		case state.Source == "db":
+			s.Updated = 1
+		default:
+			s.Created = 1
+		}
+		writeDryRun(w, r, s)
+		return
+	}
+	if err := flags.Set(name, enabled); err != nil {
+		log.Println("Feature flag update error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	state, _ := flags.Get(name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// DefaultStaleAfter is how long a city may go unscraped before it is flagged.
+const DefaultStaleAfter = 72 * time.Hour
+
+// staleAfter is read from STALE_DATA_AFTER (a Go duration such as "48h").
+var staleAfter = func() time.Duration {
+	v := os.Getenv("STALE_DATA_AFTER")
+	if v == "" {
+		return DefaultStaleAfter
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid STALE_DATA_AFTER=%q, using %s", v, DefaultStaleAfter)
+		return DefaultStaleAfter
+	}
+	return d
+}()
+
+// newFreshness builds freshness metadata from aggregated timestamps. Data that
+// has never been scraped counts as stale.
+func newFreshness(scraped, updated sql.NullTime, threshold time.Duration) *models.DataFreshness {
+	f := &models.DataFreshness{Stale: true}
+	if scraped.Valid {
+		f.LastScrapedAt = &scraped.Time
+		f.Stale = time.Since(scraped.Time) > threshold
+	}
+	if updated.Valid {
+		f.LastUpdatedAt = &updated.Time
+	}
+	return f
+}
+
+// StaleCitiesHandler reports cities whose deal data has not been scraped
+// within the staleness threshold, oldest first. ?stale_after=48h overrides
+// the threshold; ?all=true lists every city with its freshness.
+func StaleCitiesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		threshold := staleAfter
+		if v := r.URL.Query().Get("stale_after"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "stale_after must be a positive duration such as 48h", http.StatusBadRequest)
+				return
+			}
+			threshold = d
+		}
+		all := r.URL.Query().Get("all") == "true"
+
+		rows, err := db.Query(`
+			SELECT ci.id, ci.city_name, ci.is_published, f.cnt, f.scraped, f.updated
+			FROM cities ci
+			LEFT JOIN LATERAL (
+				SELECT COUNT(*) AS cnt, MAX(r.last_scraped_at) AS scraped, MAX(r.updated_at) AS updated
+				FROM restaurants r WHERE r.city ILIKE ci.city_name AND r.is_duplicate = false
+			) f ON true
+			ORDER BY f.scraped ASC NULLS FIRST, ci.id ASC`)
+		if err != nil {
+			log.Println("Freshness report query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		cities := []models.City{}
+		for rows.Next() {
+			var c models.City
+			var scraped, updated sql.NullTime
+			if err := rows.Scan(&c.ID, &c.CityName, &c.IsPublished, &c.RestaurantCount, &scraped, &updated); err != nil {
+				continue
+			}
+			c.DataFreshness = newFreshness(scraped, updated, threshold)
+			if all || c.DataFreshness.Stale {
+				cities = append(cities, c)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"stale_after": threshold.String(),
+			"cities":      cities,
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"eazyfind/geo"
+	"eazyfind/middleware"
+	"eazyfind/tracker"
+)
+
+const (
+	// GeocodePerMinute is how many addresses one client may geocode a minute.
+	GeocodePerMinute = 20
+	// MaxGeocodeAddress bounds the address length in characters.
+	MaxGeocodeAddress = 200
+)
+
+type geocodeWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	geocodeMu      sync.Mutex
+	geocodeWindows = map[string]*geocodeWindow{}
+)
+
+// GeocodeHandler resolves ?address= to candidate places through the
+// server's geocoding provider, so clients never hold provider keys. Each
+// client (API key, else session, else IP) is limited to GeocodePerMinute
+// calls; cached addresses count too.
+func GeocodeHandler(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "address is required", http.StatusBadRequest)
+		return
+	}
+	if len([]rune(address)) > MaxGeocodeAddress {
+		http.Error(w, "address must be at most "+strconv.Itoa(MaxGeocodeAddress)+" characters", http.StatusBadRequest)
+		return
+	}
+	if !geo.ForwardConfigured() {
+		http.Error(w, "Geocoding is not configured", http.StatusNotImplemented)
+		return
+	}
+	if !allowGeocode(geocodeClient(r)) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	places, err := geo.Geocode(address)
+	if errors.Is(err, geo.ErrBusy) || errors.Is(err, geo.ErrCircuitOpen) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Geocoding is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Println("Geocode error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Geocoding failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": places})
+}
+
+// geocodeClient identifies the caller for rate limiting.
+func geocodeClient(r *http.Request) string {
+	if k := middleware.GetAPIKey(r.Context()); k != nil {
+		return "key:" + strconv.FormatInt(k.ID, 10)
+	}
+	if id := middleware.GetSessionID(r.Context()); id != "" {
+		return "session:" + id
+	}
+	return "ip:" + clientIP(r)
+}
+
+func allowGeocode(client string) bool {
+	geocodeMu.Lock()
+	defer geocodeMu.Unlock()
+	now := time.Now()
+	win, ok := geocodeWindows[client]
+	if !ok || now.Sub(win.start) >= time.Minute {
+		if len(geocodeWindows) >= 100000 {
+			// Crude bound: every window restarts rather than tracking expiry.
+			geocodeWindows = map[string]*geocodeWindow{}
+		}
+		win = &geocodeWindow{start: now}
+		geocodeWindows[client] = win
+	}
+	win.count++
+	return win.count <= GeocodePerMinute
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// geoBacklogKinds are the row sets GeoStatusHandler can list.
+var geoBacklogKinds = map[string]string{
+	"failed":  "COALESCE(r.geo_status, 'PENDING') <> 'RESOLVED' AND r.last_geo_error IS NOT NULL",
+	"suspect": fmt.Sprintf("r.geo_status = 'RESOLVED' AND r.geo_confidence < %g", DefaultLowConfidenceBelow),
+}
+
+// GeoStatusHandler reports geocoding backlog health: restaurant counts by
+// geo_status per city, failed restaurants by last_geo_error, and a page of failed rows (with the worker's last
+// error) and suspect ones (resolved with geo_confidence below 0.6). Supports
+// ?city=, ?kind=failed|suspect (default both), ?error= (a last_geo_error
+// code such as ZERO_RESULTS), ?page= and ?limit= (default 50, max 200).
+func GeoStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var kind string
+		switch k := query.Get("kind"); k {
+		case "":
+			kind = fmt.Sprintf("((%s) OR (%s))", geoBacklogKinds["failed"], geoBacklogKinds["suspect"])
+		case "failed", "suspect":
+			kind = geoBacklogKinds[k]
+		default:
+			http.Error(w, "kind must be failed or suspect", http.StatusBadRequest)
+			return
+		}
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > 200 {
+			limit = 50
+		}
+
+		b := &QueryBuilder{}
+		if city := query.Get("city"); city != "" {
+			b.Where(FoldedILike(canonicalCity(db, city), "r.city_norm"))
+		}
+		cities, err := geoStatusByCity(db, b.WhereClause(), b.Args())
+		if err != nil {
+			writeGeoStatusError(w, r, err)
+			return
+		}
+		errorCounts, err := geoErrorCounts(db, b.WhereClause(), b.Args())
+		if err != nil {
+			writeGeoStatusError(w, r, err)
+			return
+		}
+
+		b.Where(Raw(kind))
+		if code := query.Get("error"); code != "" {
+			b.Where(Compare("r.last_geo_error", "=", code))
+		}
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*) FROM restaurants r "+b.WhereClause(), b.Args()...).Scan(&total); err != nil {
+			writeGeoStatusError(w, r, err)
+			return
+		}
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT r.id, COALESCE(r.restaurant_name, ''), COALESCE(r.city, ''), COALESCE(r.area, ''), COALESCE(r.geo_status, 'PENDING'),
+			       r.geo_confidence, COALESCE(r.last_geo_error, ''), r.last_geo_attempt_at, r.geocoded_at
+			FROM restaurants r
+			%s
+			ORDER BY r.last_geo_attempt_at DESC NULLS LAST, r.id
+			LIMIT %d OFFSET %d`, b.WhereClause(), limit, (page-1)*limit), b.Args()...)
+		if err != nil {
+			writeGeoStatusError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		backlog := []models.GeoBacklogRow{}
+		for rows.Next() {
+			var g models.GeoBacklogRow
+			if err := rows.Scan(&g.RestaurantID, &g.RestaurantName, &g.City, &g.Area, &g.GeoStatus,
+				&g.Confidence, &g.LastError, &g.LastAttemptAt, &g.GeocodedAt); err == nil {
+				backlog = append(backlog, g)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"cities":      cities,
+			"errors":      errorCounts,
+			"rows":        backlog,
+			"page":        page,
+			"pages":       int(math.Ceil(float64(total) / float64(limit))),
+			"total_count": total,
+		})
+	}
+}
+
+// geoStatusByCity counts the restaurants matching where by city and
+// geo_status.
+func geoStatusByCity(db *sql.DB, where string, args []interface{}) ([]models.GeoStatusCity, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT COALESCE(r.city, ''), COALESCE(r.geo_status, 'PENDING'), COUNT(*),
+		       COUNT(*) FILTER (WHERE %s), COUNT(*) FILTER (WHERE %s)
+		FROM restaurants r
+		%s
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, geoBacklogKinds["failed"], geoBacklogKinds["suspect"], where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := []models.GeoStatusCity{}
+	for rows.Next() {
+		var city, status string
+		var n, failed, suspect int
+		if err := rows.Scan(&city, &status, &n, &failed, &suspect); err != nil {
+			log.Println("Geo status scan error:", err)
+			continue
+		}
+		if len(cities) == 0 || cities[len(cities)-1].City != city {
+			cities = append(cities, models.GeoStatusCity{City: city, Counts: map[string]int{}})
+		}
+		c := &cities[len(cities)-1]
+		c.Counts[status] = n
+		c.Failed += failed
+		c.Suspect += suspect
+	}
+	return cities, rows.Err()
+}
+
+// geoErrorCounts counts the unresolved restaurants matching where by their
+// last geocoding error.
+func geoErrorCounts(db *sql.DB, where string, args []interface{}) (map[string]int, error) {
+	if where == "" {
+		where = "WHERE " + geoBacklogKinds["failed"]
+	} else {
+		where += " AND " + geoBacklogKinds["failed"]
+	}
+	rows, err := db.Query("SELECT r.last_geo_error, COUNT(*) FROM restaurants r "+where+" GROUP BY 1", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var code string
+		var n int
+		if err := rows.Scan(&code, &n); err == nil {
+			counts[code] = n
+		}
+	}
+	return counts, rows.Err()
+}
+
+func writeGeoStatusError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Geo status error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	// DefaultHeatmapCell is the grid size in degrees (~1km at Indian latitudes).
+	DefaultHeatmapCell = 0.01
+	MinHeatmapCell     = 0.001
+	MaxHeatmapCell     = 0.5
+)
+
+// HeatmapHandler snaps resolved restaurant locations in a city onto a grid with
+// ST_SnapToGrid and returns per-cell counts and average discount, optionally
+// restricted to a single cuisine. The grid size is configurable via cell, but
+// never finer than the caller's coordinate precision; location-restricted
+// restaurants are only counted for admins.
+func HeatmapHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		city := CityRef{Name: query.Get("city")}
+		if city.Name == "" {
+			http.Error(w, "city is required", http.StatusBadRequest)
+			return
+		}
+		if c, ok := ResolveCity(db, city.Name); ok {
+			city = c
+		}
+
+		cell, err := parseFinite(query.Get("cell"))
+		if err != nil || cell <= 0 {
+			cell = DefaultHeatmapCell
+		}
+		// Cells are no finer than the coordinates the caller may see, so a
+		// count of one does not pin a restaurant more precisely.
+		minCell := max(MinHeatmapCell, math.Pow(10, -float64(coordinateDecimals(r))))
+		cell = min(max(cell, minCell), MaxHeatmapCell)
+
+		b := &QueryBuilder{}
+		size := b.Arg(cell)
+		b.Where(
+			FoldedILike(city.Name, "r.city_norm"),
+			Raw("r.is_duplicate = false"),
+			Raw("r.geo_status = 'RESOLVED'"),
+			Raw(tenantScope(middleware.GetTenant(r.Context()), "r.city")),
+		)
+		if !middleware.IsAdmin(r) {
+			b.Where(Raw("r.location_restricted = false"))
+		}
+		if !includeUnpublished(r) {
+			b.Where(Raw("EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"))
+		}
+		if cuisine := query.Get("cuisine"); cuisine != "" {
+			b.Where(InSubquery(cuisineNameSubquery, []string{cuisine}))
+		}
+
+		rows, err := db.Query(`
+			SELECT ST_GeoHash(cell, 7), ST_Y(cell), ST_X(cell), COUNT(*), AVG(COALESCE(discount, 0))
+			FROM (
+				SELECT ST_SnapToGrid(r.geo::geometry, `+size+`) AS cell, r.effective_discount AS discount
+				FROM restaurants r `+b.WhereClause()+`
+			) g
+			GROUP BY cell
+			ORDER BY COUNT(*) DESC
+		`, b.Args()...)
+		if err != nil {
+			log.Println("Heatmap query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		cells := []models.HeatmapCell{}
+		for rows.Next() {
+			var c models.HeatmapCell
+			if err := rows.Scan(&c.Geohash, &c.Latitude, &c.Longitude, &c.Count, &c.AvgDiscount); err == nil {
+				cells = append(cells, c)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"city":      city.Name,
+			"city_slug": city.Slug,
+			"cell":      cell,
+			"cells":     cells,
+		})
+	}
+}
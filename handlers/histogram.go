@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	DefaultCostBuckets = 20
+	MaxCostBuckets     = 50
+	// CostHistogramPercentile bounds the regular buckets, so a few outliers
+	// don't stretch the slider; costs above it share the open-ended top bucket.
+	CostHistogramPercentile = 0.99
+)
+
+// CostHistogramHandler returns bucketed counts of cost_for_two for the
+// restaurants matching the search filters, for the price range slider.
+// min_cost and max_cost are ignored so the slider can show the whole
+// distribution around the selected range. Rows without a cost are skipped.
+func CostHistogramHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		normalized, unknown := NormalizeQuery(r.URL.Query())
+		unknown = slices.DeleteFunc(unknown, func(k string) bool { return k == "buckets" })
+		reportUnknownParams(w, unknown)
+		if warnings := ValidateSearchQuery(normalized, unknown); normalized.Get("strict") == "true" && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
+
+		buckets, err := strconv.Atoi(r.URL.Query().Get("buckets"))
+		if err != nil || buckets <= 0 {
+			buckets = DefaultCostBuckets
+		}
+		buckets = min(buckets, MaxCostBuckets)
+
+		p := ParseSearchParams(r.URL.Query())
+		p.MinCost, p.MaxCost = 0, 0
+		p.IncludeUnpublished = includeUnpublished(r)
+		p.Tenant = middleware.GetTenant(r.Context())
+		PrepareSearch(db, &p)
+
+		var low, high, top sql.NullInt64
+		var total int
+		q, args := costQuery(p, `SELECT MIN(r.cost_for_two), MAX(r.cost_for_two),
+			percentile_disc(`+strconv.FormatFloat(CostHistogramPercentile, 'f', -1, 64)+`) WITHIN GROUP (ORDER BY r.cost_for_two), COUNT(*)`, "")
+		if err := db.QueryRow(q, args...).Scan(&low, &high, &top, &total); err != nil {
+			writeHistogramError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		resp := map[string]interface{}{
+			"total_count": total,
+			"buckets":     []models.CostBucket{},
+		}
+		if total == 0 {
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		width := costBucketWidth(int(low.Int64), int(top.Int64), buckets)
+		start := int(low.Int64) / width * width
+		n := max(1, int(math.Ceil(float64(int(top.Int64)-start+1)/float64(width))))
+
+		counts := make([]int, n)
+		q, args = costQuery(p, "SELECT LEAST((r.cost_for_two - "+strconv.Itoa(start)+") / "+strconv.Itoa(width)+", "+strconv.Itoa(n-1)+") AS bucket, COUNT(*)", "GROUP BY bucket")
+		rows, err := db.Query(q, args...)
+		if err != nil {
+			writeHistogramError(w, r, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var i, c int
+			if err := rows.Scan(&i, &c); err == nil && i >= 0 && i < n {
+				counts[i] = c
+			}
+		}
+		if err := rows.Err(); err != nil {
+			writeHistogramError(w, r, err)
+			return
+		}
+
+		out := make([]models.CostBucket, n)
+		for i := range out {
+			out[i] = models.CostBucket{Min: start + i*width, Count: counts[i]}
+			if upper := start + (i+1)*width; i < n-1 || int(high.Int64) < upper {
+				out[i].Max = &upper
+			}
+		}
+		resp["min"] = low.Int64
+		resp["max"] = high.Int64
+		resp["bucket_size"] = width
+		resp["buckets"] = out
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// costQuery renders selectList over the restaurants matching p that have a
+// cost, followed by tail.
+func costQuery(p SearchParams, selectList, tail string) (string, []interface{}) {
+	b := &QueryBuilder{}
+	_, preds := SearchPredicates(b, p)
+	b.Where(preds...)
+	b.Where(Raw("r.cost_for_two > 0"))
+	return selectList + " FROM restaurants r " + b.WhereClause() + " " + tail, b.Args()
+}
+
+// costBucketWidth picks a round bucket width (1, 2 or 5 times a power of
+// ten, at least 10) that splits [low, high] into at most buckets buckets.
+func costBucketWidth(low, high, buckets int) int {
+	raw := float64(high-low+1) / float64(buckets)
+	for width := 10; ; width *= 10 {
+		for _, m := range []int{1, 2, 5} {
+			if float64(width*m) >= raw {
+				return width * m
+			}
+		}
+	}
+}
+
+func writeHistogramError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Cost histogram query error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// RestaurantHistoryHandler returns the recorded versions of a restaurant's cost,
+// rating, offer and discount, newest first.
+func RestaurantHistoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT COALESCE(cost_for_two, 0), COALESCE(rating, 0), COALESCE(offer, ''), COALESCE(effective_discount, 0), recorded_at
+			FROM restaurant_history
+			WHERE restaurant_id = $1
+			ORDER BY recorded_at DESC
+			LIMIT 500
+		`, id)
+		if err != nil {
+			log.Println("History query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		history := []models.RestaurantSnapshot{}
+		for rows.Next() {
+			var s models.RestaurantSnapshot
+			if err := rows.Scan(&s.CostForTwo, &s.Rating, &s.Offer, &s.EffectiveDiscount, &s.RecordedAt); err == nil {
+				history = append(history, s)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"restaurant_id": strconv.FormatInt(id, 10),
+			"history":       history,
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	DefaultImpersonationTTL = 15 * time.Minute
+	MaxImpersonationTTL     = time.Hour
+)
+
+// CreateImpersonationTokenHandler mints a token for support to act as a user.
+// Expects {"user_id", "reason", "created_by"} and optionally "scope" ("read",
+// the default, or "write") and "ttl_minutes" (default 15, max 60). The
+// plaintext token is returned exactly once.
+func CreateImpersonationTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			UserID     string `json:"user_id"`
+			Reason     string `json:"reason"`
+			CreatedBy  string `json:"created_by"`
+			Scope      string `json:"scope"`
+			TTLMinutes int    `json:"ttl_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		body.UserID, body.Reason, body.CreatedBy = strings.TrimSpace(body.UserID), strings.TrimSpace(body.Reason), strings.TrimSpace(body.CreatedBy)
+		if body.UserID == "" || body.Reason == "" || body.CreatedBy == "" {
+			http.Error(w, "user_id, reason and created_by are required", http.StatusBadRequest)
+			return
+		}
+		if body.Scope == "" {
+			body.Scope = "read"
+		}
+		if body.Scope != "read" && body.Scope != "write" {
+			http.Error(w, "scope must be read or write", http.StatusBadRequest)
+			return
+		}
+		ttl := DefaultImpersonationTTL
+		if body.TTLMinutes != 0 {
+			ttl = time.Duration(body.TTLMinutes) * time.Minute
+			if ttl <= 0 || ttl > MaxImpersonationTTL {
+				http.Error(w, "ttl_minutes must be between 1 and "+strconv.Itoa(int(MaxImpersonationTTL/time.Minute)), http.StatusBadRequest)
+				return
+			}
+		}
+
+		raw := make([]byte, 24)
+		rand.Read(raw)
+		token := middleware.ImpersonationTokenPrefix + hex.EncodeToString(raw)
+
+		t := models.ImpersonationToken{UserID: body.UserID, Scope: body.Scope, Reason: body.Reason, CreatedBy: body.CreatedBy, Token: token}
+		err := db.QueryRow(`
+			INSERT INTO impersonation_tokens (token_hash, user_id, scope, reason, created_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5, now() + $6 * interval '1 second')
+			RETURNING id, created_at, expires_at
+		`, middleware.HashAPIKey(token), t.UserID, t.Scope, t.Reason, t.CreatedBy, int(ttl.Seconds())).Scan(&t.ID, &t.CreatedAt, &t.ExpiresAt)
+		if err != nil {
+			log.Println("Impersonation token insert error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Impersonation token %d minted by %s for user %s (%s, until %s): %s", t.ID, t.CreatedBy, t.UserID, t.Scope, t.ExpiresAt.Format(time.RFC3339), t.Reason)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// ImpersonationTokenHandler returns a token (without its secret) and the
+// audit log of every request made with it, oldest first.
+func ImpersonationTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid token id", http.StatusBadRequest)
+			return
+		}
+		var t models.ImpersonationToken
+		err = db.QueryRow(`
+			SELECT id, user_id, scope, reason, created_by, created_at, expires_at, revoked_at
+			FROM impersonation_tokens WHERE id = $1
+		`, id).Scan(&t.ID, &t.UserID, &t.Scope, &t.Reason, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Impersonation token not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeImpersonationError(w, r, err)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT method, path, status, request_id, requested_at
+			FROM impersonation_requests WHERE token_id = $1 ORDER BY requested_at, id
+		`, id)
+		if err != nil {
+			writeImpersonationError(w, r, err)
+			return
+		}
+		defer rows.Close()
+		requests := []models.ImpersonationRequest{}
+		for rows.Next() {
+			var req models.ImpersonationRequest
+			if err := rows.Scan(&req.Method, &req.Path, &req.Status, &req.RequestID, &req.RequestedAt); err == nil {
+				requests = append(requests, req)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": t, "requests": requests})
+	}
+}
+
+// RevokeImpersonationTokenHandler ends a token before it expires.
+func RevokeImpersonationTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid token id", http.StatusBadRequest)
+			return
+		}
+		res, err := db.Exec("UPDATE impersonation_tokens SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1", id)
+		if err != nil {
+			writeImpersonationError(w, r, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Impersonation token not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeImpersonationError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Impersonation token query error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"eazyfind/maintenance"
+)
+
+// RecomputeDiscountsHandler starts a background job that re-derives
+// effective_discount from offer text. Expects an optional body
+// {"city": "...", "ids": [1, 2], "dry_run": true}; responds 202 with the job.
+func RecomputeDiscountsHandler(db *sql.DB) http.HandlerFunc {
+	return runTask(db, "recompute-discounts", "/api/admin/maintenance/jobs/")
+}
+
+// RequeueGeocodesHandler starts a background job that resets resolved
+// restaurants, or with "failed": true FAILED ones, to PENDING so the
+// geocoding worker resolves them again. Expects {"city": "...",
+// "confidence_below": 0.5, "before": "2025-01-31", "ids": [1, 2],
+// "dry_run": true} with at least one filter; responds 202 with the job.
+func RequeueGeocodesHandler(db *sql.DB) http.HandlerFunc {
+	return runTask(db, "requeue-geocodes", "/api/admin/tasks/jobs/")
+}
+
+// RunTaskHandler starts the maintenance task named in the path as a
+// background job. The optional JSON body is passed to the task as its
+// parameters; {"dry_run": true}, or ?dry_run=true, is honoured by tasks
+// that support it.
+func RunTaskHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runTask(db, r.PathValue("name"), "/api/admin/tasks/jobs/")(w, r)
+	}
+}
+
+func runTask(db *sql.DB, name, jobPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		task, ok := maintenance.Lookup(name)
+		if !ok {
+			http.Error(w, "Unknown task", http.StatusNotFound)
+			return
+		}
+		params, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		params = bytes.TrimSpace(params)
+		var opts struct {
+			DryRun bool `json:"dry_run"`
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &opts); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		if isDryRun(r) && !opts.DryRun {
+			if params, err = withDryRun(params); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			opts.DryRun = true
+		}
+		if opts.DryRun && !task.DryRun {
+			http.Error(w, "Task does not support dry_run", http.StatusBadRequest)
+			return
+		}
+		if task.Validate != nil {
+			if err := task.Validate(params); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		job := maintenance.Start(task.Name, opts.DryRun, func(ctx context.Context, j *maintenance.Job) error {
+			return task.Run(ctx, db, params, j)
+		})
+		status := job.Status()
+
+		w.Header().Set("Location", jobPath+status.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// withDryRun sets "dry_run": true in a task's JSON object params, so
+// ?dry_run=true reaches tasks that only read their body.
+func withDryRun(params []byte) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &fields); err != nil {
+			return nil, err
+		}
+	}
+	fields["dry_run"] = json.RawMessage("true")
+	return json.Marshal(fields)
+}
+
+// ListTasksHandler lists the registered maintenance tasks and the jobs run
+// since the process started, newest first.
+func ListTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tasks": maintenance.Tasks(),
+		"jobs":  maintenance.List(),
+	})
+}
+
+// MaintenanceJobHandler reports the progress of a maintenance job.
+func MaintenanceJobHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := maintenance.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// CancelMaintenanceJobHandler stops a running maintenance job after its
+// current batch. Batches already committed are kept.
+func CancelMaintenanceJobHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := maintenance.Cancel(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
@@ -3,32 +3,75 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"eazyfind/cache"
+	"eazyfind/geo"
+	"eazyfind/middleware"
 	"eazyfind/models"
+	"eazyfind/tracker"
 )
 
-// CitiesHandler retrieves all available cities from the database for filter population.
+// includeUnpublished reports whether an admin asked to see hidden rows via
+// include_unpublished=true. The flag is ignored for everyone else.
+func includeUnpublished(r *http.Request) bool {
+	return r.URL.Query().Get("include_unpublished") == "true" && middleware.IsAdmin(r)
+}
+
+// metadataCache holds aggregated metadata responses that are expensive to
+// compute but change slowly. For a minute after an entry expires it is still
+// served while one request reloads it, so a popular city's lists are not
+// rebuilt by every request that arrives at once.
+var metadataCache = cache.NewStale(5*time.Minute, time.Minute)
+
+// metadataEntry is a cached list with the time it was loaded, which is its
+// Last-Modified: a 304 then always refers to the body this instance serves,
+// not to newer rows it has not loaded yet.
+type metadataEntry struct {
+	value    interface{}
+	loadedAt time.Time
+}
+
+// cachedMetadata returns the value cached under key, calling load when it is
+// missing, and when it was loaded.
+func cachedMetadata(key string, load func() (interface{}, error)) (interface{}, time.Time, error) {
+	v, err := metadataCache.GetOrLoad(key, func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return metadataEntry{value: value, loadedAt: time.Now()}, nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	e := v.(metadataEntry)
+	return e.value, e.loadedAt, nil
+}
+
+// CitiesHandler retrieves all published cities for filter population, each with
+// its active restaurant count and three most common cuisines.
 func CitiesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query("SELECT id, city_name, COALESCE(latitude, 0), COALESCE(longitude, 0), COALESCE(geo_status, 'PENDING') FROM cities ORDER BY id ASC")
+		all := includeUnpublished(r)
+		tenant := middleware.GetTenant(r.Context())
+		cities, loadedAt, err := listCities(db, all, tenant)
 		if err != nil {
 			log.Println("Cities query error:", err)
+			tracker.CaptureRequest(r, err)
 			http.Error(w, "Something went wrong", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
-
-		cities := []models.City{}
-		for rows.Next() {
-			var c models.City
-			if err := rows.Scan(&c.ID, &c.CityName, &c.Latitude, &c.Longitude, &c.GeoStatus); err == nil {
-				cities = append(cities, c)
-			}
+		if notModifiedSince(w, r, loadedAt) {
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -36,47 +79,186 @@ func CitiesHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// CuisinesHandler retrieves the full list of cuisines to populate the searchable multi-select filter.
+// listCities returns the cities (only published ones unless all) of tenant,
+// or of every tenant when nil, each with its restaurant count and three most
+// common cuisines, and when the list was loaded. The list is cached in
+// metadataCache.
+func listCities(db *sql.DB, all bool, tenant *middleware.Tenant) ([]models.City, time.Time, error) {
+	cacheKey := "cities:" + strconv.FormatBool(all)
+	if tenant != nil {
+		cacheKey += ":" + tenant.Slug
+	}
+	v, loadedAt, err := cachedMetadata(cacheKey, func() (interface{}, error) {
+		return loadCities(db, all, tenant)
+	})
+	if err != nil {
+		return nil, loadedAt, err
+	}
+	return v.([]models.City), loadedAt, nil
+}
+
+// loadCities runs the listCities query.
+func loadCities(db *sql.DB, all bool, tenant *middleware.Tenant) ([]models.City, error) {
+	b := &QueryBuilder{}
+	if !all {
+		b.Where(Raw("ci.is_published"))
+	}
+	b.Where(Raw(tenantScope(tenant, "ci.city_name")))
+	where := b.WhereClause()
+	// Counts and top cuisines are computed per city in lateral subqueries so
+	// the whole listing is a single round-trip.
+	rows, err := db.Query(`
+		SELECT ci.id, ci.city_name, COALESCE(ci.slug, ''), COALESCE(ci.latitude, 0), COALESCE(ci.longitude, 0), COALESCE(ci.geo_status, 'PENDING'), ci.is_published,
+		       ` + versionOf("ci") + `::text, rc.cnt, rc.scraped, rc.updated, COALESCE(tc.top, '[]')
+		FROM cities ci
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS cnt, MAX(r.last_scraped_at) AS scraped, MAX(r.updated_at) AS updated
+			FROM restaurants r WHERE r.city ILIKE ci.city_name AND r.is_duplicate = false
+		) rc ON true
+		LEFT JOIN LATERAL (
+			SELECT json_agg(t.cuisine_name ORDER BY t.n DESC, t.cuisine_name) AS top FROM (
+				SELECT c.cuisine_name, COUNT(*) AS n
+				FROM restaurants r
+				JOIN restaurant_cuisines x ON x.restaurant_id = r.id
+				JOIN cuisines c ON c.id = x.cuisine_id
+				WHERE r.city ILIKE ci.city_name AND r.is_duplicate = false
+				GROUP BY c.cuisine_name
+				ORDER BY n DESC, c.cuisine_name
+				LIMIT 3
+			) t
+		) tc ON true
+		` + where + `
+		ORDER BY ci.id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := []models.City{}
+	for rows.Next() {
+		var c models.City
+		var top []byte
+		var scraped, updated sql.NullTime
+		if err := rows.Scan(&c.ID, &c.CityName, &c.Slug, &c.Latitude, &c.Longitude, &c.GeoStatus, &c.IsPublished, &c.Version, &c.RestaurantCount, &scraped, &updated, &top); err == nil {
+			json.Unmarshal(top, &c.TopCuisines)
+			c.DataFreshness = newFreshness(scraped, updated, staleAfter)
+			cities = append(cities, c)
+		}
+	}
+	return cities, nil
+}
+
+// usageQuery counts active restaurants per taxonomy item. Without a city, items
+// with no restaurants are dropped unless include_empty=true. With ?city= the list
+// is always restricted, via EXISTS, to items present in that city.
+func usageQuery(db *sql.DB, r *http.Request, table, nameCol, junction, fk string) (string, []interface{}) {
+	b := &QueryBuilder{}
+	join := "r.id = j.restaurant_id AND r.is_duplicate = false"
+	filter, having := "", "HAVING COUNT(r.id) > 0"
+	if r.URL.Query().Get("include_empty") == "true" {
+		having = ""
+	}
+	if city := r.URL.Query().Get("city"); city != "" {
+		ph := b.Arg(canonicalCity(db, city))
+		join += " AND r.city ILIKE " + ph
+		filter = fmt.Sprintf(`WHERE EXISTS (
+			SELECT 1 FROM %s j2 JOIN restaurants r2 ON r2.id = j2.restaurant_id
+			WHERE j2.%s = t.id AND r2.city ILIKE %s AND r2.is_duplicate = false
+		)`, junction, fk, ph)
+		having = ""
+	}
+	return fmt.Sprintf(`
+		SELECT t.id, t.%s, COUNT(r.id)
+		FROM %s t
+		LEFT JOIN %s j ON j.%s = t.id
+		LEFT JOIN restaurants r ON %s
+		%s
+		GROUP BY t.id, t.%s
+		%s
+		ORDER BY %s
+	`, nameCol, table, junction, fk, join, filter, nameCol, having, taxonomyOrder(r, nameCol)), b.Args()
+}
+
+// taxonomyOrder maps ?order= onto a whitelisted ORDER BY: popular sorts by
+// restaurant count, alpha by name, and the default keeps insertion order.
+func taxonomyOrder(r *http.Request, nameCol string) string {
+	switch r.URL.Query().Get("order") {
+	case "popular":
+		return "COUNT(r.id) DESC, t." + nameCol + " ASC"
+	case "alpha":
+		return "lower(t." + nameCol + ") ASC"
+	}
+	return "t.id ASC"
+}
+
+// taxonomyCacheKey shards cached taxonomy lists per (case-insensitive) city
+// and the other list parameters.
+func taxonomyCacheKey(kind string, r *http.Request) string {
+	q := r.URL.Query()
+	filters := url.Values{}
+	for _, k := range []string{"city", "include_empty", "order", "group"} {
+		if v := strings.ToLower(strings.TrimSpace(q.Get(k))); v != "" {
+			filters.Set(k, v)
+		}
+	}
+	return cache.Key(kind, filters)
+}
+
+// groupByLetter buckets cuisines under their uppercase initial ("#" for
+// non-letters), preserving the order they arrive in.
+func groupByLetter(cuisines []models.Cuisine) []map[string]interface{} {
+	groups := []map[string]interface{}{}
+	index := map[string]int{}
+	for _, c := range cuisines {
+		letter := "#"
+		if first := strings.ToUpper(strings.TrimSpace(c.CuisineName)); first != "" && first[0] >= 'A' && first[0] <= 'Z' {
+			letter = first[:1]
+		}
+		i, ok := index[letter]
+		if !ok {
+			i = len(groups)
+			index[letter] = i
+			groups = append(groups, map[string]interface{}{"letter": letter, "cuisines": []models.Cuisine{}})
+		}
+		groups[i]["cuisines"] = append(groups[i]["cuisines"].([]models.Cuisine), c)
+	}
+	return groups
+}
+
+// CuisinesHandler retrieves the cuisines used by at least one restaurant (optionally
+// within ?city=) with their counts, to populate the searchable multi-select filter.
+// order=popular|alpha changes the ordering and group=letter buckets by initial.
 func CuisinesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query("SELECT id, cuisine_name FROM cuisines ORDER BY id ASC")
+		resp, loadedAt, err := listCuisines(db, r)
 		if err != nil {
 			log.Println("Cuisines query error:", err)
+			tracker.CaptureRequest(r, err)
 			http.Error(w, "Something went wrong", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
-
-		cuisines := []models.Cuisine{}
-		for rows.Next() {
-			var c models.Cuisine
-			if err := rows.Scan(&c.ID, &c.CuisineName); err == nil {
-				cuisines = append(cuisines, c)
-			}
+		if notModifiedSince(w, r, loadedAt) {
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(cuisines)
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-// MealTypesHandler retrieves all defined meal categories (e.g., Breakfast, Lunch, Dinner).
+// MealTypesHandler retrieves the meal categories (e.g., Breakfast, Lunch, Dinner) in
+// use, optionally within ?city=, with their restaurant counts.
 func MealTypesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query("SELECT id, meal_type FROM meal_types ORDER BY id ASC")
+		meals, loadedAt, err := listMealTypes(db, r)
 		if err != nil {
 			log.Println("MealTypes query error:", err)
+			tracker.CaptureRequest(r, err)
 			http.Error(w, "Something went wrong", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
-
-		meals := []models.MealType{}
-		for rows.Next() {
-			var m models.MealType
-			if err := rows.Scan(&m.ID, &m.MealType); err == nil {
-				meals = append(meals, m)
-			}
+		if notModifiedSince(w, r, loadedAt) {
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -85,7 +267,8 @@ func MealTypesHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // DetectCityHandler identifies the user's city based on latitude and longitude coordinates,
-// using reverse geocoding via Geoapify or a nearest-neighbor distance search in the database.
+// using the cities' service areas, then reverse geocoding via Geoapify, then a
+// nearest-neighbor distance search in the database.
 func DetectCityHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		latStr := r.URL.Query().Get("lat")
@@ -96,67 +279,84 @@ func DetectCityHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		lat, _ := strconv.ParseFloat(latStr, 64)
-		lon, _ := strconv.ParseFloat(lonStr, 64)
+		lat, lon, ok := parseLatLon(latStr, lonStr)
+		if !ok {
+			http.Error(w, "lat and lon must be valid coordinates", http.StatusBadRequest)
+			return
+		}
 
 		log.Printf("Detecting city for lat: %v, lon: %v", lat, lon)
 
-		apiKey := os.Getenv("GEOAPIFY_API_KEY")
-		resolvedCity := ""
+		// A city whose service area contains the point wins outright; the
+		// smallest area is picked where areas overlap.
+		var dbCity, slug string
+		err := db.QueryRow(fmt.Sprintf(`
+			SELECT city_name, slug FROM cities
+			WHERE is_published AND ST_Contains(service_area, ST_SetSRID(ST_MakePoint($1, $2), 4326)) %s
+			ORDER BY ST_Area(service_area)
+			LIMIT 1`, andTenantScope(r, "city_name")), lon, lat).Scan(&dbCity, &slug)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"city": dbCity, "city_slug": slug})
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Service area lookup error:", err)
+		}
 
-		if apiKey != "" {
-			apiURL := fmt.Sprintf("https://api.geoapify.com/v1/geocode/reverse?lat=%f&lon=%f&apiKey=%s", lat, lon, apiKey)
-			resp, err := http.Get(apiURL)
-			if err != nil {
+		// Geoapify is best effort: when it is unconfigured, failing or busy the
+		// nearest published city is used instead.
+		resolvedCity, fallback := "", "disabled"
+		if os.Getenv("GEOAPIFY_API_KEY") != "" || geo.FakeProviders {
+			city, err := geo.ReverseCity(lat, lon)
+			switch {
+			case errors.Is(err, geo.ErrCircuitOpen):
+				fallback = "circuit_open"
+			case errors.Is(err, geo.ErrBusy):
+				fallback = "busy"
+			case err != nil:
 				log.Println("Geoapify request error:", err)
-			} else {
-				defer resp.Body.Close()
-				var result struct {
-					Features []struct {
-						Properties struct {
-							City string `json:"city"`
-						} `json:"properties"`
-					} `json:"features"`
-				}
-				if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && len(result.Features) > 0 {
-					city := result.Features[0].Properties.City
-					log.Printf("Geoapify resolved city: %s", city)
-					if city == "Delhi" || city == "Noida" || city == "Gurugram" || city == "New Delhi" || city == "Gurgaon" {
-						resolvedCity = "delhi-ncr"
-					} else {
-						resolvedCity = city
-					}
-				} else if err != nil {
-					log.Println("Geoapify decode error:", err)
+				fallback = "error"
+			default:
+				log.Printf("Geoapify resolved city: %s", city)
+				fallback = "unmatched"
+				if city == "Delhi" || city == "Noida" || city == "Gurugram" || city == "New Delhi" || city == "Gurgaon" {
+					resolvedCity = "delhi-ncr"
+				} else {
+					resolvedCity = city
 				}
 			}
 		}
 
-		var dbCity string
 		if resolvedCity != "" {
-			err := db.QueryRow("SELECT city_name FROM cities WHERE city_name ILIKE $1", resolvedCity).Scan(&dbCity)
+			err := db.QueryRow(fmt.Sprintf(`
+				SELECT city_name, slug FROM cities
+				WHERE (slug = slugify($1) OR city_name_norm = fold_text($1) OR slugify($1) = ANY(aliases)) AND is_published %s
+				LIMIT 1`, andTenantScope(r, "city_name")), resolvedCity).Scan(&dbCity, &slug)
 			if err == nil {
 				log.Printf("Found match in DB for resolved city: %s", dbCity)
 				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{"city": dbCity})
+				json.NewEncoder(w).Encode(map[string]string{"city": dbCity, "city_slug": slug})
 				return
 			}
 			log.Printf("Resolved city %s not found in DB, falling back to closest", resolvedCity)
 		}
+		geo.RecordReverseFallback(fallback)
 
-		// Use fmt.Sprintf for coordinates to avoid prepared statement issues in this specific environment if params fail
 		// Cast the point to geography explicitly to match the 'geo' column type
 		query := fmt.Sprintf(`
-			SELECT city_name 
+			SELECT city_name, slug
 			FROM cities 
-			ORDER BY ST_Distance(geo, ST_SetSRID(ST_MakePoint(%f, %f), 4326)::geography) ASC 
+			WHERE is_published %s
+			ORDER BY ST_Distance(geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) ASC 
 			LIMIT 1
-		`, lon, lat)
+		`, andTenantScope(r, "city_name"))
 
-		err := db.QueryRow(query).Scan(&dbCity)
+		err = db.QueryRow(query, lon, lat).Scan(&dbCity, &slug)
 
 		if err != nil {
 			log.Printf("Closest city query error for lat %f, lon %f: %v", lat, lon, err)
+			tracker.CaptureRequest(r, err)
 			http.Error(w, "Could not detect city", http.StatusInternalServerError)
 			return
 		}
@@ -164,10 +364,146 @@ func DetectCityHandler(db *sql.DB) http.HandlerFunc {
 		log.Printf("Closest city found in DB: %s", dbCity)
 
 		if dbCity == "delhi-ncr" || dbCity == "delhi" || dbCity == "noida" || dbCity == "gurugram" {
-			dbCity = "delhi-ncr"
+			dbCity, slug = "delhi-ncr", "delhi-ncr"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"city": dbCity, "city_slug": slug})
+	}
+}
+
+// DetectAreaRadiusMeters is how far from the point restaurants are counted
+// when the area comes from the listings.
+const DetectAreaRadiusMeters = 1500
+
+// DetectAreaHandler labels coordinates with their neighbourhood, for headings
+// like "Deals near Indiranagar". Geoapify's neighbourhood or suburb is used
+// when available (cached per ~1km); otherwise, or when it has none, the most
+// common area among published restaurants within DetectAreaRadiusMeters.
+func DetectAreaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lat, lon, ok := parseLatLon(r.URL.Query().Get("lat"), r.URL.Query().Get("lon"))
+		if !ok {
+			http.Error(w, "lat and lon must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		var address geo.Address
+		source := ""
+		if os.Getenv("GEOAPIFY_API_KEY") != "" || geo.FakeProviders {
+			a, err := geo.Reverse(lat, lon)
+			switch {
+			case errors.Is(err, geo.ErrCircuitOpen):
+				geo.RecordReverseFallback("circuit_open")
+			case errors.Is(err, geo.ErrBusy):
+				geo.RecordReverseFallback("busy")
+			case err != nil:
+				log.Println("Geoapify request error:", err)
+				geo.RecordReverseFallback("error")
+			default:
+				address = a
+				if a.Area != "" {
+					source = "geocoder"
+				}
+			}
+		}
+
+		if address.Area == "" {
+			var area, city string
+			err := db.QueryRow(fmt.Sprintf(`
+				SELECT r.area, MIN(r.city) FROM restaurants r
+				WHERE r.geo IS NOT NULL AND COALESCE(r.area, '') <> '' AND r.is_duplicate = false
+				  AND ST_DWithin(r.geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, %d)
+				  AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published) %s
+				GROUP BY r.area ORDER BY COUNT(*) DESC, r.area LIMIT 1`, DetectAreaRadiusMeters, andTenantScope(r, "r.city")), lon, lat).Scan(&area, &city)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Println("Detect area query error:", err)
+				tracker.CaptureRequest(r, err)
+				http.Error(w, "Could not detect area", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				address.Area, source = area, "restaurants"
+				if address.City == "" {
+					address.City = city
+				}
+			}
+		}
+		if address.Area == "" {
+			http.Error(w, "No area found near this point", http.StatusNotFound)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"city": dbCity})
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]string{
+			"area":              address.Area,
+			"city":              address.City,
+			"formatted_address": address.Formatted,
+			"source":            source,
+		})
+	}
+}
+
+// listCuisines returns the cuisines for CuisinesHandler's query parameters,
+// grouped by letter with group=letter, and when they were loaded. Cached in
+// metadataCache.
+func listCuisines(db *sql.DB, r *http.Request) (interface{}, time.Time, error) {
+	return cachedMetadata(taxonomyCacheKey("cuisines", r), func() (interface{}, error) {
+		return loadCuisines(db, r)
+	})
+}
+
+// loadCuisines runs the listCuisines query.
+func loadCuisines(db *sql.DB, r *http.Request) (interface{}, error) {
+	query, args := usageQuery(db, r, "cuisines", "cuisine_name", "restaurant_cuisines", "cuisine_id")
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cuisines := []models.Cuisine{}
+	for rows.Next() {
+		var c models.Cuisine
+		if err := rows.Scan(&c.ID, &c.CuisineName, &c.RestaurantCount); err == nil {
+			cuisines = append(cuisines, c)
+		}
+	}
+	var resp interface{} = cuisines
+	if r.URL.Query().Get("group") == "letter" {
+		resp = groupByLetter(cuisines)
+	}
+	return resp, nil
+}
+
+// listMealTypes returns the meal types for MealTypesHandler's query
+// parameters, and when they were loaded. Cached in metadataCache.
+func listMealTypes(db *sql.DB, r *http.Request) ([]models.MealType, time.Time, error) {
+	v, loadedAt, err := cachedMetadata(taxonomyCacheKey("meal_types", r), func() (interface{}, error) {
+		return loadMealTypes(db, r)
+	})
+	if err != nil {
+		return nil, loadedAt, err
+	}
+	return v.([]models.MealType), loadedAt, nil
+}
+
+// loadMealTypes runs the listMealTypes query.
+func loadMealTypes(db *sql.DB, r *http.Request) ([]models.MealType, error) {
+	query, args := usageQuery(db, r, "meal_types", "meal_type", "restaurant_meal_types", "meal_type_id")
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	meals := []models.MealType{}
+	for rows.Next() {
+		var m models.MealType
+		if err := rows.Scan(&m.ID, &m.MealType, &m.RestaurantCount); err == nil {
+			meals = append(meals, m)
+		}
 	}
+	return meals, nil
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"eazyfind/codec"
+	"eazyfind/models"
+)
+
+// responseFormat picks the first supported media type from the Accept header,
+// defaulting to JSON.
+func responseFormat(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case codec.ContentTypeProtobuf, "application/protobuf":
+			return codec.ContentTypeProtobuf
+		case codec.ContentTypeMsgpack, "application/x-msgpack":
+			return codec.ContentTypeMsgpack
+		case "application/json", "*/*":
+			return "application/json"
+		}
+	}
+	return "application/json"
+}
+
+// writeSearchResponse encodes a search response in the negotiated format.
+// resp is the JSON/MessagePack document; protobuf carries only the
+// restaurants, pages and total count defined in proto/restaurant.proto.
+func writeSearchResponse(w http.ResponseWriter, r *http.Request, resp interface{}, restaurants []models.Restaurant, pages, totalCount int) {
+	w.Header().Add("Vary", "Accept")
+	format := responseFormat(r)
+	w.Header().Set("Content-Type", format)
+
+	switch format {
+	case codec.ContentTypeProtobuf:
+		w.Write(codec.MarshalSearchResponse(restaurants, pages, totalCount))
+	case codec.ContentTypeMsgpack:
+		body, err := codec.MarshalMsgpack(resp)
+		if err != nil {
+			log.Println("Msgpack encode error:", err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	default:
+		json.NewEncoder(w).Encode(resp)
+	}
+}
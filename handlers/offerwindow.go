@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eazyfind/tracker"
+	"eazyfind/worker"
+
+	"github.com/lib/pq"
+)
+
+// localWallTime is the active_at layout for a time given in the city's own
+// clock rather than as an instant.
+const localWallTime = "2006-01-02T15:04"
+
+// parseActiveAt accepts an RFC 3339 instant, or a local wall-clock time
+// ("2006-01-02T15:04") that is read in each restaurant's city timezone.
+func parseActiveAt(v string) (at time.Time, local bool, ok bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, true
+	}
+	if t, err := time.Parse(localWallTime, v); err == nil {
+		return t, true, true
+	}
+	return time.Time{}, false, false
+}
+
+// cityLocalTime returns a SQL timestamp for at (now when zero) on the clock
+// of r.city, falling back to worker.LocalTimezone for cities without one.
+// A local at is already on that clock and is used as is.
+func cityLocalTime(b *QueryBuilder, at time.Time, local bool) string {
+	if local {
+		return fmt.Sprintf("%s::timestamp", b.Arg(at.Format("2006-01-02 15:04:05")))
+	}
+	instant := "now()"
+	if !at.IsZero() {
+		instant = b.Arg(at) + "::timestamptz"
+	}
+	return fmt.Sprintf(`(%s AT TIME ZONE COALESCE(
+		(SELECT ci.timezone FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.timezone IS NOT NULL LIMIT 1), %s))`,
+		instant, b.Arg(worker.LocalTimezone))
+}
+
+// offerWindowOpen is true when the restaurant's offer window contains the
+// local timestamp expression t. It must only be used for rows with a window.
+func offerWindowOpen(t string) string {
+	return fmt.Sprintf(`(r.offer_window_days IS NULL OR EXTRACT(DOW FROM %[1]s)::int = ANY(r.offer_window_days))
+		AND CASE WHEN r.offer_window_start <= r.offer_window_end
+			THEN %[1]s::time >= r.offer_window_start AND %[1]s::time < r.offer_window_end
+			ELSE %[1]s::time >= r.offer_window_start OR %[1]s::time < r.offer_window_end END`, t)
+}
+
+// SetOfferWindowHandler limits a restaurant's offer to a local time window.
+// Expects {"days": [1,2,3,4,5], "start": "15:00", "end": "19:00"}; days are
+// 0 = Sunday and may be omitted for every day. An optional "version" (or
+// If-Match) makes the edit fail with 409 if the restaurant changed since.
+func SetOfferWindowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Days    []int  `json:"days"`
+			Start   string `json:"start"`
+			End     string `json:"end"`
+			Version string `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		start, errStart := time.Parse("15:04", body.Start)
+		end, errEnd := time.Parse("15:04", body.End)
+		if errStart != nil || errEnd != nil || start.Equal(end) {
+			http.Error(w, "start and end must be different HH:MM times", http.StatusBadRequest)
+			return
+		}
+		var days []int64
+		for _, d := range body.Days {
+			if d < 0 || d > 6 {
+				http.Error(w, "days must be 0-6 (0 = Sunday)", http.StatusBadRequest)
+				return
+			}
+			days = append(days, int64(d))
+		}
+		var dayArg interface{}
+		if len(days) > 0 {
+			dayArg = pq.Array(days)
+		}
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+
+		res, err := adminExec(db, r, restaurantChanged(id), `
+			UPDATE restaurants SET offer_window_days = $1, offer_window_start = $2, offer_window_end = $3
+			WHERE id = $4 AND `+versionMatches("restaurants", "$5")+`
+		`, dayArg, body.Start, body.End, id, version)
+		writeOfferWindowUpdate(db, w, r, id, res, err)
+	}
+}
+
+// DeleteOfferWindowHandler makes a restaurant's offer valid at all times again.
+func DeleteOfferWindowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, "")
+		if !ok {
+			return
+		}
+		res, err := adminExec(db, r, restaurantChanged(id), `
+			UPDATE restaurants SET offer_window_days = NULL, offer_window_start = NULL, offer_window_end = NULL
+			WHERE id = $1 AND `+versionMatches("restaurants", "$2")+`
+		`, id, version)
+		writeOfferWindowUpdate(db, w, r, id, res, err)
+	}
+}
+
+func writeOfferWindowUpdate(db *sql.DB, w http.ResponseWriter, r *http.Request, id int64, res sql.Result, err error) {
+	if err != nil {
+		log.Println("Offer window update error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		writeNotFoundOrConflict(db, w, r, "restaurants", id, "Restaurant not found")
+		return
+	}
+	if writeDryRun(w, r, MutationSummary{Updated: n}) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCityTimezoneHandler sets the IANA timezone that offer windows and busy
+// times in a city are evaluated in. Expects {"timezone": "Asia/Dubai"}; an
+// empty string restores the default. An optional "version" (or If-Match)
+// makes the edit fail with 409 if the city changed since.
+func SetCityTimezoneHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid city id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Timezone *string `json:"timezone"`
+			Version  string  `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Timezone == nil {
+			http.Error(w, "timezone is required", http.StatusBadRequest)
+			return
+		}
+
+		// The database evaluates the windows, so it decides which names are valid.
+		var tz sql.NullString
+		if *body.Timezone != "" {
+			var known bool
+			if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = $1)", *body.Timezone).Scan(&known); err == nil && !known {
+				http.Error(w, "Unknown timezone", http.StatusBadRequest)
+				return
+			}
+			tz = sql.NullString{String: *body.Timezone, Valid: true}
+		}
+
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+		res, err := adminExec(db, r, cityChanged(id), "UPDATE cities SET timezone = $1 WHERE id = $2 AND "+versionMatches("cities", "$3"), tz, id, version)
+		if err != nil {
+			log.Println("City timezone update error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			writeNotFoundOrConflict(db, w, r, "cities", id, "City not found")
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Updated: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
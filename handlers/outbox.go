@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+
+	"eazyfind/middleware"
+	"eazyfind/outbox"
+)
+
+// Admin edits record outbox events instead of dropping caches directly, so a
+// cache is only invalidated once the edit has committed.
+func init() {
+	clearMetadata := func(context.Context, outbox.Event) error {
+		metadataCache.Clear()
+		return nil
+	}
+	outbox.Handle(outbox.TopicRestaurantChanged, clearMetadata)
+	outbox.Handle(outbox.TopicCityChanged, clearMetadata)
+	outbox.Handle(outbox.TopicSynonymsChanged, func(context.Context, outbox.Event) error {
+		synonyms.invalidate()
+		return nil
+	})
+	outbox.Handle(outbox.TopicAPIKeyChanged, func(context.Context, outbox.Event) error {
+		middleware.InvalidateAPIKeys()
+		return nil
+	})
+}
+
+// restaurantChanged is the outbox message for edits to restaurants ids.
+func restaurantChanged(ids ...int64) outbox.Message {
+	return outbox.Message{Topic: outbox.TopicRestaurantChanged, Payload: map[string]interface{}{"ids": ids}}
+}
+
+// cityChanged is the outbox message for an edit to city id.
+func cityChanged(id int64) outbox.Message {
+	return outbox.Message{Topic: outbox.TopicCityChanged, Payload: map[string]interface{}{"id": id}}
+}
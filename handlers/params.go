@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"eazyfind/deals"
+	"eazyfind/geo"
+)
+
+// UnknownParamsHeader lists query keys the server ignored, to help clients debug.
+const UnknownParamsHeader = "X-Unknown-Params"
+
+// SearchParamKeys lists the canonical (snake_case) search parameters.
+var SearchParamKeys = []string{
+	"page", "limit", "name", "min_cost", "max_cost", "rating", "discount", "free",
+	"city", "area", "cuisine_ids", "meal_type_ids", "cuisine", "meal_type", "cuisines", "meal_types",
+	"lat", "lon", "radius", "within_minutes", "mode", "points", "route", "buffer", "sort", "expand",
+	"delivers_to", "quiet_now", "happy_hour", "active_at", "tag", "brand",
+	"payment_method", "units", "diverse",
+}
+
+// paramAliases maps spellings that don't squash to a canonical key.
+var paramAliases = map[string]string{
+	"q": "name",
+}
+
+// globalParamKeys are accepted on every endpoint and never reported as unknown.
+var globalParamKeys = []string{"include_unpublished", "strict", "precision", "fields", "include", "snapshot"}
+
+// canonicalKeys indexes canonical names by their squashed form (lowercase,
+// separators removed) so minCost, min_cost, MIN-COST all resolve to min_cost.
+var canonicalKeys = func() map[string]string {
+	m := map[string]string{}
+	for _, k := range append(append([]string{}, SearchParamKeys...), globalParamKeys...) {
+		m[squashKey(k)] = k
+	}
+	for alias, k := range paramAliases {
+		m[alias] = k
+	}
+	return m
+}()
+
+func squashKey(k string) string {
+	k = strings.ToLower(k)
+	return strings.NewReplacer("_", "", "-", "").Replace(k)
+}
+
+// NormalizeQuery rewrites query keys to their canonical spelling and returns the
+// keys it did not recognize. When several spellings of one key are present the
+// canonical spelling wins.
+func NormalizeQuery(query url.Values) (url.Values, []string) {
+	normalized := url.Values{}
+	var unknown []string
+	exact := map[string]bool{}
+	for key, vals := range query {
+		canon, ok := canonicalKeys[squashKey(key)]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		if key == canon {
+			normalized[canon] = vals
+			exact[canon] = true
+		} else if !exact[canon] && len(normalized.Get(canon)) == 0 {
+			normalized[canon] = vals
+		}
+	}
+	sort.Strings(unknown)
+	return normalized, unknown
+}
+
+// reportUnknownParams advertises ignored query keys in a debug header.
+func reportUnknownParams(w http.ResponseWriter, unknown []string) {
+	if len(unknown) > 0 {
+		w.Header().Set(UnknownParamsHeader, strings.Join(unknown, ","))
+	}
+}
+
+// ParamWarning describes a query parameter that was invalid or could not be applied.
+type ParamWarning struct {
+	Param   string `json:"param"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// numericRanges bounds the numeric search parameters; a zero max means unbounded.
+var numericRanges = map[string][2]float64{
+	"page":           {1, 0},
+	"limit":          {1, MaxLimit},
+	"min_cost":       {0, 0},
+	"max_cost":       {0, 0},
+	"rating":         {0, 5},
+	"discount":       {0, 100},
+	"lat":            {-90, 90},
+	"lon":            {-180, 180},
+	"radius":         {1, MaxRadius},
+	"within_minutes": {1, MaxWithinMinutes},
+	"buffer":         {1, MaxRouteBuffer},
+}
+
+// parseFinite parses a float parameter, rejecting "NaN" and "Inf", which
+// strconv.ParseFloat accepts and which slip past range checks because every
+// comparison with NaN is false.
+func parseFinite(raw string) (float64, error) {
+	f, err := strconv.ParseFloat(raw, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return 0, &strconv.NumError{Func: "ParseFloat", Num: raw, Err: strconv.ErrSyntax}
+	}
+	return f, err
+}
+
+// parseLatLon parses a coordinate pair, reporting false unless both are
+// finite numbers within range.
+func parseLatLon(latStr, lonStr string) (lat, lon float64, ok bool) {
+	lat, errLat := parseFinite(latStr)
+	lon, errLon := parseFinite(lonStr)
+	if errLat != nil || errLon != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// ValidateSearchQuery reports every search parameter that ParseSearchParams
+// would ignore or clamp. The query should already be normalized.
+func ValidateSearchQuery(query url.Values, unknown []string) []ParamWarning {
+	var warnings []ParamWarning
+	for _, k := range unknown {
+		warnings = append(warnings, ParamWarning{Param: k, Value: query.Get(k), Message: "unknown parameter"})
+	}
+
+	keys := make([]string, 0, len(numericRanges))
+	for k := range numericRanges {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		raw := query.Get(k)
+		if raw == "" {
+			continue
+		}
+		n, err := parseFinite(raw)
+		bounds := numericRanges[k]
+		switch {
+		case err != nil:
+			warnings = append(warnings, ParamWarning{Param: k, Value: raw, Message: "must be a number"})
+		case n < bounds[0] || (bounds[1] != 0 && n > bounds[1]):
+			msg := fmt.Sprintf("must be at least %g", bounds[0])
+			if bounds[1] != 0 {
+				msg = fmt.Sprintf("must be between %g and %g", bounds[0], bounds[1])
+			}
+			warnings = append(warnings, ParamWarning{Param: k, Value: raw, Message: msg})
+		}
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil {
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 {
+			limit = DefaultLimit
+		}
+		if last := maxPage(min(limit, MaxLimit)); page > last {
+			warnings = append(warnings, ParamWarning{Param: "page", Value: query.Get("page"), Message: fmt.Sprintf("must be at most %d at this limit; narrow the filters to reach later results", last)})
+		}
+	}
+	for _, k := range []string{"cuisine_ids", "meal_type_ids", "cuisines", "meal_types"} {
+		if v := query.Get(k); v != "" && len(splitList(v, false)) > MaxFilterValues {
+			warnings = append(warnings, ParamWarning{Param: k, Message: fmt.Sprintf("at most %d values are used", MaxFilterValues)})
+		}
+	}
+	if v := query.Get("name"); len([]rune(v)) > MaxNameLength {
+		warnings = append(warnings, ParamWarning{Param: "name", Message: fmt.Sprintf("only the first %d characters are used", MaxNameLength)})
+	}
+	if (query.Get("lat") == "") != (query.Get("lon") == "") {
+		warnings = append(warnings, ParamWarning{Param: "lat", Message: "lat and lon must be given together"})
+	}
+	if minC, maxC := query.Get("min_cost"), query.Get("max_cost"); minC != "" && maxC != "" {
+		lo, errLo := strconv.Atoi(minC)
+		hi, errHi := strconv.Atoi(maxC)
+		if errLo == nil && errHi == nil && hi > 0 && lo > hi {
+			warnings = append(warnings, ParamWarning{Param: "min_cost", Value: minC, Message: "must not exceed max_cost"})
+		}
+	}
+	for _, k := range []string{"free", "quiet_now", "happy_hour", "diverse"} {
+		if v := query.Get(k); v != "" && v != "true" && v != "false" {
+			warnings = append(warnings, ParamWarning{Param: k, Value: v, Message: "must be true or false"})
+		}
+	}
+	if v := query.Get("sort"); v != "" {
+		if _, ok := sortOrders[v]; !ok {
+			warnings = append(warnings, ParamWarning{Param: "sort", Value: v, Message: "unsupported sort"})
+		}
+	}
+	if v := query.Get("mode"); v != "" && !geo.IsolineModes[v] {
+		warnings = append(warnings, ParamWarning{Param: "mode", Value: v, Message: "must be walk or drive"})
+	}
+	if v := query.Get("points"); v != "" && len(parsePoints(v)) < 2 {
+		warnings = append(warnings, ParamWarning{Param: "points", Value: v, Message: "needs at least two lat,lon pairs separated by ';'"})
+	}
+	if v := query.Get("active_at"); v != "" {
+		if _, _, ok := parseActiveAt(v); !ok {
+			warnings = append(warnings, ParamWarning{Param: "active_at", Value: v, Message: "must be an RFC 3339 time or a local 2006-01-02T15:04"})
+		}
+	}
+	if _, invalid := parsePaymentMethods(query.Get("payment_method")); len(invalid) > 0 {
+		warnings = append(warnings, ParamWarning{Param: "payment_method", Value: strings.Join(invalid, ","), Message: "unknown payment method"})
+	}
+	if v := query.Get("units"); v != "" && v != "km" && v != "mi" {
+		warnings = append(warnings, ParamWarning{Param: "units", Value: v, Message: "must be km or mi"})
+	}
+	if v := query.Get("delivers_to"); v != "" && len(parsePoints(v)) != 1 {
+		warnings = append(warnings, ParamWarning{Param: "delivers_to", Value: v, Message: "must be a single lat,lon pair"})
+	}
+	if v := query.Get("route"); v != "" {
+		if route, err := geo.DecodePolyline(v); err != nil || len(route) < 2 {
+			warnings = append(warnings, ParamWarning{Param: "route", Message: "must be an encoded polyline with at least two points"})
+		}
+	}
+	if _, invalid := ParseFields(query.Get("fields")); len(invalid) > 0 {
+		warnings = append(warnings, ParamWarning{Param: "fields", Value: strings.Join(invalid, ","), Message: "unknown field"})
+	}
+	if v := query.Get("snapshot"); v != "" {
+		if _, err := DecodeSnapshot(v); err != nil {
+			warnings = append(warnings, ParamWarning{Param: "snapshot", Value: v, Message: "invalid snapshot token; start paging again without it"})
+		}
+	}
+	if _, invalid := ParseInclude(query, nil); len(invalid) > 0 {
+		warnings = append(warnings, ParamWarning{Param: "include", Value: strings.Join(invalid, ","), Message: "must be cuisines or meal_types"})
+	}
+	for _, k := range []string{"cuisine_ids", "meal_type_ids"} {
+		for _, id := range splitList(query.Get(k), true) {
+			if _, err := strconv.ParseInt(id, 10, 64); id != "" && err != nil {
+				warnings = append(warnings, ParamWarning{Param: k, Value: id, Message: "must be a list of numeric ids"})
+			}
+		}
+	}
+	return warnings
+}
+
+// unresolvedWarnings converts taxonomy names that matched nothing into warnings.
+func unresolvedWarnings(unresolved []UnresolvedFilter) []ParamWarning {
+	var warnings []ParamWarning
+	for _, u := range unresolved {
+		warnings = append(warnings, ParamWarning{Param: u.Param, Value: u.Value, Message: "no matching entry"})
+	}
+	return warnings
+}
+
+// writeStrictError rejects a strict-mode request with 422 and the full list of problems.
+func writeStrictError(w http.ResponseWriter, warnings []ParamWarning) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "invalid_parameters",
+		"details": warnings,
+	})
+}
+
+// parsePaymentMethods splits a comma-separated payment_method parameter into
+// the known method names and those that are not recognised.
+func parsePaymentMethods(raw string) (methods, invalid []string) {
+	for _, m := range strings.Split(raw, ",") {
+		m = strings.ToLower(strings.TrimSpace(m))
+		switch {
+		case m == "":
+		case deals.IsPaymentMethod(m):
+			methods = append(methods, m)
+		default:
+			invalid = append(invalid, m)
+		}
+	}
+	return methods, invalid
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/models"
+	"eazyfind/outbox"
+	"eazyfind/tracker"
+)
+
+// QuietBusyness is the busyness below which a restaurant counts as quiet for
+// quiet_now=true.
+const QuietBusyness = 40
+
+// SetPopularTimesHandler replaces a restaurant's busy times with imported
+// ones, which estimation never overwrites. Expects a JSON array of
+// {"day": 0-6 (0 = Sunday), "hour": 0-23, "busyness": 0-100} in local time.
+func SetPopularTimesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		var slots []models.PopularTime
+		if err := json.NewDecoder(r.Body).Decode(&slots); err != nil || len(slots) == 0 {
+			http.Error(w, "Expected a non-empty JSON array of {day, hour, busyness}", http.StatusBadRequest)
+			return
+		}
+		var invalid []string
+		for i, s := range slots {
+			if s.Day < 0 || s.Day > 6 || s.Hour < 0 || s.Hour > 23 || s.Busyness < 0 || s.Busyness > 100 {
+				invalid = append(invalid, fmt.Sprintf("slot %d: day must be 0-6, hour 0-23 and busyness 0-100", i))
+			}
+		}
+		if len(invalid) > 0 {
+			// A dry run lists every bad slot; the real request is rejected whole.
+			if !writeDryRun(w, r, MutationSummary{Skipped: int64(len(slots)), Errors: invalid}) {
+				http.Error(w, "day must be 0-6, hour 0-23 and busyness 0-100", http.StatusBadRequest)
+			}
+			return
+		}
+		body, _ := json.Marshal(slots)
+
+		var summary MutationSummary
+		var res sql.Result
+		tx, err := db.Begin()
+		if err == nil {
+			defer tx.Rollback()
+			res, err = tx.Exec("DELETE FROM popular_times WHERE restaurant_id = $1", id)
+		}
+		if err == nil {
+			summary.Deleted, _ = res.RowsAffected()
+			res, err = tx.Exec(`
+				INSERT INTO popular_times (restaurant_id, day, hour, busyness, source)
+				SELECT $1, s.day, s.hour, s.busyness, 'import'
+				FROM json_to_recordset($2::json) AS s(day SMALLINT, hour SMALLINT, busyness SMALLINT)
+				ON CONFLICT (restaurant_id, day, hour) DO UPDATE SET busyness = EXCLUDED.busyness, updated_at = now()
+			`, id, string(body))
+		}
+		if err == nil {
+			summary.Created, _ = res.RowsAffected()
+			if writeDryRun(w, r, summary) {
+				return
+			}
+			err = outbox.Record(tx, restaurantChanged(id))
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Println("Popular times update error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeletePopularTimesHandler removes a restaurant's busy times; they are
+// estimated again on the next run if it has enough clicks.
+func DeletePopularTimesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		res, err := adminExec(db, r, restaurantChanged(id), "DELETE FROM popular_times WHERE restaurant_id = $1", id)
+		if err != nil {
+			log.Println("Popular times delete error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if writeDryRun(w, r, MutationSummary{Deleted: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+)
+
+// MaxCoordinateDecimals is full precision (~0.1m); anything coarser is rounding.
+const MaxCoordinateDecimals = 6
+
+// publicCoordinateDecimals is the precision anonymous clients receive, read
+// from GEO_PRIVACY_DECIMALS (unset means full precision).
+var publicCoordinateDecimals = func() int {
+	v := os.Getenv("GEO_PRIVACY_DECIMALS")
+	if v == "" {
+		return MaxCoordinateDecimals
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > MaxCoordinateDecimals {
+		log.Printf("Invalid GEO_PRIVACY_DECIMALS=%q, coordinates will not be rounded", v)
+		return MaxCoordinateDecimals
+	}
+	return n
+}()
+
+// coordinateDecimals picks the precision for this request. API-key holders and
+// admins get full precision by default; anyone may ask for coarser coordinates
+// with ?precision=N but never finer than they are entitled to.
+func coordinateDecimals(r *http.Request) int {
+	decimals := publicCoordinateDecimals
+	if middleware.IsAdmin(r) || middleware.GetAPIKey(r.Context()) != nil {
+		decimals = MaxCoordinateDecimals
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("precision")); err == nil && n >= 0 && n < decimals {
+		decimals = n
+	}
+	return decimals
+}
+
+// metersPerDegree is the length of a degree of latitude, near enough for
+// sizing distance buckets.
+const metersPerDegree = 111320
+
+// ApplyGeoPrivacy rounds restaurant coordinates for the requesting client and
+// strips them entirely from location-restricted rows for non-admins. Distances
+// are rounded to the same precision, and dropped with the coordinates, so they
+// cannot be used to trilaterate what was hidden.
+func ApplyGeoPrivacy(r *http.Request, restaurants []models.Restaurant) {
+	decimals := coordinateDecimals(r)
+	admin := middleware.IsAdmin(r)
+	scale := math.Pow(10, float64(decimals))
+	for i := range restaurants {
+		res := &restaurants[i]
+		if res.LocationRestricted && !admin {
+			res.Latitude, res.Longitude, res.Distance = 0, 0, 0
+			continue
+		}
+		if decimals < MaxCoordinateDecimals {
+			res.Latitude = math.Round(res.Latitude*scale) / scale
+			res.Longitude = math.Round(res.Longitude*scale) / scale
+			res.Distance = bucketDistance(res.Distance, decimals)
+		}
+	}
+}
+
+// bucketDistance rounds meters to the distance one step of the last kept
+// coordinate decimal spans (about 111m at 3 decimals). Nonzero distances
+// never round down to zero.
+func bucketDistance(meters float64, decimals int) float64 {
+	if meters <= 0 {
+		return meters
+	}
+	bucket := metersPerDegree / math.Pow(10, float64(decimals))
+	return math.Max(bucket, math.Round(meters/bucket)*bucket)
+}
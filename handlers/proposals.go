@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/models"
+	"eazyfind/outbox"
+	"eazyfind/tracker"
+)
+
+// CuisineProposalsHandler lists classifier proposals, most confident first.
+// Supports ?status=pending (default), accepted or rejected, ?city= and ?limit=.
+func CuisineProposalsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = "pending"
+		}
+		if status != "pending" && status != "accepted" && status != "rejected" {
+			http.Error(w, "status must be pending, accepted or rejected", http.StatusBadRequest)
+			return
+		}
+		b := &QueryBuilder{}
+		b.Where(Compare("p.status", "=", status))
+		if city := r.URL.Query().Get("city"); city != "" {
+			b.Where(FoldedILike(city, "r.city_norm"))
+		}
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 200
+		}
+
+		rows, err := db.Query(`
+			SELECT p.restaurant_id, r.restaurant_name, p.cuisine_id, c.cuisine_name, p.confidence, p.source,
+			       p.status, p.created_at, p.reviewed_at
+			FROM cuisine_proposals p
+			JOIN restaurants r ON r.id = p.restaurant_id
+			JOIN cuisines c ON c.id = p.cuisine_id
+			`+b.WhereClause()+`
+			ORDER BY p.confidence DESC, p.restaurant_id, p.cuisine_id
+			LIMIT `+strconv.Itoa(limit), b.Args()...)
+		if err != nil {
+			writeProposalError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		proposals := []models.CuisineProposal{}
+		for rows.Next() {
+			var p models.CuisineProposal
+			if err := rows.Scan(&p.RestaurantID, &p.RestaurantName, &p.CuisineID, &p.CuisineName, &p.Confidence, &p.Source,
+				&p.Status, &p.CreatedAt, &p.ReviewedAt); err == nil {
+				proposals = append(proposals, p)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proposals)
+	}
+}
+
+// AcceptCuisineProposalHandler links a pending proposal's cuisine to its
+// restaurant. With If-Match it fails with 409 if the restaurant changed since
+// that version.
+func AcceptCuisineProposalHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewCuisineProposal(db, w, r, "accepted")
+	}
+}
+
+// RejectCuisineProposalHandler dismisses a pending proposal; the classifier
+// will not propose that cuisine for the restaurant again.
+func RejectCuisineProposalHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewCuisineProposal(db, w, r, "rejected")
+	}
+}
+
+func reviewCuisineProposal(db *sql.DB, w http.ResponseWriter, r *http.Request, status string) {
+	restaurantID, err1 := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	cuisineID, err2 := strconv.ParseInt(r.PathValue("cuisineId"), 10, 64)
+	if err1 != nil || err2 != nil || restaurantID <= 0 || cuisineID <= 0 {
+		http.Error(w, "Invalid restaurant or cuisine id", http.StatusBadRequest)
+		return
+	}
+	var version *int64
+	if status == "accepted" {
+		var ok bool
+		if version, ok = expectedVersion(w, r, ""); !ok {
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeProposalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if version != nil {
+		// Lock the restaurant so its cuisines cannot change before commit.
+		var current int64
+		err := tx.QueryRow("SELECT "+versionOf("r")+" FROM restaurants r WHERE r.id = $1 FOR UPDATE", restaurantID).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			writeProposalError(w, r, err)
+			return
+		}
+		if err == sql.ErrNoRows || current != *version {
+			writeNotFoundOrConflict(db, w, r, "restaurants", restaurantID, "Restaurant not found")
+			return
+		}
+	}
+
+	res, err := tx.Exec(`
+		UPDATE cuisine_proposals SET status = $3, reviewed_at = now()
+		WHERE restaurant_id = $1 AND cuisine_id = $2 AND status = 'pending'
+	`, restaurantID, cuisineID, status)
+	if err != nil {
+		writeProposalError(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Pending proposal not found", http.StatusNotFound)
+		return
+	}
+	summary := MutationSummary{Updated: 1}
+	if status == "accepted" {
+		res, err = tx.Exec(`
+			INSERT INTO restaurant_cuisines (restaurant_id, cuisine_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, restaurantID, cuisineID)
+		if err != nil {
+			writeProposalError(w, r, err)
+			return
+		}
+		summary.Created, _ = res.RowsAffected()
+	}
+	if writeDryRun(w, r, summary) {
+		return
+	}
+	if status == "accepted" {
+		if err := outbox.Record(tx, restaurantChanged(restaurantID)); err != nil {
+			writeProposalError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeProposalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeProposalError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Cuisine proposal error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
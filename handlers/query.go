@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortOrders is the whitelist of ORDER BY expressions a client may select via
+// the sort parameter. Sort values are only ever used as keys into this map and
+// never interpolated into SQL directly.
+var sortOrders = map[string]string{
+	"discount":     "effective_discount DESC, id ASC",
+	"rating_desc":  "rating DESC, id ASC",
+	"cost_asc":     "cost_for_two ASC, id ASC",
+	"distance_asc": "distance ASC, id ASC",
+}
+
+// OrderByClause resolves a client sort key to a whitelisted ORDER BY clause,
+// falling back to the "Best Deals" discount ordering for unknown keys.
+func OrderByClause(sort string) string {
+	expr, ok := sortOrders[sort]
+	if !ok {
+		expr = sortOrders["discount"]
+	}
+	return "ORDER BY " + expr
+}
+
+// Predicate renders a single SQL condition against a QueryBuilder. Arguments are
+// registered through the builder so placeholders are numbered in the order the
+// predicates are applied.
+type Predicate func(b *QueryBuilder) string
+
+// QueryBuilder accumulates WHERE conditions and their positional arguments.
+type QueryBuilder struct {
+	args       []interface{}
+	conditions []string
+}
+
+// Arg registers a value and returns its positional placeholder (e.g. "$3").
+func (b *QueryBuilder) Arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// ArgList registers every value and returns a comma-separated placeholder list.
+func (b *QueryBuilder) ArgList(vals []string) string {
+	placeholders := make([]string, 0, len(vals))
+	for _, v := range vals {
+		placeholders = append(placeholders, b.Arg(v))
+	}
+	return strings.Join(placeholders, ",")
+}
+
+// Point registers a longitude/latitude pair and returns a WGS84 point expression.
+func (b *QueryBuilder) Point(lon, lat float64) string {
+	return fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), 4326)", b.Arg(lon), b.Arg(lat))
+}
+
+// GeogPoint is Point cast to geography, for ST_Distance and ST_DWithin
+// against r.geo in meters rather than degrees.
+func (b *QueryBuilder) GeogPoint(lon, lat float64) string {
+	return b.Point(lon, lat) + "::geography"
+}
+
+// Where applies the predicates in order and appends the resulting conditions.
+func (b *QueryBuilder) Where(preds ...Predicate) {
+	for _, pred := range preds {
+		if cond := pred(b); cond != "" {
+			b.conditions = append(b.conditions, cond)
+		}
+	}
+}
+
+// WhereClause joins all conditions with AND, or returns "" when there are none.
+func (b *QueryBuilder) WhereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// Args returns the positional arguments in placeholder order.
+func (b *QueryBuilder) Args() []interface{} {
+	return b.args
+}
+
+// Raw adds a fixed condition that takes no arguments.
+func Raw(cond string) Predicate {
+	return func(b *QueryBuilder) string { return cond }
+}
+
+// Compare produces "column op $n", e.g. Compare("r.rating", ">=", 4.0).
+func Compare(column, op string, v interface{}) Predicate {
+	return func(b *QueryBuilder) string {
+		return fmt.Sprintf("%s %s %s", column, op, b.Arg(v))
+	}
+}
+
+// ILike matches any of the given columns case-insensitively against a single value.
+func ILike(v string, columns ...string) Predicate {
+	return func(b *QueryBuilder) string {
+		return ilikeAny(b.Arg(v), columns)
+	}
+}
+
+// FoldedILike is ILike against accent-folded columns such as r.city_norm and
+// r.area_norm: the value is folded the same way, so "Bengalūru" matches
+// "Bengaluru".
+func FoldedILike(v string, columns ...string) Predicate {
+	return func(b *QueryBuilder) string {
+		return ilikeAny("fold_text("+b.Arg(v)+")", columns)
+	}
+}
+
+// ilikeAny ORs "column ILIKE expr" over columns.
+func ilikeAny(expr string, columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, c := range columns {
+		parts = append(parts, fmt.Sprintf("%s ILIKE %s", c, expr))
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+// InSubquery fills the %s in a "r.id IN (SELECT ...)" template with one
+// placeholder per value.
+func InSubquery(template string, vals []string) Predicate {
+	return func(b *QueryBuilder) string {
+		return fmt.Sprintf(template, b.ArgList(vals))
+	}
+}
+
+// DWithin restricts r.geo to a radius in meters around point, which should be
+// a geography (see GeogPoint). The radius is bound as an argument unless it is
+// a fixed literal supplied by the caller.
+func DWithin(point string, radius interface{}) Predicate {
+	return func(b *QueryBuilder) string {
+		r := ""
+		switch v := radius.(type) {
+		case int:
+			r = fmt.Sprintf("%d", v)
+		default:
+			r = b.Arg(v)
+		}
+		return fmt.Sprintf("ST_DWithin(r.geo, %s, %s)", point, r)
+	}
+}
+
+// splitList splits a comma-separated parameter, optionally trimming whitespace.
+func splitList(s string, trim bool) []string {
+	vals := strings.Split(s, ",")
+	if trim {
+		for i := range vals {
+			vals[i] = strings.TrimSpace(vals[i])
+		}
+	}
+	return vals
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		preds []Predicate
+		where string
+		args  []interface{}
+	}{
+		{
+			name:  "none",
+			where: "",
+		},
+		{
+			name:  "raw takes no arguments",
+			preds: []Predicate{Raw("r.is_duplicate = false")},
+			where: "WHERE r.is_duplicate = false",
+		},
+		{
+			name:  "empty conditions are skipped",
+			preds: []Predicate{Raw(""), Compare("r.rating", ">=", 4.0)},
+			where: "WHERE r.rating >= $1",
+			args:  []interface{}{4.0},
+		},
+		{
+			name:  "compare",
+			preds: []Predicate{Compare("r.cost_for_two", "<=", 800), Compare("r.rating", ">=", 4.5)},
+			where: "WHERE r.cost_for_two <= $1 AND r.rating >= $2",
+			args:  []interface{}{800, 4.5},
+		},
+		{
+			name:  "ilike one column",
+			preds: []Predicate{ILike("%pizza%", "r.restaurant_name")},
+			where: "WHERE r.restaurant_name ILIKE $1",
+			args:  []interface{}{"%pizza%"},
+		},
+		{
+			name:  "ilike shares one placeholder across columns",
+			preds: []Predicate{Compare("r.rating", ">=", 4.0), ILike("%koramangala%", "r.area", "r.city")},
+			where: "WHERE r.rating >= $1 AND (r.area ILIKE $2 OR r.city ILIKE $2)",
+			args:  []interface{}{4.0, "%koramangala%"},
+		},
+		{
+			name:  "folded ilike",
+			preds: []Predicate{FoldedILike("Bengalūru", "r.city_norm")},
+			where: "WHERE r.city_norm ILIKE fold_text($1)",
+			args:  []interface{}{"Bengalūru"},
+		},
+		{
+			name: "in subquery numbers after earlier arguments",
+			preds: []Predicate{
+				Compare("r.rating", ">=", 3.5),
+				InSubquery("r.id IN (SELECT restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON c.id = rc.cuisine_id WHERE c.cuisine_name IN (%s))", []string{"Italian", "Chinese"}),
+				Compare("r.cost_for_two", "<=", 500),
+			},
+			where: "WHERE r.rating >= $1 AND r.id IN (SELECT restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON c.id = rc.cuisine_id WHERE c.cuisine_name IN ($2,$3)) AND r.cost_for_two <= $4",
+			args:  []interface{}{3.5, "Italian", "Chinese", 500},
+		},
+		{
+			name:  "dwithin literal radius",
+			preds: []Predicate{DWithin("ST_SetSRID(ST_MakePoint(77.6, 12.9), 4326)::geography", 5000)},
+			where: "WHERE ST_DWithin(r.geo, ST_SetSRID(ST_MakePoint(77.6, 12.9), 4326)::geography, 5000)",
+		},
+		{
+			name:  "dwithin bound radius",
+			preds: []Predicate{Compare("r.rating", ">=", 4.0), DWithin("p.geo", 2500.5)},
+			where: "WHERE r.rating >= $1 AND ST_DWithin(r.geo, p.geo, $2)",
+			args:  []interface{}{4.0, 2500.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &QueryBuilder{}
+			b.Where(tt.preds...)
+			if got := b.WhereClause(); got != tt.where {
+				t.Errorf("WhereClause() = %q, want %q", got, tt.where)
+			}
+			if got := b.Args(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("Args() = %#v, want %#v", got, tt.args)
+			}
+		})
+	}
+}
+
+func TestQueryBuilderPlaceholders(t *testing.T) {
+	b := &QueryBuilder{}
+	if got := b.Arg("a"); got != "$1" {
+		t.Errorf("Arg() = %q, want $1", got)
+	}
+	if got := b.ArgList([]string{"b", "c", "d"}); got != "$2,$3,$4" {
+		t.Errorf("ArgList() = %q, want $2,$3,$4", got)
+	}
+	if got := b.ArgList(nil); got != "" {
+		t.Errorf("ArgList(nil) = %q, want empty", got)
+	}
+	if got := b.GeogPoint(77.59, 12.97); got != "ST_SetSRID(ST_MakePoint($5, $6), 4326)::geography" {
+		t.Errorf("GeogPoint() = %q", got)
+	}
+	want := []interface{}{"a", "b", "c", "d", 77.59, 12.97}
+	if got := b.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"eazyfind/tracker"
+)
+
+// DefaultDistanceCaps bound how far from the searcher results may be, per
+// sort, unless SEARCH_DISTANCE_CAPS or a city says otherwise. "Best Deals"
+// is capped so a huge discount far away does not outrank nearby ones.
+var DefaultDistanceCaps = map[string]float64{"discount": 100000}
+
+// CityMatchDistance is how close to a city's centre a coordinate search
+// without city= must be to use that city's radius settings, when the point is
+// not inside any service area.
+const CityMatchDistance = 50000
+
+// RadiusConfig holds the default search radius and per-sort distance caps, in
+// meters. A cap of 0 (or no entry) leaves that sort uncapped.
+type RadiusConfig struct {
+	DefaultRadius float64
+	DistanceCaps  map[string]float64
+}
+
+// searchRadius is read from SEARCH_DEFAULT_RADIUS (meters) and
+// SEARCH_DISTANCE_CAPS ("discount=100000, rating_desc=50000").
+var searchRadius = func() RadiusConfig {
+	c := RadiusConfig{DefaultRadius: DefaultRadius, DistanceCaps: map[string]float64{}}
+	for sort, m := range DefaultDistanceCaps {
+		c.DistanceCaps[sort] = m
+	}
+	if v := os.Getenv("SEARCH_DEFAULT_RADIUS"); v != "" {
+		if m, err := strconv.ParseFloat(v, 64); err == nil && m > 0 {
+			c.DefaultRadius = m
+		} else {
+			log.Printf("Invalid SEARCH_DEFAULT_RADIUS=%q, using %d", v, DefaultRadius)
+		}
+	}
+	for _, part := range strings.Split(os.Getenv("SEARCH_DISTANCE_CAPS"), ",") {
+		sort, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		sort = strings.TrimSpace(sort)
+		if sort == "" {
+			continue
+		}
+		m, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if _, known := sortOrders[sort]; !known || err != nil || m < 0 {
+			log.Printf("Ignoring invalid SEARCH_DISTANCE_CAPS entry %q", part)
+			continue
+		}
+		c.DistanceCaps[sort] = m
+	}
+	return c
+}()
+
+// capSort is the DistanceCaps key for a search sort; "" is the default
+// discount order.
+func capSort(sort string) string {
+	if sort == "" {
+		return "discount"
+	}
+	return sort
+}
+
+// cityRadiusOverrides maps city names to their radius settings, for cities
+// that have any. Cached with the other city metadata.
+func cityRadiusOverrides(db *sql.DB) map[string]RadiusConfig {
+	v, err := metadataCache.GetOrLoad("search-radius", func() (interface{}, error) {
+		return loadRadiusOverrides(db)
+	})
+	if err != nil {
+		log.Println("City radius query error:", err)
+		return map[string]RadiusConfig{}
+	}
+	return v.(map[string]RadiusConfig)
+}
+
+// loadRadiusOverrides runs the cityRadiusOverrides query.
+func loadRadiusOverrides(db *sql.DB) (map[string]RadiusConfig, error) {
+	rows, err := db.Query(`
+		SELECT city_name, COALESCE(search_radius_m, 0), COALESCE(distance_caps, '{}')
+		FROM cities WHERE search_radius_m IS NOT NULL OR distance_caps IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := map[string]RadiusConfig{}
+	for rows.Next() {
+		var name string
+		var c RadiusConfig
+		var caps []byte
+		if err := rows.Scan(&name, &c.DefaultRadius, &caps); err != nil {
+			continue
+		}
+		json.Unmarshal(caps, &c.DistanceCaps)
+		overrides[strings.ToLower(name)] = c
+	}
+	return overrides, nil
+}
+
+// applyRadiusConfig replaces the global default radius and distance cap with
+// the searched city's, when it has overrides. A coordinate search without
+// city= uses the city whose service area contains the point, or else the
+// nearest city centre within CityMatchDistance.
+func applyRadiusConfig(db *sql.DB, p *SearchParams) {
+	if !p.HasLocation && len(p.Points) == 0 {
+		return
+	}
+	overrides := cityRadiusOverrides(db)
+	if len(overrides) == 0 {
+		return
+	}
+	city := p.City
+	if city == "" {
+		lat, lon := p.Lat, p.Lon
+		if !p.HasLocation {
+			lat, lon = p.Points[0].Lat, p.Points[0].Lon
+		}
+		err := db.QueryRow(`
+			SELECT city_name FROM cities
+			WHERE ST_Covers(service_area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+			   OR ST_DWithin(geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)
+			ORDER BY ST_Covers(service_area, ST_SetSRID(ST_MakePoint($1, $2), 4326)) IS TRUE DESC,
+			         ST_Distance(geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+			LIMIT 1`, lon, lat, CityMatchDistance).Scan(&city)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println("Radius city lookup error:", err)
+		}
+	}
+	c, ok := overrides[strings.ToLower(city)]
+	if !ok {
+		return
+	}
+	if c.DefaultRadius > 0 && p.RadiusSource == "default" {
+		p.Radius, p.RadiusSource = c.DefaultRadius, "city"
+	}
+	if m, ok := c.DistanceCaps[capSort(p.Sort)]; ok {
+		p.DistanceCap = m
+	}
+}
+
+// SetCityRadiusHandler sets a city's default search radius and per-sort
+// distance caps, in meters. Nulls (or an empty caps object) fall back to the
+// global SEARCH_DEFAULT_RADIUS and SEARCH_DISTANCE_CAPS.
+func SetCityRadiusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid city id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			DefaultRadius *float64           `json:"default_radius"`
+			DistanceCaps  map[string]float64 `json:"distance_caps"`
+			Version       string             `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		var radius sql.NullInt64
+		if body.DefaultRadius != nil {
+			if *body.DefaultRadius <= 0 || *body.DefaultRadius > MaxExpandedRadius {
+				http.Error(w, "default_radius must be between 1 and "+strconv.Itoa(MaxExpandedRadius), http.StatusBadRequest)
+				return
+			}
+			radius = sql.NullInt64{Int64: int64(*body.DefaultRadius), Valid: true}
+		}
+		var caps sql.NullString
+		if len(body.DistanceCaps) > 0 {
+			for sort, m := range body.DistanceCaps {
+				if _, known := sortOrders[sort]; !known || m < 0 {
+					http.Error(w, "distance_caps keys must be sort names and values non-negative meters", http.StatusBadRequest)
+					return
+				}
+			}
+			raw, _ := json.Marshal(body.DistanceCaps)
+			caps = sql.NullString{String: string(raw), Valid: true}
+		}
+
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+		res, err := adminExec(db, r, cityChanged(id), "UPDATE cities SET search_radius_m = $1, distance_caps = $2 WHERE id = $3 AND "+versionMatches("cities", "$4"), radius, caps, id, version)
+		if err != nil {
+			log.Println("City radius update error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			writeNotFoundOrConflict(db, w, r, "cities", id, "City not found")
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Updated: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/sanitize"
+	"eazyfind/tracker"
+)
+
+// RecentSearchLimit is how many distinct searches are kept per owner.
+const RecentSearchLimit = 20
+
+// recentSearchOwner identifies whose history a request reads and writes: the
+// signed-in user, else the anonymous session. It returns "" for neither.
+func recentSearchOwner(r *http.Request) string {
+	if id := middleware.UserID(r); id != "" {
+		return "user:" + id
+	}
+	if sid := middleware.GetSessionID(r.Context()); sid != "" {
+		return "session:" + sid
+	}
+	return ""
+}
+
+// recordRecentSearch stores a search in the caller's history in the
+// background, moving a repeated search to the top and dropping the oldest
+// beyond RecentSearchLimit.
+func recordRecentSearch(db *sql.DB, r *http.Request, text string, params url.Values) {
+	owner := recentSearchOwner(r)
+	encoded := params.Encode()
+	if owner == "" || encoded == "" || middleware.ReadOnlyImpersonation(r.Context()) {
+		return
+	}
+	go func() {
+		_, err := db.Exec(`
+			INSERT INTO recent_searches (owner, query_text, params) VALUES ($1, $2, $3)
+			ON CONFLICT (owner, params) DO UPDATE SET searched_at = now(), query_text = EXCLUDED.query_text`,
+			owner, sanitize.Line(text, MaxNameLength), encoded)
+		if err == nil {
+			_, err = db.Exec(`
+				DELETE FROM recent_searches WHERE owner = $1 AND id NOT IN (
+					SELECT id FROM recent_searches WHERE owner = $1 ORDER BY searched_at DESC LIMIT $2
+				)`, owner, RecentSearchLimit)
+		}
+		if err != nil {
+			log.Println("Recent search insert error:", err)
+		}
+	}()
+}
+
+// recentSearches returns the owner's searches, newest first, optionally only
+// those whose text starts with prefix.
+func recentSearches(db *sql.DB, owner, prefix string, limit int) ([]models.RecentSearch, error) {
+	rows, err := db.Query(`
+		SELECT id, query_text, params, searched_at FROM recent_searches
+		WHERE owner = $1 AND starts_with(lower(query_text), lower($2))
+		ORDER BY searched_at DESC LIMIT $3`, owner, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.RecentSearch{}
+	for rows.Next() {
+		var s models.RecentSearch
+		if err := rows.Scan(&s.ID, &s.Query, &s.Params, &s.SearchedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// RecentSearchesHandler lists the caller's recent searches (the signed-in
+// user's, else the session's), newest first.
+func RecentSearchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items := []models.RecentSearch{}
+		if owner := recentSearchOwner(r); owner != "" {
+			var err error
+			if items, err = recentSearches(db, owner, "", RecentSearchLimit); err != nil {
+				writeRecentSearchError(w, r, err)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"searches": items})
+	}
+}
+
+// DeleteRecentSearchesHandler clears the caller's recent searches, or with
+// an {id} in the path just that one.
+func DeleteRecentSearchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := recentSearchOwner(r)
+		if owner == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var err error
+		if idStr := r.PathValue("id"); idStr != "" {
+			id, perr := strconv.ParseInt(idStr, 10, 64)
+			if perr != nil || id <= 0 {
+				http.Error(w, "Invalid search id", http.StatusBadRequest)
+				return
+			}
+			var res sql.Result
+			if res, err = db.Exec("DELETE FROM recent_searches WHERE owner = $1 AND id = $2", owner, id); err == nil {
+				if n, _ := res.RowsAffected(); n == 0 {
+					http.Error(w, "Search not found", http.StatusNotFound)
+					return
+				}
+			}
+		} else {
+			_, err = db.Exec("DELETE FROM recent_searches WHERE owner = $1", owner)
+		}
+		if err != nil {
+			writeRecentSearchError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeRecentSearchError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Recent searches error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/sanitize"
+	"eazyfind/tracker"
+)
+
+// maxAttributionLength trims client-supplied source/campaign labels.
+const maxAttributionLength = 64
+
+// PartnerRedirectHandler records an outbound click for a listing and redirects
+// to its partner URL with utm attribution parameters appended. The source and
+// campaign query parameters are stored with the click and forwarded as
+// utm_medium and utm_campaign.
+func PartnerRedirectHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("restaurantId"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+
+		var rawURL string
+		err = db.QueryRow("SELECT COALESCE(url, '') FROM restaurants WHERE id = $1", id).Scan(&rawURL)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Restaurant not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Redirect query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+
+		// Only redirect to absolute web URLs so a bad row can't become an open redirect to another scheme.
+		target, err := url.Parse(rawURL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			http.Error(w, "Restaurant has no partner link", http.StatusNotFound)
+			return
+		}
+
+		source := sanitize.Line(r.URL.Query().Get("source"), maxAttributionLength)
+		campaign := sanitize.Line(r.URL.Query().Get("campaign"), maxAttributionLength)
+		sid := middleware.GetSessionID(r.Context())
+		// Suspicious clicks still redirect but are not counted for attribution.
+		switch verdict, reason := screenSubmission(r, AbuseKindClick, strconv.FormatInt(id, 10)); verdict {
+		case abuseHold:
+			quarantineSubmission(db, r, AbuseKindClick, reason, clickPayload{RestaurantID: id, Source: source, Campaign: campaign})
+		case abuseAllow:
+			go func() {
+				if _, err := db.Exec("INSERT INTO outbound_clicks (restaurant_id, source, campaign, session_id) VALUES ($1, $2, $3, $4)", id, source, campaign, sid); err != nil {
+					log.Println("Click insert error:", err)
+				}
+			}()
+		}
+
+		q := target.Query()
+		q.Set("utm_source", "eazyfind")
+		if source != "" {
+			q.Set("utm_medium", source)
+		} else {
+			q.Set("utm_medium", "referral")
+		}
+		if campaign != "" {
+			q.Set("utm_campaign", campaign)
+		}
+		target.RawQuery = q.Encode()
+
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+
+	"github.com/lib/pq"
+)
+
+// phonePattern accepts the characters found in formatted phone numbers.
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ()\-]{6,20}$`)
+
+// contactVisible reports whether the client may see full contact details:
+// admins and API-key holders do, anonymous clients get masked phone numbers.
+func contactVisible(r *http.Request) bool {
+	return middleware.IsAdmin(r) || middleware.GetAPIKey(r.Context()) != nil
+}
+
+// maskPhone hides all but the last two digits, keeping the formatting so
+// clients can still tell a number is present.
+func maskPhone(phone string) string {
+	digits := 0
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	var b strings.Builder
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits--
+			if digits >= 2 {
+				c = 'X'
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// applyContactMasking masks the phone number for anonymous clients and drops
+// the street address of location-restricted restaurants for non-admins.
+func applyContactMasking(r *http.Request, res *models.Restaurant) {
+	if res.LocationRestricted && !middleware.IsAdmin(r) {
+		res.AddressLine = ""
+		res.DeliveryArea = nil
+	}
+	if !contactVisible(r) && res.Phone != "" {
+		res.Phone = maskPhone(res.Phone)
+	}
+}
+
+// RestaurantRoutes serves GET /api/restaurants/{id}/{view}: the history and
+// details views of a restaurant by id, and /api/restaurants/slug/{slug}.
+// ServeMux cannot register slug/{slug} alongside {id}/history, as neither
+// pattern is more specific, so the views are dispatched here.
+func RestaurantRoutes(db *sql.DB) http.HandlerFunc {
+	history, details, bySlug := RestaurantHistoryHandler(db), RestaurantDetailHandler(db), RestaurantBySlugHandler(db)
+	return func(w http.ResponseWriter, r *http.Request) {
+		view := r.PathValue("view")
+		switch {
+		case r.PathValue("id") == "slug":
+			r.SetPathValue("slug", view)
+			bySlug(w, r)
+		case view == "history":
+			history(w, r)
+		case view == "details":
+			details(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// RestaurantDetailHandler returns a single restaurant with its contact
+// details for click-to-call and directions.
+func RestaurantDetailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		writeRestaurantDetail(db, w, r, "r.id = $1", id)
+	}
+}
+
+// RestaurantBySlugHandler returns the same representation as
+// RestaurantDetailHandler, looked up by the restaurant's URL slug.
+func RestaurantBySlugHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := strings.ToLower(r.PathValue("slug"))
+		if !slugPattern.MatchString(slug) {
+			http.Error(w, "Invalid restaurant slug", http.StatusBadRequest)
+			return
+		}
+		writeRestaurantDetail(db, w, r, "r.slug = $1", slug)
+	}
+}
+
+// slugPattern matches slugs generated by the slugify() database function.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// writeRestaurantDetail writes the restaurant matching cond, a fixed
+// condition with a single placeholder bound to arg.
+func writeRestaurantDetail(db *sql.DB, w http.ResponseWriter, r *http.Request, cond string, arg interface{}) {
+	published := "AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"
+	if includeUnpublished(r) {
+		published = ""
+	}
+	cols := SelectColumns(nil, relatedFields, false)
+	query := fmt.Sprintf(`
+		SELECT %s, COALESCE(r.url, ''), COALESCE(r.phone, ''), COALESCE(r.website, ''), COALESCE(r.address_line, ''),
+		       r.price_level, COALESCE(r.opening_hours, 'null'), COALESCE(r.field_sources, 'null'),
+		       COALESCE(ST_AsGeoJSON(r.delivery_area), ''), r.delivery_radius_m,
+		       COALESCE((SELECT json_agg(json_build_object('day', pt.day, 'hour', pt.hour, 'busyness', pt.busyness) ORDER BY pt.day, pt.hour)
+		                 FROM popular_times pt WHERE pt.restaurant_id = r.id), 'null'),
+		       r.offer_window_days, COALESCE(to_char(r.offer_window_start, 'HH24:MI'), ''), COALESCE(to_char(r.offer_window_end, 'HH24:MI'), ''),
+		       EXISTS (SELECT 1 FROM coupons c WHERE c.restaurant_id = r.id AND %s), %s
+		FROM restaurants r
+		WHERE %s AND r.is_duplicate = false %s %s
+	`, selectList(cols, ""), couponOpen, versionOf("r"), cond, published, andTenantScope(r, "r.city"))
+
+	var pageURL, phone, website, address string
+	var hoursJSON, sourcesJSON, popularJSON []byte
+	var priceLevel, deliveryRadius sql.NullInt64
+	var deliveryArea, windowStart, windowEnd string
+	var windowDays []int64
+	var couponAvailable bool
+	var version int64
+	res, err := ScanRestaurant(db.QueryRow(query, arg), cols, &pageURL, &phone, &website, &address, &priceLevel, &hoursJSON, &sourcesJSON, &deliveryArea, &deliveryRadius, &popularJSON,
+		pq.Array(&windowDays), &windowStart, &windowEnd, &couponAvailable, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Restaurant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Restaurant detail query error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusBadRequest)
+		return
+	}
+	res.URL, res.Phone, res.Website, res.AddressLine = pageURL, phone, website, address
+	json.Unmarshal(hoursJSON, &res.OpeningHours)
+	json.Unmarshal(sourcesJSON, &res.FieldSources)
+	json.Unmarshal(popularJSON, &res.PopularTimes)
+	if priceLevel.Valid {
+		level := int(priceLevel.Int64)
+		res.PriceLevel = &level
+	}
+	if deliveryArea != "" {
+		res.DeliveryArea = json.RawMessage(deliveryArea)
+	}
+	if deliveryRadius.Valid {
+		radius := int(deliveryRadius.Int64)
+		res.DeliveryRadius = &radius
+	}
+	res.CouponAvailable = couponAvailable
+	res.Version = strconv.FormatInt(version, 10)
+	if windowStart != "" {
+		res.OfferWindow = &models.OfferWindow{Start: windowStart, End: windowEnd}
+		for _, d := range windowDays {
+			res.OfferWindow.Days = append(res.OfferWindow.Days, int(d))
+		}
+	}
+
+	results := []models.Restaurant{res}
+	ApplyGeoPrivacy(r, results)
+	applyContactMasking(r, &results[0])
+
+	w.Header().Set("ETag", strconv.Quote(res.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results[0])
+}
+
+// SetRestaurantContactHandler updates a restaurant's contact details. Only the
+// fields present in the body are changed; an empty string clears a field.
+// Expects {"phone": "...", "website": "...", "address_line": "...", "version": "..."};
+// with a version (or If-Match) the edit fails with 409 if the restaurant
+// changed since that version was read.
+func SetRestaurantContactHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Phone       *string `json:"phone"`
+			Website     *string `json:"website"`
+			AddressLine *string `json:"address_line"`
+			Version     string  `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, body.Version)
+		if !ok {
+			return
+		}
+		if body.Phone != nil && *body.Phone != "" && !phonePattern.MatchString(*body.Phone) {
+			http.Error(w, "phone must contain only digits, spaces, +, -, ( and )", http.StatusBadRequest)
+			return
+		}
+		if body.Website != nil && *body.Website != "" {
+			u, err := url.Parse(*body.Website)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				http.Error(w, "website must be an http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Edited fields are attributed to an admin; cleared ones lose their source.
+		sources := map[string]interface{}{}
+		for field, v := range map[string]*string{"phone": body.Phone, "website": body.Website, "address_line": body.AddressLine} {
+			if v != nil {
+				sources[field] = nil
+				if deref(v) != "" {
+					sources[field] = "admin"
+				}
+			}
+		}
+		sourcesJSON, _ := json.Marshal(sources)
+
+		res, err := adminExec(db, r, restaurantChanged(id), `
+			UPDATE restaurants SET
+				phone = CASE WHEN $1 THEN NULLIF($2, '') ELSE phone END,
+				website = CASE WHEN $3 THEN NULLIF($4, '') ELSE website END,
+				address_line = CASE WHEN $5 THEN NULLIF($6, '') ELSE address_line END,
+				field_sources = jsonb_strip_nulls(COALESCE(field_sources, '{}'::jsonb) || $8::jsonb)
+			WHERE id = $7 AND `+versionMatches("restaurants", "$9")+`
+		`, body.Phone != nil, deref(body.Phone), body.Website != nil, deref(body.Website), body.AddressLine != nil, deref(body.AddressLine), id, string(sourcesJSON), version)
+		if err != nil {
+			log.Println("Restaurant contact update error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			writeNotFoundOrConflict(db, w, r, "restaurants", id, "Restaurant not found")
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Updated: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
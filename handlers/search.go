@@ -1,8 +1,8 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
@@ -10,12 +10,39 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"eazyfind/geo"
+	"eazyfind/middleware"
 	"eazyfind/models"
+	"eazyfind/names"
+	"eazyfind/tracker"
 )
 
 const (
-	DefaultLimit = 12
+	DefaultLimit     = 12
+	MaxLimit         = 1000
+	DefaultRadius    = 50000
+	MaxWithinMinutes = 60
+	MaxSearchPoints  = 5
+
+	// Sparse radius searches are widened RadiusExpansionFactor-fold at a time,
+	// up to MaxExpandedRadius, until at least MinRadiusResults match.
+	MinRadiusResults      = 5
+	RadiusExpansionFactor = 2
+	MaxExpandedRadius     = 100000
+
+	DefaultRouteBuffer = 1000
+	MaxRouteBuffer     = 5000
+	MaxRoutePoints     = 500
+
+	// Guardrails against a single request scanning most of the table: radii
+	// are capped, pages past MaxOffset rows are clamped to the last one
+	// allowed, and list filters and names are truncated.
+	MaxRadius       = MaxExpandedRadius
+	MaxOffset       = 10000
+	MaxFilterValues = 50
+	MaxNameLength   = 100
 )
 
 type SearchParams struct {
@@ -28,8 +55,12 @@ type SearchParams struct {
 	Rating      float64
 	Discount    float64
 	Free        bool
+	QuietNow    bool
+	HappyHour   bool
 	City        string
 	Area        string
+	Tag         string
+	Brand       string
 	CuisineIds  string
 	MealTypeIds string
 	Cuisine     string
@@ -41,280 +72,655 @@ type SearchParams struct {
 	Radius      float64
 	HasLocation bool
 	Sort        string
+
+	// PaymentMethods keeps offers redeemable with any of these methods;
+	// offers without a payment restriction always match.
+	PaymentMethods []string
+
+	// ActiveAt keeps only offers valid at that time instead of now; when
+	// ActiveAtLocal it is a wall-clock time in each city's timezone.
+	ActiveAt      time.Time
+	ActiveAtLocal bool
+
+	// ExpandRadius allows a sparse radius search to be widened (expand=false
+	// turns it off); RequestedRadius is set to the original radius once it was.
+	ExpandRadius    bool
+	RequestedRadius float64
+
+	// RadiusSource says where Radius came from: "request", "city" (the
+	// city's default) or "default" (SEARCH_DEFAULT_RADIUS). DistanceCap is
+	// the sort's proximity limit for coordinate searches, 0 when uncapped.
+	RadiusSource string
+	DistanceCap  float64
+
+	// Diverse reranks the page so one brand or cuisine does not fill it.
+	Diverse bool
+
+	// WithinMinutes and Mode request a travel-time search; Isoline holds the
+	// resolved GeoJSON polygon once the handler has fetched it.
+	WithinMinutes int
+	Mode          string
+	Isoline       string
+
+	// Points holds two or more origins for group searches; results are ranked
+	// by their distance to the farthest point.
+	Points []geo.LatLon
+
+	// IncludeUnpublished lets admins search cities that are hidden from the public.
+	IncludeUnpublished bool
+
+	// IncludeDuplicates keeps rows marked as duplicates, for admin triage.
+	IncludeDuplicates bool
+
+	// Tenant limits results to a white-label tenant's cities; nil searches all.
+	Tenant *middleware.Tenant
+
+	// Ctx cancels the search queries, usually with the request; nil never does.
+	Ctx context.Context
+
+	// Route is a decoded commute polyline; restaurants within RouteBuffer
+	// meters of it are returned.
+	Route       []geo.LatLon
+	RouteBuffer float64
+
+	// DeliversTo keeps restaurants whose delivery area, or delivery radius
+	// when they have no area, covers this address.
+	DeliversTo *geo.LatLon
+
+	// CuisineIDSets and MealTypeIDSets hold the text filters after
+	// ResolveTaxonomyFilters mapped them to IDs; each set is one IN condition.
+	CuisineIDSets     [][]string
+	MealTypeIDSets    [][]string
+	ResolvedCuisines  []TaxonomyItem
+	ResolvedMealTypes []TaxonomyItem
+	Unresolved        []UnresolvedFilter
+
+	// Fields limits the selected columns and JSON output; nil means all fields.
+	// Include lists the related collections (cuisines, meal_types) to aggregate.
+	Fields  []string
+	Include []string
+
+	// Snapshot pins later pages to the data the first page was served from,
+	// so an import running while a client pages does not shift the pages.
+	Snapshot Snapshot
 }
 
 // ParseSearchParams extracts and normalizes restaurant search filters from the URL query.
+// Keys are normalized first, so any supported spelling (minCost, min_cost) works.
 func ParseSearchParams(query url.Values) SearchParams {
+	query, _ = NormalizeQuery(query)
 	p := SearchParams{
 		Limit: DefaultLimit,
 	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		p.Limit = min(limit, MaxLimit)
+	}
 
 	p.Page, _ = strconv.Atoi(query.Get("page"))
-	if p.Page <= 0 {
-		p.Page = 1
-	}
+	p.Page = min(max(p.Page, 1), maxPage(p.Limit))
 	p.Offset = (p.Page - 1) * p.Limit
 
-	p.Name = query.Get("name")
-	if p.Name == "" {
-		p.Name = query.Get("q")
-	}
+	p.Name = truncateRunes(query.Get("name"), MaxNameLength)
 
-	p.MinCost, _ = strconv.Atoi(query.Get("minCost"))
-	if p.MinCost == 0 {
-		p.MinCost, _ = strconv.Atoi(query.Get("min_cost"))
-	}
-	p.MaxCost, _ = strconv.Atoi(query.Get("maxCost"))
-	if p.MaxCost == 0 {
-		p.MaxCost, _ = strconv.Atoi(query.Get("max_cost"))
-	}
+	p.MinCost, _ = strconv.Atoi(query.Get("min_cost"))
+	p.MaxCost, _ = strconv.Atoi(query.Get("max_cost"))
 
-	p.Rating, _ = strconv.ParseFloat(query.Get("rating"), 64)
-	if d, _ := strconv.ParseFloat(query.Get("discount"), 64); d > 0 {
+	p.Rating, _ = parseFinite(query.Get("rating"))
+	if d, _ := parseFinite(query.Get("discount")); d > 0 {
 		p.Discount = d / 100.0
 	}
 	p.Free = query.Get("free") == "true"
+	p.QuietNow = query.Get("quiet_now") == "true"
+	p.HappyHour = query.Get("happy_hour") == "true"
+	p.Diverse = query.Get("diverse") == "true"
+	p.ActiveAt, p.ActiveAtLocal, _ = parseActiveAt(query.Get("active_at"))
 
 	p.City = query.Get("city")
 	p.Area = query.Get("area")
-	p.CuisineIds = query.Get("cuisineIds")
-	p.MealTypeIds = query.Get("mealtypeIds")
+	p.Tag = strings.ToLower(strings.TrimSpace(query.Get("tag")))
+	p.PaymentMethods, _ = parsePaymentMethods(query.Get("payment_method"))
+	p.Brand = strings.TrimSpace(query.Get("brand"))
+	p.CuisineIds = limitList(query.Get("cuisine_ids"))
+	p.MealTypeIds = limitList(query.Get("meal_type_ids"))
 	p.Cuisine = query.Get("cuisine")
 	p.MealType = query.Get("meal_type")
-	p.Cuisines = query.Get("cuisines")
-	p.MealTypes = query.Get("mealtypes")
+	p.Cuisines = limitList(query.Get("cuisines"))
+	p.MealTypes = limitList(query.Get("meal_types"))
 
-	latStr, lonStr := query.Get("lat"), query.Get("lon")
-	if latStr != "" && lonStr != "" {
-		p.Lat, _ = strconv.ParseFloat(latStr, 64)
-		p.Lon, _ = strconv.ParseFloat(lonStr, 64)
-		p.Radius, _ = strconv.ParseFloat(query.Get("radius"), 64)
-		if p.Radius <= 0 {
-			p.Radius = 50000
-		}
+	if lat, lon, ok := parseLatLon(query.Get("lat"), query.Get("lon")); ok {
+		p.Lat, p.Lon = lat, lon
+		p.Radius, p.RadiusSource = parseRadius(query.Get("radius"))
 		p.HasLocation = true
+		p.ExpandRadius = query.Get("expand") != "false"
+
+		p.WithinMinutes, _ = strconv.Atoi(query.Get("within_minutes"))
+		p.WithinMinutes = min(max(p.WithinMinutes, 0), MaxWithinMinutes)
+		p.Mode = query.Get("mode")
+		if !geo.IsolineModes[p.Mode] {
+			p.Mode = "walk"
+		}
 	}
 
+	if points := parsePoints(query.Get("points")); len(points) >= 2 {
+		p.Points = points
+		p.HasLocation = false
+		p.Radius, p.RadiusSource = parseRadius(query.Get("radius"))
+	}
+
+	if points := parsePoints(query.Get("delivers_to")); len(points) == 1 {
+		p.DeliversTo = &points[0]
+	}
+
+	if raw := query.Get("route"); raw != "" {
+		if route, err := geo.DecodePolyline(raw); err == nil && len(route) >= 2 {
+			p.Route = thinRoute(route, MaxRoutePoints)
+			p.RouteBuffer, _ = parseFinite(query.Get("buffer"))
+			if p.RouteBuffer <= 0 {
+				p.RouteBuffer = DefaultRouteBuffer
+			}
+			p.RouteBuffer = min(p.RouteBuffer, MaxRouteBuffer)
+		}
+	}
+
+	p.Fields, _ = ParseFields(query.Get("fields"))
+	p.Snapshot, _ = DecodeSnapshot(query.Get("snapshot"))
+	p.Include, _ = ParseInclude(query, relatedFields)
+
 	p.Sort = query.Get("sort")
+	if _, ok := sortOrders[p.Sort]; !ok {
+		p.Sort = ""
+	}
+	if len(p.Points) > 0 && p.Sort == "" {
+		p.Sort = "distance_asc"
+	}
+	p.DistanceCap = searchRadius.DistanceCaps[capSort(p.Sort)]
 	return p
 }
 
-// BuildSearchQueries generates SQL WHERE clauses and arguments based on provided SearchParams.
-// It handles spatial queries (PostGIS), text similarity, and relational filters.
-func BuildSearchQueries(p SearchParams) (string, string, []interface{}) {
-	var args []interface{}
-	var conditions []string
-	idx := 1
+// thinRoute keeps every nth vertex (plus the endpoint) so long routes stay
+// within a reasonable query size.
+func thinRoute(route []geo.LatLon, limit int) []geo.LatLon {
+	if len(route) <= limit {
+		return route
+	}
+	step := (len(route) + limit - 2) / (limit - 1)
+	thinned := make([]geo.LatLon, 0, limit)
+	for i := 0; i < len(route)-1; i += step {
+		thinned = append(thinned, route[i])
+	}
+	return append(thinned, route[len(route)-1])
+}
+
+// parseRadius reads the radius parameter in meters, capped at MaxRadius,
+// falling back to the configured default.
+func parseRadius(raw string) (float64, string) {
+	if radius, _ := parseFinite(raw); radius > 0 {
+		return min(radius, MaxRadius), "request"
+	}
+	return searchRadius.DefaultRadius, "default"
+}
+
+// maxPage is the last page of limit results that starts within MaxOffset.
+func maxPage(limit int) int {
+	return MaxOffset/limit + 1
+}
+
+// limitList keeps the first MaxFilterValues entries of a comma-separated list.
+func limitList(raw string) string {
+	vals := strings.SplitN(raw, ",", MaxFilterValues+1)
+	if len(vals) <= MaxFilterValues {
+		return raw
+	}
+	return strings.Join(vals[:MaxFilterValues], ",")
+}
+
+// truncateRunes cuts s to at most n characters.
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
 
+// parsePoints reads "lat1,lon1;lat2,lon2" pairs, skipping malformed or
+// out-of-range entries and keeping at most MaxSearchPoints.
+func parsePoints(raw string) []geo.LatLon {
+	var points []geo.LatLon
+	for _, pair := range strings.Split(raw, ";") {
+		lat, lon, ok := strings.Cut(pair, ",")
+		if !ok {
+			continue
+		}
+		la, lo, ok := parseLatLon(strings.TrimSpace(lat), strings.TrimSpace(lon))
+		if !ok {
+			continue
+		}
+		points = append(points, geo.LatLon{Lat: la, Lon: lo})
+		if len(points) == MaxSearchPoints {
+			break
+		}
+	}
+	return points
+}
+
+const (
+	cuisineNameSubquery  = "r.id IN (SELECT rc.restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE c.cuisine_name ILIKE %s)"
+	cuisineNamesSubquery = "r.id IN (SELECT rc.restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE c.cuisine_name IN (%s))"
+	cuisineIDsSubquery   = "r.id IN (SELECT restaurant_id FROM restaurant_cuisines WHERE cuisine_id IN (%s))"
+	mealTypeSubquery     = "r.id IN (SELECT rmt.restaurant_id FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE m.meal_type ILIKE %s)"
+	mealTypesSubquery    = "r.id IN (SELECT rmt.restaurant_id FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE m.meal_type IN (%s))"
+	mealTypeIDsSubquery  = "r.id IN (SELECT restaurant_id FROM restaurant_meal_types WHERE meal_type_id IN (%s))"
+)
+
+// SearchPredicates translates SearchParams into an ordered list of predicates.
+// It also returns the SQL expression used for the distance column.
+func SearchPredicates(b *QueryBuilder, p SearchParams) (string, []Predicate) {
+	var preds []Predicate
 	distanceExpr := "0.0"
 
 	// Calculate distance expression whenever coordinates are provided, regardless of city filter.
 	// This ensures that even when filtering by city, the frontend receives proximity data.
+	var point string
 	if p.HasLocation {
-		distanceExpr = fmt.Sprintf("ST_Distance(r.geo, ST_SetSRID(ST_MakePoint($%d, $%d), 4326))", idx, idx+1)
-		args = append(args, p.Lon, p.Lat)
-		idx += 2
+		point = b.GeogPoint(p.Lon, p.Lat)
+		distanceExpr = fmt.Sprintf("ST_Distance(r.geo, %s)", point)
 
-		// Enforce a 100km proximity limit specifically for "Best Deals" to ensure relevance.
-		if p.Sort == "" || p.Sort == "discount" {
-			conditions = append(conditions, fmt.Sprintf("ST_DWithin(r.geo, ST_SetSRID(ST_MakePoint($%d, $%d), 4326), 100000)", idx-2, idx-1))
+		// Enforce the sort's proximity limit (100km for "Best Deals" by default) to ensure relevance.
+		if p.DistanceCap > 0 {
+			preds = append(preds, DWithin(point, p.DistanceCap))
 		}
 	}
 
+	if len(p.Points) > 0 {
+		// Group search: score each restaurant by its distance to the farthest
+		// point so the ranking favours places convenient for everyone.
+		distances := make([]string, 0, len(p.Points))
+		for _, pt := range p.Points {
+			point := b.GeogPoint(pt.Lon, pt.Lat)
+			distances = append(distances, fmt.Sprintf("ST_Distance(r.geo, %s)", point))
+			if p.City == "" {
+				preds = append(preds, DWithin(point, p.Radius))
+			}
+		}
+		distanceExpr = "GREATEST(" + strings.Join(distances, ", ") + ")"
+	}
+
+	if len(p.Route) > 0 {
+		// Commute search: keep restaurants within the buffer of the route line.
+		line := fmt.Sprintf("ST_GeogFromText(%s)", b.Arg(geo.LineStringWKT(p.Route)))
+		if !p.HasLocation && len(p.Points) == 0 {
+			distanceExpr = fmt.Sprintf("ST_Distance(r.geo, %s)", line)
+		}
+		preds = append(preds, func(b *QueryBuilder) string {
+			return fmt.Sprintf("ST_DWithin(r.geo, %s, %s)", line, b.Arg(p.RouteBuffer))
+		})
+	}
+
+	if p.Isoline != "" {
+		// Travel-time search replaces the plain radius with the reachable polygon.
+		preds = append(preds, func(b *QueryBuilder) string {
+			return fmt.Sprintf("ST_Within(r.geo::geometry, ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326))", b.Arg(p.Isoline))
+		})
+	}
+
 	if p.City != "" {
-		conditions = append(conditions, fmt.Sprintf("r.city ILIKE $%d", idx))
-		args = append(args, p.City)
-		idx++
-	} else if p.HasLocation {
+		if p.IncludeUnpublished {
+			preds = append(preds, FoldedILike(p.City, "r.city_norm"))
+		} else {
+			preds = append(preds, func(b *QueryBuilder) string {
+				city := b.Arg(p.City)
+				return fmt.Sprintf("r.city_norm ILIKE fold_text(%s) AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name_norm ILIKE fold_text(%s) AND ci.is_published)", city, city)
+			})
+		}
+	} else if p.HasLocation && p.Isoline == "" {
 		// If NO city is provided but location is active, use ST_DWithin for discovery.
-		conditions = append(conditions, fmt.Sprintf("ST_DWithin(r.geo, ST_SetSRID(ST_MakePoint($%d, $%d), 4326), $%d)", idx-2, idx-1, idx))
-		args = append(args, p.Radius)
-		idx++
+		preds = append(preds, DWithin(point, p.Radius))
 	}
 
-	if p.Name != "" {
-		conditions = append(conditions, fmt.Sprintf("(r.restaurant_name ILIKE $%d OR r.area ILIKE $%d)", idx, idx))
-		args = append(args, "%"+p.Name+"%")
-		idx++
+	if p.DeliversTo != nil {
+		preds = append(preds, func(b *QueryBuilder) string {
+			addr := b.Point(p.DeliversTo.Lon, p.DeliversTo.Lat)
+			return fmt.Sprintf("(ST_Covers(r.delivery_area, %s) OR (r.delivery_area IS NULL AND ST_DWithin(r.geo, %s::geography, r.delivery_radius_m)))", addr, addr)
+		})
 	}
 
+	if p.Name != "" {
+		preds = append(preds, ILike("%"+p.Name+"%", "r.restaurant_name", "r.area"))
+	}
 	if p.Area != "" {
-		conditions = append(conditions, fmt.Sprintf("r.area ILIKE $%d", idx))
-		args = append(args, "%"+p.Area+"%")
-		idx++
+		preds = append(preds, FoldedILike("%"+p.Area+"%", "r.area_norm"))
 	}
 
 	if p.Cuisine != "" {
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT rc.restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE c.cuisine_name ILIKE $%d)", idx))
-		args = append(args, p.Cuisine)
-		idx++
+		preds = append(preds, InSubquery(cuisineNameSubquery, []string{p.Cuisine}))
 	}
-
 	if p.Cuisines != "" {
-		names := strings.Split(p.Cuisines, ",")
-		var placeholders []string
-		for _, name := range names {
-			placeholders = append(placeholders, fmt.Sprintf("$%d", idx))
-			args = append(args, strings.TrimSpace(name))
-			idx++
-		}
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT rc.restaurant_id FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE c.cuisine_name IN (%s))", strings.Join(placeholders, ",")))
+		preds = append(preds, InSubquery(cuisineNamesSubquery, splitList(p.Cuisines, true)))
 	}
-
 	if p.CuisineIds != "" {
-		ids := strings.Split(p.CuisineIds, ",")
-		var placeholders []string
-		for _, id := range ids {
-			placeholders = append(placeholders, fmt.Sprintf("$%d", idx))
-			args = append(args, id)
-			idx++
-		}
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT restaurant_id FROM restaurant_cuisines WHERE cuisine_id IN (%s))", strings.Join(placeholders, ",")))
+		preds = append(preds, InSubquery(cuisineIDsSubquery, splitList(p.CuisineIds, false)))
+	}
+	for _, ids := range p.CuisineIDSets {
+		preds = append(preds, InSubquery(cuisineIDsSubquery, ids))
 	}
 
 	if p.MealType != "" {
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT rmt.restaurant_id FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE m.meal_type ILIKE $%d)", idx))
-		args = append(args, p.MealType)
-		idx++
+		preds = append(preds, InSubquery(mealTypeSubquery, []string{p.MealType}))
 	}
-
 	if p.MealTypes != "" {
-		names := strings.Split(p.MealTypes, ",")
-		var placeholders []string
-		for _, name := range names {
-			placeholders = append(placeholders, fmt.Sprintf("$%d", idx))
-			args = append(args, strings.TrimSpace(name))
-			idx++
-		}
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT rmt.restaurant_id FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE m.meal_type IN (%s))", strings.Join(placeholders, ",")))
+		preds = append(preds, InSubquery(mealTypesSubquery, splitList(p.MealTypes, true)))
 	}
-
 	if p.MealTypeIds != "" {
-		ids := strings.Split(p.MealTypeIds, ",")
-		var placeholders []string
-		for _, id := range ids {
-			placeholders = append(placeholders, fmt.Sprintf("$%d", idx))
-			args = append(args, id)
-			idx++
-		}
-		conditions = append(conditions, fmt.Sprintf("r.id IN (SELECT restaurant_id FROM restaurant_meal_types WHERE meal_type_id IN (%s))", strings.Join(placeholders, ",")))
+		preds = append(preds, InSubquery(mealTypeIDsSubquery, splitList(p.MealTypeIds, false)))
+	}
+	for _, ids := range p.MealTypeIDSets {
+		preds = append(preds, InSubquery(mealTypeIDsSubquery, ids))
 	}
 
 	if p.MinCost > 0 {
-		conditions = append(conditions, fmt.Sprintf("r.cost_for_two >= $%d", idx))
-		args = append(args, p.MinCost)
-		idx++
+		preds = append(preds, Compare("r.cost_for_two", ">=", p.MinCost))
 	}
 	if p.MaxCost > 0 {
-		conditions = append(conditions, fmt.Sprintf("r.cost_for_two <= $%d", idx))
-		args = append(args, p.MaxCost)
-		idx++
+		preds = append(preds, Compare("r.cost_for_two", "<=", p.MaxCost))
 	}
 	if p.Rating > 0 {
-		conditions = append(conditions, fmt.Sprintf("r.rating >= $%d", idx))
-		args = append(args, p.Rating)
-		idx++
+		preds = append(preds, Compare("r.rating", ">=", p.Rating))
 	}
 	if p.Discount > 0 {
-		conditions = append(conditions, fmt.Sprintf("r.effective_discount >= $%d", idx))
-		args = append(args, p.Discount)
-		idx++
+		preds = append(preds, Compare("r.effective_discount", ">=", p.Discount))
 	}
 	if p.Free {
-		conditions = append(conditions, "r.free = true")
+		preds = append(preds, Raw("r.free = true"))
+	}
+	if p.Tag != "" {
+		preds = append(preds, func(b *QueryBuilder) string {
+			return fmt.Sprintf("r.tags @> ARRAY[%s]::text[]", b.Arg(p.Tag))
+		})
+	}
+	if len(p.PaymentMethods) > 0 {
+		preds = append(preds, func(b *QueryBuilder) string {
+			return fmt.Sprintf("(r.payment_methods IS NULL OR r.payment_methods = '{}' OR r.payment_methods && ARRAY[%s]::text[])", b.ArgList(p.PaymentMethods))
+		})
+	}
+	if key := names.Key(p.Brand); key != "" {
+		preds = append(preds, brandPredicate(key))
+	}
+	if p.QuietNow {
+		preds = append(preds, func(b *QueryBuilder) string {
+			// A slot without a row had no recorded activity, so it counts as quiet.
+			now := cityLocalTime(b, time.Time{}, false)
+			return fmt.Sprintf(`EXISTS (SELECT 1 FROM popular_times pt WHERE pt.restaurant_id = r.id)
+				AND NOT EXISTS (SELECT 1 FROM popular_times pt WHERE pt.restaurant_id = r.id
+					AND pt.day = EXTRACT(DOW FROM %s) AND pt.hour = EXTRACT(HOUR FROM %s) AND pt.busyness >= %s)`,
+				now, now, b.Arg(QuietBusyness))
+		})
+	}
+	if p.HappyHour || !p.ActiveAt.IsZero() {
+		preds = append(preds, func(b *QueryBuilder) string {
+			open := offerWindowOpen(cityLocalTime(b, p.ActiveAt, p.ActiveAtLocal))
+			if p.HappyHour {
+				return "r.offer_window_start IS NOT NULL AND " + open
+			}
+			// Offers without a window are valid at any time.
+			return fmt.Sprintf("(r.offer_window_start IS NULL OR (%s))", open)
+		})
 	}
 
-	conditions = append(conditions, "r.is_duplicate = false")
+	if !p.Snapshot.IsZero() {
+		preds = append(preds, Compare("r.id", "<=", p.Snapshot.MaxID))
+	}
 
-	whereStr := "WHERE " + strings.Join(conditions, " AND ")
+	preds = append(preds, Raw(tenantScope(p.Tenant, "r.city")))
+	if !p.IncludeDuplicates {
+		preds = append(preds, Raw("r.is_duplicate = false"))
+	}
+	return distanceExpr, preds
+}
+
+// BuildSearchQueries generates SQL WHERE clauses and arguments based on provided SearchParams.
+// It handles spatial queries (PostGIS), text similarity, and relational filters.
+func BuildSearchQueries(p SearchParams) (string, string, []interface{}) {
+	b := &QueryBuilder{}
+	distanceExpr, preds := SearchPredicates(b, p)
+	b.Where(preds...)
+	whereStr := b.WhereClause()
+	from := searchSource(b, p.Snapshot)
 
-	countQuery := "SELECT COUNT(*) FROM restaurants r " + whereStr
+	countQuery := "SELECT COUNT(*), MAX(r.last_scraped_at), MAX(r.updated_at) FROM " + from + " " + whereStr
 
-	selectFields := "r.id, r.restaurant_name, r.city, r.area, r.cost_for_two, r.rating, r.latitude, r.longitude, r.image_url, r.effective_discount, r.free, r.offer, r.percentage"
-	resultQuery := fmt.Sprintf(`
-		SELECT %s, %s as distance,
-		       COALESCE((SELECT json_agg(json_build_object('id', c.id, 'cuisine_name', c.cuisine_name)) FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE rc.restaurant_id = r.id), '[]') as cuisines,
-		       COALESCE((SELECT json_agg(json_build_object('id', m.id, 'meal_type', m.meal_type)) FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE rmt.restaurant_id = r.id), '[]') as meal_types
-		FROM restaurants r %s
-	`, selectFields, distanceExpr, whereStr)
+	resultQuery := fmt.Sprintf("SELECT %s FROM %s %s", selectList(SelectColumns(p.Fields, p.Include, true), distanceExpr), from, whereStr)
 
-	return countQuery, resultQuery, args
+	return countQuery, resultQuery, b.Args()
 }
 
-func ScanRestaurant(rows *sql.Rows, hasExtraFields bool) (models.Restaurant, error) {
-	var r models.Restaurant
-	var cuisinesJSON, mealTypesJSON []byte
-	var err error
+// PrepareSearch applies synonym normalization, resolves cuisine and meal-type
+// names to IDs, applies the city's radius settings, and fetches any
+// travel-time polygon so the params are ready for BuildSearchQueries.
+func PrepareSearch(db *sql.DB, p *SearchParams) {
+	p.City = canonicalCity(db, p.City)
+	NormalizeSearchParams(db, p)
+	ResolveTaxonomyFilters(db, p)
+	applyRadiusConfig(db, p)
+	if p.WithinMinutes > 0 {
+		isoline, err := geo.Isoline(p.Lat, p.Lon, p.WithinMinutes, p.Mode)
+		if err != nil {
+			log.Println("Isoline lookup failed, falling back to radius search:", err)
+		} else {
+			p.Isoline = isoline
+		}
+	}
+}
 
-	if hasExtraFields {
-		err = rows.Scan(&r.ID, &r.RestaurantName, &r.City, &r.Area, &r.CostForTwo, &r.Rating, &r.Latitude, &r.Longitude, &r.ImageURL, &r.EffectiveDiscount, &r.Free, &r.Offer, &r.Percentage, &r.Distance, &cuisinesJSON, &mealTypesJSON)
-	} else {
-		err = rows.Scan(&r.ID, &r.RestaurantName, &r.City, &r.Area, &r.CostForTwo, &r.Rating, &r.Latitude, &r.Longitude, &r.ImageURL, &r.EffectiveDiscount, &r.Free, &r.Offer, &r.Percentage, &cuisinesJSON, &mealTypesJSON)
+// expandRadius widens a radius search that matched fewer than
+// MinRadiusResults restaurants, re-counting after each step, and returns the
+// summary for the radius it settled on. Searches bounded by a city, polygon
+// or several points are left alone.
+func expandRadius(db *sql.DB, p *SearchParams, total int, freshness *models.DataFreshness) (int, *models.DataFreshness, error) {
+	if !p.ExpandRadius || !p.HasLocation || p.City != "" || p.Isoline != "" || len(p.Points) > 0 {
+		return total, freshness, nil
 	}
+	requested := p.Radius
+	for total < MinRadiusResults && p.Radius < MaxExpandedRadius {
+		p.Radius = min(p.Radius*RadiusExpansionFactor, MaxExpandedRadius)
+		var err error
+		if total, freshness, err = SearchSummary(db, *p); err != nil {
+			return 0, nil, err
+		}
+	}
+	if p.Radius != requested {
+		p.RequestedRadius = requested
+	}
+	return total, freshness, nil
+}
+
+// context returns p.Ctx, or the background context when it is nil.
+func (p SearchParams) context() context.Context {
+	if p.Ctx == nil {
+		return context.Background()
+	}
+	return p.Ctx
+}
+
+// CountSearch returns the total number of restaurants matching p.
+func CountSearch(db *sql.DB, p SearchParams) (int, error) {
+	totalCount, _, err := SearchSummary(db, p)
+	return totalCount, err
+}
 
+// SearchSummary returns the number of restaurants matching p and how fresh
+// their data is, in a single query.
+func SearchSummary(db *sql.DB, p SearchParams) (int, *models.DataFreshness, error) {
+	countQ, _, args := BuildSearchQueries(p)
+	var totalCount int
+	var scraped, updated sql.NullTime
+	if err := db.QueryRowContext(p.context(), countQ, args...).Scan(&totalCount, &scraped, &updated); err != nil {
+		return 0, nil, err
+	}
+	return totalCount, newFreshness(scraped, updated, staleAfter), nil
+}
+
+// FetchSearchPage returns the page of restaurants selected by p.Limit and p.Offset.
+func FetchSearchPage(db *sql.DB, p SearchParams) ([]models.Restaurant, error) {
+	results := []models.Restaurant{}
+	err := StreamSearch(db, p, func(res models.Restaurant) error {
+		results = append(results, res)
+		return nil
+	})
 	if err != nil {
-		return r, err
+		return nil, err
 	}
+	return results, nil
+}
 
-	json.Unmarshal(cuisinesJSON, &r.Cuisines)
-	json.Unmarshal(mealTypesJSON, &r.MealTypes)
-	return r, nil
+// StreamSearch calls fn for each restaurant on the page selected by p as rows
+// arrive, without buffering the page (except a diverse page, which is
+// reranked first). It stops at the first error from fn.
+func StreamSearch(db *sql.DB, p SearchParams, fn func(models.Restaurant) error) error {
+	if p.Diverse && p.Limit <= MaxDiverseLimit {
+		page, err := fetchDiversePage(db, p)
+		if err != nil {
+			return err
+		}
+		for _, res := range page {
+			if err := fn(res); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, resultQ, args := BuildSearchQueries(p)
+	finalQuery := fmt.Sprintf("%s %s LIMIT %d OFFSET %d", resultQ, OrderByClause(p.Sort), p.Limit, p.Offset)
+	rows, err := db.QueryContext(p.context(), finalQuery, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols := SelectColumns(p.Fields, p.Include, true)
+	for rows.Next() {
+		res, err := ScanRestaurant(rows, cols)
+		if err != nil {
+			continue
+		}
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 // SearchHandler coordinates the multi-stage search process: parameter parsing,
 // result counting for pagination, and final data retrieval with ordering.
 func SearchHandler(db *sql.DB) http.HandlerFunc {
+	return searchHandler(db, relatedFields)
+}
+
+// MapSearchHandler serves the same search for map pins, which don't render
+// cuisines or meal types, so relations are only aggregated with include=.
+func MapSearchHandler(db *sql.DB) http.HandlerFunc {
+	return searchHandler(db, []string{})
+}
+
+func searchHandler(db *sql.DB, defaultInclude []string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		normalized, unknown := NormalizeQuery(r.URL.Query())
+		reportUnknownParams(w, unknown)
+		strict := normalized.Get("strict") == "true"
+
+		// Strict clients get a 422 for any parameter problem; lenient ones get the
+		// search with bad filters ignored and listed under "warnings".
+		warnings := ValidateSearchQuery(normalized, unknown)
+		if strict && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
+
 		p := ParseSearchParams(r.URL.Query())
-		countQ, resultQ, args := BuildSearchQueries(p)
+		p.Include, _ = ParseInclude(normalized, defaultInclude)
+		p.IncludeUnpublished = includeUnpublished(r)
+		p.Tenant = middleware.GetTenant(r.Context())
+		p.Ctx = r.Context()
+		PrepareSearch(db, &p)
+		// The first page reads live data; the token it hands out pins later
+		// pages to that data.
+		snapshot := p.Snapshot
+		if snapshot.IsZero() {
+			snapshot = currentSnapshot(db)
+		}
+		if !snapshot.IsZero() {
+			w.Header().Set(SnapshotHeader, EncodeSnapshot(snapshot))
+		}
+		warnings = append(warnings, unresolvedWarnings(p.Unresolved)...)
+		if strict && len(warnings) > 0 {
+			writeStrictError(w, warnings)
+			return
+		}
 
-		var totalCount int
-		err := db.QueryRow(countQ, args...).Scan(&totalCount)
+		totalCount, freshness, err := SearchSummary(db, p)
+		if err == nil {
+			totalCount, freshness, err = expandRadius(db, &p, totalCount, freshness)
+		}
 		if err != nil {
 			log.Println("Count query error:", err)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"restaurants": []models.Restaurant{}, "pages": 0})
+			tracker.CaptureRequest(r, err)
+			writeSearchResponse(w, r, map[string]interface{}{"restaurants": []models.Restaurant{}, "pages": 0}, nil, 0, 0)
 			return
 		}
 
 		totalPages := int(math.Ceil(float64(totalCount) / float64(p.Limit)))
 		if p.Page > totalPages && totalPages > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"restaurants": []models.Restaurant{}, "pages": totalPages})
+			writeSearchResponse(w, r, map[string]interface{}{"restaurants": []models.Restaurant{}, "pages": totalPages}, nil, totalPages, totalCount)
 			return
 		}
 
-		orderBy := "ORDER BY effective_discount DESC, id ASC"
-		switch p.Sort {
-		case "rating_desc":
-			orderBy = "ORDER BY rating DESC, id ASC"
-		case "cost_asc":
-			orderBy = "ORDER BY cost_for_two ASC, id ASC"
-		default:
+		if wantsStream(r, p) {
+			w.Header().Set("X-Total-Count", strconv.Itoa(totalCount))
+			streamNDJSON(db, w, r, p)
+			return
 		}
 
-		finalQuery := fmt.Sprintf("%s %s LIMIT %d OFFSET %d", resultQ, orderBy, p.Limit, p.Offset)
-		rows, err := db.Query(finalQuery, args...)
+		results, err := FetchSearchPage(db, p)
 		if err != nil {
 			log.Println("Search result query error:", err)
+			tracker.CaptureRequest(r, err)
 			http.Error(w, "Something went wrong", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
 
-		results := []models.Restaurant{}
-		for rows.Next() {
-			if res, err := ScanRestaurant(rows, true); err == nil {
-				results = append(results, res)
+		ApplyGeoPrivacy(r, results)
+		ApplyDistanceText(r, results)
+
+		searchKey := r.URL.Query()
+		searchKey.Del("page")
+		searchKey.Del("snapshot")
+		recordActivity(db, r, ActivitySearch, searchKey.Encode())
+		recordRecentSearch(db, r, p.Name, searchKey)
+
+		resp := map[string]interface{}{
+			"restaurants":     ProjectFields(results, p.Fields),
+			"pages":           totalPages,
+			"total_count":     totalCount,
+			"applied_filters": DescribeSearch(db, p),
+			"data_freshness":  freshness,
+		}
+		if !snapshot.IsZero() {
+			resp["snapshot"] = EncodeSnapshot(snapshot)
+		}
+		if len(p.Unresolved) > 0 {
+			resp["unresolved_filters"] = p.Unresolved
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		if totalCount < SuggestionThreshold {
+			if term := suggestionTerm(p); term != "" {
+				if suggestion := DidYouMean(db, term); suggestion != "" {
+					resp["did_you_mean"] = suggestion
+				}
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"restaurants": results,
-			"pages":       totalPages,
-			"total_count": totalCount,
-		})
+		writeSearchResponse(w, r, resp, results, totalPages, totalCount)
 	}
 }
 
@@ -328,20 +734,36 @@ func GetRestaurantsByCityHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "City is required", http.StatusBadRequest)
 			return
 		}
+		if c, ok := ResolveCity(db, city); ok {
+			if redirectToCitySlug(w, r, c) {
+				return
+			}
+			city = c.Name
+		}
+		if notModified(db, w, r, cityRestaurantsLastModified, city) {
+			return
+		}
+
+		fields, _ := ParseFields(r.URL.Query().Get("fields"))
+		include, _ := ParseInclude(r.URL.Query(), relatedFields)
+		cols := SelectColumns(fields, include, false)
 
 		// The query uses complex sub-query aggregation to fetch related metadata
 		// (cuisines, meal types) in a single database round-trip, significantly
-		// reducing network overhead. The ILIKE filter provides flexible city
-		// matching without the complexity of trigram indexes.
+		// reducing network overhead. The ILIKE filter on the accent-folded city
+		// provides flexible city matching without the complexity of trigram indexes.
 		query := `
-			SELECT r.id, r.restaurant_name, r.city, r.area, r.cost_for_two, r.rating, r.latitude, r.longitude, r.image_url, r.effective_discount, r.free, r.offer, r.percentage,
-				COALESCE((SELECT json_agg(json_build_object('id', c.id, 'cuisine_name', c.cuisine_name)) FROM restaurant_cuisines rc JOIN cuisines c ON rc.cuisine_id = c.id WHERE rc.restaurant_id = r.id), '[]') as cuisines,
-				COALESCE((SELECT json_agg(json_build_object('id', m.id, 'meal_type', m.meal_type)) FROM restaurant_meal_types rmt JOIN meal_types m ON rmt.meal_type_id = m.id WHERE rmt.restaurant_id = r.id), '[]') as meal_types
+			SELECT %s
 			FROM restaurants r
-			WHERE r.city ILIKE $1 AND r.is_duplicate = false
+			WHERE r.city_norm ILIKE fold_text($1) AND r.is_duplicate = false %s %s
 			ORDER BY r.effective_discount DESC
 			LIMIT 10
 		`
+		published := "AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name_norm ILIKE fold_text($1) AND ci.is_published)"
+		if includeUnpublished(r) {
+			published = ""
+		}
+		query = fmt.Sprintf(query, selectList(cols, ""), published, andTenantScope(r, "r.city"))
 
 		rows, err := db.Query(query, city)
 		if err != nil {
@@ -352,12 +774,13 @@ func GetRestaurantsByCityHandler(db *sql.DB) http.HandlerFunc {
 
 		results := []models.Restaurant{}
 		for rows.Next() {
-			if res, err := ScanRestaurant(rows, false); err == nil {
+			if res, err := ScanRestaurant(rows, cols); err == nil {
 				results = append(results, res)
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
+		ApplyGeoPrivacy(r, results)
+
+		writeSearchResponse(w, r, ProjectFields(results, fields), results, 0, len(results))
 	}
 }
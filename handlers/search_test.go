@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const injection = "1'); DROP TABLE restaurants; --"
+
+// TestSearchParamsInjection sends an injection attempt through every search
+// parameter, alone and alongside a location so the geo branches run, and
+// checks it never reaches the SQL text: values are bound as arguments or
+// matched against a whitelist.
+func TestSearchParamsInjection(t *testing.T) {
+	keys := append([]string{"fields", "include", "snapshot"}, SearchParamKeys...)
+	for _, key := range keys {
+		for _, base := range []string{"", "lat=12.97&lon=77.59"} {
+			query, _ := url.ParseQuery(base)
+			query.Set(key, injection)
+			t.Run(key+"?"+base, func(t *testing.T) {
+				p := ParseSearchParams(query)
+				p.DistanceCap = 100000
+				countQuery, resultQuery, _ := BuildSearchQueries(p)
+				for _, sql := range []string{countQuery, resultQuery, OrderByClause(p.Sort)} {
+					if strings.Contains(sql, "DROP TABLE") {
+						t.Fatalf("%s=%q reached the SQL text: %s", key, injection, sql)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	for sort, expr := range sortOrders {
+		if got := OrderByClause(sort); got != "ORDER BY "+expr {
+			t.Errorf("OrderByClause(%q) = %q", sort, got)
+		}
+	}
+	for _, sort := range []string{"", "rating DESC", "id; DROP TABLE restaurants", "discount--", "DISCOUNT"} {
+		if got := OrderByClause(sort); got != "ORDER BY "+sortOrders["discount"] {
+			t.Errorf("OrderByClause(%q) = %q, want the default order", sort, got)
+		}
+		if p := ParseSearchParams(url.Values{"sort": {sort}}); p.Sort != "" {
+			t.Errorf("ParseSearchParams kept sort %q", p.Sort)
+		}
+	}
+}
+
+func TestParseLatLon(t *testing.T) {
+	tests := []struct {
+		lat, lon string
+		ok       bool
+	}{
+		{"12.97", "77.59", true},
+		{"-90", "180", true},
+		{"90.1", "77.59", false},
+		{"12.97", "-180.5", false},
+		{"", "77.59", false},
+		{"abc", "77.59", false},
+		{"NaN", "77.59", false},
+		{"12.97", "nan", false},
+		{"Inf", "77.59", false},
+		{"12.97", "-Infinity", false},
+		{"1e400", "77.59", false},
+	}
+	for _, tt := range tests {
+		if _, _, ok := parseLatLon(tt.lat, tt.lon); ok != tt.ok {
+			t.Errorf("parseLatLon(%q, %q) ok = %v, want %v", tt.lat, tt.lon, ok, tt.ok)
+		}
+	}
+}
+
+func TestParseSearchParamsRejectsNaN(t *testing.T) {
+	p := ParseSearchParams(url.Values{"lat": {"NaN"}, "lon": {"NaN"}, "rating": {"NaN"}, "discount": {"Inf"}})
+	if p.HasLocation {
+		t.Error("lat=NaN set a location")
+	}
+	if p.Rating != 0 || p.Discount != 0 {
+		t.Errorf("rating = %v, discount = %v, want 0", p.Rating, p.Discount)
+	}
+	if p := ParseSearchParams(url.Values{"points": {"NaN,77.59;12.97,77.59;12.98,Inf"}}); len(p.Points) != 0 {
+		t.Errorf("points = %v, want none", p.Points)
+	}
+
+	warnings := ValidateSearchQuery(url.Values{"lat": {"NaN"}, "lon": {"77.59"}, "radius": {"Inf"}}, nil)
+	if len(warnings) != 2 || warnings[0].Param != "lat" || warnings[1].Param != "radius" {
+		t.Errorf("ValidateSearchQuery warnings = %v, want lat and radius", warnings)
+	}
+}
+
+// TestCoordinateHandlersRejectNaN checks NaN and Inf are refused before any
+// query runs, so no database is needed.
+func TestCoordinateHandlersRejectNaN(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"detect-city": DetectCityHandler(nil),
+		"detect-area": DetectAreaHandler(nil),
+	}
+	for name, h := range handlers {
+		for _, q := range []string{"lat=NaN&lon=77.59", "lat=12.97&lon=NaN", "lat=Inf&lon=77.59", "lat=12.97&lon=-Inf"} {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("GET", "/?"+q, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s ?%s = %d, want 400", name, q, w.Code)
+			}
+		}
+	}
+}
+
+// TestSearchDistancesInMeters checks that search points are cast to
+// geography, so ST_Distance and ST_DWithin against r.geo work in meters and
+// radii are bound as meters rather than degrees.
+func TestSearchDistancesInMeters(t *testing.T) {
+	const point = "ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography"
+	p := ParseSearchParams(url.Values{"lat": {"12.97"}, "lon": {"77.59"}, "radius": {"2500"}})
+	p.DistanceCap = 100000
+	countQuery, resultQuery, args := BuildSearchQueries(p)
+	if want := "ST_Distance(r.geo, " + point + ")"; !strings.Contains(resultQuery, want) {
+		t.Errorf("result query lacks %s", want)
+	}
+	for _, want := range []string{
+		"ST_DWithin(r.geo, " + point + ", $3)",
+		"ST_DWithin(r.geo, " + point + ", $4)",
+	} {
+		if !strings.Contains(countQuery, want) {
+			t.Errorf("count query lacks %s:\n%s", want, countQuery)
+		}
+	}
+	if want := []interface{}{77.59, 12.97, 100000.0, 2500.0}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+
+	p = ParseSearchParams(url.Values{"points": {"12.97,77.59;12.98,77.6"}, "radius": {"1500"}})
+	countQuery, resultQuery, _ = BuildSearchQueries(p)
+	if want := "GREATEST(ST_Distance(r.geo, " + point + "), ST_Distance(r.geo, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography))"; !strings.Contains(resultQuery, want) {
+		t.Errorf("result query lacks %s", want)
+	}
+	if strings.Count(countQuery, "4326)::geography, $") != 2 {
+		t.Errorf("count query does not bound both points in meters:\n%s", countQuery)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/tracker"
+)
+
+// ServiceAreasHandler returns the service areas of published cities as a
+// GeoJSON FeatureCollection for drawing coverage on a map.
+func ServiceAreasHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant := middleware.GetTenant(r.Context())
+		cacheKey := "service-areas"
+		if tenant != nil {
+			cacheKey += ":" + tenant.Slug
+		}
+		scope := andTenantScope(r, "ci.city_name")
+		collection, err := metadataCache.GetOrLoad(cacheKey, func() (interface{}, error) {
+			return loadServiceAreas(db, scope)
+		})
+		if err != nil {
+			log.Println("Service areas query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(collection)
+	}
+}
+
+// loadServiceAreas builds the ServiceAreasHandler collection; scope is the
+// tenant condition from andTenantScope.
+func loadServiceAreas(db *sql.DB, scope string) (map[string]interface{}, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT ci.id, ci.city_name, COALESCE(ci.slug, ''), ST_AsGeoJSON(ci.service_area)
+		FROM cities ci
+		WHERE ci.service_area IS NOT NULL AND ci.is_published %s
+		ORDER BY ci.city_name`, scope))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	features := []map[string]interface{}{}
+	for rows.Next() {
+		var id int64
+		var name, slug, geometry string
+		if err := rows.Scan(&id, &name, &slug, &geometry); err != nil {
+			continue
+		}
+		features = append(features, map[string]interface{}{
+			"type":       "Feature",
+			"geometry":   json.RawMessage(geometry),
+			"properties": map[string]interface{}{"id": id, "city": name, "city_slug": slug},
+		})
+	}
+	return map[string]interface{}{"type": "FeatureCollection", "features": features}, nil
+}
+
+// SetServiceAreaHandler replaces a city's service area. The body is a GeoJSON
+// Polygon or MultiPolygon in WGS84, or a Feature wrapping one. With If-Match
+// the edit fails with 409 if the city changed since that version.
+func SetServiceAreaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid city id", http.StatusBadRequest)
+			return
+		}
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		geometry, ok := validPolygon(db, w, raw)
+		if !ok {
+			return
+		}
+		version, ok := expectedVersion(w, r, "")
+		if !ok {
+			return
+		}
+
+		res, err := adminExec(db, r, cityChanged(id), "UPDATE cities SET service_area = ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON($1), 4326)) WHERE id = $2 AND "+versionMatches("cities", "$3"), geometry, id, version)
+		writeServiceAreaUpdate(db, w, r, id, res, err)
+	}
+}
+
+// DeleteServiceAreaHandler removes a city's service area.
+func DeleteServiceAreaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid city id", http.StatusBadRequest)
+			return
+		}
+		version, ok := expectedVersion(w, r, "")
+		if !ok {
+			return
+		}
+		res, err := adminExec(db, r, cityChanged(id), "UPDATE cities SET service_area = NULL WHERE id = $1 AND "+versionMatches("cities", "$2"), id, version)
+		writeServiceAreaUpdate(db, w, r, id, res, err)
+	}
+}
+
+// validPolygon checks that raw is a valid GeoJSON Polygon or MultiPolygon, or
+// a Feature wrapping one, and returns the geometry. It writes a 400 and
+// returns false otherwise.
+func validPolygon(db *sql.DB, w http.ResponseWriter, raw json.RawMessage) (string, bool) {
+	var body struct {
+		Type     string          `json:"type"`
+		Geometry json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		http.Error(w, "Invalid GeoJSON", http.StatusBadRequest)
+		return "", false
+	}
+	geometry := raw
+	if body.Type == "Feature" {
+		geometry = body.Geometry
+		if err := json.Unmarshal(geometry, &body); err != nil {
+			http.Error(w, "Feature has no geometry", http.StatusBadRequest)
+			return "", false
+		}
+	}
+	if body.Type != "Polygon" && body.Type != "MultiPolygon" {
+		http.Error(w, "geometry must be a Polygon or MultiPolygon", http.StatusBadRequest)
+		return "", false
+	}
+
+	var reason string
+	if err := db.QueryRow("SELECT ST_IsValidReason(ST_GeomFromGeoJSON($1))", string(geometry)).Scan(&reason); err != nil {
+		http.Error(w, "Invalid GeoJSON geometry", http.StatusBadRequest)
+		return "", false
+	}
+	if reason != "Valid Geometry" {
+		http.Error(w, "Invalid geometry: "+reason, http.StatusBadRequest)
+		return "", false
+	}
+	return string(geometry), true
+}
+
+func writeServiceAreaUpdate(db *sql.DB, w http.ResponseWriter, r *http.Request, id int64, res sql.Result, err error) {
+	if err != nil {
+		log.Println("Service area update error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		writeNotFoundOrConflict(db, w, r, "cities", id, "City not found")
+		return
+	}
+	if writeDryRun(w, r, MutationSummary{Updated: n}) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
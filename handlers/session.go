@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	ActivitySearch = "search"
+	ActivityView   = "view"
+
+	recentActivityLimit = 10
+)
+
+const (
+	// activityQueueSize bounds the session activity waiting to be written.
+	activityQueueSize = 256
+	// activityWriteTimeout bounds each insert, so a stalled database cannot
+	// hold the writer forever.
+	activityWriteTimeout = 5 * time.Second
+)
+
+type activityRecord struct {
+	sessionID, kind, payload string
+}
+
+var (
+	activityQueue   = make(chan activityRecord, activityQueueSize)
+	activityWriter  sync.Once
+	activityDropped = expvar.NewInt("session_activity_dropped")
+)
+
+// recordActivity queues a search or view for the current anonymous session.
+// One background writer inserts them, so a traffic spike cannot tie up the
+// connection pool; when the queue is full the activity is dropped (counted as
+// session_activity_dropped in /debug/vars) rather than slowing the response.
+func recordActivity(db *sql.DB, r *http.Request, kind, payload string) {
+	sid := middleware.GetSessionID(r.Context())
+	if sid == "" || payload == "" {
+		return
+	}
+	activityWriter.Do(func() { go writeActivity(db) })
+	select {
+	case activityQueue <- activityRecord{sessionID: sid, kind: kind, payload: payload}:
+	default:
+		activityDropped.Add(1)
+	}
+}
+
+func writeActivity(db *sql.DB) {
+	for a := range activityQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), activityWriteTimeout)
+		_, err := db.ExecContext(ctx, "INSERT INTO session_activity (session_id, kind, payload) VALUES ($1, $2, $3)", a.sessionID, a.kind, a.payload)
+		cancel()
+		if err != nil {
+			log.Println("Session activity insert error:", err)
+		}
+	}
+}
+
+// RecordViewHandler records that the current session opened a restaurant.
+// Expects a JSON body of the form {"restaurant_id": "123"}.
+func RecordViewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RestaurantID string `json:"restaurant_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if id, err := strconv.ParseInt(body.RestaurantID, 10, 64); err != nil || id <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+
+		// Suspicious views get the same response so bots cannot tell.
+		switch verdict, reason := screenSubmission(r, AbuseKindView, body.RestaurantID); verdict {
+		case abuseHold:
+			quarantineSubmission(db, r, AbuseKindView, reason, viewPayload{RestaurantID: body.RestaurantID})
+		case abuseAllow:
+			recordActivity(db, r, ActivityView, body.RestaurantID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RecentActivityHandler returns the latest distinct searches and restaurant views
+// for the current anonymous session, newest first.
+func RecentActivityHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sid := middleware.GetSessionID(r.Context())
+
+		searches, err := recentActivity(db, sid, ActivitySearch)
+		if err == nil {
+			var views []models.SessionActivity
+			views, err = recentActivity(db, sid, ActivityView)
+			if err == nil {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"searches": searches,
+					"views":    views,
+				})
+				return
+			}
+		}
+
+		log.Println("Recent activity query error:", err)
+		tracker.CaptureRequest(r, err)
+		http.Error(w, "Something went wrong", http.StatusBadRequest)
+	}
+}
+
+func recentActivity(db *sql.DB, sid, kind string) ([]models.SessionActivity, error) {
+	rows, err := db.Query(`
+		SELECT payload, MAX(created_at) AS last_seen
+		FROM session_activity
+		WHERE session_id = $1 AND kind = $2
+		GROUP BY payload
+		ORDER BY last_seen DESC
+		LIMIT $3
+	`, sid, kind, recentActivityLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.SessionActivity{}
+	for rows.Next() {
+		var a models.SessionActivity
+		if err := rows.Scan(&a.Payload, &a.CreatedAt); err == nil {
+			items = append(items, a)
+		}
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"eazyfind/tracker"
+)
+
+const (
+	shareCodeLength   = 7
+	shareCodeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	maxShareQuery     = 2048
+)
+
+// canonicalSearchQuery keeps only known search parameters (minus page) and
+// encodes them in sorted order so identical searches share one code.
+func canonicalSearchQuery(raw string) (string, error) {
+	values, err := url.ParseQuery(strings.TrimPrefix(raw, "?"))
+	if err != nil {
+		return "", err
+	}
+	values, _ = NormalizeQuery(values)
+	clean := url.Values{}
+	for k, v := range values {
+		if k != "page" && slices.Contains(SearchParamKeys, k) && len(v) > 0 && v[0] != "" {
+			clean.Set(k, v[0])
+		}
+	}
+	return clean.Encode(), nil
+}
+
+func newShareCode() string {
+	b := make([]byte, shareCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = shareCodeAlphabet[int(b[i])%len(shareCodeAlphabet)]
+	}
+	return string(b)
+}
+
+// CreateShareHandler stores a search query string under a short code.
+// Expects {"query": "city=pune&cuisines=Italian&discount=40&maxCost=800"};
+// creating the same search twice returns the existing code.
+func CreateShareHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+			// Website is a honeypot: share forms hide it from people.
+			Website string `json:"website"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if !allowPublicSubmission(w, r, AbuseKindShare, body.Website) {
+			return
+		}
+		query, err := canonicalSearchQuery(body.Query)
+		if err != nil || query == "" || len(query) > maxShareQuery {
+			http.Error(w, "query must contain at least one search filter", http.StatusBadRequest)
+			return
+		}
+
+		var code string
+		err = db.QueryRow(`
+			INSERT INTO share_links (code, query) VALUES ($1, $2)
+			ON CONFLICT (query) DO UPDATE SET query = EXCLUDED.query
+			RETURNING code
+		`, newShareCode(), query).Scan(&code)
+		if err != nil {
+			log.Println("Share insert error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"code": code, "query": query, "path": "/s/" + code})
+	}
+}
+
+// ResolveShareHandler looks up a short code. Browsers are redirected to the
+// frontend (FRONTEND_URL) with the saved filters applied; API clients get JSON.
+func ResolveShareHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.PathValue("code")
+		if len(code) != shareCodeLength {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+			return
+		}
+
+		var query string
+		err := db.QueryRow("UPDATE share_links SET hits = hits + 1 WHERE code = $1 RETURNING query", code).Scan(&query)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Share lookup error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+
+		if frontend := os.Getenv("FRONTEND_URL"); frontend != "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, strings.TrimSuffix(frontend, "/")+"/?"+query, http.StatusFound)
+			return
+		}
+
+		params, _ := url.ParseQuery(query)
+		flat := map[string]string{}
+		for k := range params {
+			flat[k] = params.Get(k)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "query": query, "params": flat})
+	}
+}
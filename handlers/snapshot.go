@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SnapshotHeader carries the snapshot token on every search response,
+// including streamed ones that have no JSON envelope.
+const SnapshotHeader = "X-Snapshot"
+
+// Snapshot pins later pages of a search to the data as it was when the first
+// page was served: restaurants added since (ids above MaxID) are left out, and
+// restaurants changed since are ranked and filtered on their cost, rating,
+// offer and discount as of At.
+type Snapshot struct {
+	MaxID int64
+	At    time.Time
+}
+
+// IsZero reports whether s pins nothing.
+func (s Snapshot) IsZero() bool {
+	return s.MaxID == 0
+}
+
+// currentSnapshotQuery returns the newest restaurant id and the database's
+// clock. MAX(id) is answered from the primary key index.
+const currentSnapshotQuery = "SELECT COALESCE(MAX(id), 0), now() FROM restaurants"
+
+var errInvalidSnapshot = errors.New("invalid snapshot token")
+
+// EncodeSnapshot renders a snapshot as an opaque, URL-safe token.
+func EncodeSnapshot(s Snapshot) string {
+	b := binary.BigEndian.AppendUint64(nil, uint64(s.MaxID))
+	b = binary.BigEndian.AppendUint64(b, uint64(s.At.UnixMicro()))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeSnapshot parses a token produced by EncodeSnapshot.
+func DecodeSnapshot(token string) (Snapshot, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 16 {
+		return Snapshot{}, errInvalidSnapshot
+	}
+	s := Snapshot{
+		MaxID: int64(binary.BigEndian.Uint64(b)),
+		At:    time.UnixMicro(int64(binary.BigEndian.Uint64(b[8:]))).UTC(),
+	}
+	if s.MaxID <= 0 || s.At.Unix() <= 0 || s.At.After(time.Now().Add(time.Minute)) {
+		return Snapshot{}, errInvalidSnapshot
+	}
+	return s, nil
+}
+
+// currentSnapshot returns the snapshot to hand out with a fresh search, or a
+// zero Snapshot if it cannot be determined (no token is returned then).
+func currentSnapshot(db *sql.DB) Snapshot {
+	var s Snapshot
+	if err := db.QueryRow(currentSnapshotQuery).Scan(&s.MaxID, &s.At); err != nil {
+		return Snapshot{}
+	}
+	return s
+}
+
+// searchSource is the FROM item a search reads as r. With a snapshot, rows
+// changed after it take their cost, rating, offer and discount from the last
+// restaurant_history row recorded by then, so an import that changes sort
+// values cannot move rows between pages or in and out of filters. Unchanged
+// rows are read as they are.
+func searchSource(b *QueryBuilder, s Snapshot) string {
+	if s.IsZero() {
+		return "restaurants r"
+	}
+	at := b.Arg(s.At)
+	return fmt.Sprintf(`restaurants r0 CROSS JOIN LATERAL jsonb_populate_record(r0, CASE WHEN r0.updated_at <= %s THEN '{}'::jsonb ELSE COALESCE((
+		SELECT jsonb_build_object('cost_for_two', rh.cost_for_two, 'rating', rh.rating, 'offer', rh.offer, 'effective_discount', rh.effective_discount)
+		FROM restaurant_history rh
+		WHERE rh.restaurant_id = r0.id AND rh.recorded_at <= %s
+		ORDER BY rh.recorded_at DESC
+		LIMIT 1), '{}'::jsonb) END) r`, at, at)
+}
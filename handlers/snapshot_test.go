@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotToken(t *testing.T) {
+	s := Snapshot{MaxID: 48213, At: time.Date(2026, 1, 16, 8, 30, 0, 123456000, time.UTC)}
+	got, err := DecodeSnapshot(EncodeSnapshot(s))
+	if err != nil || got != s {
+		t.Fatalf("DecodeSnapshot(EncodeSnapshot(%v)) = %v, %v", s, got, err)
+	}
+	for _, token := range []string{
+		"",
+		"not a token",
+		EncodeSnapshot(Snapshot{MaxID: 0, At: s.At}),
+		EncodeSnapshot(Snapshot{MaxID: 1, At: time.Now().Add(time.Hour)}),
+		EncodeSnapshot(s)[:11], // the old id-only token
+	} {
+		if _, err := DecodeSnapshot(token); err == nil {
+			t.Errorf("DecodeSnapshot(%q) accepted an invalid token", token)
+		}
+	}
+}
+
+func TestSnapshotSearchReadsHistory(t *testing.T) {
+	s := Snapshot{MaxID: 48213, At: time.Date(2026, 1, 16, 8, 30, 0, 0, time.UTC)}
+	p := ParseSearchParams(url.Values{"rating": {"4"}, "sort": {"rating_desc"}, "snapshot": {EncodeSnapshot(s)}})
+	countQuery, resultQuery, args := BuildSearchQueries(p)
+	for _, q := range []string{countQuery, resultQuery} {
+		if !strings.Contains(q, "FROM restaurants r0 CROSS JOIN LATERAL jsonb_populate_record(r0,") ||
+			!strings.Contains(q, "rh.recorded_at <= $3") {
+			t.Errorf("query does not read restaurant_history as of the snapshot:\n%s", q)
+		}
+	}
+	if len(args) != 3 || args[1] != s.MaxID || args[2] != s.At {
+		t.Errorf("args = %#v", args)
+	}
+
+	p = ParseSearchParams(url.Values{"rating": {"4"}})
+	if countQuery, _, _ := BuildSearchQueries(p); !strings.Contains(countQuery, "FROM restaurants r WHERE") {
+		t.Errorf("a search without a snapshot should read restaurants directly:\n%s", countQuery)
+	}
+}
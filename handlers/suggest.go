@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+// SuggestionThreshold is the result count below which a spelling suggestion is looked up.
+const SuggestionThreshold = 3
+
+// suggestionTerm picks the free-text term worth correcting from a search,
+// preferring the name query over cuisine filters and unresolved names.
+func suggestionTerm(p SearchParams) string {
+	switch {
+	case p.Name != "":
+		return p.Name
+	case p.Cuisine != "":
+		return p.Cuisine
+	case p.Cuisines != "" && !strings.Contains(p.Cuisines, ","):
+		return p.Cuisines
+	case len(p.Unresolved) > 0:
+		return p.Unresolved[0].Value
+	}
+	return ""
+}
+
+// DidYouMean returns the closest restaurant or cuisine name by trigram similarity,
+// or "" when nothing is similar enough or the term is already an exact match.
+func DidYouMean(db *sql.DB, term string) string {
+	term = strings.TrimSpace(term)
+	if len(term) < 3 {
+		return ""
+	}
+	if canonical, ok := synonyms.lookup(db, term); ok && !strings.EqualFold(canonical, term) {
+		return canonical
+	}
+
+	var suggestion string
+	err := db.QueryRow(`
+		SELECT term FROM (
+			SELECT cuisine_name AS term, similarity(cuisine_name, $1) AS score FROM cuisines WHERE cuisine_name % $1
+			UNION ALL
+			SELECT restaurant_name, similarity(restaurant_name, $1) FROM restaurants WHERE restaurant_name % $1 AND is_duplicate = false
+		) t
+		WHERE lower(term) <> lower($1)
+		ORDER BY score DESC
+		LIMIT 1
+	`, term).Scan(&suggestion)
+	if err != nil {
+		return ""
+	}
+	return suggestion
+}
+
+// SuggestLimit is how many suggestions of each kind SuggestHandler returns.
+const SuggestLimit = 5
+
+// SuggestHandler suggests completions for the search box as the user types
+// ?q=: the caller's recent searches starting with it (the latest ones when q
+// is empty), then cuisines and published restaurants whose names start with
+// it.
+func SuggestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		resp := map[string]interface{}{"recent": []models.RecentSearch{}, "cuisines": []string{}, "restaurants": []string{}}
+
+		if owner := recentSearchOwner(r); owner != "" {
+			recent, err := recentSearches(db, owner, q, SuggestLimit)
+			if err != nil {
+				writeSuggestError(w, r, err)
+				return
+			}
+			resp["recent"] = recent
+		}
+		if q != "" {
+			for key, query := range map[string]string{
+				"cuisines": "SELECT cuisine_name FROM cuisines WHERE starts_with(lower(cuisine_name), lower($1)) ORDER BY cuisine_name LIMIT $2",
+				"restaurants": fmt.Sprintf(`
+					SELECT name FROM (
+						SELECT DISTINCT COALESCE(r.display_name, r.restaurant_name) AS name FROM restaurants r
+						WHERE starts_with(lower(COALESCE(r.display_name, r.restaurant_name)), lower($1)) AND r.is_duplicate = false
+						  AND EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published) %s
+					) t ORDER BY name LIMIT $2`, andTenantScope(r, "r.city")),
+			} {
+				names, err := suggestNames(db, query, q)
+				if err != nil {
+					writeSuggestError(w, r, err)
+					return
+				}
+				resp[key] = names
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, no-store")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func suggestNames(db *sql.DB, query, q string) ([]string, error) {
+	rows, err := db.Query(query, q, SuggestLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func writeSuggestError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Suggest error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"eazyfind/outbox"
+	"eazyfind/tracker"
+)
+
+// SynonymCacheTTL bounds how stale the in-memory synonym dictionary may get
+// when it is edited outside the admin endpoints.
+const SynonymCacheTTL = time.Minute
+
+type synonymCache struct {
+	mu     sync.RWMutex
+	terms  map[string]string
+	loaded time.Time
+}
+
+var synonyms synonymCache
+
+// lookup returns the canonical form of term, reloading the dictionary when stale.
+func (c *synonymCache) lookup(db *sql.DB, term string) (string, bool) {
+	c.mu.RLock()
+	fresh := c.terms != nil && time.Since(c.loaded) < SynonymCacheTTL
+	c.mu.RUnlock()
+	if !fresh {
+		c.reload(db)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	canonical, ok := c.terms[strings.ToLower(strings.TrimSpace(term))]
+	return canonical, ok
+}
+
+func (c *synonymCache) reload(db *sql.DB) {
+	rows, err := db.Query("SELECT term, canonical FROM synonyms")
+	if err != nil {
+		log.Println("Synonyms query error:", err)
+		// Keep what was loaded (nothing, on a first failure) and retry after
+		// SynonymCacheTTL rather than on every lookup while the database is down.
+		c.mu.Lock()
+		if c.terms == nil {
+			c.terms = map[string]string{}
+		}
+		c.loaded = time.Now()
+		c.mu.Unlock()
+		return
+	}
+	defer rows.Close()
+
+	terms := map[string]string{}
+	for rows.Next() {
+		var term, canonical string
+		if err := rows.Scan(&term, &canonical); err == nil {
+			terms[strings.ToLower(term)] = canonical
+		}
+	}
+
+	c.mu.Lock()
+	c.terms = terms
+	c.loaded = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *synonymCache) invalidate() {
+	c.mu.Lock()
+	c.terms = nil
+	c.mu.Unlock()
+}
+
+// NormalizeSearchParams rewrites colloquial terms to their canonical cuisine names.
+// A free-text name that is a known synonym becomes a structured cuisine filter.
+func NormalizeSearchParams(db *sql.DB, p *SearchParams) {
+	if p.Cuisine != "" {
+		if canonical, ok := synonyms.lookup(db, p.Cuisine); ok {
+			p.Cuisine = canonical
+		}
+	}
+	if p.Cuisines != "" {
+		names := splitList(p.Cuisines, true)
+		for i, name := range names {
+			if canonical, ok := synonyms.lookup(db, name); ok {
+				names[i] = canonical
+			}
+		}
+		p.Cuisines = strings.Join(names, ",")
+	}
+	if p.Name != "" && p.Cuisine == "" && p.Cuisines == "" {
+		if canonical, ok := synonyms.lookup(db, p.Name); ok {
+			p.Cuisine = canonical
+			p.Name = ""
+		}
+	}
+}
+
+// SynonymsHandler lists the synonym dictionary.
+func SynonymsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query("SELECT term, canonical FROM synonyms ORDER BY term ASC")
+		if err != nil {
+			log.Println("Synonyms query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		list := []map[string]string{}
+		for rows.Next() {
+			var term, canonical string
+			if err := rows.Scan(&term, &canonical); err == nil {
+				list = append(list, map[string]string{"term": term, "canonical": canonical})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// PutSynonymHandler creates or replaces the mapping for {term}.
+// Expects a JSON body of the form {"canonical": "North Indian"}.
+func PutSynonymHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		term := strings.ToLower(strings.TrimSpace(r.PathValue("term")))
+		var body struct {
+			Canonical string `json:"canonical"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || term == "" || strings.TrimSpace(body.Canonical) == "" {
+			http.Error(w, "term and canonical are required", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		var created bool
+		if err == nil {
+			defer tx.Rollback()
+			// xmax is zero only for a freshly inserted row.
+			err = tx.QueryRow(`
+				INSERT INTO synonyms (term, canonical) VALUES ($1, $2)
+				ON CONFLICT (term) DO UPDATE SET canonical = EXCLUDED.canonical
+				RETURNING xmax = 0
+			`, term, strings.TrimSpace(body.Canonical)).Scan(&created)
+		}
+		if err == nil {
+			summary := MutationSummary{Updated: 1}
+			if created {
+				summary = MutationSummary{Created: 1}
+			}
+			if writeDryRun(w, r, summary) {
+				return
+			}
+			err = outbox.Record(tx, synonymsChanged(term))
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Println("Synonym upsert error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"term": term, "canonical": strings.TrimSpace(body.Canonical)})
+	}
+}
+
+// DeleteSynonymHandler removes the mapping for {term}.
+func DeleteSynonymHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		term := strings.ToLower(strings.TrimSpace(r.PathValue("term")))
+		res, err := adminExec(db, r, synonymsChanged(term), "DELETE FROM synonyms WHERE term = $1", term)
+		if err != nil {
+			log.Println("Synonym delete error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			http.Error(w, "Synonym not found", http.StatusNotFound)
+			return
+		}
+		if writeDryRun(w, r, MutationSummary{Deleted: n}) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func synonymsChanged(term string) outbox.Message {
+	return outbox.Message{Topic: outbox.TopicSynonymsChanged, Payload: map[string]interface{}{"term": term}}
+}
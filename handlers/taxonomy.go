@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaxonomyCacheTTL controls how often cuisine and meal-type names are reloaded.
+const TaxonomyCacheTTL = 5 * time.Minute
+
+// TaxonomyItem is a cuisine or meal type as stored in the lookup tables.
+type TaxonomyItem struct {
+	ID   int64  `json:"id,string"`
+	Name string `json:"name"`
+}
+
+type taxonomyCache struct {
+	mu        sync.RWMutex
+	cuisines  map[string]TaxonomyItem
+	mealTypes map[string]TaxonomyItem
+	loaded    time.Time
+}
+
+var taxonomy taxonomyCache
+
+func (c *taxonomyCache) ensure(db *sql.DB) {
+	c.mu.RLock()
+	fresh := time.Since(c.loaded) < TaxonomyCacheTTL
+	c.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	cuisines, err := loadTaxonomy(db, "SELECT id, cuisine_name FROM cuisines")
+	if err != nil {
+		log.Println("Taxonomy load error:", err)
+		return
+	}
+	mealTypes, err := loadTaxonomy(db, "SELECT id, meal_type FROM meal_types")
+	if err != nil {
+		log.Println("Taxonomy load error:", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.cuisines, c.mealTypes, c.loaded = cuisines, mealTypes, time.Now()
+	c.mu.Unlock()
+}
+
+func loadTaxonomy(db *sql.DB, query string) (map[string]TaxonomyItem, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := map[string]TaxonomyItem{}
+	for rows.Next() {
+		var it TaxonomyItem
+		if err := rows.Scan(&it.ID, &it.Name); err == nil {
+			items[taxonomyKey(it.Name)] = it
+		}
+	}
+	return items, rows.Err()
+}
+
+// taxonomyKey folds case and repeated whitespace so "  North   indian" matches "North Indian".
+func taxonomyKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// ResolveCuisine looks up a cuisine by name, ignoring case and whitespace and
+// tolerating small typos.
+func ResolveCuisine(db *sql.DB, name string) (TaxonomyItem, bool) {
+	taxonomy.ensure(db)
+	taxonomy.mu.RLock()
+	defer taxonomy.mu.RUnlock()
+	return fuzzyLookup(taxonomy.cuisines, name)
+}
+
+// ResolveMealType looks up a meal type by name, ignoring case and whitespace and
+// tolerating small typos.
+func ResolveMealType(db *sql.DB, name string) (TaxonomyItem, bool) {
+	taxonomy.ensure(db)
+	taxonomy.mu.RLock()
+	defer taxonomy.mu.RUnlock()
+	return fuzzyLookup(taxonomy.mealTypes, name)
+}
+
+// fuzzyLookup prefers an exact key match, then the single closest name within an
+// edit distance of roughly one typo per four characters. Ties are rejected
+// rather than guessed.
+func fuzzyLookup(items map[string]TaxonomyItem, name string) (TaxonomyItem, bool) {
+	key := taxonomyKey(name)
+	if it, ok := items[key]; ok {
+		return it, true
+	}
+	if len(key) < 4 {
+		return TaxonomyItem{}, false
+	}
+
+	limit := max(1, len(key)/4)
+	best, bestDist, tie := TaxonomyItem{}, limit+1, false
+	for k, it := range items {
+		d := editDistance(key, k)
+		if d < bestDist {
+			best, bestDist, tie = it, d, false
+		} else if d == bestDist {
+			tie = true
+		}
+	}
+	if bestDist > limit || tie {
+		return TaxonomyItem{}, false
+	}
+	return best, true
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// UnresolvedFilter is a text filter value that matched no known taxonomy entry.
+type UnresolvedFilter struct {
+	Param string `json:"param"`
+	Value string `json:"value"`
+}
+
+// ResolveTaxonomyFilters replaces the cuisine, cuisines, meal_type and meal_types
+// text filters with ID sets. Names that can't be resolved are dropped from the
+// query and recorded in p.Unresolved so the caller can report them.
+func ResolveTaxonomyFilters(db *sql.DB, p *SearchParams) {
+	resolve := func(param string, names []string, lookup func(*sql.DB, string) (TaxonomyItem, bool), resolved *[]TaxonomyItem) []string {
+		var ids []string
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+			it, ok := lookup(db, name)
+			if !ok {
+				p.Unresolved = append(p.Unresolved, UnresolvedFilter{Param: param, Value: name})
+				continue
+			}
+			ids = append(ids, strconv.FormatInt(it.ID, 10))
+			*resolved = append(*resolved, it)
+		}
+		return ids
+	}
+
+	if p.Cuisine != "" {
+		if ids := resolve("cuisine", []string{p.Cuisine}, ResolveCuisine, &p.ResolvedCuisines); len(ids) > 0 {
+			p.CuisineIDSets = append(p.CuisineIDSets, ids)
+		}
+		p.Cuisine = ""
+	}
+	if p.Cuisines != "" {
+		if ids := resolve("cuisines", splitList(p.Cuisines, true), ResolveCuisine, &p.ResolvedCuisines); len(ids) > 0 {
+			p.CuisineIDSets = append(p.CuisineIDSets, ids)
+		}
+		p.Cuisines = ""
+	}
+	if p.MealType != "" {
+		if ids := resolve("meal_type", []string{p.MealType}, ResolveMealType, &p.ResolvedMealTypes); len(ids) > 0 {
+			p.MealTypeIDSets = append(p.MealTypeIDSets, ids)
+		}
+		p.MealType = ""
+	}
+	if p.MealTypes != "" {
+		if ids := resolve("meal_types", splitList(p.MealTypes, true), ResolveMealType, &p.ResolvedMealTypes); len(ids) > 0 {
+			p.MealTypeIDSets = append(p.MealTypeIDSets, ids)
+		}
+		p.MealTypes = ""
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"eazyfind/middleware"
+)
+
+// tenantScope returns a condition limiting column, a city name, to the cities
+// of tenant t. It is empty when t is nil or not limited to any cities. The
+// tenant id is an integer, so it is formatted into the SQL directly and the
+// condition can be added to queries with any argument numbering.
+func tenantScope(t *middleware.Tenant, column string) string {
+	if t == nil || !t.Scoped {
+		return ""
+	}
+	return fmt.Sprintf(`%s ILIKE ANY (SELECT tci.city_name FROM tenant_cities tc JOIN cities tci ON tci.id = tc.city_id WHERE tc.tenant_id = %d)`, column, t.ID)
+}
+
+// andTenantScope is tenantScope prefixed with AND, for appending to a fixed
+// WHERE clause.
+func andTenantScope(r *http.Request, column string) string {
+	if s := tenantScope(middleware.GetTenant(r.Context()), column); s != "" {
+		return "AND " + s
+	}
+	return ""
+}
+
+// TenantHandler returns the name and branding of the tenant serving the
+// request, for white-label frontends to theme themselves.
+func TenantHandler(w http.ResponseWriter, r *http.Request) {
+	t := middleware.GetTenant(r.Context())
+	if t == nil {
+		http.Error(w, "No tenant for this host", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	DefaultTrendWeeks = 12
+	MaxTrendWeeks     = 52
+)
+
+// CityTrendsHandler returns weekly averages of effective discount and cost for two,
+// broken down by cuisine, computed from each restaurant's restaurant_history
+// values as of the end of each week. Optional filters:
+// area, cuisine and weeks (lookback window, capped at MaxTrendWeeks).
+func CityTrendsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		city := CityRef{Name: r.PathValue("city")}
+		if city.Name == "" {
+			http.Error(w, "City is required", http.StatusBadRequest)
+			return
+		}
+		if c, ok := ResolveCity(db, city.Name); ok {
+			if redirectToCitySlug(w, r, c) {
+				return
+			}
+			city = c
+		}
+
+		query := r.URL.Query()
+		weeks, _ := strconv.Atoi(query.Get("weeks"))
+		if weeks <= 0 {
+			weeks = DefaultTrendWeeks
+		}
+		if weeks > MaxTrendWeeks {
+			weeks = MaxTrendWeeks
+		}
+
+		b := &QueryBuilder{}
+		weeksArg := b.Arg(weeks)
+		b.Where(
+			FoldedILike(city.Name, "r.city_norm"),
+			Raw("r.is_duplicate = false"),
+		)
+		b.Where(Raw(tenantScope(middleware.GetTenant(r.Context()), "r.city")))
+		if !includeUnpublished(r) {
+			b.Where(Raw("EXISTS (SELECT 1 FROM cities ci WHERE ci.city_name ILIKE r.city AND ci.is_published)"))
+		}
+		if area := query.Get("area"); area != "" {
+			b.Where(FoldedILike("%"+area+"%", "r.area_norm"))
+		}
+		if cuisine := query.Get("cuisine"); cuisine != "" {
+			b.Where(ILike(cuisine, "c.cuisine_name"))
+		}
+
+		// Each week counts every restaurant at its last recorded values before
+		// the week ended, not just the rows written that week, since history
+		// only gets a row when something changes.
+		rows, err := db.Query(`
+			SELECT c.cuisine_name, wk.week,
+			       AVG(COALESCE(h.effective_discount, 0)), AVG(COALESCE(h.cost_for_two, 0)), COUNT(*)
+			FROM generate_series(
+			         date_trunc('week', now()) - make_interval(weeks => `+weeksArg+` - 1),
+			         date_trunc('week', now()), interval '1 week') AS wk(week)
+			CROSS JOIN restaurants r
+			JOIN restaurant_cuisines rc ON rc.restaurant_id = r.id
+			JOIN cuisines c ON c.id = rc.cuisine_id
+			CROSS JOIN LATERAL (
+				SELECT rh.effective_discount, rh.cost_for_two
+				FROM restaurant_history rh
+				WHERE rh.restaurant_id = r.id AND rh.recorded_at < wk.week + interval '1 week'
+				ORDER BY rh.recorded_at DESC
+				LIMIT 1
+			) h
+			`+b.WhereClause()+`
+			GROUP BY c.cuisine_name, wk.week
+			ORDER BY c.cuisine_name, wk.week
+		`, b.Args()...)
+		if err != nil {
+			log.Println("Trends query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		series := []models.TrendSeries{}
+		for rows.Next() {
+			var cuisine string
+			var p models.TrendPoint
+			if err := rows.Scan(&cuisine, &p.Week, &p.AvgDiscount, &p.AvgCost, &p.Samples); err != nil {
+				continue
+			}
+			if n := len(series); n == 0 || series[n-1].Cuisine != cuisine {
+				series = append(series, models.TrendSeries{Cuisine: cuisine})
+			}
+			series[len(series)-1].Points = append(series[len(series)-1].Points, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"city":      city.Name,
+			"city_slug": city.Slug,
+			"weeks":     weeks,
+			"series":    series,
+		})
+	}
+}
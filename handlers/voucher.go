@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/qr"
+	"eazyfind/tracker"
+)
+
+const (
+	// VoucherTTL is how long an issued voucher can be redeemed.
+	VoucherTTL = 2 * time.Hour
+	// voucherQRScale is the PNG pixel size of one QR module.
+	voucherQRScale = 8
+)
+
+// VoucherSecret reads VOUCHER_SECRET, falling back to a random per-process key
+// (outstanding vouchers then stop validating on restart).
+func VoucherSecret() []byte {
+	if s := os.Getenv("VOUCHER_SECRET"); s != "" {
+		return []byte(s)
+	}
+	log.Println("VOUCHER_SECRET not set, using an ephemeral voucher key")
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// signVoucher returns the token for a voucher: its id and expiry followed by
+// a truncated HMAC, short enough for a small QR code.
+func signVoucher(secret []byte, id int64, expires time.Time) string {
+	payload := make([]byte, 16)
+	binary.BigEndian.PutUint64(payload, uint64(id))
+	binary.BigEndian.PutUint64(payload[8:], uint64(expires.Unix()))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(voucherMAC(secret, payload))
+}
+
+// verifyVoucher checks a token's signature and returns its voucher id and
+// expiry.
+func verifyVoucher(secret []byte, token string) (int64, time.Time, bool) {
+	p, s, ok := strings.Cut(token, ".")
+	payload, err1 := base64.RawURLEncoding.DecodeString(p)
+	sig, err2 := base64.RawURLEncoding.DecodeString(s)
+	if !ok || err1 != nil || err2 != nil || len(payload) != 16 || !hmac.Equal(sig, voucherMAC(secret, payload)) {
+		return 0, time.Time{}, false
+	}
+	id := int64(binary.BigEndian.Uint64(payload))
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[8:])), 0)
+	return id, expires, true
+}
+
+func voucherMAC(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:16]
+}
+
+// VoucherHandler issues the signed-in user a voucher for a restaurant's
+// current offer and renders it as a QR code. ?format=png (default), svg or
+// json. An unredeemed, unexpired voucher is reissued rather than creating a
+// new one; offers limited to a time window only get vouchers inside it.
+func VoucherHandler(db *sql.DB, secret []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid offer id", http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "png"
+		}
+		if format != "png" && format != "svg" && format != "json" {
+			http.Error(w, "format must be png, svg or json", http.StatusBadRequest)
+			return
+		}
+		user := middleware.UserID(r)
+		if middleware.ReadOnlyImpersonation(r.Context()) {
+			// Showing a voucher issues one when the user has none.
+			http.Error(w, "Impersonation token is read-only", http.StatusForbidden)
+			return
+		}
+
+		b := &QueryBuilder{}
+		idArg := b.Arg(id)
+		var offer string
+		var open bool
+		err = db.QueryRow(fmt.Sprintf(`
+			SELECT r.offer, r.offer_window_start IS NULL OR (%s)
+			FROM restaurants r
+			WHERE r.id = %s AND r.is_duplicate = false AND COALESCE(r.offer, '') <> '' AND r.offer_expired_at IS NULL %s
+		`, offerWindowOpen(cityLocalTime(b, time.Time{}, false)), idArg, andTenantScope(r, "r.city")), b.Args()...).Scan(&offer, &open)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "No current offer for this restaurant", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeVoucherError(w, r, err)
+			return
+		}
+		if !open {
+			http.Error(w, "Offer is not valid at this time", http.StatusConflict)
+			return
+		}
+
+		v := models.Voucher{RestaurantID: id}
+		err = db.QueryRow(`
+			SELECT id, offer, issued_at, expires_at FROM vouchers
+			WHERE restaurant_id = $1 AND user_id = $2 AND offer = $3 AND redeemed_at IS NULL AND expires_at > now()
+			ORDER BY expires_at DESC LIMIT 1
+		`, id, user, offer).Scan(&v.ID, &v.Offer, &v.IssuedAt, &v.ExpiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.QueryRow(`
+				INSERT INTO vouchers (restaurant_id, user_id, offer, expires_at) VALUES ($1, $2, $3, $4)
+				RETURNING id, offer, issued_at, expires_at
+			`, id, user, offer, time.Now().Add(VoucherTTL)).Scan(&v.ID, &v.Offer, &v.IssuedAt, &v.ExpiresAt)
+		}
+		if err != nil {
+			writeVoucherError(w, r, err)
+			return
+		}
+		v.Token = signVoucher(secret, v.ID, v.ExpiresAt)
+
+		w.Header().Set("Cache-Control", "no-store")
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(v)
+			return
+		}
+		code, err := qr.Encode([]byte(v.Token))
+		if err != nil {
+			writeVoucherError(w, r, err)
+			return
+		}
+		w.Header().Set("X-Voucher-Expires", v.ExpiresAt.UTC().Format(time.RFC3339))
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(code.SVG()))
+			return
+		}
+		img, err := code.PNG(voucherQRScale)
+		if err != nil {
+			writeVoucherError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	}
+}
+
+// ValidateVoucherHandler lets a restaurant redeem a scanned voucher. Expects
+// {"token": "...", "restaurant_id": "123"} from an admin or a partner API key
+// bound to that restaurant; a voucher can be redeemed once, at the restaurant
+// it was issued for.
+func ValidateVoucherHandler(db *sql.DB, secret []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := middleware.GetAPIKey(r.Context())
+		admin := middleware.IsAdmin(r)
+		if key == nil && !admin {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Token        string `json:"token"`
+			RestaurantID string `json:"restaurant_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		restaurantID, err := strconv.ParseInt(body.RestaurantID, 10, 64)
+		if err != nil || restaurantID <= 0 {
+			http.Error(w, "Invalid restaurant id", http.StatusBadRequest)
+			return
+		}
+		if !admin && !key.ActsFor(restaurantID) {
+			http.Error(w, "API key is not bound to this restaurant", http.StatusForbidden)
+			return
+		}
+		id, expires, ok := verifyVoucher(secret, strings.TrimSpace(body.Token))
+		if !ok {
+			http.Error(w, "Invalid voucher", http.StatusBadRequest)
+			return
+		}
+		if !expires.After(time.Now()) {
+			http.Error(w, "Voucher has expired", http.StatusGone)
+			return
+		}
+
+		var v models.Voucher
+		err = db.QueryRow(`
+			UPDATE vouchers SET redeemed_at = now()
+			WHERE id = $1 AND restaurant_id = $2 AND redeemed_at IS NULL AND expires_at > now()
+			RETURNING id, restaurant_id, offer, issued_at, expires_at, redeemed_at
+		`, id, restaurantID).Scan(&v.ID, &v.RestaurantID, &v.Offer, &v.IssuedAt, &v.ExpiresAt, &v.RedeemedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeVoucherRejection(db, w, r, id, restaurantID)
+			return
+		}
+		if err != nil {
+			writeVoucherError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// writeVoucherRejection explains why a validly signed voucher was not redeemed.
+func writeVoucherRejection(db *sql.DB, w http.ResponseWriter, r *http.Request, id, restaurantID int64) {
+	var issuedFor int64
+	var redeemedAt sql.NullTime
+	err := db.QueryRow("SELECT restaurant_id, redeemed_at FROM vouchers WHERE id = $1", id).Scan(&issuedFor, &redeemedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Voucher not found", http.StatusNotFound)
+	case err != nil:
+		writeVoucherError(w, r, err)
+	case issuedFor != restaurantID:
+		http.Error(w, "Voucher is for another restaurant", http.StatusConflict)
+	case redeemedAt.Valid:
+		http.Error(w, "Voucher already redeemed at "+redeemedAt.Time.UTC().Format(time.RFC3339), http.StatusConflict)
+	default:
+		http.Error(w, "Voucher has expired", http.StatusGone)
+	}
+}
+
+func writeVoucherError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("Voucher error:", err)
+	tracker.CaptureRequest(r, err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
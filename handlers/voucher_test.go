@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoucherToken(t *testing.T) {
+	secret := []byte("test-secret")
+	expires := time.Now().Add(VoucherTTL).Truncate(time.Second)
+	token := signVoucher(secret, 42, expires)
+
+	p, sig, _ := strings.Cut(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(p)
+	payload[7] ^= 1 // voucher 43
+	flipped := base64.RawURLEncoding.EncodeToString(payload) + "." + sig
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		ok     bool
+	}{
+		{"round trip", secret, token, true},
+		{"flipped payload byte", secret, flipped, false},
+		{"wrong secret", []byte("other-secret"), token, false},
+		{"truncated signature", secret, token[:len(token)-1], false},
+		{"no signature", secret, p, false},
+		{"empty", secret, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, exp, ok := verifyVoucher(tt.secret, tt.token)
+			if ok != tt.ok {
+				t.Fatalf("verifyVoucher() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (id != 42 || !exp.Equal(expires)) {
+				t.Errorf("verifyVoucher() = %d, %v, want 42, %v", id, exp, expires)
+			}
+		})
+	}
+}
+
+// TestVoucherTokenExpired checks an expired voucher still verifies but
+// carries its past expiry, which redemption refuses.
+func TestVoucherTokenExpired(t *testing.T) {
+	secret := []byte("test-secret")
+	expires := time.Now().Add(-time.Minute).Truncate(time.Second)
+	_, exp, ok := verifyVoucher(secret, signVoucher(secret, 42, expires))
+	if !ok || !exp.Equal(expires) {
+		t.Fatalf("verifyVoucher() = %v, %v, want %v, true", exp, ok, expires)
+	}
+	if exp.After(time.Now()) {
+		t.Errorf("expired voucher reports expiry %v in the future", exp)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"eazyfind/models"
+)
+
+// WarmupCities is how many of the largest published cities Warmup
+// precomputes deals and a first search page for.
+const WarmupCities = 5
+
+// Warmup fills metadataCache with the default city, cuisine and meal-type
+// lists and the top deals of the largest cities, and runs each of those
+// cities' first search page so the database has the plans and pages in
+// memory. It runs before the server accepts requests, so the first ones
+// after a deploy or a Neon cold start are not the slow ones. Statements are
+// not prepared ahead: Connect keeps no idle connections, so they would not
+// outlive the warm-up. Failures are logged and the remaining steps still run.
+func Warmup(db *sql.DB) {
+	start := time.Now()
+	cities, _, err := listCities(db, false, nil)
+	if err != nil {
+		log.Println("Warm-up cities error:", err)
+	}
+	defaults := &http.Request{URL: &url.URL{Path: "/"}}
+	if _, _, err := listCuisines(db, defaults); err != nil {
+		log.Println("Warm-up cuisines error:", err)
+	}
+	if _, _, err := listMealTypes(db, defaults); err != nil {
+		log.Println("Warm-up meal types error:", err)
+	}
+	cityRadiusOverrides(db)
+
+	largest := make([]models.City, len(cities))
+	copy(largest, cities)
+	sort.SliceStable(largest, func(i, j int) bool { return largest[i].RestaurantCount > largest[j].RestaurantCount })
+	if len(largest) > WarmupCities {
+		largest = largest[:WarmupCities]
+	}
+	for _, c := range largest {
+		if _, err := topDeals(db, nil, c.CityName, DefaultWidgetLimit); err != nil {
+			log.Printf("Warm-up deals error for %s: %v", c.CityName, err)
+		}
+		p := ParseSearchParams(url.Values{"city": {c.CityName}})
+		PrepareSearch(db, &p)
+		if _, _, err := SearchSummary(db, p); err != nil {
+			log.Printf("Warm-up search error for %s: %v", c.CityName, err)
+			continue
+		}
+		if _, err := FetchSearchPage(db, p); err != nil {
+			log.Printf("Warm-up search error for %s: %v", c.CityName, err)
+		}
+	}
+	log.Printf("Warm-up done in %s (%d cities)", time.Since(start).Round(time.Millisecond), len(largest))
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"eazyfind/middleware"
+	"eazyfind/models"
+	"eazyfind/tracker"
+)
+
+const (
+	DefaultWidgetLimit = 5
+	MaxWidgetLimit     = 10
+)
+
+// WidgetDeal is one deal in the embeddable widget: only what a partner page
+// needs to show and link it.
+type WidgetDeal struct {
+	Name       string  `json:"name"`
+	Area       string  `json:"area,omitempty"`
+	Offer      string  `json:"offer"`
+	Discount   int     `json:"discount_percent"`
+	Rating     float64 `json:"rating,omitempty"`
+	CostForTwo int     `json:"cost_for_two,omitempty"`
+	ImageURL   string  `json:"image_url,omitempty"`
+	// URL goes through the /r/{id} redirect, so widget clicks are recorded
+	// with source=widget.
+	URL string `json:"url,omitempty"`
+}
+
+// widgetTemplate is the HTML widget: self-contained, with inline styles, for
+// partners to embed in an iframe.
+var widgetTemplate = template.Must(template.New("widget").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Top deals in {{.City}}</title>
+<style>
+body{margin:0;font:14px/1.4 system-ui,sans-serif;color:#222}
+.ef{padding:12px;border:1px solid #e5e5e5;border-radius:8px}
+.ef h2{margin:0 0 8px;font-size:16px}
+.ef ul{list-style:none;margin:0;padding:0}
+.ef li{padding:8px 0;border-top:1px solid #f0f0f0}
+.ef li:first-child{border-top:0}
+.ef a{color:inherit;text-decoration:none}
+.ef .offer{color:#c0392b;font-weight:600}
+.ef .meta{color:#777;font-size:12px}
+.ef .more{display:block;margin-top:8px;font-size:12px;color:#c0392b}
+</style></head>
+<body><div class="ef">
+<h2>Top deals in {{.City}}</h2>
+<ul>{{range .Deals}}
+<li><a href="{{.URL}}" target="_blank" rel="noopener"><strong>{{.Name}}</strong>{{if .Area}} · {{.Area}}{{end}}<br>
+<span class="offer">{{.Offer}}</span>
+<span class="meta">{{if .Rating}}★ {{.Rating}}{{end}}{{if .CostForTwo}} · ₹{{.CostForTwo}} for two{{end}}</span></a></li>{{else}}
+<li>No deals right now.</li>{{end}}
+</ul>{{if .MoreURL}}
+<a class="more" href="{{.MoreURL}}" target="_blank" rel="noopener">More deals on EazyFind</a>{{end}}
+</div></body></html>
+`))
+
+// WidgetDealsHandler returns the top deals in ?city= for partner sites to
+// embed: JSON by default, or with ?format=html a self-contained HTML page
+// for an iframe. ?limit= is 1 to MaxWidgetLimit. Any origin may call it.
+func WidgetDealsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		city, ok := ResolveCity(db, query.Get("city"))
+		if !ok {
+			http.Error(w, "Unknown city", http.StatusNotFound)
+			return
+		}
+		limit := DefaultWidgetLimit
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > MaxWidgetLimit {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(MaxWidgetLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		deals, err := topDeals(db, middleware.GetTenant(r.Context()), city.Name, limit)
+		if err != nil {
+			log.Println("Widget deals query error:", err)
+			tracker.CaptureRequest(r, err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		// Cached deals link to the redirect by path; the widget is embedded
+		// on partner pages, so links are made absolute on this API's host.
+		base := "http://" + r.Host
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			base = "https://" + r.Host
+		}
+		deals = append([]WidgetDeal(nil), deals...)
+		for i := range deals {
+			if deals[i].URL != "" {
+				deals[i].URL = base + deals[i].URL
+			}
+		}
+		moreURL := ""
+		if frontend := os.Getenv("FRONTEND_URL"); frontend != "" {
+			moreURL = strings.TrimSuffix(frontend, "/") + "/?" + url.Values{"city": {city.Slug}, "sort": {"discount"}}.Encode()
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		if query.Get("format") == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = widgetTemplate.Execute(w, map[string]interface{}{"City": city.Name, "Deals": deals, "MoreURL": moreURL})
+			if err != nil {
+				log.Println("Widget render error:", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"city":      city.Name,
+			"city_slug": city.Slug,
+			"deals":     deals,
+			"more_url":  moreURL,
+		})
+	}
+}
+
+// topDeals returns the best deals in city visible to tenant (nil for none),
+// cached with the other metadata so partner pages and the startup warm-up
+// share one query per city.
+func topDeals(db *sql.DB, tenant *middleware.Tenant, city string, limit int) ([]WidgetDeal, error) {
+	var tenantID int64
+	if tenant != nil {
+		tenantID = tenant.ID
+	}
+	cacheKey := "top-deals:" + strconv.FormatInt(tenantID, 10) + ":" + strings.ToLower(city) + ":" + strconv.Itoa(limit)
+	v, err := metadataCache.GetOrLoad(cacheKey, func() (interface{}, error) {
+		return loadTopDeals(db, tenant, city, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]WidgetDeal), nil
+}
+
+// loadTopDeals runs the topDeals search.
+func loadTopDeals(db *sql.DB, tenant *middleware.Tenant, city string, limit int) ([]WidgetDeal, error) {
+	p := ParseSearchParams(url.Values{"city": {city}, "sort": {"discount"}})
+	p.Limit, p.Offset = limit, 0
+	p.Discount = 0.01
+	p.Tenant = tenant
+	PrepareSearch(db, &p)
+	results, err := FetchSearchPage(db, p)
+	if err != nil {
+		return nil, err
+	}
+	deals := make([]WidgetDeal, 0, len(results))
+	for _, res := range results {
+		deals = append(deals, widgetDeal(res))
+	}
+	return deals, nil
+}
+
+func widgetDeal(res models.Restaurant) WidgetDeal {
+	link := ""
+	if res.URL != "" {
+		link = "/r/" + strconv.FormatInt(res.ID, 10) + "?source=widget"
+	}
+	name := res.DisplayName
+	if name == "" {
+		name = res.RestaurantName
+	}
+	return WidgetDeal{
+		Name:       name,
+		Area:       res.Area,
+		Offer:      res.Offer,
+		Discount:   int(math.Round(res.EffectiveDiscount * 100)),
+		Rating:     res.Rating,
+		CostForTwo: res.CostForTwo,
+		ImageURL:   res.ImageURL,
+		URL:        link,
+	}
+}
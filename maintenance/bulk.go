@@ -0,0 +1,149 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+
+	"eazyfind/outbox"
+)
+
+// BulkChanges are the taxonomy edits applied by BulkUpdate. Removals run
+// after additions, so an item in both lists ends up removed.
+type BulkChanges struct {
+	AddCuisines     []int64
+	RemoveCuisines  []int64
+	AddMealTypes    []int64
+	RemoveMealTypes []int64
+	AddTags         []string
+	RemoveTags      []string
+}
+
+// BulkUpdate applies c to every restaurant r matching cond, walking them in
+// id order with one transaction per batch. cond may use args as $1..$n. The
+// updated counter is the number of restaurants that actually changed; a dry
+// run performs each batch and rolls it back so the counts are exact.
+func BulkUpdate(ctx context.Context, db *sql.DB, cond string, args []interface{}, c BulkChanges, dryRun bool, j *Job) error {
+	var total int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM restaurants r WHERE "+cond, args...).Scan(&total); err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	batchQuery := fmt.Sprintf("SELECT r.id FROM restaurants r WHERE %s AND r.id > $%d ORDER BY r.id LIMIT %d", cond, len(args)+1, BatchSize)
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := db.QueryContext(ctx, batchQuery, append(args, lastID)...)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		lastID = ids[len(ids)-1]
+
+		changed, err := applyBulkBatch(ctx, db, ids, c, dryRun)
+		if err != nil {
+			return err
+		}
+		j.Progress(int64(len(ids)), changed)
+	}
+}
+
+func applyBulkBatch(ctx context.Context, db *sql.DB, ids []int64, c BulkChanges, dryRun bool) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type statement struct {
+		query string
+		args  []interface{}
+	}
+	var statements []statement
+	if len(c.AddCuisines) > 0 {
+		statements = append(statements, statement{`
+			INSERT INTO restaurant_cuisines (restaurant_id, cuisine_id)
+			SELECT r, x FROM unnest($1::bigint[]) r CROSS JOIN unnest($2::bigint[]) x
+			ON CONFLICT DO NOTHING RETURNING restaurant_id`, []interface{}{pq.Array(c.AddCuisines)}})
+	}
+	if len(c.RemoveCuisines) > 0 {
+		statements = append(statements, statement{`
+			DELETE FROM restaurant_cuisines WHERE restaurant_id = ANY($1) AND cuisine_id = ANY($2)
+			RETURNING restaurant_id`, []interface{}{pq.Array(c.RemoveCuisines)}})
+	}
+	if len(c.AddMealTypes) > 0 {
+		statements = append(statements, statement{`
+			INSERT INTO restaurant_meal_types (restaurant_id, meal_type_id)
+			SELECT r, x FROM unnest($1::bigint[]) r CROSS JOIN unnest($2::bigint[]) x
+			ON CONFLICT DO NOTHING RETURNING restaurant_id`, []interface{}{pq.Array(c.AddMealTypes)}})
+	}
+	if len(c.RemoveMealTypes) > 0 {
+		statements = append(statements, statement{`
+			DELETE FROM restaurant_meal_types WHERE restaurant_id = ANY($1) AND meal_type_id = ANY($2)
+			RETURNING restaurant_id`, []interface{}{pq.Array(c.RemoveMealTypes)}})
+	}
+	if len(c.AddTags) > 0 || len(c.RemoveTags) > 0 {
+		statements = append(statements, statement{`
+			UPDATE restaurants r SET tags = t.tags
+			FROM (
+				SELECT id, ARRAY(SELECT DISTINCT x FROM unnest(tags || $2::text[]) x WHERE x <> ALL($3::text[]) ORDER BY x) AS tags
+				FROM restaurants WHERE id = ANY($1)
+			) t
+			WHERE r.id = t.id AND r.tags <> t.tags
+			RETURNING r.id`, []interface{}{pq.Array(c.AddTags), pq.Array(c.RemoveTags)}})
+	}
+
+	changed := map[int64]bool{}
+	for _, s := range statements {
+		rows, err := tx.QueryContext(ctx, s.query, append([]interface{}{pq.Array(ids)}, s.args...)...)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err == nil {
+				changed[id] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	if !dryRun && len(changed) > 0 {
+		ids := make([]int64, 0, len(changed))
+		for id := range changed {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+		if err := outbox.Record(tx, outbox.Message{Topic: outbox.TopicRestaurantChanged, Payload: map[string]interface{}{"ids": ids}}); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(changed)), nil
+}
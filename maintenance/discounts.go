@@ -0,0 +1,122 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"eazyfind/deals"
+	"eazyfind/outbox"
+)
+
+// BatchSize is the number of rows read and written per transaction.
+const BatchSize = 500
+
+// DiscountFilter limits a discount recompute to a city and/or explicit ids.
+type DiscountFilter struct {
+	City   string  `json:"city"`
+	IDs    []int64 `json:"ids"`
+	DryRun bool    `json:"dry_run"`
+}
+
+func (f DiscountFilter) where() (string, []interface{}) {
+	cond, args := "is_duplicate = false", []interface{}{}
+	if f.City != "" {
+		args = append(args, f.City)
+		cond += fmt.Sprintf(" AND city_norm ILIKE fold_text($%d)", len(args))
+	}
+	if len(f.IDs) > 0 {
+		args = append(args, pq.Array(f.IDs))
+		cond += fmt.Sprintf(" AND id = ANY($%d)", len(args))
+	}
+	return cond, args
+}
+
+// RecomputeDiscounts re-derives effective_discount and payment_methods from
+// each restaurant's offer text, walking the table in id order one batch per
+// transaction. Only rows whose values actually change are written; a dry run
+// only counts them.
+func RecomputeDiscounts(ctx context.Context, db *sql.DB, f DiscountFilter, j *Job) error {
+	cond, args := f.where()
+
+	var total int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM restaurants WHERE "+cond, args...).Scan(&total); err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	batchQuery := fmt.Sprintf(`
+		SELECT id, COALESCE(offer, ''), COALESCE(percentage, ''), COALESCE(cost_for_two, 0), COALESCE(effective_discount, 0),
+		       COALESCE(payment_methods, '{}')
+		FROM restaurants WHERE %s AND id > $%d ORDER BY id LIMIT %d`, cond, len(args)+1, BatchSize)
+
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := db.QueryContext(ctx, batchQuery, append(args, lastID)...)
+		if err != nil {
+			return err
+		}
+		type change struct {
+			id       int64
+			discount float64
+			methods  []string
+		}
+		var changes []change
+		var processed int64
+		for rows.Next() {
+			var id int64
+			var offer, percentage string
+			var cost int
+			var current float64
+			var currentMethods []string
+			if err := rows.Scan(&id, &offer, &percentage, &cost, &current, pq.Array(&currentMethods)); err != nil {
+				rows.Close()
+				return err
+			}
+			processed++
+			lastID = id
+			d := deals.NormalizeDiscount(offer, percentage, cost)
+			methods := deals.PaymentMethods(offer)
+			if math.Abs(d-current) > 1e-9 || !slices.Equal(methods, currentMethods) {
+				changes = append(changes, change{id, d, methods})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if processed == 0 {
+			return nil
+		}
+
+		if !f.DryRun && len(changes) > 0 {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			ids := make([]int64, 0, len(changes))
+			for _, c := range changes {
+				if _, err := tx.Exec("UPDATE restaurants SET effective_discount = $1, payment_methods = $2 WHERE id = $3", c.discount, pq.Array(c.methods), c.id); err != nil {
+					tx.Rollback()
+					return err
+				}
+				ids = append(ids, c.id)
+			}
+			if err := outbox.Record(tx, outbox.Message{Topic: outbox.TopicRestaurantChanged, Payload: map[string]interface{}{"ids": ids}}); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		}
+		j.Progress(processed, int64(len(changes)))
+	}
+}
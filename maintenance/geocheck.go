@@ -0,0 +1,74 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"eazyfind/geo"
+)
+
+// GeoCheckSample is how many geocoded restaurants check-geo measures.
+const GeoCheckSample = 200
+
+// geoCheckTolerance is the largest relative difference check-geo accepts
+// between PostGIS and haversine distances; spheroid vs sphere stays well
+// inside it, while a distance in degrees misses by orders of magnitude.
+const geoCheckTolerance = 0.01
+
+// geoReference is the point sampled distances are measured from (central
+// Bengaluru); any fixed point works.
+var geoReference = geo.LatLon{Lat: 12.9716, Lon: 77.5946}
+
+// CheckGeo verifies that restaurants.geo and cities.geo are geography columns
+// and that the distances search computes from them are in meters: for a
+// sample of restaurants, ST_Distance(geo, reference) must agree with the
+// haversine distance of their latitude/longitude. It fails on the first
+// column or row that does not.
+func CheckGeo(ctx context.Context, db *sql.DB, _ json.RawMessage, j *Job) error {
+	for _, table := range []string{"restaurants", "cities"} {
+		var typ string
+		err := db.QueryRowContext(ctx, `
+			SELECT format_type(atttypid, atttypmod) FROM pg_attribute
+			WHERE attrelid = $1::regclass AND attname = 'geo' AND NOT attisdropped`, table).Scan(&typ)
+		if err != nil {
+			return fmt.Errorf("%s.geo: %w", table, err)
+		}
+		if typ != "geography(Point,4326)" {
+			return fmt.Errorf("%s.geo is %s, want geography(Point,4326); re-apply schema.sql to migrate it", table, typ)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, latitude, longitude,
+		       ST_Distance(geo, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+		FROM restaurants
+		WHERE geo IS NOT NULL AND latitude IS NOT NULL AND longitude IS NOT NULL
+		ORDER BY id LIMIT $3`, geoReference.Lon, geoReference.Lat, GeoCheckSample)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var checked int64
+	for rows.Next() {
+		var id int64
+		var pt geo.LatLon
+		var got float64
+		if err := rows.Scan(&id, &pt.Lat, &pt.Lon, &got); err != nil {
+			return err
+		}
+		want := geo.Distance(pt, geoReference)
+		if math.Abs(got-want) > math.Max(1, want*geoCheckTolerance) {
+			return fmt.Errorf("restaurant %d: PostGIS distance %.1fm, haversine %.1fm; geo is out of sync with latitude/longitude (run rebuild-geo) or not in meters", id, got, want)
+		}
+		checked++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	j.SetTotal(checked)
+	j.Progress(checked, 0)
+	return nil
+}
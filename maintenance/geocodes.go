@@ -0,0 +1,150 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GeocodeFilter selects resolved restaurants to send back to the geocoding
+// worker, or with Failed, restaurants the geocoder could not find. At least
+// one of the filters must be set.
+type GeocodeFilter struct {
+	Failed          bool     `json:"failed"`
+	City            string   `json:"city"`
+	ConfidenceBelow *float64 `json:"confidence_below"`
+	// Before matches rows geocoded before this date (YYYY-MM-DD or RFC 3339),
+	// including rows geocoded before geocoded_at was recorded.
+	Before string  `json:"before"`
+	IDs    []int64 `json:"ids"`
+	DryRun bool    `json:"dry_run"`
+
+	before time.Time
+}
+
+// ParseGeocodeFilter decodes and validates a requeue filter.
+func ParseGeocodeFilter(params json.RawMessage) (GeocodeFilter, error) {
+	var f GeocodeFilter
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &f); err != nil {
+			return f, errors.New("invalid JSON body")
+		}
+	}
+	if !f.Failed && f.City == "" && f.ConfidenceBelow == nil && f.Before == "" && len(f.IDs) == 0 {
+		return f, errors.New("at least one of failed, city, confidence_below, before or ids is required")
+	}
+	if f.ConfidenceBelow != nil && (*f.ConfidenceBelow <= 0 || *f.ConfidenceBelow > 1) {
+		return f, errors.New("confidence_below must be between 0 and 1")
+	}
+	if f.Before != "" {
+		t, err := time.Parse(time.RFC3339, f.Before)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", f.Before); err != nil {
+				return f, errors.New("before must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+			}
+		}
+		f.before = t
+	}
+	return f, nil
+}
+
+func (f GeocodeFilter) where() (string, []interface{}) {
+	cond, args := "geo_status = 'RESOLVED' AND is_duplicate = false", []interface{}{}
+	if f.Failed {
+		cond = "geo_status = 'FAILED' AND is_duplicate = false"
+	}
+	if f.City != "" {
+		args = append(args, f.City)
+		cond += fmt.Sprintf(" AND city_norm ILIKE fold_text($%d)", len(args))
+	}
+	if f.ConfidenceBelow != nil {
+		args = append(args, *f.ConfidenceBelow)
+		cond += fmt.Sprintf(" AND geo_confidence < $%d", len(args))
+	}
+	if !f.before.IsZero() {
+		args = append(args, f.before)
+		cond += fmt.Sprintf(" AND (geocoded_at IS NULL OR geocoded_at < $%d)", len(args))
+	}
+	if len(f.IDs) > 0 {
+		args = append(args, pq.Array(f.IDs))
+		cond += fmt.Sprintf(" AND id = ANY($%d)", len(args))
+	}
+	return cond, args
+}
+
+// RequeueGeocodes resets matching restaurants to PENDING one batch per
+// statement so the geocoding worker resolves them again. Existing coordinates
+// are kept until the new result is stored; a dry run only counts the rows.
+func RequeueGeocodes(ctx context.Context, db *sql.DB, f GeocodeFilter, j *Job) error {
+	cond, args := f.where()
+
+	var total int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM restaurants WHERE "+cond, args...).Scan(&total); err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	batchQuery := fmt.Sprintf("SELECT id FROM restaurants WHERE %s AND id > $%d ORDER BY id LIMIT %d", cond, len(args)+1, BatchSize)
+
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := db.QueryContext(ctx, batchQuery, append(args, lastID)...)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		lastID = ids[len(ids)-1]
+
+		updated := int64(len(ids))
+		if !f.DryRun {
+			res, err := db.ExecContext(ctx, "UPDATE restaurants SET geo_status = 'PENDING', geo_claimed_at = NULL WHERE id = ANY($1) AND geo_status IN ('RESOLVED', 'FAILED')", pq.Array(ids))
+			if err != nil {
+				return err
+			}
+			updated, _ = res.RowsAffected()
+		}
+		j.Progress(int64(len(ids)), updated)
+	}
+}
+
+func init() {
+	Register(Task{
+		Name:        "requeue-geocodes",
+		Description: "Reset resolved (or with failed, FAILED) restaurants to PENDING for re-geocoding. Params: failed, city, confidence_below, before, ids, dry_run.",
+		DryRun:      true,
+		Validate: func(params json.RawMessage) error {
+			_, err := ParseGeocodeFilter(params)
+			return err
+		},
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			f, err := ParseGeocodeFilter(params)
+			if err != nil {
+				return err
+			}
+			return RequeueGeocodes(ctx, db, f, j)
+		},
+	})
+}
@@ -0,0 +1,137 @@
+// Package maintenance runs long data-repair operations as background jobs
+// whose progress can be polled from the admin API.
+package maintenance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Job tracks one run of a maintenance operation.
+type Job struct {
+	mu     sync.Mutex
+	status JobStatus
+	cancel context.CancelFunc
+}
+
+// JobStatus is a point-in-time view of a job, safe to encode as JSON.
+type JobStatus struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Processed  int64      `json:"processed"`
+	Updated    int64      `json:"updated"`
+	DryRun     bool       `json:"dry_run"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+)
+
+// Start runs fn in the background under a new job and returns immediately.
+// fn should check ctx between batches so the job can be cancelled.
+func Start(name string, dryRun bool, fn func(ctx context.Context, j *Job) error) *Job {
+	b := make([]byte, 8)
+	rand.Read(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		status: JobStatus{ID: hex.EncodeToString(b), Name: name, Status: StatusRunning, DryRun: dryRun, StartedAt: time.Now()},
+		cancel: cancel,
+	}
+
+	jobsMu.Lock()
+	jobs[j.status.ID] = j
+	jobsMu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := fn(ctx, j)
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		now := time.Now()
+		j.status.FinishedAt = &now
+		j.status.Status = StatusSucceeded
+		if ctx.Err() != nil {
+			j.status.Status = StatusCancelled
+		} else if err != nil {
+			j.status.Status = StatusFailed
+			j.status.Error = err.Error()
+			log.Printf("Maintenance job %s (%s) failed: %v", j.status.ID, name, err)
+		}
+	}()
+	return j
+}
+
+// Get returns the status of a job started in this process.
+func Get(id string) (JobStatus, bool) {
+	jobsMu.Lock()
+	j, ok := jobs[id]
+	jobsMu.Unlock()
+	if !ok {
+		return JobStatus{}, false
+	}
+	return j.Status(), true
+}
+
+// List returns the status of every job started in this process, newest first.
+func List() []JobStatus {
+	jobsMu.Lock()
+	all := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		all = append(all, j.Status())
+	}
+	jobsMu.Unlock()
+	sort.Slice(all, func(a, b int) bool { return all[a].StartedAt.After(all[b].StartedAt) })
+	return all
+}
+
+// Cancel stops a running job. Work committed by finished batches is kept.
+func Cancel(id string) (JobStatus, bool) {
+	jobsMu.Lock()
+	j, ok := jobs[id]
+	jobsMu.Unlock()
+	if !ok {
+		return JobStatus{}, false
+	}
+	j.cancel()
+	return j.Status(), true
+}
+
+// Status returns a snapshot of the job's progress.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// SetTotal records how many rows the job expects to process.
+func (j *Job) SetTotal(n int64) {
+	j.mu.Lock()
+	j.status.Total = n
+	j.mu.Unlock()
+}
+
+// Progress adds to the processed and updated counters.
+func (j *Job) Progress(processed, updated int64) {
+	j.mu.Lock()
+	j.status.Processed += processed
+	j.status.Updated += updated
+	j.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"eazyfind/names"
+)
+
+// DuplicateRadiusMeters is how close two same-named restaurants in one city
+// must be for the later one to be marked a duplicate.
+const DuplicateRadiusMeters = 150
+
+// NormalizeNames recomputes display_name and name_key for every restaurant,
+// one batch per statement. Only rows whose values change are written; a dry
+// run only counts them.
+func NormalizeNames(ctx context.Context, db *sql.DB, dryRun bool, j *Job) error {
+	var total int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM restaurants").Scan(&total); err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ids, changed, err := normalizeNameBatch(ctx, db, "id > $1", dryRun, lastID)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		lastID = ids[len(ids)-1]
+		j.Progress(int64(len(ids)), changed)
+	}
+}
+
+// NormalizeNewNames normalizes one batch of restaurants that were scraped or
+// renamed since their name was last normalized, then marks any of them that
+// duplicate an existing restaurant. It returns the number normalized.
+func NormalizeNewNames(ctx context.Context, db *sql.DB) (int, error) {
+	ids, _, err := normalizeNameBatch(ctx, db, "name_source IS DISTINCT FROM restaurant_name", false)
+	if err != nil || len(ids) == 0 {
+		return len(ids), err
+	}
+	_, err = db.ExecContext(ctx, markDuplicatesQuery("d.id = ANY($1)"), pq.Array(ids))
+	return len(ids), err
+}
+
+// normalizeNameBatch normalizes up to BatchSize restaurants matching cond, in
+// id order; cond may use args as $1..$n. It returns the ids seen and how many
+// rows changed.
+func normalizeNameBatch(ctx context.Context, db *sql.DB, cond string, dryRun bool, args ...interface{}) ([]int64, int64, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, COALESCE(restaurant_name, ''), COALESCE(area, ''), COALESCE(city, ''),
+		       COALESCE(display_name, ''), COALESCE(name_key, ''), name_source IS NOT DISTINCT FROM restaurant_name
+		FROM restaurants WHERE %s ORDER BY id LIMIT %d`, cond, BatchSize), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ids, changedIDs []int64
+	var displays, keys []string
+	for rows.Next() {
+		var id int64
+		var name, area, city, display, key string
+		var current bool
+		if err := rows.Scan(&id, &name, &area, &city, &display, &key, &current); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		ids = append(ids, id)
+		n := names.Normalize(name, area, city)
+		if current && n.Display == display && n.Key == key {
+			continue
+		}
+		changedIDs = append(changedIDs, id)
+		displays = append(displays, n.Display)
+		keys = append(keys, n.Key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if dryRun || len(changedIDs) == 0 {
+		return ids, int64(len(changedIDs)), nil
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE restaurants r SET display_name = NULLIF(u.display, ''), name_key = NULLIF(u.key, ''), name_source = r.restaurant_name
+		FROM unnest($1::bigint[], $2::text[], $3::text[]) AS u(id, display, key)
+		WHERE r.id = u.id`, pq.Array(changedIDs), pq.Array(displays), pq.Array(keys))
+	if err != nil {
+		return nil, 0, err
+	}
+	return ids, int64(len(changedIDs)), nil
+}
+
+// markDuplicatesQuery marks restaurants d matching cond as duplicates of an
+// older restaurant with the same name_key in the same city: within
+// DuplicateRadiusMeters, or in the same area when either is not geocoded.
+func markDuplicatesQuery(cond string) string {
+	return fmt.Sprintf(`
+		UPDATE restaurants d SET is_duplicate = true
+		WHERE %s AND d.is_duplicate = false AND d.name_key IS NOT NULL
+		  AND EXISTS (
+			SELECT 1 FROM restaurants k
+			WHERE k.name_key = d.name_key AND k.id < d.id AND k.is_duplicate = false AND k.city ILIKE d.city
+			  AND (ST_DWithin(k.geo, d.geo, %d) OR ((k.geo IS NULL OR d.geo IS NULL) AND lower(k.area) = lower(d.area)))
+		  )`, cond, DuplicateRadiusMeters)
+}
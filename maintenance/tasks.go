@@ -0,0 +1,291 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Task is a named maintenance operation runnable from the admin API.
+type Task struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// DryRun reports whether the task honours {"dry_run": true}.
+	DryRun bool `json:"dry_run"`
+
+	Run func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error `json:"-"`
+	// Validate, if set, rejects bad parameters before a job is started.
+	Validate func(params json.RawMessage) error `json:"-"`
+}
+
+var registry = map[string]Task{}
+
+// Register makes a task available under its name.
+func Register(t Task) {
+	registry[t.Name] = t
+}
+
+// Lookup returns the task registered under name.
+func Lookup(name string) (Task, bool) {
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Tasks lists the registered tasks by name.
+func Tasks() []Task {
+	all := make([]Task, 0, len(registry))
+	for _, t := range registry {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].Name < all[b].Name })
+	return all
+}
+
+// DefaultEventRetentionDays is how much click and session history
+// prune-events keeps unless told otherwise.
+const DefaultEventRetentionDays = 90
+
+func init() {
+	Register(Task{
+		Name:        "recompute-discounts",
+		Description: "Re-derive effective_discount and payment_methods from offer text. Params: city, ids, dry_run.",
+		DryRun:      true,
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			var f DiscountFilter
+			if len(params) > 0 {
+				if err := json.Unmarshal(params, &f); err != nil {
+					return err
+				}
+			}
+			return RecomputeDiscounts(ctx, db, f, j)
+		},
+	})
+	Register(Task{
+		Name:        "recompute-ratings",
+		Description: "Clear scraped ratings outside the 0-5 scale so they stop skewing rating filters and sorts. Params: dry_run.",
+		DryRun:      true,
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			return walkIDs(ctx, db, j, dryRunParam(params), `
+				UPDATE restaurants SET rating = NULL
+				WHERE id > $1 AND id <= $2 AND (rating < 0 OR rating > 5)`)
+		},
+	})
+	Register(Task{
+		Name:        "rebuild-geo",
+		Description: "Rebuild the geo column from latitude/longitude for restaurants and cities where it is missing or out of sync. Params: dry_run.",
+		DryRun:      true,
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			dryRun := dryRunParam(params)
+			err := walkIDs(ctx, db, j, dryRun, `
+				UPDATE restaurants SET geo = ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
+				WHERE id > $1 AND id <= $2 AND latitude IS NOT NULL AND longitude IS NOT NULL
+				  AND (geo IS NULL OR NOT ST_Equals(geo::geometry, ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)))`)
+			if err != nil {
+				return err
+			}
+			n, err := execBatch(ctx, db, dryRun, `
+				UPDATE cities SET geo = ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
+				WHERE latitude IS NOT NULL AND longitude IS NOT NULL
+				  AND (geo IS NULL OR NOT ST_Equals(geo::geometry, ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)))`)
+			if err != nil {
+				return err
+			}
+			j.Progress(0, n)
+			return nil
+		},
+	})
+	Register(Task{
+		Name:        "check-geo",
+		Description: fmt.Sprintf("Verify that geo columns are geography and that distances for a sample of %d restaurants match their latitude/longitude in meters. Fails on the first mismatch.", GeoCheckSample),
+		Run:         CheckGeo,
+	})
+	Register(Task{
+		Name:        "normalize-names",
+		Description: "Recompute display_name and name_key from restaurant names. Params: dry_run.",
+		DryRun:      true,
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			return NormalizeNames(ctx, db, dryRunParam(params), j)
+		},
+	})
+	Register(Task{
+		Name:        "mark-duplicates",
+		Description: fmt.Sprintf("Mark restaurants sharing a name_key with an older one in the same city, within %dm (or the same area when not geocoded), as duplicates. Run normalize-names first. Params: dry_run.", DuplicateRadiusMeters),
+		DryRun:      true,
+		Run: func(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+			return walkIDs(ctx, db, j, dryRunParam(params), markDuplicatesQuery("d.id > $1 AND d.id <= $2"))
+		},
+	})
+	Register(Task{
+		Name:        "refresh-materialized-views",
+		Description: "Refresh every materialized view in the current schema, concurrently where a unique index allows it.",
+		Run:         refreshMaterializedViews,
+	})
+	Register(Task{
+		Name:        "prune-events",
+		Description: fmt.Sprintf("Delete outbound clicks, session activity, API key usage and dispatched outbox events older than older_than_days (default %d).", DefaultEventRetentionDays),
+		DryRun:      true,
+		Run:         pruneEvents,
+	})
+}
+
+// walkIDs runs update over consecutive restaurant id ranges ($1 exclusive,
+// $2 inclusive), one batch per statement, reporting progress as it goes. A
+// dry run runs each batch in a transaction and rolls it back, so the counts
+// are exact.
+func walkIDs(ctx context.Context, db *sql.DB, j *Job, dryRun bool, update string) error {
+	var total int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM restaurants").Scan(&total); err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	var last int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var upper sql.NullInt64
+		var n int64
+		err := db.QueryRowContext(ctx, "SELECT MAX(id), COUNT(*) FROM (SELECT id FROM restaurants WHERE id > $1 ORDER BY id LIMIT $2) t", last, BatchSize).Scan(&upper, &n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		updated, err := execBatch(ctx, db, dryRun, update, last, upper.Int64)
+		if err != nil {
+			return err
+		}
+		j.Progress(n, updated)
+		last = upper.Int64
+	}
+}
+
+// execBatch runs one statement and returns the rows it affected. A dry run
+// runs it in a transaction that is rolled back.
+func execBatch(ctx context.Context, db *sql.DB, dryRun bool, query string, args ...interface{}) (int64, error) {
+	if !dryRun {
+		res, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// dryRunParam reports whether a task's params ask for {"dry_run": true}.
+// runTask has already checked that they are valid JSON.
+func dryRunParam(params json.RawMessage) bool {
+	var p struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if len(params) > 0 {
+		json.Unmarshal(params, &p)
+	}
+	return p.DryRun
+}
+
+func refreshMaterializedViews(ctx context.Context, db *sql.DB, _ json.RawMessage, j *Job) error {
+	rows, err := db.QueryContext(ctx, "SELECT matviewname FROM pg_matviews WHERE schemaname = current_schema() ORDER BY matviewname")
+	if err != nil {
+		return err
+	}
+	var views []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err == nil {
+			views = append(views, v)
+		}
+	}
+	rows.Close()
+	j.SetTotal(int64(len(views)))
+
+	for _, v := range views {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := pq.QuoteIdentifier(v)
+		if _, err := db.ExecContext(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+name); err != nil {
+			// CONCURRENTLY needs a unique index and a populated view.
+			if _, err := db.ExecContext(ctx, "REFRESH MATERIALIZED VIEW "+name); err != nil {
+				return fmt.Errorf("refresh %s: %w", v, err)
+			}
+		}
+		j.Progress(1, 1)
+	}
+	return nil
+}
+
+// eventTables are pruned by prune-events; the column is compared to the cutoff.
+var eventTables = []struct{ table, column string }{
+	{"outbound_clicks", "created_at"},
+	{"session_activity", "created_at"},
+	{"api_key_usage", "day"},
+	{"outbox_events", "dispatched_at"},
+	{"quarantined_submissions", "created_at"},
+}
+
+func pruneEvents(ctx context.Context, db *sql.DB, params json.RawMessage, j *Job) error {
+	p := struct {
+		OlderThanDays int  `json:"older_than_days"`
+		DryRun        bool `json:"dry_run"`
+	}{OlderThanDays: DefaultEventRetentionDays}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+	}
+	if p.OlderThanDays <= 0 {
+		return fmt.Errorf("older_than_days must be positive")
+	}
+	cutoff := time.Now().AddDate(0, 0, -p.OlderThanDays)
+
+	var total int64
+	for _, t := range eventTables {
+		var n int64
+		if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s < $1", t.table, t.column), cutoff).Scan(&n); err != nil {
+			return err
+		}
+		total += n
+	}
+	j.SetTotal(total)
+	if p.DryRun {
+		j.Progress(total, total)
+		return nil
+	}
+
+	for _, t := range eventTables {
+		del := fmt.Sprintf("DELETE FROM %[1]s WHERE ctid IN (SELECT ctid FROM %[1]s WHERE %[2]s < $1 LIMIT $2)", t.table, t.column)
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			res, err := db.ExecContext(ctx, del, cutoff, BatchSize)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			if n == 0 {
+				break
+			}
+			j.Progress(n, n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IsAdmin reports whether the request carries the shared ADMIN_TOKEN as
+// "Authorization: Bearer <token>". It is always false when ADMIN_TOKEN is unset.
+func IsAdmin(r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// RequireAdmin guards internal endpoints with IsAdmin. When ADMIN_TOKEN is unset
+// every admin request is rejected so the routes are never accidentally left open.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	apiKeyCtxKey ctxKey = iota + 200
+
+	// APIKeyHeader carries a third-party API key.
+	APIKeyHeader = "X-API-Key"
+	// apiKeyCacheTTL bounds how long a revoked key may keep working.
+	apiKeyCacheTTL = time.Minute
+)
+
+// APIKey is the validated key attached to a request.
+type APIKey struct {
+	ID                 int64
+	RateLimitPerMinute int
+	DailyQuota         int
+	// TenantID is the tenant the key was issued for, or 0.
+	TenantID int64
+	// RestaurantIDs are the restaurants a partner key acts for, e.g. to
+	// redeem vouchers; empty for keys that only read.
+	RestaurantIDs []int64
+}
+
+// ActsFor reports whether the key was issued to the restaurant id.
+func (k *APIKey) ActsFor(id int64) bool {
+	return slices.Contains(k.RestaurantIDs, id)
+}
+
+type cachedKey struct {
+	key     *APIKey
+	expires time.Time
+}
+
+type minuteWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	keyMu    sync.Mutex
+	keyCache = map[string]cachedKey{}
+	windows  = map[int64]*minuteWindow{}
+)
+
+// HashAPIKey returns the stored form of a plaintext API key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPIKey returns the key attached by APIKeys, or nil for anonymous requests.
+func GetAPIKey(ctx context.Context) *APIKey {
+	k, _ := ctx.Value(apiKeyCtxKey).(*APIKey)
+	return k
+}
+
+// APIKeys meters requests that present an X-API-Key header: unknown or
+// unapproved keys are rejected, each key gets a per-minute rate limit and a
+// daily quota tracked in api_key_usage. Requests without a key pass through
+// unchanged so the first-party frontend keeps working.
+func APIKeys(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(APIKeyHeader)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := lookupAPIKey(db, raw)
+		if err != nil {
+			log.Println("API key lookup error:", err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if key == nil {
+			http.Error(w, "Invalid or unapproved API key", http.StatusUnauthorized)
+			return
+		}
+
+		if !allowMinute(key) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		var used int
+		err = db.QueryRow(`
+			INSERT INTO api_key_usage (api_key_id, day, requests) VALUES ($1, CURRENT_DATE, 1)
+			ON CONFLICT (api_key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+			RETURNING requests
+		`, key.ID).Scan(&used)
+		if err != nil {
+			log.Println("API key usage error:", err)
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimitPerMinute))
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(max(key.DailyQuota-used, 0)))
+		if used > key.DailyQuota {
+			http.Error(w, "Daily quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey, key)))
+	})
+}
+
+func lookupAPIKey(db *sql.DB, raw string) (*APIKey, error) {
+	hash := HashAPIKey(raw)
+
+	keyMu.Lock()
+	if c, ok := keyCache[hash]; ok && time.Now().Before(c.expires) {
+		keyMu.Unlock()
+		return c.key, nil
+	}
+	keyMu.Unlock()
+
+	k := &APIKey{}
+	err := db.QueryRow("SELECT id, rate_limit_per_minute, daily_quota, COALESCE(tenant_id, 0), restaurant_ids FROM api_keys WHERE key_hash = $1 AND status = 'APPROVED'", hash).
+		Scan(&k.ID, &k.RateLimitPerMinute, &k.DailyQuota, &k.TenantID, (*pq.Int64Array)(&k.RestaurantIDs))
+	if err == sql.ErrNoRows {
+		// Misses are not cached: random keys would grow the cache without bound.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keyMu.Lock()
+	keyCache[hash] = cachedKey{key: k, expires: time.Now().Add(apiKeyCacheTTL)}
+	keyMu.Unlock()
+	return k, nil
+}
+
+// InvalidateAPIKeys drops cached key lookups after an approval or revocation.
+func InvalidateAPIKeys() {
+	keyMu.Lock()
+	keyCache = map[string]cachedKey{}
+	keyMu.Unlock()
+}
+
+func allowMinute(k *APIKey) bool {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	win, ok := windows[k.ID]
+	now := time.Now()
+	if !ok || now.Sub(win.start) >= time.Minute {
+		win = &minuteWindow{start: now}
+		windows[k.ID] = win
+	}
+	win.count++
+	return win.count <= k.RateLimitPerMinute
+}
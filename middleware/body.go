@@ -0,0 +1,15 @@
+package middleware
+
+import "net/http"
+
+// LimitBody caps the size of request bodies so oversized payloads are rejected
+// before a handler starts decoding them. Reads past the limit fail and the
+// server closes the connection.
+func LimitBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.ContentLength != 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
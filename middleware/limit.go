@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// limitRejections counts requests turned away by each Limiter; exposed
+// through /debug/vars.
+var limitRejections = expvar.NewMap("limit_rejections")
+
+// Limiter caps how many requests to a group of routes run at once, so a
+// load spike gets fast 503s instead of queueing on the database pool until
+// every request times out.
+type Limiter struct {
+	name    string
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// RetryAfter is the Retry-After, in seconds, sent with a 503 from a
+// saturated Limiter.
+const RetryAfter = 1
+
+// NewLimiter allows maxInFlight concurrent requests through the handlers it
+// wraps. timeout, when positive, is the deadline put on each request's
+// context; handlers that query with r.Context() are cancelled at it. name
+// labels the limiter in /debug/vars.
+func NewLimiter(name string, maxInFlight int, timeout time.Duration) *Limiter {
+	return &Limiter{name: name, slots: make(chan struct{}, max(maxInFlight, 1)), timeout: timeout}
+}
+
+// Wrap applies the limiter to next. Routes wrapped by the same Limiter share
+// its slots.
+func (l *Limiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+		default:
+			limitRejections.Add(l.name, 1)
+			w.Header().Set("Retry-After", strconv.Itoa(RetryAfter))
+			http.Error(w, "Server busy, please retry", http.StatusServiceUnavailable)
+			return
+		}
+		if l.timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), l.timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// panicsRecovered counts handler panics; exposed through /debug/vars.
+var panicsRecovered = expvar.NewInt("panics_recovered")
+
+// Reporter forwards unexpected failures to an external error tracker.
+type Reporter interface {
+	Report(r *http.Request, err error, stack []byte)
+}
+
+// Recover converts handler panics into a JSON 500 response, logging the stack
+// trace alongside the request id. reporter may be nil.
+func Recover(reporter Reporter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// ErrAbortHandler is the sanctioned way to abort a response; let net/http handle it.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
+			stack := debug.Stack()
+			panicsRecovered.Add(1)
+			log.Printf("panic [%s] %s %s: %v\n%s", GetRequestID(r.Context()), r.Method, r.URL.Path, err, stack)
+			if reporter != nil {
+				reporter.Report(r, err, stack)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"internal server error","request_id":%q}`, GetRequestID(r.Context()))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
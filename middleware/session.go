@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sessionKey ctxKey = iota + 100
+
+	// SessionCookie carries the anonymous session id as "<id>.<signature>".
+	SessionCookie = "ef_sid"
+	// SessionMaxAge matches the server-side activity retention window.
+	SessionMaxAge = 14 * 24 * time.Hour
+)
+
+// SessionSecret reads SESSION_SECRET, falling back to a random per-process key
+// (sessions then reset on every restart).
+func SessionSecret() []byte {
+	if s := os.Getenv("SESSION_SECRET"); s != "" {
+		return []byte(s)
+	}
+	log.Println("SESSION_SECRET not set, using an ephemeral session key")
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// Session assigns every visitor a signed anonymous id without requiring login.
+// Cookies with a missing or invalid signature are replaced with a fresh id.
+func Session(secret []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ""
+		if c, err := r.Cookie(SessionCookie); err == nil {
+			id = verifySession(secret, c.Value)
+		}
+		if id == "" {
+			id = newSessionID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     SessionCookie,
+				Value:    id + "." + signSession(secret, id),
+				Path:     "/",
+				MaxAge:   int(SessionMaxAge.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey, id)))
+	})
+}
+
+// GetSessionID returns the anonymous session id assigned by Session.
+func GetSessionID(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey).(string)
+	return id
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signSession(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifySession(secret []byte, value string) string {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(sig), []byte(signSession(secret, id))) {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	tenantCtxKey ctxKey = iota + 300
+
+	// tenantCacheTTL bounds how long tenant changes made in the database take
+	// to apply.
+	tenantCacheTTL = time.Minute
+)
+
+// Tenant is a white-label deployment served from the same backend.
+type Tenant struct {
+	ID          int64           `json:"-"`
+	Slug        string          `json:"slug"`
+	Name        string          `json:"name"`
+	Branding    json.RawMessage `json:"branding"`
+	Hosts       []string        `json:"-"`
+	CORSOrigins []string        `json:"-"`
+	// Scoped is true when the tenant is limited to the cities listed in
+	// tenant_cities; otherwise it sees every city.
+	Scoped bool `json:"-"`
+}
+
+var (
+	tenantMu       sync.Mutex
+	tenantList     []*Tenant
+	tenantLoadedAt time.Time
+)
+
+// GetTenant returns the tenant attached by Tenants, or nil when the request
+// matched none.
+func GetTenant(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantCtxKey).(*Tenant)
+	return t
+}
+
+// Tenants resolves the request's tenant: the tenant an API key belongs to,
+// else the tenant whose hosts include the request's Host. It must run inside
+// APIKeys. Requests matching no tenant are served unscoped.
+func Tenants(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t *Tenant
+		if key := GetAPIKey(r.Context()); key != nil && key.TenantID != 0 {
+			t = findTenant(db, func(t *Tenant) bool { return t.ID == key.TenantID })
+		}
+		if t == nil {
+			host := strings.ToLower(r.Host)
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			t = findTenant(db, func(t *Tenant) bool { return containsFold(t.Hosts, host) })
+		}
+		if t != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tenantCtxKey, t))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TenantOriginAllowed reports whether origin is one of any tenant's
+// cors_origins.
+func TenantOriginAllowed(db *sql.DB, origin string) bool {
+	return findTenant(db, func(t *Tenant) bool { return containsFold(t.CORSOrigins, origin) }) != nil
+}
+
+func findTenant(db *sql.DB, match func(*Tenant) bool) *Tenant {
+	for _, t := range loadTenants(db) {
+		if match(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+func loadTenants(db *sql.DB) []*Tenant {
+	tenantMu.Lock()
+	defer tenantMu.Unlock()
+	if time.Since(tenantLoadedAt) < tenantCacheTTL {
+		return tenantList
+	}
+	// On error keep the previous list until the next attempt.
+	tenantLoadedAt = time.Now()
+
+	rows, err := db.Query(`
+		SELECT t.id, t.slug, t.name, COALESCE(t.branding, '{}'), t.hosts, t.cors_origins,
+		       EXISTS (SELECT 1 FROM tenant_cities tc WHERE tc.tenant_id = t.id)
+		FROM tenants t
+		ORDER BY t.id`)
+	if err != nil {
+		log.Println("Tenants query error:", err)
+		return tenantList
+	}
+	defer rows.Close()
+
+	list := []*Tenant{}
+	for rows.Next() {
+		t := &Tenant{}
+		var branding []byte
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &branding, pq.Array(&t.Hosts), pq.Array(&t.CORSOrigins), &t.Scoped); err != nil {
+			log.Println("Tenants scan error:", err)
+			continue
+		}
+		t.Branding = branding
+		list = append(list, t)
+	}
+	tenantList = list
+	return tenantList
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signToken(secret []byte, header, claims string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyUserToken(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Unix(1760000000, 0)
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+	valid := signToken(secret, hs256, `{"sub":"user-1","exp":1760000060}`)
+	parts := strings.Split(valid, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":1760000060}`)) + "." + parts[2]
+	sig := []byte(parts[2])
+	sig[0] ^= 1
+
+	tests := []struct {
+		name, token, want string
+	}{
+		{"valid", valid, "user-1"},
+		{"wrong secret", signToken([]byte("other"), hs256, `{"sub":"user-1","exp":1760000060}`), ""},
+		{"tampered claims", forged, ""},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + string(sig), ""},
+		{"alg none", signToken(secret, `{"alg":"none"}`, `{"sub":"user-1","exp":1760000060}`), ""},
+		{"alg RS256", signToken(secret, `{"alg":"RS256"}`, `{"sub":"user-1","exp":1760000060}`), ""},
+		{"alg lowercase", signToken(secret, `{"alg":"hs256"}`, `{"sub":"user-1","exp":1760000060}`), ""},
+		{"unsigned", parts[0] + "." + parts[1] + ".", ""},
+		{"expired", signToken(secret, hs256, `{"sub":"user-1","exp":1759999999}`), ""},
+		{"expires now", signToken(secret, hs256, `{"sub":"user-1","exp":1760000000}`), ""},
+		{"no exp", signToken(secret, hs256, `{"sub":"user-1"}`), ""},
+		{"no sub", signToken(secret, hs256, `{"exp":1760000060}`), ""},
+		{"two segments", "a.b", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyUserToken(secret, tt.token, now); got != tt.want {
+				t.Errorf("verifyUserToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Restaurant represents the core model for a dining establishment, including
 // metadata, location, and associated relational data (cuisines, meal types).
 type Restaurant struct {
 	ID                int64   `json:"id,string"`
 	RestaurantName    string  `json:"restaurant_name" db:"restaurant_name"`
+	DisplayName       string  `json:"display_name,omitempty"`
+	Slug              string  `json:"slug,omitempty"`
 	URL               string  `json:"url,omitempty"`
 	City              string  `json:"city"`
 	Area              string  `json:"area,omitempty"`
@@ -15,34 +22,392 @@ type Restaurant struct {
 	Percentage        string  `json:"percentage,omitempty"`
 	EffectiveDiscount float64 `json:"effective_discount"`
 	Free              bool    `json:"free"`
-	Latitude          float64 `json:"latitude"`
-	Longitude         float64 `json:"longitude"`
+	Latitude          float64 `json:"latitude,omitempty"`
+	Longitude         float64 `json:"longitude,omitempty"`
 	GeoStatus         string  `json:"geo_status"`
 	ImageURL          string  `json:"image_url,omitempty"`
 
+	// ImageAttribution is the credit (HTML) that must be shown with a sourced image.
+	ImageAttribution string `json:"image_attribution,omitempty"`
+
+	// Tags are admin-assigned labels such as "late-night".
+	Tags []string `json:"tags,omitempty"`
+
+	// PaymentMethods lists the banks, wallets or channels ("hdfc", "upi",
+	// "app") the offer is restricted to; empty when any payment qualifies.
+	PaymentMethods []string `json:"payment_methods,omitempty"`
+
+	// GeoConfidence scores the geocoded pin from 0 (approximate) to 1
+	// (rooftop); nil when the row was not geocoded by the worker.
+	GeoConfidence *float64 `json:"geo_confidence,omitempty"`
+
+	// LocationRestricted rows never expose exact coordinates to public clients.
+	LocationRestricted bool `json:"location_restricted,omitempty"`
+
+	// Contact details, returned by the detail endpoint only.
+	Phone       string `json:"phone,omitempty"`
+	Website     string `json:"website,omitempty"`
+	AddressLine string `json:"address_line,omitempty"`
+
+	// Enriched details; FieldSources names where each filled field came from.
+	PriceLevel   *int              `json:"price_level,omitempty"`
+	OpeningHours []string          `json:"opening_hours,omitempty"`
+	FieldSources map[string]string `json:"field_sources,omitempty"`
+
+	// Delivery zone, returned by the detail endpoint only: a GeoJSON
+	// MultiPolygon, or a radius in meters when there is no area.
+	DeliveryArea   json.RawMessage `json:"delivery_area,omitempty"`
+	DeliveryRadius *int            `json:"delivery_radius_m,omitempty"`
+
+	// PopularTimes is how busy the restaurant is by local weekday and hour,
+	// returned by the detail endpoint only.
+	PopularTimes []PopularTime `json:"popular_times,omitempty"`
+
+	// OfferWindow limits the offer to certain local times; nil when it is
+	// valid whenever the restaurant is open. Returned by the detail endpoint
+	// only.
+	OfferWindow *OfferWindow `json:"offer_window,omitempty"`
+
+	// CouponAvailable is true when the offer has a coupon code signed-in users
+	// can still reveal. Returned by the detail endpoint only.
+	CouponAvailable bool `json:"coupon_available,omitempty"`
+
+	// Version changes whenever the restaurant or its cuisines and meal types
+	// do; admin edits send it back to detect conflicting changes. Returned by
+	// the detail endpoint and admin search only.
+	Version string `json:"version,omitempty"`
+
 	// Extras for V2 (included in JSON to be safe)
 	Distance  float64    `json:"distance,omitempty"`
 	Cuisines  []Cuisine  `json:"cuisines,omitempty"`
 	MealTypes []MealType `json:"meal_types,omitempty"`
+
+	// DistanceText is Distance formatted for display ("1.2 km away").
+	DistanceText string `json:"distance_text,omitempty"`
+}
+
+// PopularTime is a restaurant's busyness (0-100) at one local weekday
+// (0 = Sunday) and hour.
+type PopularTime struct {
+	Day      int `json:"day"`
+	Hour     int `json:"hour"`
+	Busyness int `json:"busyness"`
+}
+
+// OfferWindow is when a time-limited offer is valid, in the city's local
+// time. End before Start means the window runs past midnight.
+type OfferWindow struct {
+	// Days are weekdays, 0 = Sunday; empty means every day.
+	Days  []int  `json:"days,omitempty"`
+	Start string `json:"start"`
+	End   string `json:"end"`
 }
 
 // Cuisine represents a specific culinary category used for filtering and search.
 type Cuisine struct {
 	ID          int64  `json:"id,string"`
 	CuisineName string `json:"cuisine_name"`
+
+	RestaurantCount int `json:"restaurant_count,omitempty"`
 }
 
 // MealType defines the time or category of a meal (e.g., Breakfast, Dinner).
 type MealType struct {
 	ID       int64  `json:"id,string"`
 	MealType string `json:"meal_type"`
+
+	RestaurantCount int `json:"restaurant_count,omitempty"`
 }
 
 // City represents the cities table
 type City struct {
-	ID        int64   `json:"id,string"`
-	CityName  string  `json:"city_name" db:"city_name"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-	GeoStatus string  `json:"geo_status"`
+	ID          int64   `json:"id,string"`
+	CityName    string  `json:"city_name" db:"city_name"`
+	Slug        string  `json:"slug"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	GeoStatus   string  `json:"geo_status"`
+	IsPublished bool    `json:"is_published"`
+	// Version changes whenever the city does; admin edits send it back to
+	// detect conflicting changes.
+	Version string `json:"version"`
+
+	RestaurantCount int            `json:"restaurant_count"`
+	TopCuisines     []string       `json:"top_cuisines"`
+	DataFreshness   *DataFreshness `json:"data_freshness,omitempty"`
+}
+
+// DataFreshness reports how current a set of restaurants is: when they were
+// last scraped and when their data last changed.
+type DataFreshness struct {
+	LastScrapedAt *time.Time `json:"last_scraped_at"`
+	LastUpdatedAt *time.Time `json:"last_updated_at"`
+	Stale         bool       `json:"stale"`
+}
+
+// RestaurantSnapshot is one historical version of a restaurant's price and deal fields.
+type RestaurantSnapshot struct {
+	CostForTwo        int       `json:"cost_for_two"`
+	Rating            float64   `json:"rating"`
+	Offer             string    `json:"offer,omitempty"`
+	EffectiveDiscount float64   `json:"effective_discount"`
+	RecordedAt        time.Time `json:"recorded_at"`
+}
+
+// TrendPoint is one weekly aggregate of historical deal data.
+type TrendPoint struct {
+	Week        time.Time `json:"week"`
+	AvgDiscount float64   `json:"avg_discount"`
+	AvgCost     float64   `json:"avg_cost"`
+	Samples     int       `json:"samples"`
+}
+
+// TrendSeries groups weekly trend points for a single cuisine.
+type TrendSeries struct {
+	Cuisine string       `json:"cuisine"`
+	Points  []TrendPoint `json:"points"`
+}
+
+// HeatmapCell is one grid square of a restaurant density map.
+type HeatmapCell struct {
+	Geohash     string  `json:"geohash"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Count       int     `json:"count"`
+	AvgDiscount float64 `json:"avg_discount"`
+}
+
+// RestaurantDistance is the distance from a point to one restaurant, with
+// the route there when travel times were requested and could be computed.
+type RestaurantDistance struct {
+	ID           int64   `json:"id,string"`
+	Distance     float64 `json:"distance"`
+	DistanceText string  `json:"distance_text"`
+	// TravelDistance (meters) and TravelSeconds follow the road or footpath network.
+	TravelDistance *float64 `json:"travel_distance,omitempty"`
+	TravelSeconds  *float64 `json:"travel_seconds,omitempty"`
+}
+
+// CostBucket counts restaurants whose cost_for_two falls in [Min, Max); Max
+// is nil for the open-ended top bucket.
+type CostBucket struct {
+	Min   int  `json:"min"`
+	Max   *int `json:"max"`
+	Count int  `json:"count"`
+}
+
+// SessionActivity is one recent search or restaurant view recorded for an anonymous session.
+type SessionActivity struct {
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey describes a third-party API key. The plaintext key is only returned once, at creation.
+type APIKey struct {
+	ID                 int64      `json:"id,string"`
+	Name               string     `json:"name"`
+	OwnerEmail         string     `json:"owner_email"`
+	Status             string     `json:"status"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	DailyQuota         int        `json:"daily_quota"`
+	RestaurantIDs      []int64    `json:"restaurant_ids,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ApprovedAt         *time.Time `json:"approved_at,omitempty"`
+	Key                string     `json:"key,omitempty"`
+}
+
+// ImpersonationToken lets support act as a user. Token is only set in the
+// response that mints it.
+type ImpersonationToken struct {
+	ID        int64      `json:"id,string"`
+	UserID    string     `json:"user_id"`
+	Scope     string     `json:"scope"`
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Token     string     `json:"token,omitempty"`
+}
+
+// ImpersonationRequest is one request made with an impersonation token.
+type ImpersonationRequest struct {
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Status      int       `json:"status"`
+	RequestID   string    `json:"request_id,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// APIKeyUsage is the number of requests made with a key on a given day.
+type APIKeyUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+}
+
+// DeadLink is a restaurant image or partner URL that failed its last check.
+type DeadLink struct {
+	RestaurantID   int64     `json:"restaurant_id,string"`
+	RestaurantName string    `json:"restaurant_name"`
+	Field          string    `json:"field"`
+	URL            string    `json:"url"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Failures       int       `json:"failures"`
+	FirstFailedAt  time.Time `json:"first_failed_at"`
+	LastCheckedAt  time.Time `json:"last_checked_at"`
+}
+
+// LowConfidenceGeocode is a geocoded restaurant whose pin may be imprecise.
+type LowConfidenceGeocode struct {
+	RestaurantID   int64   `json:"restaurant_id,string"`
+	RestaurantName string  `json:"restaurant_name"`
+	City           string  `json:"city"`
+	Area           string  `json:"area,omitempty"`
+	AddressLine    string  `json:"address_line,omitempty"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	LocationType   string  `json:"location_type,omitempty"`
+	PartialMatch   bool    `json:"partial_match"`
+	Confidence     float64 `json:"geo_confidence"`
+}
+
+// Coupon is an exclusive code attached to a restaurant's offer. Reveals
+// counts users the code was shown to; Redemptions those who reported using it.
+type Coupon struct {
+	ID              int64      `json:"id,string"`
+	RestaurantID    int64      `json:"restaurant_id,string"`
+	RestaurantName  string     `json:"restaurant_name"`
+	Code            string     `json:"code"`
+	RedemptionLimit *int       `json:"redemption_limit,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	Reveals         int        `json:"reveals"`
+	Redemptions     int        `json:"redemptions"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// CouponReveal is a coupon code as revealed to the signed-in user.
+type CouponReveal struct {
+	Code       string     `json:"code"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevealedAt time.Time  `json:"revealed_at"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+}
+
+// Voucher is a signed, single-use voucher for a restaurant's offer.
+type Voucher struct {
+	ID           int64      `json:"id,string"`
+	RestaurantID int64      `json:"restaurant_id,string"`
+	Offer        string     `json:"offer"`
+	Token        string     `json:"token,omitempty"`
+	IssuedAt     time.Time  `json:"issued_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RedeemedAt   *time.Time `json:"redeemed_at,omitempty"`
+}
+
+// AdminRestaurant is a restaurant in admin search results, with the reasons
+// it may be hidden from or ranked down in public search.
+type AdminRestaurant struct {
+	Restaurant
+	Statuses []string `json:"statuses"`
+}
+
+// CuisineProposal is a cuisine suggested for a restaurant by the classifier.
+type CuisineProposal struct {
+	RestaurantID   int64      `json:"restaurant_id,string"`
+	RestaurantName string     `json:"restaurant_name"`
+	CuisineID      int64      `json:"cuisine_id,string"`
+	CuisineName    string     `json:"cuisine_name"`
+	Confidence     float64    `json:"confidence"`
+	Source         string     `json:"source"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// GeoStatusCity counts a city's restaurants by geo_status, plus those whose
+// geocoding failed and those resolved with a suspect pin.
+type GeoStatusCity struct {
+	City    string         `json:"city"`
+	Counts  map[string]int `json:"counts"`
+	Failed  int            `json:"failed"`
+	Suspect int            `json:"suspect"`
+}
+
+// GeoBacklogRow is a restaurant whose geocoding failed or whose pin is suspect.
+type GeoBacklogRow struct {
+	RestaurantID   int64      `json:"restaurant_id,string"`
+	RestaurantName string     `json:"restaurant_name"`
+	City           string     `json:"city"`
+	Area           string     `json:"area,omitempty"`
+	GeoStatus      string     `json:"geo_status"`
+	Confidence     *float64   `json:"geo_confidence,omitempty"`
+	LastError      string     `json:"last_geo_error,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_geo_attempt_at,omitempty"`
+	GeocodedAt     *time.Time `json:"geocoded_at,omitempty"`
+}
+
+// ExportJob is an admin export queued for the export worker. URL and
+// ExpiresAt are set once it has succeeded.
+type ExportJob struct {
+	ID         int64      `json:"id,string"`
+	Params     string     `json:"params"`
+	Status     string     `json:"status"`
+	StorageKey string     `json:"-"`
+	Rows       *int       `json:"rows,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// RecentSearch is a search the caller ran recently. Params is its query
+// string, to run it again.
+type RecentSearch struct {
+	ID         int64     `json:"id,string"`
+	Query      string    `json:"query"`
+	Params     string    `json:"params"`
+	SearchedAt time.Time `json:"searched_at"`
+}
+
+// AccountDeletion is a pending or completed request to delete a user's data.
+type AccountDeletion struct {
+	RequestedAt time.Time  `json:"requested_at"`
+	PurgeAfter  time.Time  `json:"purge_after"`
+	PurgedAt    *time.Time `json:"purged_at,omitempty"`
+}
+
+// AccountExport is everything stored about a signed-in user, for data
+// access requests.
+type AccountExport struct {
+	UserID              string               `json:"user_id"`
+	ExportedAt          time.Time            `json:"exported_at"`
+	Deletion            *AccountDeletion     `json:"deletion,omitempty"`
+	RecentSearches      []RecentSearch       `json:"recent_searches"`
+	CouponReveals       []UserCouponReveal   `json:"coupon_reveals"`
+	Vouchers            []Voucher            `json:"vouchers"`
+	ImpersonationTokens []ImpersonationToken `json:"impersonation_tokens"`
+}
+
+// UserCouponReveal is a coupon revealed to a user, with the restaurant it
+// belongs to.
+type UserCouponReveal struct {
+	RestaurantID   int64  `json:"restaurant_id,string"`
+	RestaurantName string `json:"restaurant_name"`
+	CouponReveal
+}
+
+// QuarantinedSubmission is a public event held back by abuse screening for
+// an admin to release or reject.
+type QuarantinedSubmission struct {
+	ID         int64           `json:"id,string"`
+	Kind       string          `json:"kind"`
+	ClientIP   string          `json:"client_ip"`
+	SessionID  string          `json:"session_id,omitempty"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ReviewedAt *time.Time      `json:"reviewed_at,omitempty"`
 }
@@ -0,0 +1,139 @@
+// Package names cleans scraped restaurant names. Display is the name as it
+// should be shown: without emojis, branch suffixes or shouting. Key is the
+// matching key shared by every branch of a brand, used for duplicate
+// detection and brand grouping.
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalized is a cleaned restaurant name.
+type Normalized struct {
+	Display string
+	Key     string
+}
+
+// branchSeparators introduce a branch or location suffix, as in
+// "Truffles - Koramangala" or "Meghana Foods | HSR Layout".
+var branchSeparators = []string{" - ", " – ", " — ", " | ", " @ ", " : "}
+
+// genericWords are dropped from matching keys so "Domino's Pizza Restaurant"
+// and "Dominos Pizza" match.
+var genericWords = map[string]bool{
+	"the": true, "restaurant": true, "restaurants": true, "pvt": true, "ltd": true, "private": true, "limited": true,
+}
+
+// Normalize cleans name. area and city, when given, are also stripped when
+// the name merely ends with them ("Truffles Koramangala").
+func Normalize(name, area, city string) Normalized {
+	display := stripBranch(cleanRunes(name), area, city)
+	if isShouting(display) {
+		display = titleCase(display)
+	}
+	if display == "" {
+		display = strings.Join(strings.Fields(name), " ")
+	}
+	return Normalized{Display: display, Key: Key(display)}
+}
+
+// Key returns the matching key for a name: lowercase words without
+// punctuation, apostrophes or generic words such as "restaurant", with "&"
+// read as "and". Branch suffixes are not stripped; pass a display name.
+func Key(name string) string {
+	name = strings.ToLower(strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(name))
+	var words []string
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !genericWords[w] {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// cleanRunes drops emojis, symbols and control characters and collapses
+// whitespace.
+func cleanRunes(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case unicode.IsPunct(r), r == '&', r == '+':
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// stripBranch removes a trailing location suffix: parenthesised parts, the
+// text after the last separator, and the area or city name itself.
+func stripBranch(s, area, city string) string {
+	s = stripParens(s)
+	for _, sep := range branchSeparators {
+		if i := strings.LastIndex(s, sep); i > 0 {
+			s = stripParens(s[:i])
+			break
+		}
+	}
+	for _, place := range []string{area, city} {
+		place = strings.TrimSpace(place)
+		if place == "" || len(s) <= len(place)+1 {
+			continue
+		}
+		if head := s[:len(s)-len(place)]; strings.HasSuffix(head, " ") && strings.EqualFold(s[len(head):], place) {
+			s = strings.TrimRight(head, " ,-|:@–—")
+		}
+	}
+	return s
+}
+
+func stripParens(s string) string {
+	for strings.HasSuffix(s, ")") {
+		i := strings.LastIndex(s, "(")
+		if i <= 0 {
+			break
+		}
+		s = strings.TrimRight(s[:i], " ,-|:@–—")
+	}
+	return s
+}
+
+// isShouting reports whether s has several letters and none in lower case.
+func isShouting(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			letters++
+		}
+	}
+	return letters >= 4
+}
+
+// titleCase capitalizes each word, leaving short words without vowels (KFC,
+// BBQ) as acronyms.
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		if len([]rune(w)) <= 3 && !strings.ContainsAny(w, "AEIOU") {
+			continue
+		}
+		runes := []rune(strings.ToLower(w))
+		for j, r := range runes {
+			if unicode.IsLetter(r) {
+				runes[j] = unicode.ToUpper(r)
+				break
+			}
+		}
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
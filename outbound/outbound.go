@@ -0,0 +1,201 @@
+// Package outbound is the HTTP client used for calls to third-party APIs. It
+// adds timeouts, retries with jitter for timeouts and 5xx responses, and a
+// circuit breaker per host so a failing provider is skipped instead of
+// slowing down every request and worker that depends on it.
+package outbound
+
+import (
+	"errors"
+	"expvar"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BreakerThreshold consecutive failures against a host open its circuit
+	// for BreakerCooldown, after which a single trial request is let through.
+	BreakerThreshold = 5
+	BreakerCooldown  = time.Minute
+
+	// retryBase is the backoff before the first retry; it doubles per
+	// attempt and is fully jittered.
+	retryBase = 200 * time.Millisecond
+)
+
+// ErrCircuitOpen is returned without making a request while a host's
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Client wraps http.Client with the retry policy and the host breakers.
+// Only GET and HEAD requests are retried; other methods go through the
+// breaker but are sent once.
+type Client struct {
+	http    *http.Client
+	retries int
+}
+
+// New returns a Client whose attempts each time out after timeout and which
+// retries failed attempts up to retries times. Interactive callers should
+// pass few or no retries to keep latency bounded.
+func New(timeout time.Duration, retries int) *Client {
+	return &Client{http: &http.Client{Timeout: timeout}, retries: retries}
+}
+
+// Get issues a GET request to url.
+func (c *Client) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req, retrying timeouts and 5xx responses. A 5xx response that
+// survives all retries is returned as is for the caller to inspect.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	h := hostFor(req.URL.Host)
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if !h.allow() {
+			h.shortCircuited.Add(1)
+			return nil, ErrCircuitOpen
+		}
+		if attempt > 0 {
+			h.retries.Add(1)
+		}
+		h.requests.Add(1)
+
+		resp, err := c.http.Do(req)
+		failed := err != nil || resp.StatusCode >= 500
+		h.record(failed)
+		if !failed {
+			return resp, nil
+		}
+		h.failures.Add(1)
+
+		if attempt >= c.retries || !idempotent || (err != nil && !isTimeout(err)) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(retryBase << attempt))))
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// host is the breaker and counters for one upstream host.
+type host struct {
+	mu          sync.Mutex
+	consecutive int
+	openUntil   time.Time
+	trial       bool
+	lastFailure time.Time
+
+	requests, retries, failures, shortCircuited atomic.Int64
+}
+
+func (h *host) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.consecutive < BreakerThreshold {
+		return true
+	}
+	if time.Now().Before(h.openUntil) || h.trial {
+		return false
+	}
+	h.trial = true
+	return true
+}
+
+func (h *host) record(failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trial = false
+	if !failed {
+		h.consecutive = 0
+		return
+	}
+	h.consecutive++
+	h.lastFailure = time.Now()
+	if h.consecutive >= BreakerThreshold {
+		h.openUntil = h.lastFailure.Add(BreakerCooldown)
+	}
+}
+
+var (
+	hostsMu sync.Mutex
+	hosts   = map[string]*host{}
+)
+
+func hostFor(name string) *host {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	h, ok := hosts[name]
+	if !ok {
+		h = &host{}
+		hosts[name] = h
+	}
+	return h
+}
+
+// HostState reports the breaker and counters for one upstream host.
+type HostState struct {
+	Host           string     `json:"host"`
+	Circuit        string     `json:"circuit"`
+	Requests       int64      `json:"requests"`
+	Retries        int64      `json:"retries"`
+	Failures       int64      `json:"failures"`
+	ShortCircuited int64      `json:"short_circuited"`
+	LastFailureAt  *time.Time `json:"last_failure_at"`
+}
+
+func init() {
+	expvar.Publish("outbound", expvar.Func(func() interface{} { return States() }))
+}
+
+// States returns the state of every host called since process start,
+// ordered by host name.
+func States() []HostState {
+	hostsMu.Lock()
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	hostsMu.Unlock()
+	sort.Strings(names)
+
+	states := make([]HostState, 0, len(names))
+	for _, name := range names {
+		h := hostFor(name)
+		h.mu.Lock()
+		s := HostState{
+			Host:           name,
+			Circuit:        "closed",
+			Requests:       h.requests.Load(),
+			Retries:        h.retries.Load(),
+			Failures:       h.failures.Load(),
+			ShortCircuited: h.shortCircuited.Load(),
+		}
+		if h.consecutive >= BreakerThreshold {
+			s.Circuit = "open"
+		}
+		if !h.lastFailure.IsZero() {
+			t := h.lastFailure
+			s.LastFailureAt = &t
+		}
+		h.mu.Unlock()
+		states = append(states, s)
+	}
+	return states
+}
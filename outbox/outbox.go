@@ -0,0 +1,167 @@
+// Package outbox delivers the side effects of database writes: cache
+// invalidation, webhooks and the like. A write records its events with Record
+// in the same transaction, so they exist if and only if the write commits;
+// Dispatch later hands each event to the handlers registered for its topic,
+// retrying failures with backoff. Delivery is at least once, so handlers
+// must be idempotent.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Topics recorded by the API.
+const (
+	// TopicRestaurantChanged carries {"ids": [...]} for restaurants whose
+	// listing, cuisines or meal types were edited.
+	TopicRestaurantChanged = "restaurant.changed"
+	// TopicCityChanged carries {"id": ...} for an edited city.
+	TopicCityChanged     = "city.changed"
+	TopicSynonymsChanged = "synonyms.changed"
+	// TopicAPIKeyChanged carries {"id": ...} for an approved or revoked key.
+	TopicAPIKeyChanged = "api_key.changed"
+)
+
+const (
+	// MaxAttempts is how often an event is tried before it is left failed.
+	MaxAttempts = 10
+	// maxBackoff caps the delay between attempts, which doubles from a second.
+	maxBackoff = time.Hour
+)
+
+// Message is an event to record.
+type Message struct {
+	Topic   string
+	Payload interface{}
+}
+
+// Event is a recorded message as handed to handlers.
+type Event struct {
+	ID        int64           `json:"id,string"`
+	Topic     string          `json:"topic"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+}
+
+// Handler processes one event; an error schedules a retry.
+type Handler func(ctx context.Context, e Event) error
+
+// Execer is satisfied by *sql.Tx and *sql.DB.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string][]Handler{}
+)
+
+// Handle registers fn for topic; the topic "*" receives every event.
+func Handle(topic string, fn Handler) {
+	mu.Lock()
+	handlers[topic] = append(handlers[topic], fn)
+	mu.Unlock()
+}
+
+// Record stores msgs as pending events. Pass the transaction making the
+// write they describe.
+func Record(ex Execer, msgs ...Message) error {
+	for _, m := range msgs {
+		payload, err := json.Marshal(m.Payload)
+		if err != nil {
+			return err
+		}
+		if _, err := ex.Exec("INSERT INTO outbox_events (topic, payload) VALUES ($1, $2)", m.Topic, string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispatch delivers up to limit due events, oldest first, and returns how
+// many it tried. An event whose handlers all succeed is marked dispatched;
+// otherwise it is retried later, and after MaxAttempts left failed with its
+// last error.
+func Dispatch(ctx context.Context, db *sql.DB, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, topic, payload, created_at, attempts FROM outbox_events
+		WHERE dispatched_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+		ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Topic, &payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		e.Attempts++
+		if herr := deliver(ctx, e); herr != nil {
+			log.Printf("Outbox event %d (%s) attempt %d failed: %v", e.ID, e.Topic, e.Attempts, herr)
+			_, err = db.ExecContext(ctx, `
+				UPDATE outbox_events SET attempts = $2, last_error = $3,
+					next_attempt_at = now() + $4 * interval '1 second',
+					failed_at = CASE WHEN $2 >= $5 THEN now() END
+				WHERE id = $1`, e.ID, e.Attempts, herr.Error(), backoff(e.Attempts).Seconds(), MaxAttempts)
+		} else {
+			_, err = db.ExecContext(ctx, "UPDATE outbox_events SET attempts = $2, dispatched_at = now(), last_error = NULL WHERE id = $1", e.ID, e.Attempts)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
+
+// deliver runs every handler for e, returning the first error.
+func deliver(ctx context.Context, e Event) (err error) {
+	mu.RLock()
+	fns := append(append([]Handler{}, handlers[e.Topic]...), handlers["*"]...)
+	mu.RUnlock()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panic: %v", p)
+		}
+	}()
+	for _, fn := range fns {
+		if err := fn(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backoff(attempts int) time.Duration {
+	d := time.Second << min(attempts-1, 12)
+	return min(d, maxBackoff)
+}
+
+// Counts reports how many events are pending and how many failed for good.
+func Counts(db *sql.DB) (pending, failed int, err error) {
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE dispatched_at IS NULL AND failed_at IS NULL), COUNT(*) FILTER (WHERE failed_at IS NOT NULL)
+		FROM outbox_events`).Scan(&pending, &failed)
+	return pending, failed, err
+}
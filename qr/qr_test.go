@@ -0,0 +1,38 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		n, version int
+	}{
+		{0, 1},
+		{14, 1},
+		{15, 2},
+		{26, 2},
+		{27, 3},
+		{180, 9},
+		{181, 10},
+		{213, 10},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.n))
+		if err != nil {
+			t.Errorf("Encode(%d bytes): %v", tt.n, err)
+			continue
+		}
+		if want := 17 + 4*tt.version; c.Size != want {
+			t.Errorf("Encode(%d bytes) size = %d, want %d (version %d)", tt.n, c.Size, want, tt.version)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(bytes.Repeat([]byte("a"), 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(214 bytes) error = %v, want ErrTooLong", err)
+	}
+}
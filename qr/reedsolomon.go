@@ -0,0 +1,59 @@
+package qr
+
+// Reed-Solomon error correction over GF(256) with the QR field polynomial
+// x^8 + x^4 + x^3 + x^2 + 1.
+
+var gfExp, gfLog [256]int
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+gfLog[b])%255]
+}
+
+// generator returns the coefficients of (x - a^0)(x - a^1)...(x - a^(n-1)),
+// highest degree first, without the leading 1.
+func generator(n int) []int {
+	g := []int{1}
+	for i := 0; i < n; i++ {
+		next := make([]int, len(g)+1)
+		for j, c := range g {
+			next[j] ^= c
+			next[j+1] ^= gfMul(c, gfExp[i])
+		}
+		g = next
+	}
+	return g[1:]
+}
+
+// remainder returns the error correction codewords for data.
+func remainder(data []byte, gen []int) []byte {
+	rem := make([]int, len(gen))
+	for _, b := range data {
+		factor := int(b) ^ rem[0]
+		copy(rem, rem[1:])
+		rem[len(rem)-1] = 0
+		for i, c := range gen {
+			rem[i] ^= gfMul(c, factor)
+		}
+	}
+	out := make([]byte, len(rem))
+	for i, v := range rem {
+		out[i] = byte(v)
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+// Package sanitize cleans user-generated text before it is stored, so API
+// responses only ever carry plain, bounded text: HTML tags, control and
+// invisible formatting characters are removed, whitespace is collapsed,
+// configured profanity is masked and the result is cut to a length limit.
+package sanitize
+
+import (
+	"html"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// profanity holds the lowercase words masked by Text and Line, read from the
+// comma-separated PROFANITY_WORDS (unset means no masking).
+var profanity = func() map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.Split(os.Getenv("PROFANITY_WORDS"), ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			words[w] = true
+		}
+	}
+	return words
+}()
+
+// Line cleans single-line text such as a name or a search: every run of
+// whitespace, newlines included, becomes one space. maxLen bounds the result
+// in characters; 0 means no limit.
+func Line(s string, maxLen int) string {
+	return truncate(maskProfanity(strings.Join(strings.Fields(clean(s)), " ")), maxLen)
+}
+
+// Text cleans multi-line text such as a review or a note. Paragraph breaks
+// are kept, at most one blank line in a row; other whitespace is collapsed.
+// maxLen bounds the result in characters; 0 means no limit.
+func Text(s string, maxLen int) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(clean(s), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return truncate(maskProfanity(strings.Join(lines, "\n")), maxLen)
+}
+
+// clean decodes entities, strips tags and drops invalid UTF-8, control
+// characters other than newlines and tabs, and invisible formatting
+// characters such as zero-width spaces and bidirectional overrides.
+func clean(s string) string {
+	s = stripTags(html.UnescapeString(strings.ToValidUTF8(s, "")))
+	s = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stripTags removes HTML tags and comments. A "<" not followed by a letter,
+// "/", "!" or "?" is not a tag and is kept, as in "under <500".
+func stripTags(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		next, _ := utf8.DecodeRuneInString(s[i+1:])
+		if !unicode.IsLetter(next) && next != '/' && next != '!' && next != '?' {
+			b.WriteByte('<')
+			s = s[i+1:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			// An unterminated tag swallows the rest, as a browser would.
+			return b.String()
+		}
+		// Tags separate words ("a<br>b"), so leave a space for Fields to fold.
+		b.WriteByte(' ')
+		s = s[i+end+1:]
+	}
+}
+
+// maskProfanity replaces every letter but the first of each listed word
+// with "*", matching whole words case-insensitively.
+func maskProfanity(s string) string {
+	if len(profanity) == 0 {
+		return s
+	}
+	var b strings.Builder
+	word := func(w string) {
+		if profanity[strings.ToLower(w)] {
+			_, size := utf8.DecodeRuneInString(w)
+			b.WriteString(w[:size])
+			b.WriteString(strings.Repeat("*", utf8.RuneCountInString(w)-1))
+			return
+		}
+		b.WriteString(w)
+	}
+	start := -1
+	for i, r := range s {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\''
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			word(s[start:i])
+			start = -1
+		}
+		if !inWord {
+			b.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		word(s[start:])
+	}
+	return b.String()
+}
+
+// truncate cuts s to at most n characters, dropping trailing whitespace left
+// at the cut.
+func truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimRightFunc(string([]rune(s)[:n]), unicode.IsSpace)
+}
@@ -0,0 +1,105 @@
+package sanitize
+
+import "testing"
+
+func TestStripTags(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain text", "Masala Dosa", "Masala Dosa"},
+		{"tags", "<b>Masala</b> Dosa", "Masala Dosa"},
+		{"tags separate words", "Masala<br>Dosa", "Masala Dosa"},
+		{"script", `<script>alert("x")</script>`, `alert("x")`},
+		{"attributes", `<img src=x onerror="alert(1)">Dosa`, "Dosa"},
+		{"comment", "Dosa<!-- hidden -->", "Dosa"},
+		{"less than a number", "meals under <500", "meals under <500"},
+		{"less than a space", "a < b and b<= c", "a < b and b<= c"},
+		{"trailing less than", "cheaper <", "cheaper <"},
+		{"unterminated tag", "Dosa <img src=x onerror=alert(1)", "Dosa"},
+		{"entity-encoded tag", "&lt;img src=x onerror=alert(1)&gt;Dosa", "Dosa"},
+		{"entity-encoded less than", "under &lt;500", "under <500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Line(tt.in, 0); got != tt.want {
+				t.Errorf("Line(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvisibleCharacters(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"nul and bell", "Dosa\x00\x07 Corner", "Dosa Corner"},
+		{"escape sequence", "\x1b[31mDosa", "[31mDosa"},
+		{"del and c1", "Dosa\x7f\u0085", "Dosa"},
+		{"zero-width space", "Do\u200bsa", "Dosa"},
+		{"zero-width joiner", "Do\u200dsa", "Dosa"},
+		{"bidi override", "\u202eDosa\u202c", "Dosa"},
+		{"byte order mark", "\ufeffDosa", "Dosa"},
+		{"invalid utf-8", "Do\xffsa", "Dosa"},
+		{"tabs and newlines fold", "Masala\t\r\nDosa", "Masala Dosa"},
+		{"non-latin text kept", "मसाला डोसा", "मसाला डोसा"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Line(tt.in, 0); got != tt.want {
+				t.Errorf("Line(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	in := "  Great   dosa.\r\n\r\n\r\n\u200bService was  slow.\n<p>Would return</p>\n\n"
+	want := "Great dosa.\n\nService was slow.\nWould return"
+	if got := Text(in, 0); got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestMaskProfanity(t *testing.T) {
+	saved := profanity
+	profanity = map[string]bool{"darn": true, "heck": true}
+	defer func() { profanity = saved }()
+
+	tests := []struct {
+		in, want string
+	}{
+		{"darn good dosa", "d*** good dosa"},
+		{"DARN, what the Heck!", "D***, what the H***!"},
+		{"darned good", "darned good"},
+		{"heckle", "heckle"},
+		{"no words here", "no words here"},
+		{"<b>darn</b>", "d***"},
+	}
+	for _, tt := range tests {
+		if got := Line(tt.in, 0); got != tt.want {
+			t.Errorf("Line(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"Masala Dosa", 0, "Masala Dosa"},
+		{"Masala Dosa", 20, "Masala Dosa"},
+		{"Masala Dosa", 6, "Masala"},
+		{"Masala Dosa", 7, "Masala"},
+		{"मसाला डोसा", 5, "मसाला"},
+		{"Café crème", 4, "Café"},
+		{"🍕🍕🍕", 2, "🍕🍕"},
+	}
+	for _, tt := range tests {
+		got := Line(tt.in, tt.n)
+		if got != tt.want {
+			t.Errorf("Line(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
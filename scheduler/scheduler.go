@@ -0,0 +1,217 @@
+// Package scheduler runs the background workers on cron-style schedules,
+// with per-job jitter and protection against overlapping runs.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"eazyfind/tracker"
+)
+
+// Job is a unit of background work run on a schedule.
+type Job struct {
+	Name string
+	// Spec is the default schedule; see Parse. SCHEDULE_<NAME> in the
+	// environment or a row in job_schedules overrides it, and "off"
+	// disables the job.
+	Spec string
+	// Jitter is the maximum random delay added to each activation so
+	// instances and jobs sharing a schedule do not fire in lockstep.
+	Jitter time.Duration
+	Run    func()
+}
+
+// JobState reports a job's schedule and recent activity.
+type JobState struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	NextRunAt    *time.Time `json:"next_run_at"`
+	Runs         int64      `json:"runs"`
+	// Skipped counts activations dropped because the previous run, here or
+	// on another instance, had not finished.
+	Skipped int64 `json:"skipped"`
+}
+
+type entry struct {
+	job      Job
+	schedule *Schedule
+
+	mu    sync.Mutex
+	state JobState
+}
+
+var (
+	mu      sync.Mutex
+	entries = map[string]*entry{}
+)
+
+// Register adds a job. Jobs registered after Start are not run.
+func Register(j Job) {
+	mu.Lock()
+	entries[j.Name] = &entry{job: j}
+	mu.Unlock()
+}
+
+// Start resolves each registered job's schedule and begins running them.
+// Schedules come from job_schedules, then SCHEDULE_<NAME> (name upper-cased,
+// hyphens as underscores), then the job's default; they are read once at
+// startup.
+func Start(db *sql.DB) {
+	overrides := loadOverrides(db)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, e := range entries {
+		spec := e.job.Spec
+		if v := os.Getenv(envKey(name)); v != "" {
+			spec = v
+		}
+		if v, ok := overrides[name]; ok {
+			spec = v
+		}
+		e.state = JobState{Name: name, Schedule: spec}
+		if strings.EqualFold(spec, "off") {
+			log.Printf("Scheduled job %s disabled", name)
+			continue
+		}
+		sched, err := Parse(spec)
+		if err != nil {
+			log.Printf("Invalid schedule for job %s (%v), using default %q", name, err, e.job.Spec)
+			if sched, err = Parse(e.job.Spec); err != nil {
+				log.Printf("Invalid default schedule for job %s: %v", name, err)
+				continue
+			}
+			e.state.Schedule = e.job.Spec
+		}
+		e.schedule = sched
+		log.Printf("Scheduled job %s (%s, jitter %v)", name, e.state.Schedule, e.job.Jitter)
+		go e.loop(db)
+	}
+}
+
+func envKey(name string) string {
+	return "SCHEDULE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func loadOverrides(db *sql.DB) map[string]string {
+	overrides := map[string]string{}
+	rows, err := db.Query("SELECT name, schedule FROM job_schedules")
+	if err != nil {
+		log.Println("Failed to load job schedules:", err)
+		return overrides
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, spec string
+		if err := rows.Scan(&name, &spec); err == nil {
+			overrides[name] = spec
+		}
+	}
+	return overrides
+}
+
+func (e *entry) loop(db *sql.DB) {
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Schedule for job %s never fires again, stopping", e.job.Name)
+			return
+		}
+		if e.job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(e.job.Jitter))))
+		}
+		e.mu.Lock()
+		e.state.NextRunAt = &next
+		e.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+		go e.run(db)
+	}
+}
+
+// run executes the job unless a previous run is still going in this process
+// or holds the job's advisory lock on another instance.
+func (e *entry) run(db *sql.DB) {
+	e.mu.Lock()
+	if e.state.Running {
+		e.state.Skipped++
+		e.mu.Unlock()
+		return
+	}
+	e.state.Running = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.state.Running = false
+		e.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Printf("Scheduled job %s: %v", e.job.Name, err)
+		tracker.Capture(err, map[string]string{"job": e.job.Name})
+		return
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext('scheduler:' || $1))", e.job.Name).Scan(&locked); err != nil {
+		log.Printf("Scheduled job %s: %v", e.job.Name, err)
+		tracker.Capture(err, map[string]string{"job": e.job.Name})
+		return
+	}
+	if !locked {
+		e.mu.Lock()
+		e.state.Skipped++
+		e.mu.Unlock()
+		return
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext('scheduler:' || $1))", e.job.Name)
+
+	started := time.Now()
+	e.job.Run()
+
+	e.mu.Lock()
+	e.state.LastRunAt = &started
+	e.state.LastDuration = time.Since(started).Round(time.Millisecond).String()
+	e.state.Runs++
+	e.mu.Unlock()
+}
+
+// State returns the state of the named job.
+func State(name string) (JobState, bool) {
+	mu.Lock()
+	e, ok := entries[name]
+	mu.Unlock()
+	if !ok {
+		return JobState{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state, true
+}
+
+// States returns every job's state, ordered by name.
+func States() []JobState {
+	mu.Lock()
+	all := make([]JobState, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		all = append(all, e.state)
+		e.mu.Unlock()
+	}
+	mu.Unlock()
+	sort.Slice(all, func(a, b int) bool { return all[a].Name < all[b].Name })
+	return all
+}
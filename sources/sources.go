@@ -0,0 +1,84 @@
+// Package sources re-fetches restaurant listings from the sites they were
+// scraped from. Site-specific adapters register themselves with Register;
+// the generic HTTP adapter only detects listings that have been taken down.
+package sources
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Offer is the current deal shown on a source listing.
+type Offer struct {
+	Offer      string
+	Percentage string
+	// Expired is set when the listing no longer shows any offer.
+	Expired bool
+}
+
+// ErrUnknown means the adapter could not tell whether the offer is current
+// (for example, the page loaded but has no recognizable offer markup).
+var ErrUnknown = errors.New("offer state unknown")
+
+// Adapter fetches the live offer for a listing URL it recognizes.
+type Adapter interface {
+	Name() string
+	Match(url string) bool
+	FetchOffer(ctx context.Context, url string) (Offer, error)
+}
+
+var (
+	mu       sync.RWMutex
+	adapters []Adapter
+)
+
+// Register adds a site adapter. Adapters are tried in registration order,
+// before the generic fallback.
+func Register(a Adapter) {
+	mu.Lock()
+	defer mu.Unlock()
+	adapters = append(adapters, a)
+}
+
+// For returns the adapter for url, falling back to the generic one.
+func For(url string) Adapter {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, a := range adapters {
+		if a.Match(url) {
+			return a
+		}
+	}
+	return generic
+}
+
+var generic Adapter = httpAdapter{client: &http.Client{Timeout: 15 * time.Second}}
+
+// httpAdapter treats a listing that returns 404 or 410 as having no offer.
+// Anything else is reported as ErrUnknown, since offers cannot be read
+// without a site-specific adapter.
+type httpAdapter struct {
+	client *http.Client
+}
+
+func (httpAdapter) Name() string      { return "http" }
+func (httpAdapter) Match(string) bool { return true }
+
+func (a httpAdapter) FetchOffer(ctx context.Context, url string) (Offer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Offer{}, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Offer{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return Offer{Expired: true}, nil
+	}
+	return Offer{}, ErrUnknown
+}
@@ -0,0 +1,355 @@
+// Package storage keeps files (restaurant images, export files) in an
+// S3-compatible bucket or a local directory behind one interface.
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a key with no object.
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps objects under slash-separated keys. Put returns the URL public
+// objects (images) are served from; SignedURL returns a time-limited link
+// for private ones (exports, staged files) that works without credentials.
+type Store interface {
+	Put(key, contentType string, data []byte) (string, error)
+	// Get returns the object's contents and content type; the caller closes
+	// the reader.
+	Get(key string) (io.ReadCloser, string, error)
+	SignedURL(key string, ttl time.Duration) (string, error)
+	Delete(key string) error
+}
+
+// FromEnv configures a Store. STORAGE_BACKEND picks one explicitly (s3 or
+// local); otherwise S3_BUCKET selects S3 and STORAGE_DIR a local directory:
+//   - s3: S3_BUCKET, S3_ENDPOINT, S3_REGION, S3_ACCESS_KEY_ID and
+//     S3_SECRET_ACCESS_KEY address any S3-compatible bucket (AWS, R2, MinIO);
+//   - local: STORAGE_DIR (or IMAGE_STORE_DIR) is written to directly, and
+//     signed URLs point at /api/files, which verifies them with
+//     STORAGE_SIGNING_SECRET (random per process if unset).
+//
+// STORAGE_PUBLIC_URL is the base URL stored keys are served from. It returns
+// nil when no storage is configured.
+func FromEnv() Store {
+	publicURL := strings.TrimSuffix(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = os.Getenv("IMAGE_STORE_DIR")
+	}
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" && os.Getenv("S3_BUCKET") != "" {
+		backend = "s3"
+	} else if backend == "" && dir != "" {
+		backend = "local"
+	}
+
+	switch backend {
+	case "s3", "minio":
+		bucket := os.Getenv("S3_BUCKET")
+		if bucket == "" {
+			return nil
+		}
+		endpoint := strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/")
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+		if publicURL == "" {
+			publicURL = endpoint + "/" + bucket
+		}
+		return &s3Store{
+			endpoint:  endpoint,
+			bucket:    bucket,
+			region:    region,
+			accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			publicURL: publicURL,
+			http:      &http.Client{Timeout: 30 * time.Second},
+		}
+	case "local":
+		if dir == "" || publicURL == "" {
+			return nil
+		}
+		return &dirStore{dir: dir, publicURL: publicURL}
+	}
+	return nil
+}
+
+// dirStore writes objects to a directory served by a static file host.
+type dirStore struct {
+	dir       string
+	publicURL string
+}
+
+// path maps key into the directory, refusing keys that would escape it.
+func (s *dirStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(key))
+	if clean == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s *dirStore) Put(key, contentType string, data []byte) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return s.publicURL + "/" + key, nil
+}
+
+func (s *dirStore) Get(key string) (io.ReadCloser, string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, contentType, nil
+}
+
+// SignedURL links to the API's file route, which checks the signature
+// before serving the object with Get.
+func (s *dirStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	expires := time.Now().Add(ttl).Unix()
+	q := url.Values{"expires": {strconv.FormatInt(expires, 10)}, "signature": {fileSignature(key, expires)}}
+	return FilesPath + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+func (s *dirStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// FilesPath is the API route serving local objects through signed URLs.
+const FilesPath = "/api/files"
+
+var signingKey = loadSigningKey()
+
+func loadSigningKey() []byte {
+	if k := os.Getenv("STORAGE_SIGNING_SECRET"); k != "" {
+		return []byte(k)
+	}
+	k := make([]byte, 32)
+	rand.Read(k)
+	return k
+}
+
+func fileSignature(key string, expires int64) string {
+	return hex.EncodeToString(hmacSHA256(signingKey, key+"\n"+strconv.FormatInt(expires, 10)))
+}
+
+// VerifySignedURL reports whether expires and signature, from a URL made by
+// a local store's SignedURL, are valid for key and not yet expired.
+func VerifySignedURL(key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(fileSignature(key, exp)))
+}
+
+// s3Store uploads with a path-style PUT signed with AWS Signature Version 4.
+type s3Store struct {
+	endpoint, bucket, region string
+	accessKey, secretKey     string
+	publicURL                string
+	http                     *http.Client
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+var emptyPayloadHash = sha256Hex(nil)
+
+func (s *s3Store) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+}
+
+func (s *s3Store) Put(key, contentType string, data []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, sha256Hex(data), time.Now().UTC())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("object upload failed: %s: %s", resp.Status, body)
+	}
+	return s.publicURL + "/" + key, nil
+}
+
+func (s *s3Store) Get(key string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	s.sign(req, emptyPayloadHash, time.Now().UTC())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("object download failed: %s: %s", resp.Status, body)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *s3Store) Delete(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptyPayloadHash, time.Now().UTC())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("object delete failed: %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL (Signature Version 4 query
+// authentication), valid for ttl up to the 7 days S3 allows.
+func (s *s3Store) SignedURL(key string, ttl time.Duration) (string, error) {
+	return s.presign(s.objectURL(key), ttl, time.Now().UTC())
+}
+
+func (s *s3Store) presign(objectURL string, ttl time.Duration, now time.Time) (string, error) {
+	u, err := url.Parse(objectURL)
+	if err != nil {
+		return "", err
+	}
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), s.region)
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(min(ttl, 7*24*time.Hour).Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	query := strings.ReplaceAll(q.Encode(), "+", "%20")
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		query,
+		"host:" + u.Host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = query + "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String(), nil
+}
+
+// sign adds Signature Version 4 headers to req, whose body hashes to
+// payloadHash.
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var names, lines []string
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		names, lines = append(names, "content-type"), append(lines, "content-type:"+ct)
+	}
+	names = append(names, "host", "x-amz-content-sha256", "x-amz-date")
+	lines = append(lines, "host:"+req.URL.Host, "x-amz-content-sha256:"+payloadHash, "x-amz-date:"+amzDate)
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		(&url.URL{Path: req.URL.Path}).EscapedPath(),
+		"",
+		strings.Join(lines, "\n"),
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), s.region)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, s.signature(now, canonical)))
+}
+
+// signature signs a canonical request made at now.
+func (s *s3Store) signature(now time.Time, canonical string) string {
+	day := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, s.region)
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,149 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"eazyfind/middleware"
+)
+
+// client holds the parsed DSN. It is nil when SENTRY_DSN is unset, which turns
+// every capture into a no-op.
+var client *sentryClient
+
+type sentryClient struct {
+	endpoint    string
+	authHeader  string
+	release     string
+	environment string
+	http        *http.Client
+}
+
+// Init configures error tracking from SENTRY_DSN, SENTRY_RELEASE and
+// SENTRY_ENVIRONMENT. Any Sentry-compatible ingest (Sentry, GlitchTip) works.
+func Init() {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		log.Println("Invalid SENTRY_DSN, error tracking disabled")
+		return
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := path[:i+1], path[i+1:]
+	if project == "" {
+		log.Println("SENTRY_DSN has no project id, error tracking disabled")
+		return
+	}
+
+	env := os.Getenv("SENTRY_ENVIRONMENT")
+	if env == "" {
+		env = "production"
+	}
+
+	client = &sentryClient{
+		endpoint:    fmt.Sprintf("%s://%s/%sapi/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		authHeader:  fmt.Sprintf("Sentry sentry_version=7, sentry_client=eazyfind/1.0, sentry_key=%s", u.User.Username()),
+		release:     os.Getenv("SENTRY_RELEASE"),
+		environment: env,
+		http:        &http.Client{Timeout: 5 * time.Second},
+	}
+	log.Printf("Error tracking enabled (environment: %s, release: %s)", client.environment, client.release)
+}
+
+// Capture reports err with optional tags. It never blocks the caller.
+func Capture(err error, tags map[string]string) {
+	capture(err, tags, nil, nil)
+}
+
+// CaptureRequest reports err along with the request method, path, query and id.
+func CaptureRequest(r *http.Request, err error) {
+	capture(err, map[string]string{"request_id": middleware.GetRequestID(r.Context())}, r, nil)
+}
+
+// Reporter adapts the tracker to middleware.Recover.
+type Reporter struct{}
+
+// Report implements middleware.Reporter.
+func (Reporter) Report(r *http.Request, err error, stack []byte) {
+	capture(err, map[string]string{"request_id": middleware.GetRequestID(r.Context()), "panic": "true"}, r, stack)
+}
+
+func capture(err error, tags map[string]string, r *http.Request, stack []byte) {
+	if client == nil || err == nil {
+		return
+	}
+
+	event := map[string]interface{}{
+		"event_id":    newEventID(),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"platform":    "go",
+		"level":       "error",
+		"environment": client.environment,
+		"tags":        tags,
+		"exception": map[string]interface{}{
+			"values": []map[string]string{{"type": fmt.Sprintf("%T", err), "value": err.Error()}},
+		},
+	}
+	if client.release != "" {
+		event["release"] = client.release
+	}
+	if r != nil {
+		event["request"] = map[string]string{
+			"method":       r.Method,
+			"url":          r.URL.Path,
+			"query_string": r.URL.RawQuery,
+		}
+	}
+	if stack != nil {
+		event["extra"] = map[string]string{"stack": string(stack)}
+	}
+
+	go client.send(event)
+}
+
+func (c *sentryClient) send(event map[string]interface{}) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q}`+"\n", event["event_id"])
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.authHeader)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		log.Println("Error tracker send failed:", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
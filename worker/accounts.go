@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"eazyfind/scheduler"
+)
+
+// AccountPurgeSchedule controls how often accounts past their deletion grace
+// period are purged.
+const AccountPurgeSchedule = "@daily"
+
+// StartAccountPurge schedules removal of the data of users whose deletion
+// grace period has passed.
+func StartAccountPurge(db *sql.DB) {
+	scheduler.Register(scheduler.Job{
+		Name:   "account-purge",
+		Spec:   AccountPurgeSchedule,
+		Jitter: 30 * time.Minute,
+		Run: func() {
+			rows, err := db.Query("SELECT user_id FROM account_deletions WHERE purged_at IS NULL AND purge_after <= now() ORDER BY purge_after")
+			if err != nil {
+				log.Println("Account purge error:", err)
+				return
+			}
+			var users []string
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err == nil {
+					users = append(users, id)
+				}
+			}
+			rows.Close()
+
+			purged := 0
+			for _, id := range users {
+				if err := purgeAccount(db, id); err != nil {
+					log.Println("Account purge error:", err)
+					continue
+				}
+				purged++
+			}
+			if purged > 0 {
+				log.Printf("Purged data of %d deleted accounts", purged)
+			}
+		},
+	})
+}
+
+// purgeAccount deletes a user's recent searches and replaces their id on
+// vouchers, coupon reveals and impersonation tokens with a random pseudonym,
+// so redemption counts and the support audit trail survive but no longer
+// point at the user.
+func purgeAccount(db *sql.DB, userID string) error {
+	raw := make([]byte, 12)
+	rand.Read(raw)
+	pseudonym := "deleted:" + hex.EncodeToString(raw)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"UPDATE coupon_reveals SET user_id = $2 WHERE user_id = $1",
+		"UPDATE vouchers SET user_id = $2 WHERE user_id = $1",
+		"UPDATE impersonation_tokens SET user_id = $2, revoked_at = COALESCE(revoked_at, now()) WHERE user_id = $1",
+	} {
+		if _, err := tx.Exec(stmt, userID, pseudonym); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM recent_searches WHERE owner = $1", "user:"+userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE account_deletions SET purged_at = now() WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
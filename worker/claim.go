@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"eazyfind/tracker"
+)
+
+// GeoClaimTimeout is how long a row may stay IN_PROGRESS before the reaper
+// assumes its worker died and returns it to PENDING.
+const GeoClaimTimeout = 10 * time.Minute
+
+// geoClaim is a row claimed for geocoding.
+type geoClaim struct {
+	id            int64
+	name, city    string
+	area, address string
+}
+
+// claimPending atomically moves up to limit PENDING rows of table to
+// IN_PROGRESS and returns them. SKIP LOCKED lets overlapping runs and other
+// instances claim disjoint rows. The rows are read in full before returning
+// so the claim commits before any of them is updated. table and cols are
+// compile-time constants supplied by the caller; cols must yield id, name, city, area and address.
+func claimPending(db *sql.DB, table, cols string, limit int) ([]geoClaim, error) {
+	rows, err := db.Query(`
+		UPDATE `+table+` SET geo_status = 'IN_PROGRESS', geo_claimed_at = now()
+		WHERE id IN (
+			SELECT id FROM `+table+` WHERE geo_status = 'PENDING'
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+cols, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claims []geoClaim
+	for rows.Next() {
+		var c geoClaim
+		if err := rows.Scan(&c.id, &c.name, &c.city, &c.area, &c.address); err != nil {
+			return claims, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// Geocoding error codes recorded in last_geo_error. Other errors are stored
+// as their message.
+const (
+	GeoErrorZeroResults = "ZERO_RESULTS"
+	GeoErrorOverLimit   = "OVER_QUERY_LIMIT"
+	GeoErrorTimeout     = "TIMEOUT"
+)
+
+// permanentGeoErrors will not succeed on retry, so rows failing with them
+// are marked FAILED until an admin requeues them.
+var permanentGeoErrors = map[string]bool{
+	GeoErrorZeroResults: true,
+	"INVALID_REQUEST":   true,
+}
+
+// failClaim records why geocoding a claimed row failed. Rows with a permanent
+// error are marked FAILED; others return to PENDING for a later run.
+func failClaim(db *sql.DB, table string, id int64, cause error) {
+	code := geoErrorCode(cause)
+	status := "PENDING"
+	if permanentGeoErrors[code] {
+		status = "FAILED"
+	}
+	_, err := db.Exec(`UPDATE `+table+` SET geo_status = $2, geo_claimed_at = NULL, last_geo_error = $3, last_geo_attempt_at = now()
+		WHERE id = $1 AND geo_status = 'IN_PROGRESS'`, id, status, code)
+	if err != nil {
+		log.Printf("Failed to release %s %d: %v", table, id, err)
+		tracker.Capture(err, map[string]string{"worker": "geocoding", "table": table, "id": strconv.FormatInt(id, 10)})
+	}
+}
+
+// geoErrorCode classifies a geocoding error: the API status where there is
+// one, TIMEOUT for timeouts, or else the message without the request URL,
+// which carries the API key.
+func geoErrorCode(err error) string {
+	var status apiStatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNoGeocodeResults):
+		return GeoErrorZeroResults
+	case errors.Is(err, errThrottled):
+		return GeoErrorOverLimit
+	case errors.As(err, &status):
+		return string(status)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return GeoErrorTimeout
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return err.Error()
+}
+
+// releaseClaim returns a claimed row to PENDING so a later run retries it.
+func releaseClaim(db *sql.DB, table string, id int64) {
+	_, err := db.Exec("UPDATE "+table+" SET geo_status = 'PENDING', geo_claimed_at = NULL WHERE id = $1 AND geo_status = 'IN_PROGRESS'", id)
+	if err != nil {
+		log.Printf("Failed to release %s %d: %v", table, id, err)
+		tracker.Capture(err, map[string]string{"worker": "geocoding", "table": table, "id": strconv.FormatInt(id, 10)})
+	}
+}
+
+// reapStaleClaims returns rows whose claim has outlived GeoClaimTimeout to
+// PENDING, recovering work from crashed or restarted instances.
+func reapStaleClaims(db *sql.DB) {
+	for _, table := range []string{"cities", "restaurants"} {
+		res, err := db.Exec(`
+			UPDATE `+table+` SET geo_status = 'PENDING', geo_claimed_at = NULL
+			WHERE geo_status = 'IN_PROGRESS' AND geo_claimed_at < now() - make_interval(secs => $1)`, GeoClaimTimeout.Seconds())
+		if err != nil {
+			log.Printf("Stale claim reaper error (%s): %v", table, err)
+			tracker.Capture(err, map[string]string{"worker": "geocoding", "table": table})
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Returned %d stale %s geocoding claims to PENDING", n, table)
+		}
+	}
+}
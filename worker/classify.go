@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"eazyfind/classify"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	CuisineClassifySchedule = "30 3 * * *"
+	CuisineClassifyBatch    = 200
+	CuisineClassifyMaxRun   = 5000
+	// CuisineProposalMinConfidence drops weaker proposals rather than
+	// queueing them for review.
+	CuisineProposalMinConfidence = 0.5
+)
+
+// StartCuisineClassifier schedules a nightly job proposing cuisines for
+// restaurants with none linked. When CUISINE_MODEL_URL is set, that model is
+// consulted alongside the keyword rules.
+func StartCuisineClassifier(db *sql.DB) {
+	if url := os.Getenv("CUISINE_MODEL_URL"); url != "" {
+		classify.Register(classify.NewModel(url))
+		log.Println("Cuisine classifier using model at", url)
+	}
+	scheduler.Register(scheduler.Job{
+		Name:   "cuisine-classifier",
+		Spec:   CuisineClassifySchedule,
+		Jitter: 10 * time.Minute,
+		Run: func() {
+			c, err := loadCuisineClassifier(db)
+			if err != nil {
+				log.Println("Cuisine classifier setup error:", err)
+				tracker.Capture(err, map[string]string{"worker": "cuisine-classifier"})
+				return
+			}
+			for done := 0; done < CuisineClassifyMaxRun; done += CuisineClassifyBatch {
+				if c.run(db) < CuisineClassifyBatch {
+					return
+				}
+			}
+		},
+	})
+}
+
+// cuisineClassifier holds the rules for one run and the ids of the cuisines
+// they may propose, keyed by lowercased name.
+type cuisineClassifier struct {
+	rules *classify.Rules
+	ids   map[string]int64
+}
+
+func loadCuisineClassifier(db *sql.DB) (*cuisineClassifier, error) {
+	rows, err := db.Query("SELECT id, cuisine_name FROM cuisines WHERE cuisine_name IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]int64{}
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err == nil {
+			ids[strings.ToLower(strings.TrimSpace(name))] = id
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT term, canonical FROM synonyms")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	synonyms := map[string]string{}
+	for rows.Next() {
+		var term, canonical string
+		if err := rows.Scan(&term, &canonical); err == nil {
+			synonyms[term] = canonical
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &cuisineClassifier{rules: classify.NewRules(names, synonyms), ids: ids}, nil
+}
+
+type unclassified struct {
+	id    int64
+	input classify.Input
+}
+
+// run classifies one batch of restaurants without cuisines that changed
+// since they were last classified, queueing proposals as pending. Proposals
+// already reviewed are left alone. Returns the number of restaurants seen.
+func (c *cuisineClassifier) run(db *sql.DB) int {
+	rows, err := db.Query(`
+		SELECT r.id, r.restaurant_name, COALESCE(r.offer, '')
+		FROM restaurants r
+		WHERE r.is_duplicate = false
+		  AND (r.cuisines_classified_at IS NULL OR r.cuisines_classified_at < r.updated_at)
+		  AND NOT EXISTS (SELECT 1 FROM restaurant_cuisines rc WHERE rc.restaurant_id = r.id)
+		ORDER BY r.id
+		LIMIT $1
+	`, CuisineClassifyBatch)
+	if err != nil {
+		log.Println("Cuisine classifier query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "cuisine-classifier"})
+		return 0
+	}
+	var batch []unclassified
+	for rows.Next() {
+		var u unclassified
+		if err := rows.Scan(&u.id, &u.input.Name, &u.input.Text); err == nil {
+			batch = append(batch, u)
+		}
+	}
+	rows.Close()
+
+	proposed := 0
+	for _, u := range batch {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		proposals, err := classify.Classify(ctx, c.rules, u.input)
+		cancel()
+		if err != nil {
+			log.Printf("Cuisine classifier error for restaurant %d: %v", u.id, err)
+			tracker.Capture(err, map[string]string{"worker": "cuisine-classifier"})
+		}
+		for _, p := range proposals {
+			id, ok := c.ids[strings.ToLower(strings.TrimSpace(p.Cuisine))]
+			if !ok || p.Confidence < CuisineProposalMinConfidence {
+				continue
+			}
+			_, err := db.Exec(`
+				INSERT INTO cuisine_proposals (restaurant_id, cuisine_id, confidence, source)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (restaurant_id, cuisine_id) DO UPDATE
+				SET confidence = EXCLUDED.confidence, source = EXCLUDED.source, created_at = now()
+				WHERE cuisine_proposals.status = 'pending'
+			`, u.id, id, p.Confidence, p.Source)
+			if err != nil {
+				log.Println("Cuisine proposal insert error:", err)
+				continue
+			}
+			proposed++
+		}
+		if _, err := db.Exec("UPDATE restaurants SET cuisines_classified_at = now() WHERE id = $1", u.id); err != nil {
+			log.Println("Cuisine classifier update error:", err)
+		}
+	}
+	if len(batch) > 0 {
+		log.Printf("Cuisine classifier: %d restaurants, %d proposals", len(batch), proposed)
+	}
+	return len(batch)
+}
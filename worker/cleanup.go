@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"eazyfind/middleware"
+	"eazyfind/scheduler"
+)
+
+// SessionCleanupSchedule controls how often expired session activity is pruned.
+const SessionCleanupSchedule = "@hourly"
+
+// StartSessionCleanup schedules deletion of anonymous session activity and
+// recent searches older than the session retention window.
+func StartSessionCleanup(db *sql.DB) {
+	scheduler.Register(scheduler.Job{
+		Name:   "session-cleanup",
+		Spec:   SessionCleanupSchedule,
+		Jitter: 5 * time.Minute,
+		Run: func() {
+			res, err := db.Exec("DELETE FROM session_activity WHERE created_at < now() - make_interval(secs => $1)", middleware.SessionMaxAge.Seconds())
+			if err != nil {
+				log.Println("Session cleanup error:", err)
+				return
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				log.Printf("Pruned %d expired session activity rows", n)
+			}
+			// Signed-in users keep their history; anonymous sessions expire.
+			res, err = db.Exec("DELETE FROM recent_searches WHERE owner LIKE 'session:%' AND searched_at < now() - make_interval(secs => $1)", middleware.SessionMaxAge.Seconds())
+			if err != nil {
+				log.Println("Session cleanup error:", err)
+				return
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				log.Printf("Pruned %d expired session recent searches", n)
+			}
+		},
+	})
+}
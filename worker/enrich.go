@@ -0,0 +1,282 @@
+package worker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"eazyfind/outbound"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	EnrichmentBatchSize = 20
+	EnrichmentSchedule  = "* * * * *"
+	// DefaultPlacesBudget is the number of Places API calls allowed per day
+	// when PLACES_DAILY_BUDGET is unset. Each restaurant costs two calls.
+	DefaultPlacesBudget = 1000
+
+	// SourcePlaces marks fields filled in from the Places API.
+	SourcePlaces = "google_places"
+)
+
+// EnrichmentHealth reports Places enrichment progress since process start.
+type EnrichmentHealth struct {
+	Enriched   int64 `json:"enriched"`
+	NotFound   int64 `json:"not_found"`
+	Failed     int64 `json:"failed"`
+	BudgetUsed int64 `json:"budget_used_today"`
+	Budget     int64 `json:"daily_budget"`
+}
+
+var (
+	enrichedCount atomic.Int64
+	notFoundCount atomic.Int64
+	enrichFailed  atomic.Int64
+
+	placesBudget = envBudget()
+	budgetMu     sync.Mutex
+	budgetDay    string
+	budgetUsed   int64
+)
+
+func envBudget() int64 {
+	if v := os.Getenv("PLACES_DAILY_BUDGET"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("Invalid PLACES_DAILY_BUDGET=%q, using %d", v, DefaultPlacesBudget)
+	}
+	return DefaultPlacesBudget
+}
+
+// GetEnrichmentHealth returns the enrichment counters and today's budget use.
+func GetEnrichmentHealth() EnrichmentHealth {
+	budgetMu.Lock()
+	used := budgetUsed
+	if budgetDay != time.Now().UTC().Format("2006-01-02") {
+		used = 0
+	}
+	budgetMu.Unlock()
+	return EnrichmentHealth{
+		Enriched:   enrichedCount.Load(),
+		NotFound:   notFoundCount.Load(),
+		Failed:     enrichFailed.Load(),
+		BudgetUsed: used,
+		Budget:     placesBudget,
+	}
+}
+
+// spendBudget reserves n Places calls from today's budget, returning false
+// when the budget is exhausted.
+func spendBudget(n int64) bool {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	if today := time.Now().UTC().Format("2006-01-02"); budgetDay != today {
+		budgetDay, budgetUsed = today, 0
+	}
+	if budgetUsed+n > placesBudget {
+		return false
+	}
+	budgetUsed += n
+	return true
+}
+
+// placeDetails is the subset of a Places Details result we store.
+type placeDetails struct {
+	PlaceID     string
+	Phone       string
+	Website     string
+	PriceLevel  *int
+	WeekdayText []string
+}
+
+// StartEnrichmentWorker schedules a job that fills phone, website, price level and
+// opening hours for geocoded restaurants from the Places API. Only blank
+// fields are filled, and each one is recorded in field_sources.
+func StartEnrichmentWorker(db *sql.DB) {
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	if apiKey == "" {
+		log.Println("GOOGLE_MAPS_API_KEY not set, skipping Places enrichment")
+		return
+	}
+	log.Printf("Registering Places enrichment worker (Batch: %d, Daily budget: %d calls)", EnrichmentBatchSize, placesBudget)
+	scheduler.Register(scheduler.Job{
+		Name:   "enrichment",
+		Spec:   EnrichmentSchedule,
+		Jitter: 10 * time.Second,
+		Run:    func() { enrichRestaurants(db, apiKey) },
+	})
+}
+
+func enrichRestaurants(db *sql.DB, apiKey string) {
+	rows, err := db.Query(`
+		SELECT id, restaurant_name, city, latitude, longitude,
+		       COALESCE(phone, ''), COALESCE(website, ''), price_level IS NOT NULL, opening_hours IS NOT NULL
+		FROM restaurants
+		WHERE geo_status = 'RESOLVED' AND enrichment_status IS NULL AND is_duplicate = false
+		ORDER BY id
+		LIMIT $1`, EnrichmentBatchSize)
+	if err != nil {
+		log.Println("Enrichment query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "enrichment"})
+		return
+	}
+
+	type pending struct {
+		id                 int64
+		name, city         string
+		lat, lon           float64
+		phone, website     string
+		hasPrice, hasHours bool
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.name, &p.city, &p.lat, &p.lon, &p.phone, &p.website, &p.hasPrice, &p.hasHours); err == nil {
+			batch = append(batch, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range batch {
+		if !spendBudget(2) {
+			log.Println("Places daily budget exhausted, pausing enrichment until tomorrow")
+			return
+		}
+
+		details, err := fetchPlaceDetails(p.name, p.city, p.lat, p.lon, apiKey)
+		if errors.Is(err, outbound.ErrCircuitOpen) {
+			log.Println("Places API circuit open, pausing enrichment")
+			return
+		}
+		status := "ENRICHED"
+		switch {
+		case err == errPlaceNotFound:
+			status = "NOT_FOUND"
+			notFoundCount.Add(1)
+		case err != nil:
+			log.Printf("Places enrichment failed for [%d] %s: %v", p.id, p.name, err)
+			status = "FAILED"
+			enrichFailed.Add(1)
+		}
+		if details == nil {
+			details = &placeDetails{}
+		}
+
+		// Only blank fields are filled; record where each new value came from.
+		sources := map[string]string{}
+		if p.phone == "" && details.Phone != "" {
+			sources["phone"] = SourcePlaces
+		}
+		if p.website == "" && details.Website != "" {
+			sources["website"] = SourcePlaces
+		}
+		if !p.hasPrice && details.PriceLevel != nil {
+			sources["price_level"] = SourcePlaces
+		}
+		var hours interface{}
+		if !p.hasHours && len(details.WeekdayText) > 0 {
+			sources["opening_hours"] = SourcePlaces
+			b, _ := json.Marshal(details.WeekdayText)
+			hours = string(b)
+		}
+		var price sql.NullInt64
+		if details.PriceLevel != nil {
+			price = sql.NullInt64{Int64: int64(*details.PriceLevel), Valid: true}
+		}
+		sourcesJSON, _ := json.Marshal(sources)
+
+		_, err = db.Exec(`
+			UPDATE restaurants SET
+				phone = COALESCE(NULLIF(phone, ''), NULLIF($1, '')),
+				website = COALESCE(NULLIF(website, ''), NULLIF($2, '')),
+				price_level = COALESCE(price_level, $3),
+				opening_hours = COALESCE(opening_hours, $4::jsonb),
+				google_place_id = COALESCE(NULLIF($5, ''), google_place_id),
+				field_sources = COALESCE(field_sources, '{}'::jsonb) || $6::jsonb,
+				enrichment_status = $7,
+				enriched_at = now()
+			WHERE id = $8
+		`, details.Phone, details.Website, price, hours, details.PlaceID, string(sourcesJSON), status, p.id)
+		if err != nil {
+			log.Printf("Failed to store enrichment for restaurant %d: %v", p.id, err)
+			tracker.Capture(err, map[string]string{"worker": "enrichment", "id": strconv.FormatInt(p.id, 10)})
+			continue
+		}
+		if status == "ENRICHED" {
+			enrichedCount.Add(1)
+		}
+	}
+}
+
+var errPlaceNotFound = fmt.Errorf("no matching place")
+
+// fetchPlaceDetails finds the place nearest the restaurant's coordinates and
+// loads its contact details and opening hours.
+func fetchPlaceDetails(name, city string, lat, lon float64, apiKey string) (*placeDetails, error) {
+	findURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/place/findplacefromtext/json?input=%s&inputtype=textquery&fields=place_id&locationbias=%s&key=%s",
+		url.QueryEscape(name+", "+city), url.QueryEscape(fmt.Sprintf("circle:200@%f,%f", lat, lon)), url.QueryEscape(apiKey))
+	var found struct {
+		Candidates []struct {
+			PlaceID string `json:"place_id"`
+		} `json:"candidates"`
+		Status string `json:"status"`
+	}
+	if err := getJSON(googleClient, findURL, &found); err != nil {
+		return nil, err
+	}
+	if found.Status == "ZERO_RESULTS" || len(found.Candidates) == 0 {
+		return nil, errPlaceNotFound
+	}
+	if found.Status != "OK" {
+		return nil, fmt.Errorf("find place API error: %s", found.Status)
+	}
+
+	placeID := found.Candidates[0].PlaceID
+	detailsURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/place/details/json?place_id=%s&fields=formatted_phone_number,website,price_level,opening_hours&key=%s",
+		url.QueryEscape(placeID), url.QueryEscape(apiKey))
+	var details struct {
+		Result struct {
+			Phone        string `json:"formatted_phone_number"`
+			Website      string `json:"website"`
+			PriceLevel   *int   `json:"price_level"`
+			OpeningHours struct {
+				WeekdayText []string `json:"weekday_text"`
+			} `json:"opening_hours"`
+		} `json:"result"`
+		Status string `json:"status"`
+	}
+	if err := getJSON(googleClient, detailsURL, &details); err != nil {
+		return nil, err
+	}
+	if details.Status != "OK" {
+		return nil, fmt.Errorf("place details API error: %s", details.Status)
+	}
+
+	return &placeDetails{
+		PlaceID:     placeID,
+		Phone:       details.Result.Phone,
+		Website:     details.Result.Website,
+		PriceLevel:  details.Result.PriceLevel,
+		WeekdayText: details.Result.OpeningHours.WeekdayText,
+	}, nil
+}
+
+func getJSON(client *outbound.Client, apiURL string, v interface{}) error {
+	resp, err := client.Get(apiURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eazyfind/outbound"
+	"eazyfind/scheduler"
+	"eazyfind/storage"
+	"eazyfind/tracker"
+)
+
+const (
+	ImageBatchSize = 20
+	ImageSchedule  = "*/5 * * * *"
+	// MaxImageBytes bounds a downloaded photo.
+	MaxImageBytes = 5 << 20
+	// ImageMaxWidth is the width requested from the Place Photo API.
+	ImageMaxWidth = 800
+)
+
+// photoClient downloads Place photos, which are larger than API responses.
+var photoClient = outbound.New(15*time.Second, 1)
+
+// StartImageWorker fills image_url for restaurants that have none: a Places
+// photo copied into object storage when one is available, otherwise a generic
+// placeholder for the restaurant's cuisine from IMAGE_PLACEHOLDER_BASE_URL.
+func StartImageWorker(db *sql.DB) {
+	store := storage.FromEnv()
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	placeholderBase := strings.TrimSuffix(os.Getenv("IMAGE_PLACEHOLDER_BASE_URL"), "/")
+	if (store == nil || apiKey == "") && placeholderBase == "" {
+		log.Println("No image storage or placeholder set configured, skipping image worker")
+		return
+	}
+	log.Printf("Registering image worker (Batch: %d)", ImageBatchSize)
+	scheduler.Register(scheduler.Job{
+		Name:   "images",
+		Spec:   ImageSchedule,
+		Jitter: 30 * time.Second,
+		Run:    func() { fillMissingImages(db, store, apiKey, placeholderBase) },
+	})
+}
+
+func fillMissingImages(db *sql.DB, store storage.Store, apiKey, placeholderBase string) {
+	// With Places access, wait for enrichment so the place id is known.
+	rows, err := db.Query(`
+		SELECT r.id, COALESCE(r.google_place_id, ''),
+		       COALESCE((SELECT c.cuisine_name FROM restaurant_cuisines rc JOIN cuisines c ON c.id = rc.cuisine_id
+		                 WHERE rc.restaurant_id = r.id ORDER BY c.id LIMIT 1), '')
+		FROM restaurants r
+		WHERE COALESCE(r.image_url, '') = '' AND r.image_status IS NULL AND r.is_duplicate = false
+		  AND ($2 OR r.enrichment_status IS NOT NULL)
+		ORDER BY r.id
+		LIMIT $1`, ImageBatchSize, store == nil || apiKey == "")
+	if err != nil {
+		log.Println("Image worker query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "images"})
+		return
+	}
+
+	type pending struct {
+		id               int64
+		placeID, cuisine string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.placeID, &p.cuisine); err == nil {
+			batch = append(batch, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range batch {
+		imageURL, attribution, source, status := "", "", "", "MISSING"
+		if p.placeID != "" && store != nil && apiKey != "" && spendBudget(2) {
+			u, attr, err := storePlacePhoto(store, p.id, p.placeID, apiKey)
+			if errors.Is(err, outbound.ErrCircuitOpen) {
+				// Try again once the API recovers rather than settle for a placeholder.
+				return
+			}
+			if err != nil {
+				log.Printf("Photo fetch failed for restaurant %d: %v", p.id, err)
+			} else if u != "" {
+				imageURL, attribution, source, status = u, attr, SourcePlaces, "STORED"
+			}
+		}
+		if imageURL == "" && placeholderBase != "" && p.cuisine != "" {
+			imageURL, source, status = placeholderBase+"/"+slug(p.cuisine)+".jpg", "placeholder", "PLACEHOLDER"
+		}
+
+		_, err := db.Exec(`
+			UPDATE restaurants
+			SET image_url = NULLIF($1, ''), image_attribution = NULLIF($2, ''), image_source = NULLIF($3, ''), image_status = $4
+			WHERE id = $5 AND COALESCE(image_url, '') = ''
+		`, imageURL, attribution, source, status, p.id)
+		if err != nil {
+			log.Printf("Failed to store image for restaurant %d: %v", p.id, err)
+			tracker.Capture(err, map[string]string{"worker": "images", "id": strconv.FormatInt(p.id, 10)})
+		}
+	}
+}
+
+// storePlacePhoto copies the first Places photo into storage, returning its
+// URL and the attribution HTML Google requires alongside it. An empty URL
+// means the place has no photos.
+func storePlacePhoto(store storage.Store, id int64, placeID, apiKey string) (string, string, error) {
+	detailsURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/place/details/json?place_id=%s&fields=photos&key=%s",
+		url.QueryEscape(placeID), url.QueryEscape(apiKey))
+	var details struct {
+		Result struct {
+			Photos []struct {
+				Reference        string   `json:"photo_reference"`
+				HTMLAttributions []string `json:"html_attributions"`
+			} `json:"photos"`
+		} `json:"result"`
+		Status string `json:"status"`
+	}
+	if err := getJSON(googleClient, detailsURL, &details); err != nil {
+		return "", "", err
+	}
+	if details.Status != "OK" {
+		return "", "", fmt.Errorf("place details API error: %s", details.Status)
+	}
+	if len(details.Result.Photos) == 0 {
+		return "", "", nil
+	}
+	photo := details.Result.Photos[0]
+
+	photoURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/place/photo?maxwidth=%d&photo_reference=%s&key=%s",
+		ImageMaxWidth, url.QueryEscape(photo.Reference), url.QueryEscape(apiKey))
+	resp, err := photoClient.Get(photoURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("photo download failed: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", "", fmt.Errorf("unexpected photo content type %q", contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageBytes+1))
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) > MaxImageBytes {
+		return "", "", fmt.Errorf("photo exceeds %d bytes", MaxImageBytes)
+	}
+
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	stored, err := store.Put(fmt.Sprintf("restaurants/%d%s", id, ext), contentType, data)
+	if err != nil {
+		return "", "", err
+	}
+	return stored, strings.Join(photo.HTMLAttributions, " "), nil
+}
+
+// slug lowercases a cuisine name and replaces non-alphanumerics with hyphens,
+// e.g. "North Indian" -> "north-indian".
+func slug(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(s) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	LinkCheckSchedule    = "@hourly"
+	LinkSampleSize       = 200
+	LinkCheckConcurrency = 10
+	LinkCheckTimeout     = 10 * time.Second
+)
+
+// StartLinkChecker schedules a job that samples restaurant image and partner URLs,
+// records the ones that no longer resolve in dead_links, and clears entries
+// whose links have recovered.
+func StartLinkChecker(db *sql.DB) {
+	log.Printf("Registering link checker (Sample: %d, Concurrency: %d)", LinkSampleSize, LinkCheckConcurrency)
+	scheduler.Register(scheduler.Job{
+		Name:   "link-check",
+		Spec:   LinkCheckSchedule,
+		Jitter: 5 * time.Minute,
+		Run:    func() { checkLinks(db) },
+	})
+}
+
+type linkCheck struct {
+	restaurantID int64
+	field, url   string
+}
+
+func checkLinks(db *sql.DB) {
+	// Known-dead links are always rechecked so recoveries are noticed; the
+	// rest of the sample is random.
+	rows, err := db.Query(`
+		SELECT r.id, f.field, f.url
+		FROM restaurants r
+		CROSS JOIN LATERAL (VALUES ('image_url', r.image_url), ('url', r.url)) AS f(field, url)
+		WHERE r.is_duplicate = false AND f.url LIKE 'http%'
+		ORDER BY EXISTS (SELECT 1 FROM dead_links d WHERE d.restaurant_id = r.id AND d.field = f.field) DESC, random()
+		LIMIT $1`, LinkSampleSize)
+	if err != nil {
+		log.Println("Link checker query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "links"})
+		return
+	}
+	var checks []linkCheck
+	for rows.Next() {
+		var c linkCheck
+		if err := rows.Scan(&c.restaurantID, &c.field, &c.url); err == nil {
+			checks = append(checks, c)
+		}
+	}
+	rows.Close()
+
+	client := &http.Client{Timeout: LinkCheckTimeout}
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, LinkCheckConcurrency)
+	for _, c := range checks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(c linkCheck) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			status, err := probeLink(client, c.url)
+			if err == nil && status < 400 {
+				if _, err := db.Exec("DELETE FROM dead_links WHERE restaurant_id = $1 AND field = $2", c.restaurantID, c.field); err != nil {
+					log.Printf("Failed to clear dead link for restaurant %d: %v", c.restaurantID, err)
+				}
+				return
+			}
+
+			var statusCode sql.NullInt64
+			var errText sql.NullString
+			if err != nil {
+				errText = sql.NullString{String: err.Error(), Valid: true}
+			} else {
+				statusCode = sql.NullInt64{Int64: int64(status), Valid: true}
+			}
+			_, err = db.Exec(`
+				INSERT INTO dead_links (restaurant_id, field, url, status_code, error)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (restaurant_id, field) DO UPDATE SET
+					url = EXCLUDED.url, status_code = EXCLUDED.status_code, error = EXCLUDED.error,
+					failures = CASE WHEN dead_links.url = EXCLUDED.url THEN dead_links.failures + 1 ELSE 1 END,
+					first_failed_at = CASE WHEN dead_links.url = EXCLUDED.url THEN dead_links.first_failed_at ELSE now() END,
+					last_checked_at = now()
+			`, c.restaurantID, c.field, c.url, statusCode, errText)
+			if err != nil {
+				log.Printf("Failed to record dead link for restaurant %d: %v", c.restaurantID, err)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// probeLink issues a HEAD request, falling back to a GET for servers that
+// do not support HEAD. Only the status line is read.
+func probeLink(client *http.Client, url string) (int, error) {
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+		return resp.StatusCode, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err = client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
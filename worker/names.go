@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"eazyfind/maintenance"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	NameNormalizeSchedule = "* * * * *"
+	// NameNormalizeMaxRun bounds the batches of maintenance.BatchSize one run
+	// normalizes; the normalize-names task handles full backfills.
+	NameNormalizeMaxRun = 10
+)
+
+// StartNameNormalizer schedules normalization of newly scraped and renamed
+// restaurants' names, marking the ones that duplicate an existing restaurant.
+func StartNameNormalizer(db *sql.DB) {
+	scheduler.Register(scheduler.Job{
+		Name:   "name-normalization",
+		Spec:   NameNormalizeSchedule,
+		Jitter: 10 * time.Second,
+		Run: func() {
+			for i := 0; i < NameNormalizeMaxRun; i++ {
+				n, err := maintenance.NormalizeNewNames(context.Background(), db)
+				if err != nil {
+					log.Println("Name normalization error:", err)
+					tracker.Capture(err, map[string]string{"worker": "name-normalization"})
+					return
+				}
+				if n < maintenance.BatchSize {
+					return
+				}
+			}
+		},
+	})
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"eazyfind/deals"
+	"eazyfind/scheduler"
+	"eazyfind/sources"
+	"eazyfind/tracker"
+)
+
+const (
+	// OfferCheckSchedule runs validation nightly; each run works through
+	// stale offers in batches of OfferBatchSize, up to OfferMaxPerRun.
+	OfferCheckSchedule    = "@nightly"
+	OfferBatchSize        = 50
+	OfferMaxPerRun        = 5000
+	OfferCheckConcurrency = 5
+	// DefaultOfferMaxAgeDays is how old an offer may get before it is
+	// re-checked against its source, unless OFFER_MAX_AGE_DAYS says otherwise.
+	DefaultOfferMaxAgeDays = 7
+)
+
+// StartOfferValidator schedules a nightly re-check of the source listing of
+// restaurants whose offers have not been confirmed for OFFER_MAX_AGE_DAYS,
+// refreshing the offer and discount or clearing offers that have ended.
+func StartOfferValidator(db *sql.DB) {
+	maxAge := DefaultOfferMaxAgeDays
+	if v := os.Getenv("OFFER_MAX_AGE_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAge = n
+		} else {
+			log.Printf("Invalid OFFER_MAX_AGE_DAYS=%q, using %d", v, DefaultOfferMaxAgeDays)
+		}
+	}
+	log.Printf("Registering offer validator (Max age: %d days, Batch: %d)", maxAge, OfferBatchSize)
+	scheduler.Register(scheduler.Job{
+		Name:   "offer-validation",
+		Spec:   OfferCheckSchedule,
+		Jitter: 15 * time.Minute,
+		Run: func() {
+			for checked := 0; checked < OfferMaxPerRun; checked += OfferBatchSize {
+				if validateOffers(db, maxAge) < OfferBatchSize {
+					return
+				}
+			}
+		},
+	})
+}
+
+type staleOffer struct {
+	id         int64
+	url        string
+	costForTwo int
+}
+
+// validateOffers checks one batch of stale offers and returns its size.
+func validateOffers(db *sql.DB, maxAgeDays int) int {
+	rows, err := db.Query(`
+		SELECT id, url, COALESCE(cost_for_two, 0)
+		FROM restaurants
+		WHERE is_duplicate = false AND url LIKE 'http%'
+		  AND (COALESCE(offer, '') <> '' OR effective_discount > 0)
+		  AND COALESCE(offer_checked_at, last_scraped_at, updated_at) < now() - make_interval(days => $1)
+		ORDER BY COALESCE(offer_checked_at, last_scraped_at, updated_at) ASC
+		LIMIT $2`, maxAgeDays, OfferBatchSize)
+	if err != nil {
+		log.Println("Offer validator query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "offers"})
+		return 0
+	}
+	var batch []staleOffer
+	for rows.Next() {
+		var o staleOffer
+		if err := rows.Scan(&o.id, &o.url, &o.costForTwo); err == nil {
+			batch = append(batch, o)
+		}
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, OfferCheckConcurrency)
+	for _, o := range batch {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(o staleOffer) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := revalidateOffer(db, o); err != nil {
+				log.Printf("Failed to update offer for restaurant %d: %v", o.id, err)
+				tracker.Capture(err, map[string]string{"worker": "offers", "id": strconv.FormatInt(o.id, 10)})
+			}
+		}(o)
+	}
+	wg.Wait()
+	return len(batch)
+}
+
+func revalidateOffer(db *sql.DB, o staleOffer) error {
+	adapter := sources.For(o.url)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	offer, err := adapter.FetchOffer(ctx, o.url)
+
+	switch {
+	case err != nil:
+		// Unknown or unreachable: note the attempt so the row is not retried
+		// every tick, but keep the current offer.
+		if !errors.Is(err, sources.ErrUnknown) {
+			log.Printf("Offer check via %s failed for restaurant %d: %v", adapter.Name(), o.id, err)
+		}
+		_, err = db.Exec("UPDATE restaurants SET offer_checked_at = now() WHERE id = $1", o.id)
+		return err
+	case offer.Expired:
+		_, err = db.Exec(`
+			UPDATE restaurants
+			SET offer = NULL, percentage = NULL, effective_discount = 0, payment_methods = NULL,
+			    offer_expired_at = now(), offer_checked_at = now(), last_scraped_at = now()
+			WHERE id = $1`, o.id)
+		return err
+	default:
+		discount := deals.NormalizeDiscount(offer.Offer, offer.Percentage, o.costForTwo)
+		_, err = db.Exec(`
+			UPDATE restaurants
+			SET offer = NULLIF($1, ''), percentage = NULLIF($2, ''), effective_discount = $3,
+			    payment_methods = $4, offer_expired_at = NULL, offer_checked_at = now(), last_scraped_at = now()
+			WHERE id = $5`, offer.Offer, offer.Percentage, discount, pq.Array(deals.PaymentMethods(offer.Offer)), o.id)
+		return err
+	}
+}
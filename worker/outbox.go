@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"eazyfind/outbound"
+	"eazyfind/outbox"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	OutboxSchedule  = "@every 5s"
+	OutboxBatchSize = 100
+	// OutboxMaxRun bounds the batches one run dispatches.
+	OutboxMaxRun = 10
+)
+
+var webhookClient = outbound.New(10*time.Second, 0)
+
+// StartOutboxDispatcher schedules delivery of outbox events. With
+// OUTBOX_WEBHOOK_URL set, every event is also POSTed there as JSON, signed
+// with OUTBOX_WEBHOOK_SECRET when that is set.
+func StartOutboxDispatcher(db *sql.DB) {
+	if url := os.Getenv("OUTBOX_WEBHOOK_URL"); url != "" {
+		outbox.Handle("*", webhookHandler(url, os.Getenv("OUTBOX_WEBHOOK_SECRET")))
+	}
+	scheduler.Register(scheduler.Job{
+		Name:   "outbox",
+		Spec:   OutboxSchedule,
+		Jitter: time.Second,
+		Run: func() {
+			for i := 0; i < OutboxMaxRun; i++ {
+				n, err := outbox.Dispatch(context.Background(), db, OutboxBatchSize)
+				if err != nil {
+					log.Println("Outbox dispatch error:", err)
+					tracker.Capture(err, map[string]string{"worker": "outbox"})
+					return
+				}
+				if n < OutboxBatchSize {
+					return
+				}
+			}
+		},
+	})
+}
+
+// webhookHandler POSTs each event to url. The X-Outbox-Signature header is the
+// hex HMAC-SHA256 of the body under secret; receivers should deduplicate on
+// the event id, as a failed delivery is retried.
+func webhookHandler(url, secret string) outbox.Handler {
+	return func(ctx context.Context, e outbox.Event) error {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			req.Header.Set("X-Outbox-Signature", hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+const (
+	// LocalTimezone is the timezone for cities without their own; popular_times
+	// days and hours are kept in the city's local time.
+	LocalTimezone = "Asia/Kolkata"
+
+	PopularTimesSchedule = "0 4 * * *"
+	// PopularTimesMinClicks is the click volume over PopularTimesWindow a
+	// restaurant needs before its busy times are estimated.
+	PopularTimesMinClicks = 20
+	PopularTimesWindow    = "8 weeks"
+)
+
+// StartPopularTimesEstimator schedules a nightly job that estimates busy
+// times from outbound clicks for restaurants without imported ones.
+func StartPopularTimesEstimator(db *sql.DB) {
+	scheduler.Register(scheduler.Job{
+		Name:   "popular-times",
+		Spec:   PopularTimesSchedule,
+		Jitter: 5 * time.Minute,
+		Run:    func() { estimatePopularTimes(db) },
+	})
+}
+
+// estimatePopularTimes replaces every estimated popular_times row: each
+// restaurant's clicks per local weekday and hour, scaled so its busiest slot
+// is 100. Restaurants with imported busy times are left alone.
+func estimatePopularTimes(db *sql.DB) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Popular times estimate error:", err)
+		tracker.Capture(err, map[string]string{"worker": "popular-times"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM popular_times WHERE source = 'estimated'"); err == nil {
+		var res sql.Result
+		res, err = tx.Exec(`
+			WITH counts AS (
+				SELECT s.restaurant_id,
+				       EXTRACT(DOW FROM s.hour AT TIME ZONE COALESCE(ci.timezone, $1))::int AS day,
+				       EXTRACT(HOUR FROM s.hour AT TIME ZONE COALESCE(ci.timezone, $1))::int AS hr,
+				       SUM(s.clicks) AS n
+				FROM click_stats_hourly s
+				JOIN restaurants r ON r.id = s.restaurant_id
+				LEFT JOIN LATERAL (
+					SELECT timezone FROM cities WHERE city_name ILIKE r.city AND timezone IS NOT NULL LIMIT 1
+				) ci ON true
+				WHERE s.hour >= now() - $3::interval
+				GROUP BY 1, 2, 3
+			), eligible AS (
+				SELECT restaurant_id, MAX(n) AS peak FROM counts GROUP BY 1 HAVING SUM(n) >= $2
+			)
+			INSERT INTO popular_times (restaurant_id, day, hour, busyness, source)
+			SELECT c.restaurant_id, c.day, c.hr, ROUND(100.0 * c.n / e.peak), 'estimated'
+			FROM counts c JOIN eligible e USING (restaurant_id)
+			WHERE NOT EXISTS (SELECT 1 FROM popular_times p WHERE p.restaurant_id = c.restaurant_id AND p.source = 'import')
+		`, LocalTimezone, PopularTimesMinClicks, PopularTimesWindow)
+		if err == nil {
+			if n, _ := res.RowsAffected(); n > 0 {
+				log.Printf("Estimated %d popular time slots", n)
+			}
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Popular times estimate error:", err)
+		tracker.Capture(err, map[string]string{"worker": "popular-times"})
+	}
+}
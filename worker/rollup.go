@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
+)
+
+// RollupSchedule runs the analytics rollup a few minutes past each hour.
+const RollupSchedule = "5 * * * *"
+
+// StartAnalyticsRollup schedules an hourly job that aggregates outbound
+// clicks into click_stats_hourly.
+func StartAnalyticsRollup(db *sql.DB) {
+	scheduler.Register(scheduler.Job{
+		Name:   "analytics-rollup",
+		Spec:   RollupSchedule,
+		Jitter: time.Minute,
+		Run:    func() { rollupClicks(db) },
+	})
+}
+
+// rollupClicks recounts the last three complete hours, so a missed run or a
+// late insert is corrected by the next one.
+func rollupClicks(db *sql.DB) {
+	res, err := db.Exec(`
+		INSERT INTO click_stats_hourly (hour, restaurant_id, source, clicks)
+		SELECT date_trunc('hour', created_at), restaurant_id, COALESCE(source, ''), COUNT(*)
+		FROM outbound_clicks
+		WHERE restaurant_id IS NOT NULL
+		  AND created_at >= date_trunc('hour', now()) - interval '3 hours'
+		  AND created_at < date_trunc('hour', now())
+		GROUP BY 1, 2, 3
+		ON CONFLICT (hour, restaurant_id, source) DO UPDATE SET clicks = EXCLUDED.clicks`)
+	if err != nil {
+		log.Println("Analytics rollup error:", err)
+		tracker.Capture(err, map[string]string{"worker": "analytics-rollup"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Rolled up %d hourly click counts", n)
+	}
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+)
+
+const (
+	// MinBatchSize and MinWorkerPoolSize are the floor the geocoding worker
+	// backs off to while the API is rate limiting it; BatchSize and
+	// WorkerPoolSize are the ceiling it grows back to.
+	MinBatchSize      = 10
+	MinWorkerPoolSize = 2
+)
+
+// errThrottled marks an OVER_QUERY_LIMIT status or HTTP 429 from the API.
+var errThrottled = errors.New("rate limited by geocoding API")
+
+// ThrottleState reports the geocoding worker's current adaptive limits.
+type ThrottleState struct {
+	BatchSize       int        `json:"batch_size"`
+	Concurrency     int        `json:"concurrency"`
+	Throttled       bool       `json:"throttled"`
+	ThrottleEvents  int64      `json:"throttle_events"`
+	LastThrottledAt *time.Time `json:"last_throttled_at"`
+}
+
+// throttle sizes geocoding runs multiplicatively down when the API pushes
+// back and additively up after each clean run.
+type throttle struct {
+	mu          sync.Mutex
+	batch       int
+	concurrency int
+	// hitThisRun stops further requests in the current run once the API
+	// has rate limited one of them.
+	hitThisRun bool
+	events     int64
+	lastHit    time.Time
+}
+
+var geoThrottle = &throttle{batch: BatchSize, concurrency: WorkerPoolSize}
+
+func init() {
+	expvar.Publish("geocoding_throttle", expvar.Func(func() interface{} { return GetThrottleState() }))
+}
+
+// GetThrottleState returns the geocoding worker's current batch size and
+// concurrency and whether it is backing off.
+func GetThrottleState() ThrottleState {
+	t := geoThrottle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := ThrottleState{
+		BatchSize:      t.batch,
+		Concurrency:    t.concurrency,
+		Throttled:      t.batch < BatchSize || t.concurrency < WorkerPoolSize,
+		ThrottleEvents: t.events,
+	}
+	if !t.lastHit.IsZero() {
+		last := t.lastHit
+		s.LastThrottledAt = &last
+	}
+	return s
+}
+
+// begin starts a run and returns the limits it should use.
+func (t *throttle) begin() (batch, concurrency int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hitThisRun = false
+	return t.batch, t.concurrency
+}
+
+// hit records a rate-limited response. Limits are halved at most once per run
+// so a burst of concurrent rejections does not collapse them to the floor.
+func (t *throttle) hit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events++
+	t.lastHit = time.Now()
+	if t.hitThisRun {
+		return
+	}
+	t.hitThisRun = true
+	t.batch = max(t.batch/2, MinBatchSize)
+	t.concurrency = max(t.concurrency/2, MinWorkerPoolSize)
+}
+
+// paused reports whether the current run has been rate limited.
+func (t *throttle) paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hitThisRun
+}
+
+// end finishes a run, growing the limits back by a tenth of their ceiling if
+// the run completed without being rate limited.
+func (t *throttle) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hitThisRun {
+		return
+	}
+	t.batch = min(t.batch+BatchSize/10, BatchSize)
+	t.concurrency = min(t.concurrency+WorkerPoolSize/10, WorkerPoolSize)
+}
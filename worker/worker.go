@@ -3,127 +3,207 @@ package worker
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"eazyfind/geo"
+	"eazyfind/outbound"
+	"eazyfind/scheduler"
+	"eazyfind/tracker"
 )
 
 const (
-	BatchSize        = 200
-	WorkerPoolSize   = 50
-	IntervalDuration = 2 * time.Second
+	BatchSize      = 200
+	WorkerPoolSize = 50
+	// GeocodingSchedule is the default cron schedule for the geocoding
+	// worker; override with SCHEDULE_GEOCODING.
+	GeocodingSchedule = "* * * * *"
 )
 
-// StartGeocodingWorker kicks off a background routine to resolve pending
-// geolocation coordinates for restaurants and cities using the Google Maps API.
-func StartGeocodingWorker(db *sql.DB) {
-	log.Printf("Starting optimized Geocoding Worker (Batch: %d, Concurrency: %d, Interval: %v)", BatchSize, WorkerPoolSize, IntervalDuration)
-	ticker := time.NewTicker(IntervalDuration)
-	go func() {
-		for range ticker.C {
-			processPendingCities(db)
-			processPendingRestaurants(db)
-		}
-	}()
+// Health summarizes worker liveness and throughput since process start.
+type Health struct {
+	Running   bool       `json:"running"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	Resolved  int64      `json:"resolved"`
+	Failed    int64      `json:"failed"`
 }
 
-// processPendingRestaurants retrieves a batch of restaurants with 'PENDING'
-// geo_status and attempts to resolve their coordinates.
-func processPendingRestaurants(db *sql.DB) {
-	query := fmt.Sprintf("SELECT id, restaurant_name, city FROM restaurants WHERE geo_status = 'PENDING' LIMIT %d", BatchSize)
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Println("Worker query error:", err)
-		return
+// googleClient makes the worker's Google Maps Platform API calls.
+var googleClient = outbound.New(10*time.Second, 2)
+
+var (
+	lastRun       atomic.Int64
+	resolvedCount atomic.Int64
+	failedCount   atomic.Int64
+)
+
+// GetHealth reports the worker as running while it is mid-run or its next
+// scheduled run is not overdue.
+func GetHealth() Health {
+	h := Health{Resolved: resolvedCount.Load(), Failed: failedCount.Load()}
+	if ts := lastRun.Load(); ts > 0 {
+		t := time.Unix(0, ts)
+		h.LastRunAt = &t
 	}
-	defer rows.Close()
+	if s, ok := scheduler.State("geocoding"); ok && s.NextRunAt != nil {
+		h.Running = s.Running || time.Since(*s.NextRunAt) < time.Minute
+	}
+	return h
+}
 
+// StartGeocodingWorker schedules a background job to resolve pending
+// geolocation coordinates for restaurants and cities using the Google Maps API.
+func StartGeocodingWorker(db *sql.DB) {
+	log.Printf("Registering Geocoding Worker (Batch: up to %d, Concurrency: up to %d)", BatchSize, WorkerPoolSize)
+	scheduler.Register(scheduler.Job{
+		Name:   "geocoding",
+		Spec:   GeocodingSchedule,
+		Jitter: 5 * time.Second,
+		Run: func() {
+			lastRun.Store(time.Now().UnixNano())
+			reapStaleClaims(db)
+			batch, concurrency := geoThrottle.begin()
+			processPendingCities(db, batch, concurrency)
+			processPendingRestaurants(db, batch, concurrency)
+			geoThrottle.end()
+		},
+	})
+}
+
+// processPendingRestaurants claims a batch of restaurants with 'PENDING'
+// geo_status and attempts to resolve their coordinates. Rows the geocoder
+// cannot find are marked FAILED; rows that fail transiently, or that are
+// skipped once the API rate limits a request, are released back to PENDING
+// for a later run.
+func processPendingRestaurants(db *sql.DB, batchSize, concurrency int) {
 	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
-	if apiKey == "" {
+	if apiKey == "" && !geo.FakeProviders {
 		log.Println("GOOGLE_MAPS_API_KEY not set, skipping geocoding")
 		return
 	}
 
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, WorkerPoolSize)
+	// Only addresses from imports or admins are used as geocoding input; one
+	// the geocoder filled in itself may be the wrong branch being re-checked.
+	claims, err := claimPending(db, "restaurants", `id, restaurant_name, city, COALESCE(area, ''),
+		CASE WHEN field_sources->>'address_line' IS DISTINCT FROM 'geocoder' THEN COALESCE(address_line, '') ELSE '' END`, batchSize)
+	if err != nil {
+		log.Println("Worker query error:", err)
+		tracker.Capture(err, map[string]string{"worker": "geocoding", "table": "restaurants"})
+	}
 
-	for rows.Next() {
-		var id int64
-		var name, city string
-		if err := rows.Scan(&id, &name, &city); err != nil {
-			continue
-		}
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
 
+	for _, c := range claims {
 		wg.Add(1)
 		semaphore <- struct{}{}
 
-		go func(id int64, name, city string) {
+		go func(id int64, name, city, area, address string) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
+			if geoThrottle.paused() {
+				releaseClaim(db, "restaurants", id)
+				return
+			}
 
-			lat, lon, err := fetchCoordinates(name, city, apiKey)
+			geo, err := geocodeRestaurant(name, area, city, address, apiKey)
+			if errors.Is(err, errThrottled) {
+				geoThrottle.hit()
+				failClaim(db, "restaurants", id, err)
+				return
+			}
+			if errors.Is(err, outbound.ErrCircuitOpen) {
+				// The API is failing; retry once the circuit closes.
+				releaseClaim(db, "restaurants", id)
+				return
+			}
 			if err != nil {
 				log.Printf("Geocoding failed for [%d] %s: %v", id, name, err)
+				failedCount.Add(1)
+				failClaim(db, "restaurants", id, err)
 				return
 			}
 
+			// The geocoder's formatted address fills in address_line unless one
+			// was set by an admin or import; an earlier geocoder address (the
+			// row was requeued) is replaced.
 			_, err = db.Exec(`
 				UPDATE restaurants 
 				SET latitude = $1, longitude = $2, 
 				    geo = ST_SetSRID(ST_MakePoint($2, $1), 4326),
-				    geo_status = 'RESOLVED'
-				WHERE id = $3
-			`, lat, lon, id)
+				    geo_status = 'RESOLVED', geo_claimed_at = NULL, geocoded_at = now(), last_geo_error = NULL, last_geo_attempt_at = now(),
+				    geo_location_type = NULLIF($5, ''), geo_partial_match = $6, geo_confidence = $7,
+				    address_line = CASE WHEN $8 THEN $4 ELSE address_line END,
+				    field_sources = CASE WHEN $8 THEN COALESCE(field_sources, '{}'::jsonb) || '{"address_line": "geocoder"}'
+				                         ELSE field_sources END
+				WHERE id = $3 AND geo_status = 'IN_PROGRESS'
+			`, geo.Lat, geo.Lon, id, geo.Address, geo.LocationType, geo.PartialMatch, geo.Confidence(), geo.Address != "" && address == "")
 
 			if err != nil {
 				log.Printf("Failed to update restaurant %d: %v", id, err)
+				tracker.Capture(err, map[string]string{"worker": "geocoding", "table": "restaurants", "id": strconv.FormatInt(id, 10)})
 			} else {
-				log.Printf("Resolved: %s (%v, %v)", name, lat, lon)
+				log.Printf("Resolved: %s (%v, %v, confidence %.2f)", name, geo.Lat, geo.Lon, geo.Confidence())
+				resolvedCount.Add(1)
 			}
-		}(id, name, city)
+		}(c.id, c.name, c.city, c.area, c.address)
 	}
 
 	wg.Wait()
 }
 
-func processPendingCities(db *sql.DB) {
-	query := fmt.Sprintf("SELECT id, city_name FROM cities WHERE geo_status = 'PENDING' LIMIT %d", BatchSize)
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Println("Worker query error (cities):", err)
+func processPendingCities(db *sql.DB, batchSize, concurrency int) {
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	if apiKey == "" && !geo.FakeProviders {
 		return
 	}
-	defer rows.Close()
 
-	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
-	if apiKey == "" {
-		return
+	claims, err := claimPending(db, "cities", "id, city_name, '', '', ''", batchSize)
+	if err != nil {
+		log.Println("Worker query error (cities):", err)
+		tracker.Capture(err, map[string]string{"worker": "geocoding", "table": "cities"})
 	}
 
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, WorkerPoolSize)
-
-	for rows.Next() {
-		var id int64
-		var cityName string
-		if err := rows.Scan(&id, &cityName); err != nil {
-			continue
-		}
+	semaphore := make(chan struct{}, concurrency)
 
+	for _, c := range claims {
 		wg.Add(1)
 		semaphore <- struct{}{}
 
 		go func(id int64, cityName string) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
+			if geoThrottle.paused() {
+				releaseClaim(db, "cities", id)
+				return
+			}
 
-			lat, lon, err := fetchCoordinates(cityName, "", apiKey)
+			geo, err := geocodeCity(cityName, apiKey)
+			if errors.Is(err, errThrottled) {
+				geoThrottle.hit()
+				failClaim(db, "cities", id, err)
+				return
+			}
+			if errors.Is(err, outbound.ErrCircuitOpen) {
+				// The API is failing; retry once the circuit closes.
+				releaseClaim(db, "cities", id)
+				return
+			}
 			if err != nil {
 				log.Printf("Geocoding failed for city [%d] %s: %v", id, cityName, err)
+				failedCount.Add(1)
+				failClaim(db, "cities", id, err)
 				return
 			}
 
@@ -131,31 +211,140 @@ func processPendingCities(db *sql.DB) {
 				UPDATE cities 
 				SET latitude = $1, longitude = $2, 
 				    geo = ST_SetSRID(ST_MakePoint($2, $1), 4326),
-				    geo_status = 'RESOLVED'
-				WHERE id = $3
-			`, lat, lon, id)
+				    geo_status = 'RESOLVED', geo_claimed_at = NULL, geocoded_at = now(), last_geo_error = NULL, last_geo_attempt_at = now()
+				WHERE id = $3 AND geo_status = 'IN_PROGRESS'
+			`, geo.Lat, geo.Lon, id)
 
 			if err != nil {
 				log.Printf("Failed to update city %d: %v", id, err)
+				tracker.Capture(err, map[string]string{"worker": "geocoding", "table": "cities", "id": strconv.FormatInt(id, 10)})
 			} else {
-				log.Printf("Resolved City: %s (%v, %v)", cityName, lat, lon)
+				log.Printf("Resolved City: %s (%v, %v)", cityName, geo.Lat, geo.Lon)
+				resolvedCount.Add(1)
 			}
-		}(id, cityName)
+		}(c.id, c.name)
 	}
 
 	wg.Wait()
 }
 
-func fetchCoordinates(name, city, apiKey string) (float64, float64, error) {
-	query := fmt.Sprintf("%s, %s", name, city)
+// apiStatusError is a geocoding API status other than OK, ZERO_RESULTS and
+// OVER_QUERY_LIMIT, such as REQUEST_DENIED or INVALID_REQUEST.
+type apiStatusError string
+
+func (e apiStatusError) Error() string { return "API error: " + string(e) }
+
+// errNoGeocodeResults means the geocoder found nothing for a query, so the
+// next query in the fallback chain should be tried.
+var errNoGeocodeResults = errors.New("no results found")
+
+// geocodeResult is the best match for a geocoding query.
+type geocodeResult struct {
+	Lat, Lon float64
+	Address  string
+	// LocationType is Google's precision class: ROOFTOP, RANGE_INTERPOLATED,
+	// GEOMETRIC_CENTER or APPROXIMATE.
+	LocationType string
+	PartialMatch bool
+	// Fallback is set when the match came from a vaguer query than the
+	// first one tried.
+	Fallback bool
+}
+
+// locationTypeConfidence scores each location_type from 0 to 1.
+var locationTypeConfidence = map[string]float64{
+	"ROOFTOP":            1.0,
+	"RANGE_INTERPOLATED": 0.8,
+	"GEOMETRIC_CENTER":   0.5,
+	"APPROXIMATE":        0.2,
+}
+
+// Confidence scores how much a pin can be trusted, from 0 to 1: the
+// location_type's score, reduced by 0.2 for a partial match and by 0.1 when
+// a fallback query was needed.
+func (g geocodeResult) Confidence() float64 {
+	c, ok := locationTypeConfidence[g.LocationType]
+	if !ok {
+		c = locationTypeConfidence["APPROXIMATE"]
+	}
+	if g.PartialMatch {
+		c -= 0.2
+	}
+	if g.Fallback {
+		c -= 0.1
+	}
+	return math.Round(max(c, 0.1)*100) / 100
+}
+
+// regionComponent restricts results to GEOCODE_REGION (an ISO country code
+// such as "IN") when it is set.
+func regionComponent() string {
+	if region := os.Getenv("GEOCODE_REGION"); region != "" {
+		return "country:" + region
+	}
+	return ""
+}
+
+// geocodeCity resolves a city's centroid.
+func geocodeCity(name, apiKey string) (geocodeResult, error) {
+	if geo.FakeProviders {
+		lat, lon := geo.FakeCityCentre(name)
+		return geocodeResult{Lat: lat, Lon: lon, LocationType: "APPROXIMATE"}, nil
+	}
+	return fetchCoordinates(name, regionComponent(), apiKey)
+}
+
+// geocodeRestaurant tries progressively vaguer queries until one matches:
+// the street address, then "name, area", then "name, city". Each query is
+// component-filtered to the restaurant's city so a same-named branch
+// elsewhere cannot win.
+func geocodeRestaurant(name, area, city, address, apiKey string) (geocodeResult, error) {
+	if geo.FakeProviders {
+		lat, lon := geo.FakeLocate(name+"|"+area, city)
+		return geocodeResult{Lat: lat, Lon: lon, LocationType: "ROOFTOP"}, nil
+	}
+	components := regionComponent()
+	if city != "" {
+		components = strings.TrimPrefix(components+"|locality:"+city, "|")
+	}
+
+	var queries []string
+	if address != "" {
+		queries = append(queries, address)
+	}
+	if area != "" && !strings.EqualFold(area, city) {
+		queries = append(queries, fmt.Sprintf("%s, %s, %s", name, area, city))
+	}
+	queries = append(queries, fmt.Sprintf("%s, %s", name, city))
+
+	var err error
+	for i, q := range queries {
+		var res geocodeResult
+		res, err = fetchCoordinates(q, components, apiKey)
+		if err == nil || !errors.Is(err, errNoGeocodeResults) {
+			res.Fallback = i > 0
+			return res, err
+		}
+	}
+	return geocodeResult{}, err
+}
+
+// fetchCoordinates geocodes query, optionally restricted by Google's
+// components filter, and returns the best match.
+func fetchCoordinates(query, components, apiKey string) (geocodeResult, error) {
 	apiURL := fmt.Sprintf("https://maps.googleapis.com/maps/api/geocode/json?address=%s&key=%s", url.QueryEscape(query), apiKey)
+	if components != "" {
+		apiURL += "&components=" + url.QueryEscape(components)
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(apiURL)
+	resp, err := googleClient.Get(apiURL)
 	if err != nil {
-		return 0, 0, err
+		return geocodeResult{}, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return geocodeResult{}, errThrottled
+	}
 
 	var result struct {
 		Results []struct {
@@ -164,22 +353,38 @@ func fetchCoordinates(name, city, apiKey string) (float64, float64, error) {
 					Lat float64 `json:"lat"`
 					Lng float64 `json:"lng"`
 				} `json:"location"`
+				LocationType string `json:"location_type"`
 			} `json:"geometry"`
+			FormattedAddress string `json:"formatted_address"`
+			PartialMatch     bool   `json:"partial_match"`
 		} `json:"results"`
 		Status string `json:"status"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, 0, err
+		return geocodeResult{}, err
 	}
 
+	if result.Status == "OVER_QUERY_LIMIT" {
+		return geocodeResult{}, errThrottled
+	}
+	if result.Status == "ZERO_RESULTS" {
+		return geocodeResult{}, errNoGeocodeResults
+	}
 	if result.Status != "OK" {
-		return 0, 0, fmt.Errorf("API error: %s", result.Status)
+		return geocodeResult{}, apiStatusError(result.Status)
 	}
 
 	if len(result.Results) == 0 {
-		return 0, 0, fmt.Errorf("no results found")
+		return geocodeResult{}, errNoGeocodeResults
 	}
 
-	return result.Results[0].Geometry.Location.Lat, result.Results[0].Geometry.Location.Lng, nil
+	best := result.Results[0]
+	return geocodeResult{
+		Lat:          best.Geometry.Location.Lat,
+		Lon:          best.Geometry.Location.Lng,
+		Address:      best.FormattedAddress,
+		LocationType: best.Geometry.LocationType,
+		PartialMatch: best.PartialMatch,
+	}, nil
 }